@@ -43,6 +43,12 @@ type BaseOneAgentSpec struct {
 	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:io.kubernetes:Secret"
 	Tokens string `json:"tokens,omitempty"`
 
+	// Optional: Reads the API and PaaS tokens from a file or an HTTP secret store instead of the secret given by tokens
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Token Source"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	TokenSource *TokenSource `json:"tokenSource,omitempty"`
+
 	// Disable certificate validation checks for installer download and API communication
 	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
 	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Skip Certificate Check"
@@ -111,6 +117,12 @@ type BaseOneAgentStatus struct {
 	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.displayName="Using immutable image"
 	// +operator-sdk:gen-csv:customresourcedefinitions.statusDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced,urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
 	UseImmutableImage bool `json:"useImmutableImage,omitempty"`
+
+	// TokenGeneration is incremented each time new tokens on the secret have been validated and activated
+	TokenGeneration int64 `json:"tokenGeneration,omitempty"`
+
+	// TokenHash identifies the active tokens, to detect when the tokens on the secret get rotated
+	TokenHash string `json:"tokenHash,omitempty"`
 }
 
 type OneAgentProxy struct {
@@ -118,12 +130,77 @@ type OneAgentProxy struct {
 	ValueFrom string `json:"valueFrom,omitempty"`
 }
 
+// TokenSource defines where the API and PaaS tokens are read from. Only one of the sources is to be set
+type TokenSource struct {
+	// Optional: Reads the tokens from files on the Operator pod, e.g., mounted by a CSI secret driver
+	File *FileTokenSource `json:"file,omitempty"`
+
+	// Optional: Reads the tokens from a Vault-compatible HTTP secret store
+	HTTP *HTTPTokenSource `json:"http,omitempty"`
+}
+
+// FileTokenSource defines a directory with the apiToken and paasToken files
+type FileTokenSource struct {
+	// Path of the directory, relative to the tokens directory of the Operator, /var/run/dynatrace/tokens by default
+	// +kubebuilder:validation:Required
+	Path string `json:"path"`
+}
+
+// HTTPTokenSource defines a secret with the apiToken and paasToken fields on an HTTP secret store
+type HTTPTokenSource struct {
+	// URL of the secret, e.g., "https://vault:8200/v1/secret/data/dynatrace"
+	// +kubebuilder:validation:Required
+	URL string `json:"url"`
+
+	// Optional: Secret with the token to authenticate with on the token field, sent on the X-Vault-Token header
+	AuthSecretName string `json:"authSecretName,omitempty"`
+
+	// Optional: ConfigMap with custom RootCAs for the secret store on the certs field
+	TrustedCAs string `json:"trustedCAs,omitempty"`
+}
+
 const (
 	// APITokenConditionType identifies the API Token validity condition
 	APITokenConditionType string = "APIToken"
 
 	// PaaSTokenConditionType identifies the PaaS Token validity condition
 	PaaSTokenConditionType string = "PaaSToken"
+
+	// MaintenanceWindowConditionType identifies whether changes are currently allowed by the maintenance windows
+	MaintenanceWindowConditionType string = "MaintenanceWindow"
+
+	// UpdateFailedConditionType identifies whether the last OneAgent version update failed health checks
+	UpdateFailedConditionType string = "UpdateFailed"
+
+	// AvailableConditionType identifies whether the OneAgent pods are ready on all nodes
+	AvailableConditionType string = "Available"
+
+	// ProgressingConditionType identifies whether the OneAgent pods are being deployed or updated
+	ProgressingConditionType string = "Progressing"
+
+	// DegradedConditionType identifies whether the reconciliation failed, or the OneAgent pods are in a failed state
+	DegradedConditionType string = "Degraded"
+
+	// IstioConfiguredConditionType identifies whether the Istio objects for the Dynatrace environment are set up
+	IstioConfiguredConditionType string = "IstioConfigured"
+
+	// PullSecretReadyConditionType identifies whether the pull secret for the immutable image is up to date
+	PullSecretReadyConditionType string = "PullSecretReady"
+
+	// ImageResolvedConditionType identifies whether the version of the immutable image could be determined
+	ImageResolvedConditionType string = "ImageResolved"
+
+	// UpToDateConditionType identifies whether all OneAgent instances run the desired version
+	UpToDateConditionType string = "UpToDate"
+
+	// TokensActiveConditionType identifies whether the tokens on the secret are in use, and their generation
+	TokensActiveConditionType string = "TokensActive"
+
+	// TokenExpiryConditionType identifies whether the tokens stay valid for longer than the expiry warning period
+	TokenExpiryConditionType string = "TokenExpiry"
+
+	// OptionalScopesConditionType identifies whether the tokens have the optional scopes needed by all features
+	OptionalScopesConditionType string = "OptionalScopes"
 )
 
 // Possible reasons for ApiToken and PaaSToken conditions
@@ -146,3 +223,129 @@ const (
 	// ReasonTokenError is set when an unknown error has been found when verifying the token
 	ReasonTokenError string = "TokenError"
 )
+
+// Possible reasons for TokensActive conditions
+const (
+	// ReasonTokensActivated is set when the tokens on the secret have been validated and are in use
+	ReasonTokensActivated string = "TokensActivated"
+
+	// ReasonTokensRejected is set when rotated tokens failed validation, and the previous ones are still in use
+	ReasonTokensRejected string = "TokensRejected"
+)
+
+// Possible reasons for TokenExpiry conditions
+const (
+	// ReasonTokensNotExpiring is set when no token expires within the expiry warning period
+	ReasonTokensNotExpiring string = "TokensNotExpiring"
+
+	// ReasonTokenExpiring is set when a token expires within the expiry warning period
+	ReasonTokenExpiring string = "TokenExpiring"
+)
+
+// Possible reasons for OptionalScopes conditions
+const (
+	// ReasonOptionalScopesGranted is set when the tokens have all the optional scopes
+	ReasonOptionalScopesGranted string = "OptionalScopesGranted"
+
+	// ReasonOptionalScopesMissing is set when optional scopes are missing on a token, disabling the features needing them
+	ReasonOptionalScopesMissing string = "OptionalScopesMissing"
+)
+
+// Possible reasons for MaintenanceWindow conditions
+const (
+	// ReasonMaintenanceWindowOpen is set when no maintenance windows are configured, or any of them is open
+	ReasonMaintenanceWindowOpen string = "WindowOpen"
+
+	// ReasonMaintenanceWindowClosed is set when pod restarts and DaemonSet updates are deferred until the next window
+	ReasonMaintenanceWindowClosed string = "WindowClosed"
+)
+
+// Possible reasons for UpdateFailed conditions
+const (
+	// ReasonUpdateSucceeded is set when the current version got ready on all nodes
+	ReasonUpdateSucceeded string = "UpdateSucceeded"
+
+	// ReasonRolledBack is set when the version failed health checks and has been reverted to the last known good one
+	ReasonRolledBack string = "RolledBack"
+
+	// ReasonNoKnownGoodVersion is set when the version failed health checks but there is no version to revert to
+	ReasonNoKnownGoodVersion string = "NoKnownGoodVersion"
+)
+
+// Possible reasons for Available conditions
+const (
+	// ReasonPodsReady is set when the OneAgent pods are ready on all nodes
+	ReasonPodsReady string = "PodsReady"
+
+	// ReasonPodsNotReady is set when some OneAgent pods aren't ready
+	ReasonPodsNotReady string = "PodsNotReady"
+
+	// ReasonDaemonSetMissing is set when the DaemonSet of a node group hasn't been created yet
+	ReasonDaemonSetMissing string = "DaemonSetMissing"
+)
+
+// Possible reasons for Progressing conditions
+const (
+	// ReasonDeployed is set when the OneAgent pods on all nodes run the latest DaemonSet template and version
+	ReasonDeployed string = "Deployed"
+
+	// ReasonDaemonSetRollingOut is set when the OneAgent pods are being created or updated to the latest DaemonSet template
+	ReasonDaemonSetRollingOut string = "DaemonSetRollingOut"
+
+	// ReasonVersionRollingOut is set when the OneAgent pods are being restarted to update to a new version
+	ReasonVersionRollingOut string = "VersionRollingOut"
+)
+
+// Possible reasons for Degraded conditions
+const (
+	// ReasonAsExpected is set when no failures have been found
+	ReasonAsExpected string = "AsExpected"
+
+	// ReasonReconcileFailed is set when the last reconciliation failed
+	ReasonReconcileFailed string = "ReconcileFailed"
+
+	// ReasonRolloutHalted is set when the rollout of a version has been halted because of failures
+	ReasonRolloutHalted string = "RolloutHalted"
+)
+
+// Possible reasons for IstioConfigured conditions
+const (
+	// ReasonIstioObjectsReady is set when the Istio objects are up to date
+	ReasonIstioObjectsReady string = "IstioObjectsReady"
+
+	// ReasonIstioFailed is set when the Istio objects couldn't be reconciled
+	ReasonIstioFailed string = "IstioFailed"
+)
+
+// Possible reasons for PullSecretReady conditions
+const (
+	// ReasonPullSecretUpToDate is set when the pull secret has been created or is up to date
+	ReasonPullSecretUpToDate string = "PullSecretUpToDate"
+
+	// ReasonPullSecretFailed is set when the pull secret couldn't be created or updated
+	ReasonPullSecretFailed string = "PullSecretFailed"
+)
+
+// Possible reasons for ImageResolved conditions
+const (
+	// ReasonImageVersionResolved is set when the version of the immutable image has been read from the registry
+	ReasonImageVersionResolved string = "ImageVersionResolved"
+
+	// ReasonImageVersionFailed is set when the version of the immutable image couldn't be read from the registry
+	ReasonImageVersionFailed string = "ImageVersionFailed"
+
+	// ReasonInstallerImage is set when the OneAgent version is downloaded by the pods, instead of using an immutable image
+	ReasonInstallerImage string = "InstallerImage"
+)
+
+// Possible reasons for UpToDate conditions
+const (
+	// ReasonVersionUpToDate is set when all OneAgent instances run the desired version
+	ReasonVersionUpToDate string = "VersionUpToDate"
+
+	// ReasonVersionOutdated is set when some OneAgent instances run a version other than the desired one
+	ReasonVersionOutdated string = "VersionOutdated"
+
+	// ReasonVersionUnknown is set when the desired version or the versions of the instances aren't known yet
+	ReasonVersionUnknown string = "VersionUnknown"
+)
@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // OneAgentSpec defines the desired state of OneAgent
@@ -129,6 +130,183 @@ type OneAgentSpec struct {
 	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Use unprivileged mode"
 	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced,urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
 	UseUnprivilegedMode *bool `json:"useUnprivilegedMode,omitempty"`
+
+	// Optional: Defines how outdated OneAgent pods get restarted when a new version is available
+	// Defaults to restarting all outdated pods one after another
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Rollout strategy"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	RolloutStrategy *OneAgentRolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// Optional: Time windows during which OneAgent pods may be restarted and the DaemonSet updated
+	// Changes are deferred until any of the windows opens. Defaults to applying changes at any time
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Maintenance windows"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// Optional: Defines which OneAgent version gets deployed on updates
+	// Defaults to always updating to the latest version
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Version policy"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	VersionPolicy *OneAgentVersionPolicy `json:"versionPolicy,omitempty"`
+
+	// Optional: Groups of nodes with their own settings, each of them deployed with a separate DaemonSet
+	// Defaults to a single DaemonSet for all nodes matching the node selector
+	// +listType=map
+	// +listMapKey=name
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Node groups"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	NodeGroups []OneAgentNodeGroup `json:"nodeGroups,omitempty"`
+
+	// Optional: Host group for the hosts, replaces passing --set-host-group on the installer arguments
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Host group"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced,urn:alm:descriptor:com.tectonic.ui:text"
+	HostGroup string `json:"hostGroup,omitempty"`
+
+	// Optional: Tags for the hosts, replaces passing --set-host-tag on the installer arguments
+	// Values may be templates on the node the host runs on, e.g., "{{ .Node.Labels.zone }}"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Host tags"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	HostTags map[string]string `json:"hostTags,omitempty"`
+
+	// Optional: Custom properties for the hosts, replaces passing --set-host-property on the installer arguments
+	// Values may be templates on the node the host runs on, e.g., "{{ .Node.Name }}"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Host properties"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	HostProperties map[string]string `json:"hostProperties,omitempty"`
+
+	// Optional: Node labels and annotations to copy into the host properties of each node
+	// Since OneAgent pods share the same template, they're copied by the host-metadata init step when pods start
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Node metadata"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	NodeMetadata *OneAgentNodeMetadata `json:"nodeMetadata,omitempty"`
+
+	// Optional: Sends an event to the hosts on Dynatrace when the OneAgent object gets deleted
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Send deletion event"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced,urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	SendDeletionEvent bool `json:"sendDeletionEvent,omitempty"`
+
+	// Optional: Sends events to the hosts on Dynatrace when OneAgent pods get restarted for an update, the DaemonSet
+	// gets changed, a rollout fails, and when a configuration change took effect on all nodes
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors=true
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.displayName="Send lifecycle events"
+	// +operator-sdk:gen-csv:customresourcedefinitions.specDescriptors.x-descriptors="urn:alm:descriptor:com.tectonic.ui:advanced,urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	SendLifecycleEvents bool `json:"sendLifecycleEvents,omitempty"`
+}
+
+// OneAgentNodeMetadata defines node labels and annotations to copy into host properties
+type OneAgentNodeMetadata struct {
+	// Optional: Node labels mapped to the names of the host properties to copy them into, e.g.,
+	// "topology.kubernetes.io/zone": "Zone". The property name defaults to the label name if empty
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Optional: Node annotations mapped to the names of the host properties to copy them into. The property name
+	// defaults to the annotation name if empty
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OneAgentNodeGroup defines settings for a group of nodes, which override the ones on the OneAgent spec
+type OneAgentNodeGroup struct {
+	// Name of the group, appended to the name of the OneAgent for its DaemonSet
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=20
+	Name string `json:"name"`
+
+	// Optional: Node selector for the nodes of the group, replaces the one on the OneAgent spec. Required if there's
+	// more than one group, and mustn't match the same nodes as the ones of the other groups
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Optional: Tolerations for the OneAgent pods of the group, replace the ones on the OneAgent spec
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Optional: Resource requests and limits for the OneAgent pods of the group, replace the ones on the OneAgent spec
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Optional: Arguments to the OneAgent installer, appended to the ones on the OneAgent spec
+	// +listType=set
+	Args []string `json:"args,omitempty"`
+
+	// Optional: Environment variables for the installer, override the ones on the OneAgent spec with the same name
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Optional: Host group for the hosts of the group, replaces the one on the OneAgent spec
+	HostGroup string `json:"hostGroup,omitempty"`
+}
+
+type VersionPolicyMode string
+
+const (
+	// VersionPolicyLatest always updates to the latest available version
+	VersionPolicyLatest VersionPolicyMode = "Latest"
+	// VersionPolicyPinned deploys the latest version matching the given version, e.g., "1.203" or "1.203.0.20201020-120000"
+	VersionPolicyPinned VersionPolicyMode = "Pinned"
+	// VersionPolicyRange deploys the latest version matching the given range, e.g., "~1.203" or ">=1.200 <1.210"
+	VersionPolicyRange VersionPolicyMode = "Range"
+	// VersionPolicyLatestMinus deploys the latest version of the minor release N releases behind the latest one
+	VersionPolicyLatestMinus VersionPolicyMode = "LatestMinus"
+)
+
+// OneAgentVersionPolicy defines which OneAgent version gets deployed
+type OneAgentVersionPolicy struct {
+	// Mode for choosing the version, either Latest, Pinned, Range or LatestMinus
+	// +kubebuilder:validation:Enum=Latest;Pinned;Range;LatestMinus
+	Mode VersionPolicyMode `json:"mode"`
+
+	// Optional: Version to pin to if mode is Pinned, either a full or a partial version, e.g., "1.203"
+	Version string `json:"version,omitempty"`
+
+	// Optional: Space separated version constraints if mode is Range, e.g., ">=1.200 <1.210"
+	// Supports the shorthands "1.203.x" for any version with the given prefix, "~1.203.2" for patch updates, and
+	// "^1.203" for minor updates
+	Range string `json:"range,omitempty"`
+
+	// Optional: Number of minor releases to stay behind the latest one if mode is LatestMinus - default 0
+	// +kubebuilder:validation:Minimum=0
+	LatestMinus int32 `json:"latestMinus,omitempty"`
+
+	// Optional: Allows the operator to downgrade OneAgents if the chosen version is older than the deployed one
+	// Defaults to keeping the deployed version until the chosen version is newer
+	AllowDowngrade bool `json:"allowDowngrade,omitempty"`
+}
+
+// MaintenanceWindow defines a recurring time window during which disruptive changes are allowed
+type MaintenanceWindow struct {
+	// Cron expression for the start of the window, with the fields minute, hour, day of month, month and day of
+	// week, e.g., "0 2 * * 6" for Saturdays at 02:00
+	Schedule string `json:"schedule"`
+
+	// How long the window stays open after each start, e.g., "2h"
+	Duration metav1.Duration `json:"duration"`
+
+	// Optional: IANA time zone for the schedule, e.g., "Europe/Vienna" - default UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// OneAgentRolloutStrategy defines how OneAgent pods get restarted in batches on version updates
+type OneAgentRolloutStrategy struct {
+	// Optional: Number or percentage of nodes to update first as canary batch
+	// Defaults to no canary batch
+	Canary *intstr.IntOrString `json:"canary,omitempty"`
+
+	// Optional: Number or percentage of nodes to update on each batch after the canary batch
+	// Defaults to all remaining nodes
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+
+	// Optional: Defines the time to wait between two batches - default 0 sec
+	// +kubebuilder:validation:Minimum=0
+	PauseSeconds *uint16 `json:"pauseSeconds,omitempty"`
+
+	// Optional: Halts the rollout when the pods of a batch don't get ready in time - default true
+	// A halted rollout continues once a different version is available
+	HaltOnFailure *bool `json:"haltOnFailure,omitempty"`
 }
 
 type OneAgentPhaseType string
@@ -166,12 +344,127 @@ type OneAgentStatus struct {
 
 	// LastImageVersionProbeTimestamp keeps track of the last time the Operator looked at the image version
 	LastImageVersionProbeTimestamp *metav1.Time `json:"lastImageVersionProbeTimestamp,omitempty"`
+
+	// Rollout keeps track of the progress of the current version rollout
+	Rollout *OneAgentRolloutStatus `json:"rollout,omitempty"`
+
+	// LastKnownGoodVersion is the last OneAgent version which got ready on all nodes
+	LastKnownGoodVersion string `json:"lastKnownGoodVersion,omitempty"`
+
+	// LastKnownGoodImageHash is the hash of the immutable image for LastKnownGoodVersion
+	LastKnownGoodImageHash string `json:"lastKnownGoodImageHash,omitempty"`
+
+	// FailedVersion is the OneAgent version which failed health checks and got rolled back. It won't be deployed again
+	FailedVersion string `json:"failedVersion,omitempty"`
+
+	// NodeGroups contains the state of the DaemonSet for each node group
+	NodeGroups []OneAgentNodeGroupStatus `json:"nodeGroups,omitempty"`
+
+	// PendingConfigChanges contains the DaemonSets changed by the Operator whose pods haven't all been updated yet.
+	// Only kept if lifecycle events are enabled
+	PendingConfigChanges []string `json:"pendingConfigChanges,omitempty"`
+}
+
+// OneAgentNodeGroupStatus defines the observed state of the DaemonSet of a node group
+type OneAgentNodeGroupStatus struct {
+	// Name of the node group
+	Name string `json:"name"`
+
+	// DaemonSet is the name of the DaemonSet deploying the group
+	DaemonSet string `json:"daemonSet,omitempty"`
+
+	// Phase of the group (Running, Deploying)
+	Phase OneAgentPhaseType `json:"phase,omitempty"`
+
+	// DesiredNumberScheduled is the number of nodes which should run the OneAgent pod of the group
+	DesiredNumberScheduled int32 `json:"desiredNumberScheduled,omitempty"`
+
+	// NumberReady is the number of nodes running a ready OneAgent pod of the group
+	NumberReady int32 `json:"numberReady,omitempty"`
+
+	// UpdatedNumberScheduled is the number of nodes running the latest DaemonSet template of the group
+	UpdatedNumberScheduled int32 `json:"updatedNumberScheduled,omitempty"`
+}
+
+type RolloutPhaseType string
+
+const (
+	RolloutCanary      RolloutPhaseType = "Canary"
+	RolloutProgressing RolloutPhaseType = "Progressing"
+	RolloutHalted      RolloutPhaseType = "Halted"
+	RolloutCompleted   RolloutPhaseType = "Completed"
+)
+
+// OneAgentRolloutStatus defines the observed state of a version rollout
+type OneAgentRolloutStatus struct {
+	// TargetVersion is the OneAgent version being rolled out
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Phase of the rollout (Canary, Progressing, Halted, Completed)
+	Phase RolloutPhaseType `json:"phase,omitempty"`
+
+	// Batches is the number of batches which have been completed
+	Batches int32 `json:"batches,omitempty"`
+
+	// UpdatedNodes contains the nodes where the OneAgent pod has been restarted for this rollout
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+
+	// LastBatchTimestamp indicates when the last batch has been completed
+	LastBatchTimestamp *metav1.Time `json:"lastBatchTimestamp,omitempty"`
+
+	// Message gives details on why a rollout has been halted
+	Message string `json:"message,omitempty"`
+
+	// PendingNodes contains the nodes of the current batch which are still to be restarted
+	PendingNodes []string `json:"pendingNodes,omitempty"`
+
+	// Restart keeps track of the OneAgent pod currently being restarted
+	Restart *OneAgentRestartStatus `json:"restart,omitempty"`
+}
+
+// OneAgentRestartStatus keeps track of the restart of a OneAgent pod on a node
+type OneAgentRestartStatus struct {
+	// NodeName is the node where the pod is being restarted
+	NodeName string `json:"nodeName"`
+
+	// PodName is the name of the last pod deleted on the node
+	PodName string `json:"podName,omitempty"`
+
+	// Attempt is the number of times the pod on the node has been deleted
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// Deadline is the time until the new pod is expected to be ready
+	Deadline *metav1.Time `json:"deadline,omitempty"`
 }
 
 type OneAgentInstance struct {
 	PodName   string `json:"podName,omitempty"`
 	Version   string `json:"version,omitempty"`
 	IPAddress string `json:"ipAddress,omitempty"`
+
+	// PodPhase is the phase of the OneAgent pod on the node
+	PodPhase corev1.PodPhase `json:"podPhase,omitempty"`
+
+	// Ready is set if the OneAgent pod on the node is ready
+	Ready bool `json:"ready,omitempty"`
+
+	// RestartCount is the number of times the OneAgent container on the node has been restarted
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// LastRestartReason is the reason why the OneAgent container last terminated, e.g., OOMKilled or Error
+	LastRestartReason string `json:"lastRestartReason,omitempty"`
+
+	// EntityID is the ID of the host in Dynatrace, not set if Dynatrace doesn't see the host
+	EntityID string `json:"entityID,omitempty"`
+
+	// LastSeenTimestamp is when Dynatrace last saw the host
+	LastSeenTimestamp *metav1.Time `json:"lastSeenTimestamp,omitempty"`
+
+	// NetworkZone is the network zone of the OneAgent on the host
+	NetworkZone string `json:"networkZone,omitempty"`
+
+	// Outdated is set if the OneAgent on the host doesn't run the desired version
+	Outdated bool `json:"outdated,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -180,6 +473,7 @@ type OneAgentInstance struct {
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=oneagents,scope=Namespaced,categories=dynatrace
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="ApiUrl",type=string,JSONPath=`.spec.apiUrl`
 // +kubebuilder:printcolumn:name="Tokens",type=string,JSONPath=`.status.tokens`
 // +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
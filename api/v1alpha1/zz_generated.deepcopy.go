@@ -24,11 +24,17 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BaseOneAgentSpec) DeepCopyInto(out *BaseOneAgentSpec) {
 	*out = *in
+	if in.TokenSource != nil {
+		in, out := &in.TokenSource, &out.TokenSource
+		*out = new(TokenSource)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Proxy != nil {
 		in, out := &in.Proxy, &out.Proxy
 		*out = new(OneAgentProxy)
@@ -77,6 +83,52 @@ func (in *BaseOneAgentStatus) DeepCopy() *BaseOneAgentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileTokenSource) DeepCopyInto(out *FileTokenSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileTokenSource.
+func (in *FileTokenSource) DeepCopy() *FileTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(FileTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPTokenSource) DeepCopyInto(out *HTTPTokenSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPTokenSource.
+func (in *HTTPTokenSource) DeepCopy() *HTTPTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OneAgent) DeepCopyInto(out *OneAgent) {
 	*out = *in
@@ -199,6 +251,10 @@ func (in *OneAgentAPMStatus) DeepCopy() *OneAgentAPMStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OneAgentInstance) DeepCopyInto(out *OneAgentInstance) {
 	*out = *in
+	if in.LastSeenTimestamp != nil {
+		in, out := &in.LastSeenTimestamp, &out.LastSeenTimestamp
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentInstance.
@@ -243,6 +299,96 @@ func (in *OneAgentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeGroup) DeepCopyInto(out *OneAgentNodeGroup) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeGroup.
+func (in *OneAgentNodeGroup) DeepCopy() *OneAgentNodeGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeGroupStatus) DeepCopyInto(out *OneAgentNodeGroupStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeGroupStatus.
+func (in *OneAgentNodeGroupStatus) DeepCopy() *OneAgentNodeGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeMetadata) DeepCopyInto(out *OneAgentNodeMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeMetadata.
+func (in *OneAgentNodeMetadata) DeepCopy() *OneAgentNodeMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OneAgentProxy) DeepCopyInto(out *OneAgentProxy) {
 	*out = *in
@@ -258,6 +404,94 @@ func (in *OneAgentProxy) DeepCopy() *OneAgentProxy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRestartStatus) DeepCopyInto(out *OneAgentRestartStatus) {
+	*out = *in
+	if in.Deadline != nil {
+		in, out := &in.Deadline, &out.Deadline
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRestartStatus.
+func (in *OneAgentRestartStatus) DeepCopy() *OneAgentRestartStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRestartStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRolloutStatus) DeepCopyInto(out *OneAgentRolloutStatus) {
+	*out = *in
+	if in.UpdatedNodes != nil {
+		in, out := &in.UpdatedNodes, &out.UpdatedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastBatchTimestamp != nil {
+		in, out := &in.LastBatchTimestamp, &out.LastBatchTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingNodes != nil {
+		in, out := &in.PendingNodes, &out.PendingNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Restart != nil {
+		in, out := &in.Restart, &out.Restart
+		*out = new(OneAgentRestartStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRolloutStatus.
+func (in *OneAgentRolloutStatus) DeepCopy() *OneAgentRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRolloutStrategy) DeepCopyInto(out *OneAgentRolloutStrategy) {
+	*out = *in
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.BatchSize != nil {
+		in, out := &in.BatchSize, &out.BatchSize
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.PauseSeconds != nil {
+		in, out := &in.PauseSeconds, &out.PauseSeconds
+		*out = new(uint16)
+		**out = **in
+	}
+	if in.HaltOnFailure != nil {
+		in, out := &in.HaltOnFailure, &out.HaltOnFailure
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRolloutStrategy.
+func (in *OneAgentRolloutStrategy) DeepCopy() *OneAgentRolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OneAgentSpec) DeepCopyInto(out *OneAgentSpec) {
 	*out = *in
@@ -306,6 +540,47 @@ func (in *OneAgentSpec) DeepCopyInto(out *OneAgentSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(OneAgentRolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.VersionPolicy != nil {
+		in, out := &in.VersionPolicy, &out.VersionPolicy
+		*out = new(OneAgentVersionPolicy)
+		**out = **in
+	}
+	if in.NodeGroups != nil {
+		in, out := &in.NodeGroups, &out.NodeGroups
+		*out = make([]OneAgentNodeGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HostTags != nil {
+		in, out := &in.HostTags, &out.HostTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HostProperties != nil {
+		in, out := &in.HostProperties, &out.HostProperties
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeMetadata != nil {
+		in, out := &in.NodeMetadata, &out.NodeMetadata
+		*out = new(OneAgentNodeMetadata)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentSpec.
@@ -326,7 +601,7 @@ func (in *OneAgentStatus) DeepCopyInto(out *OneAgentStatus) {
 		in, out := &in.Instances, &out.Instances
 		*out = make(map[string]OneAgentInstance, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 	if in.LastUpdateProbeTimestamp != nil {
@@ -337,6 +612,21 @@ func (in *OneAgentStatus) DeepCopyInto(out *OneAgentStatus) {
 		in, out := &in.LastImageVersionProbeTimestamp, &out.LastImageVersionProbeTimestamp
 		*out = (*in).DeepCopy()
 	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(OneAgentRolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeGroups != nil {
+		in, out := &in.NodeGroups, &out.NodeGroups
+		*out = make([]OneAgentNodeGroupStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingConfigChanges != nil {
+		in, out := &in.PendingConfigChanges, &out.PendingConfigChanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentStatus.
@@ -348,3 +638,43 @@ func (in *OneAgentStatus) DeepCopy() *OneAgentStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentVersionPolicy) DeepCopyInto(out *OneAgentVersionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentVersionPolicy.
+func (in *OneAgentVersionPolicy) DeepCopy() *OneAgentVersionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentVersionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenSource) DeepCopyInto(out *TokenSource) {
+	*out = *in
+	if in.File != nil {
+		in, out := &in.File, &out.File
+		*out = new(FileTokenSource)
+		**out = **in
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPTokenSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSource.
+func (in *TokenSource) DeepCopy() *TokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,442 @@
+/*
+Copyright 2020 Dynatrace LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+
+	"github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// hubStatusAnnotation keeps the status fields of v1alpha1 objects which don't exist on v1beta1, so that these are
+// restored when converting back. Otherwise writes through v1beta1 would reset them on the stored v1alpha1 object until
+// the next reconciliation, while the webhook server and the rollbacks rely on status.useImmutableImage.
+//
+// This is a temporary measure while v1alpha1 is the storage version. The annotation goes away with these fields, once
+// the storage version moves to v1beta1.
+const hubStatusAnnotation = "internal.oneagent.dynatrace.com/v1alpha1-status"
+
+// hubStatus holds the status fields of v1alpha1 objects which don't exist on v1beta1.
+type hubStatus struct {
+	Tokens            string `json:"tokens,omitempty"`
+	UseImmutableImage bool   `json:"useImmutableImage,omitempty"`
+}
+
+// ConvertTo converts this OneAgent to the Hub version (v1alpha1).
+func (src *OneAgent) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.OneAgent)
+
+	dst.ObjectMeta = src.ObjectMeta
+	hs, err := popHubStatus(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
+	convertBaseSpecTo(&src.Spec.BaseOneAgentSpec, &dst.Spec.BaseOneAgentSpec)
+	dst.Spec.NodeSelector = src.Spec.NodeSelector
+	dst.Spec.Tolerations = src.Spec.Tolerations
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.WebhookInjection = src.Spec.WebhookInjection
+	dst.Spec.Args = src.Spec.Args
+	dst.Spec.Env = src.Spec.Env
+	dst.Spec.PriorityClassName = src.Spec.PriorityClassName
+	dst.Spec.DNSPolicy = src.Spec.DNSPolicy
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.Labels = src.Spec.Labels
+	dst.Spec.UseUnprivilegedMode = src.Spec.UseUnprivilegedMode
+	dst.Spec.HostGroup = src.Spec.HostGroup
+	dst.Spec.HostTags = src.Spec.HostTags
+	dst.Spec.HostProperties = src.Spec.HostProperties
+	dst.Spec.NodeMetadata = (*v1alpha1.OneAgentNodeMetadata)(src.Spec.NodeMetadata)
+	dst.Spec.SendDeletionEvent = src.Spec.SendDeletionEvent
+	dst.Spec.SendLifecycleEvents = src.Spec.SendLifecycleEvents
+
+	if img := src.Spec.Image; img != nil {
+		dst.Spec.UseImmutableImage = img.Immutable
+		dst.Spec.Image = img.Name
+		dst.Spec.CustomPullSecret = img.PullSecret
+	}
+
+	if up := src.Spec.UpdatePolicy; up != nil {
+		dst.Spec.DisableAgentUpdate = up.Disabled
+		dst.Spec.AgentVersion = up.Version
+		dst.Spec.RolloutStrategy = (*v1alpha1.OneAgentRolloutStrategy)(up.RolloutStrategy)
+		dst.Spec.WaitReadySeconds = up.WaitReadySeconds
+
+		if vp := up.VersionPolicy; vp != nil {
+			dst.Spec.VersionPolicy = &v1alpha1.OneAgentVersionPolicy{
+				Mode:           v1alpha1.VersionPolicyMode(vp.Mode),
+				Version:        vp.Version,
+				Range:          vp.Range,
+				LatestMinus:    vp.LatestMinus,
+				AllowDowngrade: vp.AllowDowngrade,
+			}
+		}
+
+		for _, mw := range up.MaintenanceWindows {
+			dst.Spec.MaintenanceWindows = append(dst.Spec.MaintenanceWindows, v1alpha1.MaintenanceWindow(mw))
+		}
+	}
+
+	for _, g := range src.Spec.NodeGroups {
+		dst.Spec.NodeGroups = append(dst.Spec.NodeGroups, v1alpha1.OneAgentNodeGroup(g))
+	}
+
+	dst.Status.BaseOneAgentStatus = v1alpha1.BaseOneAgentStatus{
+		UpdatedTimestamp:            src.Status.UpdatedTimestamp,
+		Conditions:                  src.Status.Conditions,
+		LastAPITokenProbeTimestamp:  src.Status.LastAPITokenProbeTimestamp,
+		LastPaaSTokenProbeTimestamp: src.Status.LastPaaSTokenProbeTimestamp,
+		EnvironmentID:               src.Status.EnvironmentID,
+		TokenGeneration:             src.Status.TokenGeneration,
+		TokenHash:                   src.Status.TokenHash,
+		Tokens:                      hs.Tokens,
+		UseImmutableImage:           hs.UseImmutableImage,
+	}
+	dst.Status.Version = src.Status.Version
+	dst.Status.Phase = v1alpha1.OneAgentPhaseType(src.Status.Phase)
+	dst.Status.LastUpdateProbeTimestamp = src.Status.LastUpdateProbeTimestamp
+	dst.Status.ImageHash = src.Status.ImageHash
+	dst.Status.ImageVersion = src.Status.ImageVersion
+	dst.Status.LastImageVersionProbeTimestamp = src.Status.LastImageVersionProbeTimestamp
+	dst.Status.LastKnownGoodVersion = src.Status.LastKnownGoodVersion
+	dst.Status.LastKnownGoodImageHash = src.Status.LastKnownGoodImageHash
+	dst.Status.FailedVersion = src.Status.FailedVersion
+	dst.Status.PendingConfigChanges = src.Status.PendingConfigChanges
+
+	if src.Status.Instances != nil {
+		dst.Status.Instances = make(map[string]v1alpha1.OneAgentInstance, len(src.Status.Instances))
+		for node, inst := range src.Status.Instances {
+			dst.Status.Instances[node] = v1alpha1.OneAgentInstance(inst)
+		}
+	}
+
+	if r := src.Status.Rollout; r != nil {
+		dst.Status.Rollout = &v1alpha1.OneAgentRolloutStatus{
+			TargetVersion:      r.TargetVersion,
+			Phase:              v1alpha1.RolloutPhaseType(r.Phase),
+			Batches:            r.Batches,
+			UpdatedNodes:       r.UpdatedNodes,
+			LastBatchTimestamp: r.LastBatchTimestamp,
+			Message:            r.Message,
+			PendingNodes:       r.PendingNodes,
+			Restart:            (*v1alpha1.OneAgentRestartStatus)(r.Restart),
+		}
+	}
+
+	for _, g := range src.Status.NodeGroups {
+		dst.Status.NodeGroups = append(dst.Status.NodeGroups, v1alpha1.OneAgentNodeGroupStatus{
+			Name:                   g.Name,
+			DaemonSet:              g.DaemonSet,
+			Phase:                  v1alpha1.OneAgentPhaseType(g.Phase),
+			DesiredNumberScheduled: g.DesiredNumberScheduled,
+			NumberReady:            g.NumberReady,
+			UpdatedNumberScheduled: g.UpdatedNumberScheduled,
+		})
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *OneAgent) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.OneAgent)
+
+	dst.ObjectMeta = src.ObjectMeta
+	if err := pushHubStatus(&dst.ObjectMeta, &src.Status.BaseOneAgentStatus); err != nil {
+		return err
+	}
+
+	convertBaseSpecFrom(&src.Spec.BaseOneAgentSpec, &dst.Spec.BaseOneAgentSpec)
+	dst.Spec.NodeSelector = src.Spec.NodeSelector
+	dst.Spec.Tolerations = src.Spec.Tolerations
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.WebhookInjection = src.Spec.WebhookInjection
+	dst.Spec.Args = src.Spec.Args
+	dst.Spec.Env = src.Spec.Env
+	dst.Spec.PriorityClassName = src.Spec.PriorityClassName
+	dst.Spec.DNSPolicy = src.Spec.DNSPolicy
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.Labels = src.Spec.Labels
+	dst.Spec.UseUnprivilegedMode = src.Spec.UseUnprivilegedMode
+	dst.Spec.HostGroup = src.Spec.HostGroup
+	dst.Spec.HostTags = src.Spec.HostTags
+	dst.Spec.HostProperties = src.Spec.HostProperties
+	dst.Spec.NodeMetadata = (*OneAgentNodeMetadata)(src.Spec.NodeMetadata)
+	dst.Spec.SendDeletionEvent = src.Spec.SendDeletionEvent
+	dst.Spec.SendLifecycleEvents = src.Spec.SendLifecycleEvents
+
+	if src.Spec.UseImmutableImage || src.Spec.Image != "" || src.Spec.CustomPullSecret != "" {
+		dst.Spec.Image = &OneAgentImage{
+			Immutable:  src.Spec.UseImmutableImage,
+			Name:       src.Spec.Image,
+			PullSecret: src.Spec.CustomPullSecret,
+		}
+	}
+
+	if src.Spec.DisableAgentUpdate || src.Spec.AgentVersion != "" || src.Spec.VersionPolicy != nil ||
+		src.Spec.RolloutStrategy != nil || src.Spec.MaintenanceWindows != nil || src.Spec.WaitReadySeconds != nil {
+		up := &OneAgentUpdatePolicy{
+			Disabled:         src.Spec.DisableAgentUpdate,
+			Version:          src.Spec.AgentVersion,
+			RolloutStrategy:  (*OneAgentRolloutStrategy)(src.Spec.RolloutStrategy),
+			WaitReadySeconds: src.Spec.WaitReadySeconds,
+		}
+
+		if vp := src.Spec.VersionPolicy; vp != nil {
+			up.VersionPolicy = &OneAgentVersionPolicy{
+				Mode:           VersionPolicyMode(vp.Mode),
+				Version:        vp.Version,
+				Range:          vp.Range,
+				LatestMinus:    vp.LatestMinus,
+				AllowDowngrade: vp.AllowDowngrade,
+			}
+		}
+
+		for _, mw := range src.Spec.MaintenanceWindows {
+			up.MaintenanceWindows = append(up.MaintenanceWindows, MaintenanceWindow(mw))
+		}
+
+		dst.Spec.UpdatePolicy = up
+	}
+
+	for _, g := range src.Spec.NodeGroups {
+		dst.Spec.NodeGroups = append(dst.Spec.NodeGroups, OneAgentNodeGroup(g))
+	}
+
+	dst.Status.BaseOneAgentStatus = BaseOneAgentStatus{
+		UpdatedTimestamp:            src.Status.UpdatedTimestamp,
+		Conditions:                  src.Status.Conditions,
+		LastAPITokenProbeTimestamp:  src.Status.LastAPITokenProbeTimestamp,
+		LastPaaSTokenProbeTimestamp: src.Status.LastPaaSTokenProbeTimestamp,
+		EnvironmentID:               src.Status.EnvironmentID,
+		TokenGeneration:             src.Status.TokenGeneration,
+		TokenHash:                   src.Status.TokenHash,
+	}
+	dst.Status.Version = src.Status.Version
+	dst.Status.Phase = OneAgentPhaseType(src.Status.Phase)
+	dst.Status.LastUpdateProbeTimestamp = src.Status.LastUpdateProbeTimestamp
+	dst.Status.ImageHash = src.Status.ImageHash
+	dst.Status.ImageVersion = src.Status.ImageVersion
+	dst.Status.LastImageVersionProbeTimestamp = src.Status.LastImageVersionProbeTimestamp
+	dst.Status.LastKnownGoodVersion = src.Status.LastKnownGoodVersion
+	dst.Status.LastKnownGoodImageHash = src.Status.LastKnownGoodImageHash
+	dst.Status.FailedVersion = src.Status.FailedVersion
+	dst.Status.PendingConfigChanges = src.Status.PendingConfigChanges
+
+	if src.Status.Instances != nil {
+		dst.Status.Instances = make(map[string]OneAgentInstance, len(src.Status.Instances))
+		for node, inst := range src.Status.Instances {
+			dst.Status.Instances[node] = OneAgentInstance(inst)
+		}
+	}
+
+	if r := src.Status.Rollout; r != nil {
+		dst.Status.Rollout = &OneAgentRolloutStatus{
+			TargetVersion:      r.TargetVersion,
+			Phase:              RolloutPhaseType(r.Phase),
+			Batches:            r.Batches,
+			UpdatedNodes:       r.UpdatedNodes,
+			LastBatchTimestamp: r.LastBatchTimestamp,
+			Message:            r.Message,
+			PendingNodes:       r.PendingNodes,
+			Restart:            (*OneAgentRestartStatus)(r.Restart),
+		}
+	}
+
+	for _, g := range src.Status.NodeGroups {
+		dst.Status.NodeGroups = append(dst.Status.NodeGroups, OneAgentNodeGroupStatus{
+			Name:                   g.Name,
+			DaemonSet:              g.DaemonSet,
+			Phase:                  OneAgentPhaseType(g.Phase),
+			DesiredNumberScheduled: g.DesiredNumberScheduled,
+			NumberReady:            g.NumberReady,
+			UpdatedNumberScheduled: g.UpdatedNumberScheduled,
+		})
+	}
+
+	return nil
+}
+
+// ConvertTo converts this OneAgentAPM to the Hub version (v1alpha1).
+func (src *OneAgentAPM) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.OneAgentAPM)
+
+	dst.ObjectMeta = src.ObjectMeta
+	hs, err := popHubStatus(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
+	convertBaseSpecTo(&src.Spec.BaseOneAgentSpec, &dst.Spec.BaseOneAgentSpec)
+	dst.Spec.AgentVersion = src.Spec.AgentVersion
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.Flavor = src.Spec.Flavor
+
+	if img := src.Spec.Image; img != nil {
+		dst.Spec.UseImmutableImage = img.Immutable
+		dst.Spec.Image = img.Name
+	}
+
+	dst.Status.BaseOneAgentStatus = v1alpha1.BaseOneAgentStatus{
+		UpdatedTimestamp:            src.Status.UpdatedTimestamp,
+		Conditions:                  src.Status.Conditions,
+		LastAPITokenProbeTimestamp:  src.Status.LastAPITokenProbeTimestamp,
+		LastPaaSTokenProbeTimestamp: src.Status.LastPaaSTokenProbeTimestamp,
+		EnvironmentID:               src.Status.EnvironmentID,
+		TokenGeneration:             src.Status.TokenGeneration,
+		TokenHash:                   src.Status.TokenHash,
+		Tokens:                      hs.Tokens,
+		UseImmutableImage:           hs.UseImmutableImage,
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *OneAgentAPM) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.OneAgentAPM)
+
+	dst.ObjectMeta = src.ObjectMeta
+	if err := pushHubStatus(&dst.ObjectMeta, &src.Status.BaseOneAgentStatus); err != nil {
+		return err
+	}
+
+	convertBaseSpecFrom(&src.Spec.BaseOneAgentSpec, &dst.Spec.BaseOneAgentSpec)
+	dst.Spec.AgentVersion = src.Spec.AgentVersion
+	dst.Spec.Resources = src.Spec.Resources
+	dst.Spec.Flavor = src.Spec.Flavor
+
+	if src.Spec.UseImmutableImage || src.Spec.Image != "" {
+		dst.Spec.Image = &OneAgentAPMImage{Immutable: src.Spec.UseImmutableImage, Name: src.Spec.Image}
+	}
+
+	dst.Status.BaseOneAgentStatus = BaseOneAgentStatus{
+		UpdatedTimestamp:            src.Status.UpdatedTimestamp,
+		Conditions:                  src.Status.Conditions,
+		LastAPITokenProbeTimestamp:  src.Status.LastAPITokenProbeTimestamp,
+		LastPaaSTokenProbeTimestamp: src.Status.LastPaaSTokenProbeTimestamp,
+		EnvironmentID:               src.Status.EnvironmentID,
+		TokenGeneration:             src.Status.TokenGeneration,
+		TokenHash:                   src.Status.TokenHash,
+	}
+
+	return nil
+}
+
+func convertBaseSpecTo(src *BaseOneAgentSpec, dst *v1alpha1.BaseOneAgentSpec) {
+	dst.APIURL = src.APIURL
+	dst.SkipCertCheck = src.SkipCertCheck
+	dst.EnableIstio = src.EnableIstio
+	dst.TrustedCAs = src.TrustedCAs
+	dst.NetworkZone = src.NetworkZone
+
+	if src.Tokens != nil {
+		dst.Tokens = src.Tokens.SecretName
+
+		if src.Tokens.File != nil || src.Tokens.HTTP != nil {
+			dst.TokenSource = &v1alpha1.TokenSource{}
+		}
+		if f := src.Tokens.File; f != nil {
+			dst.TokenSource.File = &v1alpha1.FileTokenSource{Path: f.Path}
+		}
+		if h := src.Tokens.HTTP; h != nil {
+			dst.TokenSource.HTTP = &v1alpha1.HTTPTokenSource{URL: h.URL, AuthSecretName: h.AuthSecretName, TrustedCAs: h.TrustedCAs}
+		}
+	}
+
+	if src.Proxy != nil {
+		dst.Proxy = &v1alpha1.OneAgentProxy{Value: src.Proxy.URL, ValueFrom: src.Proxy.SecretName}
+	}
+}
+
+func convertBaseSpecFrom(src *v1alpha1.BaseOneAgentSpec, dst *BaseOneAgentSpec) {
+	dst.APIURL = src.APIURL
+	dst.SkipCertCheck = src.SkipCertCheck
+	dst.EnableIstio = src.EnableIstio
+	dst.TrustedCAs = src.TrustedCAs
+	dst.NetworkZone = src.NetworkZone
+
+	if src.Tokens != "" || src.TokenSource != nil {
+		dst.Tokens = &OneAgentTokens{SecretName: src.Tokens}
+	}
+
+	if ts := src.TokenSource; ts != nil {
+		if ts.File != nil {
+			dst.Tokens.File = &FileTokenSource{Path: ts.File.Path}
+		}
+		if ts.HTTP != nil {
+			dst.Tokens.HTTP = &HTTPTokenSource{URL: ts.HTTP.URL, AuthSecretName: ts.HTTP.AuthSecretName, TrustedCAs: ts.HTTP.TrustedCAs}
+		}
+	}
+
+	if src.Proxy != nil {
+		dst.Proxy = &OneAgentProxy{URL: src.Proxy.Value, SecretName: src.Proxy.ValueFrom}
+	}
+}
+
+// pushHubStatus stores the v1alpha1 status fields missing on v1beta1 on an annotation, if any of these are set.
+func pushHubStatus(meta *metav1.ObjectMeta, status *v1alpha1.BaseOneAgentStatus) error {
+	hs := hubStatus{Tokens: status.Tokens, UseImmutableImage: status.UseImmutableImage}
+	if hs == (hubStatus{}) {
+		return nil
+	}
+
+	raw, err := json.Marshal(hs)
+	if err != nil {
+		return err
+	}
+
+	// The annotations map is shared with the source object, so it's copied before changing it.
+	annotations := make(map[string]string, len(meta.Annotations)+1)
+	for k, v := range meta.Annotations {
+		annotations[k] = v
+	}
+	annotations[hubStatusAnnotation] = string(raw)
+	meta.Annotations = annotations
+
+	return nil
+}
+
+// popHubStatus reads and removes the annotation set by pushHubStatus, if present.
+func popHubStatus(meta *metav1.ObjectMeta) (hubStatus, error) {
+	var hs hubStatus
+
+	raw, ok := meta.Annotations[hubStatusAnnotation]
+	if !ok {
+		return hs, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &hs); err != nil {
+		return hs, err
+	}
+
+	annotations := make(map[string]string, len(meta.Annotations))
+	for k, v := range meta.Annotations {
+		if k != hubStatusAnnotation {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	meta.Annotations = annotations
+
+	return hs, nil
+}
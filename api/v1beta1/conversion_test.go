@@ -0,0 +1,155 @@
+/*
+Copyright 2020 Dynatrace LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newHubOneAgent() *v1alpha1.OneAgent {
+	waitReady := uint16(300)
+	batchSize := intstr.FromString("25%")
+	now := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	return &v1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace", Annotations: map[string]string{"a": "b"}},
+		Spec: v1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: v1alpha1.BaseOneAgentSpec{
+				APIURL:            "https://ENVIRONMENTID.live.dynatrace.com/api",
+				Tokens:            "tokens",
+				Proxy:             &v1alpha1.OneAgentProxy{ValueFrom: "proxy"},
+				NetworkZone:       "zone",
+				UseImmutableImage: true,
+			},
+			NodeSelector:        map[string]string{"kubernetes.io/os": "linux"},
+			Image:               "registry.example.com/dynatrace/oneagent",
+			CustomPullSecret:    "pull-secret",
+			AgentVersion:        "1.203.0",
+			WaitReadySeconds:    &waitReady,
+			Env:                 []corev1.EnvVar{{Name: "ONEAGENT_ENABLE_VOLUME_STORAGE", Value: "true"}},
+			VersionPolicy:       &v1alpha1.OneAgentVersionPolicy{Mode: v1alpha1.VersionPolicyRange, Range: ">=1.203 <1.205"},
+			RolloutStrategy:     &v1alpha1.OneAgentRolloutStrategy{BatchSize: &batchSize},
+			MaintenanceWindows:  []v1alpha1.MaintenanceWindow{{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			NodeGroups:          []v1alpha1.OneAgentNodeGroup{{Name: "gpu", HostGroup: "gpu"}},
+			HostGroup:           "cluster",
+			NodeMetadata:        &v1alpha1.OneAgentNodeMetadata{Labels: map[string]string{"topology.kubernetes.io/zone": "Zone"}},
+			SendDeletionEvent:   true,
+			SendLifecycleEvents: true,
+		},
+		Status: v1alpha1.OneAgentStatus{
+			BaseOneAgentStatus: v1alpha1.BaseOneAgentStatus{
+				UpdatedTimestamp:  now,
+				EnvironmentID:     "ENVIRONMENTID",
+				Tokens:            "tokens",
+				UseImmutableImage: true,
+				TokenGeneration:   2,
+				TokenHash:         "0123456789abcdef",
+			},
+			Version:   "1.203.0",
+			Phase:     v1alpha1.Deploying,
+			Instances: map[string]v1alpha1.OneAgentInstance{"node": {PodName: "oneagent-abcde", Version: "1.203.0"}},
+			Rollout: &v1alpha1.OneAgentRolloutStatus{
+				TargetVersion: "1.205.0",
+				Phase:         v1alpha1.RolloutProgressing,
+				Restart:       &v1alpha1.OneAgentRestartStatus{NodeName: "node", Attempt: 1},
+			},
+			NodeGroups:           []v1alpha1.OneAgentNodeGroupStatus{{Name: "gpu", Phase: v1alpha1.Running, NumberReady: 2}},
+			PendingConfigChanges: []string{"oneagent-gpu"},
+		},
+	}
+}
+
+func TestOneAgentConversion(t *testing.T) {
+	hub := newHubOneAgent()
+
+	var oa OneAgent
+	require.NoError(t, oa.ConvertFrom(hub.DeepCopy()))
+
+	assert.Equal(t, &OneAgentTokens{SecretName: "tokens"}, oa.Spec.Tokens)
+	assert.Equal(t, &OneAgentProxy{SecretName: "proxy"}, oa.Spec.Proxy)
+	assert.Equal(t, &OneAgentImage{Immutable: true, Name: "registry.example.com/dynatrace/oneagent", PullSecret: "pull-secret"}, oa.Spec.Image)
+	if assert.NotNil(t, oa.Spec.UpdatePolicy) {
+		assert.Equal(t, "1.203.0", oa.Spec.UpdatePolicy.Version)
+		assert.Equal(t, VersionPolicyRange, oa.Spec.UpdatePolicy.VersionPolicy.Mode)
+		assert.Len(t, oa.Spec.UpdatePolicy.MaintenanceWindows, 1)
+	}
+	assert.Equal(t, RolloutProgressing, oa.Status.Rollout.Phase)
+	assert.Contains(t, oa.Annotations, hubStatusAnnotation)
+
+	var back v1alpha1.OneAgent
+	require.NoError(t, oa.ConvertTo(&back))
+	assert.Equal(t, hub, &back)
+
+	// The annotations of the source object aren't changed by the conversion.
+	assert.Equal(t, map[string]string{"a": "b"}, hub.Annotations)
+}
+
+func TestOneAgentConversion_Empty(t *testing.T) {
+	hub := &v1alpha1.OneAgent{ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"}}
+
+	var oa OneAgent
+	require.NoError(t, oa.ConvertFrom(hub))
+	assert.Nil(t, oa.Spec.Tokens)
+	assert.Nil(t, oa.Spec.Image)
+	assert.Nil(t, oa.Spec.UpdatePolicy)
+	assert.Nil(t, oa.Annotations)
+
+	var back v1alpha1.OneAgent
+	require.NoError(t, oa.ConvertTo(&back))
+	assert.Equal(t, hub, &back)
+}
+
+func TestOneAgentAPMConversion(t *testing.T) {
+	hub := &v1alpha1.OneAgentAPM{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Spec: v1alpha1.OneAgentAPMSpec{
+			BaseOneAgentSpec: v1alpha1.BaseOneAgentSpec{
+				APIURL:            "https://ENVIRONMENTID.live.dynatrace.com/api",
+				Proxy:             &v1alpha1.OneAgentProxy{Value: "http://proxy:8080"},
+				UseImmutableImage: true,
+				TokenSource: &v1alpha1.TokenSource{
+					HTTP: &v1alpha1.HTTPTokenSource{URL: "https://vault:8200/v1/secret/data/dynatrace", AuthSecretName: "vault"},
+				},
+			},
+			Image:  "registry.example.com/dynatrace/codemodules",
+			Flavor: "musl",
+		},
+		Status: v1alpha1.OneAgentAPMStatus{
+			BaseOneAgentStatus: v1alpha1.BaseOneAgentStatus{EnvironmentID: "ENVIRONMENTID", Tokens: "oneagent"},
+		},
+	}
+
+	var apm OneAgentAPM
+	require.NoError(t, apm.ConvertFrom(hub.DeepCopy()))
+	assert.Equal(t, &OneAgentAPMImage{Immutable: true, Name: "registry.example.com/dynatrace/codemodules"}, apm.Spec.Image)
+	assert.Equal(t, &OneAgentProxy{URL: "http://proxy:8080"}, apm.Spec.Proxy)
+	assert.Equal(t, &OneAgentTokens{
+		HTTP: &HTTPTokenSource{URL: "https://vault:8200/v1/secret/data/dynatrace", AuthSecretName: "vault"},
+	}, apm.Spec.Tokens)
+
+	var back v1alpha1.OneAgentAPM
+	require.NoError(t, apm.ConvertTo(&back))
+	assert.Equal(t, hub, &back)
+}
@@ -0,0 +1,434 @@
+/*
+Copyright 2020 Dynatrace LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// OneAgentSpec defines the desired state of OneAgent
+// +k8s:openapi-gen=true
+type OneAgentSpec struct {
+	BaseOneAgentSpec `json:",inline"`
+
+	// Node selector to control the selection of nodes (optional)
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Optional: set tolerations for the OneAgent pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Optional: Image for the OneAgent pods, either the installer or the immutable image
+	Image *OneAgentImage `json:"image,omitempty"`
+
+	// Optional: Defines when and how the OneAgent pods get updated to new versions
+	UpdatePolicy *OneAgentUpdatePolicy `json:"updatePolicy,omitempty"`
+
+	// Optional: define resources requests and limits for single pods
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Work in progress
+	// Disables automatic injection into applications
+	// OneAgentAPM together with the webhook will then do the injection
+	WebhookInjection bool `json:"webhookInjection,omitempty"`
+
+	// Optional: Arguments to the OneAgent installer
+	// +listType=set
+	Args []string `json:"args,omitempty"`
+
+	// Optional: List of environment variables to set for the installer
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Optional: If specified, indicates the pod's priority. Name must be defined by creating a PriorityClass object with that
+	// name. If not specified the setting will be removed from the DaemonSet.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Optional: Sets DNS Policy for the OneAgent pods
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// Optional: set custom Service Account Name used with OneAgent pods
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Optional: Adds additional labels for the OneAgent pods
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Optional: Runs the OneAgent Pods as unprivileged (Early Adopter)
+	UseUnprivilegedMode *bool `json:"useUnprivilegedMode,omitempty"`
+
+	// Optional: Groups of nodes with their own settings, each of them deployed with a separate DaemonSet
+	// Defaults to a single DaemonSet for all nodes matching the node selector
+	// +listType=map
+	// +listMapKey=name
+	NodeGroups []OneAgentNodeGroup `json:"nodeGroups,omitempty"`
+
+	// Optional: Host group for the hosts, replaces passing --set-host-group on the installer arguments
+	HostGroup string `json:"hostGroup,omitempty"`
+
+	// Optional: Tags for the hosts, replaces passing --set-host-tag on the installer arguments
+	// Values may be templates on the node the host runs on, e.g., "{{ .Node.Labels.zone }}"
+	HostTags map[string]string `json:"hostTags,omitempty"`
+
+	// Optional: Custom properties for the hosts, replaces passing --set-host-property on the installer arguments
+	// Values may be templates on the node the host runs on, e.g., "{{ .Node.Name }}"
+	HostProperties map[string]string `json:"hostProperties,omitempty"`
+
+	// Optional: Node labels and annotations to copy into the host properties of each node
+	// Since OneAgent pods share the same template, they're copied by the host-metadata init step when pods start
+	NodeMetadata *OneAgentNodeMetadata `json:"nodeMetadata,omitempty"`
+
+	// Optional: Sends an event to the hosts on Dynatrace when the OneAgent object gets deleted
+	SendDeletionEvent bool `json:"sendDeletionEvent,omitempty"`
+
+	// Optional: Sends events to the hosts on Dynatrace when OneAgent pods get restarted for an update, the DaemonSet
+	// gets changed, a rollout fails, and when a configuration change took effect on all nodes
+	SendLifecycleEvents bool `json:"sendLifecycleEvents,omitempty"`
+}
+
+// OneAgentImage defines the image for the OneAgent pods
+type OneAgentImage struct {
+	// Optional: Uses the immutable OneAgent image instead of downloading the OneAgent with the installer
+	Immutable bool `json:"immutable,omitempty"`
+
+	// Optional: Custom image for the OneAgent pods
+	// Defaults to the immutable image from the Dynatrace environment if immutable is set. Otherwise, defaults to
+	// docker.io/dynatrace/oneagent:latest for Kubernetes and to registry.connect.redhat.com/dynatrace/oneagent for OpenShift
+	Name string `json:"name,omitempty"`
+
+	// Optional: Pull secret for your private registry
+	PullSecret string `json:"pullSecret,omitempty"`
+}
+
+// OneAgentUpdatePolicy defines when and how the OneAgent pods get updated
+type OneAgentUpdatePolicy struct {
+	// Optional: Disables automatic restarts of OneAgent pods in case a new version is available
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Optional: If specified, indicates the OneAgent version to use, e.g., 1.200.0
+	// Defaults to latest
+	Version string `json:"version,omitempty"`
+
+	// Optional: Defines which OneAgent version gets deployed on updates
+	// Defaults to always updating to the latest version
+	VersionPolicy *OneAgentVersionPolicy `json:"versionPolicy,omitempty"`
+
+	// Optional: Defines how outdated OneAgent pods get restarted when a new version is available
+	// Defaults to restarting all outdated pods one after another
+	RolloutStrategy *OneAgentRolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// Optional: Time windows during which OneAgent pods may be restarted and the DaemonSet updated
+	// Changes are deferred until any of the windows opens. Defaults to applying changes at any time
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// Optional: Defines the time to wait until OneAgent pod is ready after update - default 300 sec
+	// +kubebuilder:validation:Minimum=0
+	WaitReadySeconds *uint16 `json:"waitReadySeconds,omitempty"`
+}
+
+// OneAgentNodeMetadata defines node labels and annotations to copy into host properties
+type OneAgentNodeMetadata struct {
+	// Optional: Node labels mapped to the names of the host properties to copy them into, e.g.,
+	// "topology.kubernetes.io/zone": "Zone". The property name defaults to the label name if empty
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Optional: Node annotations mapped to the names of the host properties to copy them into. The property name
+	// defaults to the annotation name if empty
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OneAgentNodeGroup defines settings for a group of nodes, which override the ones on the OneAgent spec
+type OneAgentNodeGroup struct {
+	// Name of the group, appended to the name of the OneAgent for its DaemonSet
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=20
+	Name string `json:"name"`
+
+	// Optional: Node selector for the nodes of the group, replaces the one on the OneAgent spec. Required if there's
+	// more than one group, and mustn't match the same nodes as the ones of the other groups
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Optional: Tolerations for the OneAgent pods of the group, replace the ones on the OneAgent spec
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Optional: Resource requests and limits for the OneAgent pods of the group, replace the ones on the OneAgent spec
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Optional: Arguments to the OneAgent installer, appended to the ones on the OneAgent spec
+	// +listType=set
+	Args []string `json:"args,omitempty"`
+
+	// Optional: Environment variables for the installer, override the ones on the OneAgent spec with the same name
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Optional: Host group for the hosts of the group, replaces the one on the OneAgent spec
+	HostGroup string `json:"hostGroup,omitempty"`
+}
+
+type VersionPolicyMode string
+
+const (
+	// VersionPolicyLatest always updates to the latest available version
+	VersionPolicyLatest VersionPolicyMode = "Latest"
+	// VersionPolicyPinned deploys the latest version matching the given version, e.g., "1.203" or "1.203.0.20201020-120000"
+	VersionPolicyPinned VersionPolicyMode = "Pinned"
+	// VersionPolicyRange deploys the latest version matching the given range, e.g., "~1.203" or ">=1.200 <1.210"
+	VersionPolicyRange VersionPolicyMode = "Range"
+	// VersionPolicyLatestMinus deploys the latest version of the minor release N releases behind the latest one
+	VersionPolicyLatestMinus VersionPolicyMode = "LatestMinus"
+)
+
+// OneAgentVersionPolicy defines which OneAgent version gets deployed
+type OneAgentVersionPolicy struct {
+	// Mode for choosing the version, either Latest, Pinned, Range or LatestMinus
+	// +kubebuilder:validation:Enum=Latest;Pinned;Range;LatestMinus
+	Mode VersionPolicyMode `json:"mode"`
+
+	// Optional: Version to pin to if mode is Pinned, either a full or a partial version, e.g., "1.203"
+	Version string `json:"version,omitempty"`
+
+	// Optional: Space separated version constraints if mode is Range, e.g., ">=1.200 <1.210"
+	// Supports the shorthands "1.203.x" for any version with the given prefix, "~1.203.2" for patch updates, and
+	// "^1.203" for minor updates
+	Range string `json:"range,omitempty"`
+
+	// Optional: Number of minor releases to stay behind the latest one if mode is LatestMinus - default 0
+	// +kubebuilder:validation:Minimum=0
+	LatestMinus int32 `json:"latestMinus,omitempty"`
+
+	// Optional: Allows the operator to downgrade OneAgents if the chosen version is older than the deployed one
+	// Defaults to keeping the deployed version until the chosen version is newer
+	AllowDowngrade bool `json:"allowDowngrade,omitempty"`
+}
+
+// MaintenanceWindow defines a recurring time window during which disruptive changes are allowed
+type MaintenanceWindow struct {
+	// Cron expression for the start of the window, with the fields minute, hour, day of month, month and day of
+	// week, e.g., "0 2 * * 6" for Saturdays at 02:00
+	Schedule string `json:"schedule"`
+
+	// How long the window stays open after each start, e.g., "2h"
+	Duration metav1.Duration `json:"duration"`
+
+	// Optional: IANA time zone for the schedule, e.g., "Europe/Vienna" - default UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// OneAgentRolloutStrategy defines how OneAgent pods get restarted in batches on version updates
+type OneAgentRolloutStrategy struct {
+	// Optional: Number or percentage of nodes to update first as canary batch
+	// Defaults to no canary batch
+	Canary *intstr.IntOrString `json:"canary,omitempty"`
+
+	// Optional: Number or percentage of nodes to update on each batch after the canary batch
+	// Defaults to all remaining nodes
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+
+	// Optional: Defines the time to wait between two batches - default 0 sec
+	// +kubebuilder:validation:Minimum=0
+	PauseSeconds *uint16 `json:"pauseSeconds,omitempty"`
+
+	// Optional: Halts the rollout when the pods of a batch don't get ready in time - default true
+	// A halted rollout continues once a different version is available
+	HaltOnFailure *bool `json:"haltOnFailure,omitempty"`
+}
+
+type OneAgentPhaseType string
+
+const (
+	Running   OneAgentPhaseType = "Running"
+	Deploying OneAgentPhaseType = "Deploying"
+	Error     OneAgentPhaseType = "Error"
+)
+
+// OneAgentStatus defines the observed state of OneAgent
+// +k8s:openapi-gen=true
+type OneAgentStatus struct {
+	BaseOneAgentStatus `json:",inline"`
+
+	// Dynatrace version being used.
+	Version string `json:"version,omitempty"`
+
+	Instances map[string]OneAgentInstance `json:"instances,omitempty"`
+
+	// Defines the current state (Running, Updating, Error, ...)
+	Phase OneAgentPhaseType `json:"phase,omitempty"`
+
+	// LastUpdateProbeTimestamp defines the last timestamp when the querying for updates have been done
+	LastUpdateProbeTimestamp *metav1.Time `json:"lastUpdateProbeTimestamp,omitempty"`
+
+	// ImageHash contains the hash for the latest immutable image seen.
+	ImageHash string `json:"imageHash,omitempty"`
+
+	// ImageVersion contains the version for the latest immutable image seen.
+	ImageVersion string `json:"imageVersion,omitempty"`
+
+	// LastImageVersionProbeTimestamp keeps track of the last time the Operator looked at the image version
+	LastImageVersionProbeTimestamp *metav1.Time `json:"lastImageVersionProbeTimestamp,omitempty"`
+
+	// Rollout keeps track of the progress of the current version rollout
+	Rollout *OneAgentRolloutStatus `json:"rollout,omitempty"`
+
+	// LastKnownGoodVersion is the last OneAgent version which got ready on all nodes
+	LastKnownGoodVersion string `json:"lastKnownGoodVersion,omitempty"`
+
+	// LastKnownGoodImageHash is the hash of the immutable image for LastKnownGoodVersion
+	LastKnownGoodImageHash string `json:"lastKnownGoodImageHash,omitempty"`
+
+	// FailedVersion is the OneAgent version which failed health checks and got rolled back. It won't be deployed again
+	FailedVersion string `json:"failedVersion,omitempty"`
+
+	// NodeGroups contains the state of the DaemonSet for each node group
+	NodeGroups []OneAgentNodeGroupStatus `json:"nodeGroups,omitempty"`
+
+	// PendingConfigChanges contains the DaemonSets changed by the Operator whose pods haven't all been updated yet.
+	// Only kept if lifecycle events are enabled
+	PendingConfigChanges []string `json:"pendingConfigChanges,omitempty"`
+}
+
+// OneAgentNodeGroupStatus defines the observed state of the DaemonSet of a node group
+type OneAgentNodeGroupStatus struct {
+	// Name of the node group
+	Name string `json:"name"`
+
+	// DaemonSet is the name of the DaemonSet deploying the group
+	DaemonSet string `json:"daemonSet,omitempty"`
+
+	// Phase of the group (Running, Deploying)
+	Phase OneAgentPhaseType `json:"phase,omitempty"`
+
+	// DesiredNumberScheduled is the number of nodes which should run the OneAgent pod of the group
+	DesiredNumberScheduled int32 `json:"desiredNumberScheduled,omitempty"`
+
+	// NumberReady is the number of nodes running a ready OneAgent pod of the group
+	NumberReady int32 `json:"numberReady,omitempty"`
+
+	// UpdatedNumberScheduled is the number of nodes running the latest DaemonSet template of the group
+	UpdatedNumberScheduled int32 `json:"updatedNumberScheduled,omitempty"`
+}
+
+type RolloutPhaseType string
+
+const (
+	RolloutCanary      RolloutPhaseType = "Canary"
+	RolloutProgressing RolloutPhaseType = "Progressing"
+	RolloutHalted      RolloutPhaseType = "Halted"
+	RolloutCompleted   RolloutPhaseType = "Completed"
+)
+
+// OneAgentRolloutStatus defines the observed state of a version rollout
+type OneAgentRolloutStatus struct {
+	// TargetVersion is the OneAgent version being rolled out
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Phase of the rollout (Canary, Progressing, Halted, Completed)
+	Phase RolloutPhaseType `json:"phase,omitempty"`
+
+	// Batches is the number of batches which have been completed
+	Batches int32 `json:"batches,omitempty"`
+
+	// UpdatedNodes contains the nodes where the OneAgent pod has been restarted for this rollout
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+
+	// LastBatchTimestamp indicates when the last batch has been completed
+	LastBatchTimestamp *metav1.Time `json:"lastBatchTimestamp,omitempty"`
+
+	// Message gives details on why a rollout has been halted
+	Message string `json:"message,omitempty"`
+
+	// PendingNodes contains the nodes of the current batch which are still to be restarted
+	PendingNodes []string `json:"pendingNodes,omitempty"`
+
+	// Restart keeps track of the OneAgent pod currently being restarted
+	Restart *OneAgentRestartStatus `json:"restart,omitempty"`
+}
+
+// OneAgentRestartStatus keeps track of the restart of a OneAgent pod on a node
+type OneAgentRestartStatus struct {
+	// NodeName is the node where the pod is being restarted
+	NodeName string `json:"nodeName"`
+
+	// PodName is the name of the last pod deleted on the node
+	PodName string `json:"podName,omitempty"`
+
+	// Attempt is the number of times the pod on the node has been deleted
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// Deadline is the time until the new pod is expected to be ready
+	Deadline *metav1.Time `json:"deadline,omitempty"`
+}
+
+type OneAgentInstance struct {
+	PodName   string `json:"podName,omitempty"`
+	Version   string `json:"version,omitempty"`
+	IPAddress string `json:"ipAddress,omitempty"`
+
+	// PodPhase is the phase of the OneAgent pod on the node
+	PodPhase corev1.PodPhase `json:"podPhase,omitempty"`
+
+	// Ready is set if the OneAgent pod on the node is ready
+	Ready bool `json:"ready,omitempty"`
+
+	// RestartCount is the number of times the OneAgent container on the node has been restarted
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// LastRestartReason is the reason why the OneAgent container last terminated, e.g., OOMKilled or Error
+	LastRestartReason string `json:"lastRestartReason,omitempty"`
+
+	// EntityID is the ID of the host in Dynatrace, not set if Dynatrace doesn't see the host
+	EntityID string `json:"entityID,omitempty"`
+
+	// LastSeenTimestamp is when Dynatrace last saw the host
+	LastSeenTimestamp *metav1.Time `json:"lastSeenTimestamp,omitempty"`
+
+	// NetworkZone is the network zone of the OneAgent on the host
+	NetworkZone string `json:"networkZone,omitempty"`
+
+	// Outdated is set if the OneAgent on the host doesn't run the desired version
+	Outdated bool `json:"outdated,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// For full-stack monitoring, including complete APM and infrastructure layer observability.
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=oneagents,scope=Namespaced,categories=dynatrace
+// +kubebuilder:printcolumn:name="ApiUrl",type=string,JSONPath=`.spec.apiUrl`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type OneAgent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec OneAgentSpec `json:"spec"`
+	// +optional
+	Status OneAgentStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// OneAgentList contains a list of OneAgent
+type OneAgentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OneAgent `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OneAgent{}, &OneAgentList{})
+}
@@ -0,0 +1,84 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OneAgentAPMSpec defines the desired state of OneAgentAPM
+type OneAgentAPMSpec struct {
+	BaseOneAgentSpec `json:",inline"`
+
+	// Optional: Image for the code modules, only used with the immutable image
+	Image *OneAgentAPMImage `json:"image,omitempty"`
+
+	// Optional: The version of the oneagent to be used
+	// Default (if nothing set): latest
+	AgentVersion string `json:"agentVersion,omitempty"`
+
+	// Optional: define resources requests and limits for the initContainer
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Optional: defines the C standard library used
+	// Can be set to "musl" to use musl instead of glibc
+	// If a pod is annotated with the "oneagent.dynatrace.com/flavor" annotation, the value from the annotation will be used
+	Flavor string `json:"flavor,omitempty"`
+}
+
+// OneAgentAPMImage defines the image for the code modules
+type OneAgentAPMImage struct {
+	// Optional: Uses the immutable code modules image instead of downloading the code modules with the installer
+	Immutable bool `json:"immutable,omitempty"`
+
+	// Optional: Custom code modules image, in case you have it on a custom docker registry
+	// Defaults to the immutable image from the Dynatrace environment
+	Name string `json:"name,omitempty"`
+}
+
+// OneAgentAPMStatus defines the observed state of OneAgentAPM
+type OneAgentAPMStatus struct {
+	BaseOneAgentStatus `json:",inline"`
+}
+
+// For application-only monitoring used in lieu of full-stack OneAgent if node access is limited.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=oneagentapms,scope=Namespaced,categories=dynatrace
+// +kubebuilder:printcolumn:name="ApiUrl",type=string,JSONPath=`.spec.apiUrl`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type OneAgentAPM struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec OneAgentAPMSpec `json:"spec"`
+	// +optional
+	Status OneAgentAPMStatus `json:"status"`
+}
+
+// OneAgentAPMList contains a list of OneAgentAPM
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type OneAgentAPMList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OneAgentAPM `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OneAgentAPM{}, &OneAgentAPMList{})
+}
@@ -0,0 +1,740 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright  Dynatrace LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BaseOneAgentSpec) DeepCopyInto(out *BaseOneAgentSpec) {
+	*out = *in
+	if in.Tokens != nil {
+		in, out := &in.Tokens, &out.Tokens
+		*out = new(OneAgentTokens)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(OneAgentProxy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BaseOneAgentSpec.
+func (in *BaseOneAgentSpec) DeepCopy() *BaseOneAgentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BaseOneAgentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BaseOneAgentStatus) DeepCopyInto(out *BaseOneAgentStatus) {
+	*out = *in
+	in.UpdatedTimestamp.DeepCopyInto(&out.UpdatedTimestamp)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastAPITokenProbeTimestamp != nil {
+		in, out := &in.LastAPITokenProbeTimestamp, &out.LastAPITokenProbeTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.LastPaaSTokenProbeTimestamp != nil {
+		in, out := &in.LastPaaSTokenProbeTimestamp, &out.LastPaaSTokenProbeTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BaseOneAgentStatus.
+func (in *BaseOneAgentStatus) DeepCopy() *BaseOneAgentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BaseOneAgentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileTokenSource) DeepCopyInto(out *FileTokenSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileTokenSource.
+func (in *FileTokenSource) DeepCopy() *FileTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(FileTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPTokenSource) DeepCopyInto(out *HTTPTokenSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPTokenSource.
+func (in *HTTPTokenSource) DeepCopy() *HTTPTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgent) DeepCopyInto(out *OneAgent) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgent.
+func (in *OneAgent) DeepCopy() *OneAgent {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OneAgent) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentAPM) DeepCopyInto(out *OneAgentAPM) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentAPM.
+func (in *OneAgentAPM) DeepCopy() *OneAgentAPM {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentAPM)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OneAgentAPM) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentAPMImage) DeepCopyInto(out *OneAgentAPMImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentAPMImage.
+func (in *OneAgentAPMImage) DeepCopy() *OneAgentAPMImage {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentAPMImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentAPMList) DeepCopyInto(out *OneAgentAPMList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OneAgentAPM, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentAPMList.
+func (in *OneAgentAPMList) DeepCopy() *OneAgentAPMList {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentAPMList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OneAgentAPMList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentAPMSpec) DeepCopyInto(out *OneAgentAPMSpec) {
+	*out = *in
+	in.BaseOneAgentSpec.DeepCopyInto(&out.BaseOneAgentSpec)
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(OneAgentAPMImage)
+		**out = **in
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentAPMSpec.
+func (in *OneAgentAPMSpec) DeepCopy() *OneAgentAPMSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentAPMSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentAPMStatus) DeepCopyInto(out *OneAgentAPMStatus) {
+	*out = *in
+	in.BaseOneAgentStatus.DeepCopyInto(&out.BaseOneAgentStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentAPMStatus.
+func (in *OneAgentAPMStatus) DeepCopy() *OneAgentAPMStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentAPMStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentImage) DeepCopyInto(out *OneAgentImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentImage.
+func (in *OneAgentImage) DeepCopy() *OneAgentImage {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentInstance) DeepCopyInto(out *OneAgentInstance) {
+	*out = *in
+	if in.LastSeenTimestamp != nil {
+		in, out := &in.LastSeenTimestamp, &out.LastSeenTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentInstance.
+func (in *OneAgentInstance) DeepCopy() *OneAgentInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentList) DeepCopyInto(out *OneAgentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OneAgent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentList.
+func (in *OneAgentList) DeepCopy() *OneAgentList {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OneAgentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeGroup) DeepCopyInto(out *OneAgentNodeGroup) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeGroup.
+func (in *OneAgentNodeGroup) DeepCopy() *OneAgentNodeGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeGroupStatus) DeepCopyInto(out *OneAgentNodeGroupStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeGroupStatus.
+func (in *OneAgentNodeGroupStatus) DeepCopy() *OneAgentNodeGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentNodeMetadata) DeepCopyInto(out *OneAgentNodeMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentNodeMetadata.
+func (in *OneAgentNodeMetadata) DeepCopy() *OneAgentNodeMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentNodeMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentProxy) DeepCopyInto(out *OneAgentProxy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentProxy.
+func (in *OneAgentProxy) DeepCopy() *OneAgentProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRestartStatus) DeepCopyInto(out *OneAgentRestartStatus) {
+	*out = *in
+	if in.Deadline != nil {
+		in, out := &in.Deadline, &out.Deadline
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRestartStatus.
+func (in *OneAgentRestartStatus) DeepCopy() *OneAgentRestartStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRestartStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRolloutStatus) DeepCopyInto(out *OneAgentRolloutStatus) {
+	*out = *in
+	if in.UpdatedNodes != nil {
+		in, out := &in.UpdatedNodes, &out.UpdatedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastBatchTimestamp != nil {
+		in, out := &in.LastBatchTimestamp, &out.LastBatchTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingNodes != nil {
+		in, out := &in.PendingNodes, &out.PendingNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Restart != nil {
+		in, out := &in.Restart, &out.Restart
+		*out = new(OneAgentRestartStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRolloutStatus.
+func (in *OneAgentRolloutStatus) DeepCopy() *OneAgentRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentRolloutStrategy) DeepCopyInto(out *OneAgentRolloutStrategy) {
+	*out = *in
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.BatchSize != nil {
+		in, out := &in.BatchSize, &out.BatchSize
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.PauseSeconds != nil {
+		in, out := &in.PauseSeconds, &out.PauseSeconds
+		*out = new(uint16)
+		**out = **in
+	}
+	if in.HaltOnFailure != nil {
+		in, out := &in.HaltOnFailure, &out.HaltOnFailure
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentRolloutStrategy.
+func (in *OneAgentRolloutStrategy) DeepCopy() *OneAgentRolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentRolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentSpec) DeepCopyInto(out *OneAgentSpec) {
+	*out = *in
+	in.BaseOneAgentSpec.DeepCopyInto(&out.BaseOneAgentSpec)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(OneAgentImage)
+		**out = **in
+	}
+	if in.UpdatePolicy != nil {
+		in, out := &in.UpdatePolicy, &out.UpdatePolicy
+		*out = new(OneAgentUpdatePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.UseUnprivilegedMode != nil {
+		in, out := &in.UseUnprivilegedMode, &out.UseUnprivilegedMode
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NodeGroups != nil {
+		in, out := &in.NodeGroups, &out.NodeGroups
+		*out = make([]OneAgentNodeGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HostTags != nil {
+		in, out := &in.HostTags, &out.HostTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HostProperties != nil {
+		in, out := &in.HostProperties, &out.HostProperties
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeMetadata != nil {
+		in, out := &in.NodeMetadata, &out.NodeMetadata
+		*out = new(OneAgentNodeMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentSpec.
+func (in *OneAgentSpec) DeepCopy() *OneAgentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentStatus) DeepCopyInto(out *OneAgentStatus) {
+	*out = *in
+	in.BaseOneAgentStatus.DeepCopyInto(&out.BaseOneAgentStatus)
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make(map[string]OneAgentInstance, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.LastUpdateProbeTimestamp != nil {
+		in, out := &in.LastUpdateProbeTimestamp, &out.LastUpdateProbeTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.LastImageVersionProbeTimestamp != nil {
+		in, out := &in.LastImageVersionProbeTimestamp, &out.LastImageVersionProbeTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(OneAgentRolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeGroups != nil {
+		in, out := &in.NodeGroups, &out.NodeGroups
+		*out = make([]OneAgentNodeGroupStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingConfigChanges != nil {
+		in, out := &in.PendingConfigChanges, &out.PendingConfigChanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentStatus.
+func (in *OneAgentStatus) DeepCopy() *OneAgentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentTokens) DeepCopyInto(out *OneAgentTokens) {
+	*out = *in
+	if in.File != nil {
+		in, out := &in.File, &out.File
+		*out = new(FileTokenSource)
+		**out = **in
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPTokenSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentTokens.
+func (in *OneAgentTokens) DeepCopy() *OneAgentTokens {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentTokens)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentUpdatePolicy) DeepCopyInto(out *OneAgentUpdatePolicy) {
+	*out = *in
+	if in.VersionPolicy != nil {
+		in, out := &in.VersionPolicy, &out.VersionPolicy
+		*out = new(OneAgentVersionPolicy)
+		**out = **in
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(OneAgentRolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.WaitReadySeconds != nil {
+		in, out := &in.WaitReadySeconds, &out.WaitReadySeconds
+		*out = new(uint16)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentUpdatePolicy.
+func (in *OneAgentUpdatePolicy) DeepCopy() *OneAgentUpdatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentUpdatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OneAgentVersionPolicy) DeepCopyInto(out *OneAgentVersionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OneAgentVersionPolicy.
+func (in *OneAgentVersionPolicy) DeepCopy() *OneAgentVersionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OneAgentVersionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
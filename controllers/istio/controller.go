@@ -2,18 +2,22 @@ package istio
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
 	"github.com/go-logr/logr"
 	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
 	istioclientset "istio.io/client-go/pkg/clientset/versioned"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -66,7 +70,7 @@ func (c *Controller) initialiseIstioClient(config *rest.Config) (istioclientset.
 
 // ReconcileIstio - runs the istio's reconcile workflow,
 // creating/deleting VS & SE for external communications
-func (c *Controller) ReconcileIstio(instance dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) ReconcileIstio(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	dtc dtclient.Client) (updated bool, err error) {
 
 	enabled, err := CheckIstioEnabled(c.config)
@@ -84,19 +88,19 @@ func (c *Controller) ReconcileIstio(instance dynatracev1alpha1.BaseOneAgent,
 		return false, fmt.Errorf("istio: failed to get host for Dynatrace API URL: %w", err)
 	}
 
-	if upd, err := c.reconcileIstioConfigurations(instance, []dtclient.CommunicationHost{apiHost}, "api-url"); err != nil {
+	if upd, err := c.reconcileIstioConfigurations(ctx, instance, []dtclient.CommunicationHost{apiHost}, "api-url"); err != nil {
 		return false, fmt.Errorf("istio: error reconciling config for Dynatrace API URL: %w", err)
 	} else if upd {
 		return true, nil
 	}
 
 	// Fetch endpoints via Dynatrace client
-	ci, err := dtc.GetConnectionInfo()
+	ci, err := dtc.GetConnectionInfo(ctx)
 	if err != nil {
 		return false, fmt.Errorf("istio: failed to get Dynatrace communication endpoints: %w", err)
 	}
 
-	if upd, err := c.reconcileIstioConfigurations(instance, ci.CommunicationHosts, "communication-endpoint"); err != nil {
+	if upd, err := c.reconcileIstioConfigurations(ctx, instance, ci.CommunicationHosts, "communication-endpoint"); err != nil {
 		return false, fmt.Errorf("istio: error reconciling config for Dynatrace communication endpoints: %w", err)
 	} else if upd {
 		return true, nil
@@ -105,14 +109,58 @@ func (c *Controller) ReconcileIstio(instance dynatracev1alpha1.BaseOneAgent,
 	return false, nil
 }
 
-func (c *Controller) reconcileIstioConfigurations(instance dynatracev1alpha1.BaseOneAgent,
+// RemoveIstioConfigurations deletes all VirtualServices and ServiceEntries created for instance, e.g., when the
+// instance is being deleted. Nothing is done if Istio isn't installed on the cluster.
+func (c *Controller) RemoveIstioConfigurations(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent) error {
+	listOps := metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			"dynatrace": "oneagent",
+			"oneagent":  instance.GetName(),
+		}).String(),
+	}
+
+	ns := instance.GetNamespace()
+	vsList, err := c.istioClient.NetworkingV1alpha3().VirtualServices(ns).List(ctx, listOps)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("istio: failed to list VirtualServices: %w", err)
+	}
+
+	for _, vs := range vsList.Items {
+		c.logger.Info("istio: removing VirtualService", "objectName", vs.GetName())
+		err := c.istioClient.NetworkingV1alpha3().VirtualServices(ns).Delete(ctx, vs.GetName(), metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("istio: failed to delete VirtualService %s: %w", vs.GetName(), err)
+		}
+	}
+
+	seList, err := c.istioClient.NetworkingV1alpha3().ServiceEntries(ns).List(ctx, listOps)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("istio: failed to list ServiceEntries: %w", err)
+	}
+
+	for _, se := range seList.Items {
+		c.logger.Info("istio: removing ServiceEntry", "objectName", se.GetName())
+		err := c.istioClient.NetworkingV1alpha3().ServiceEntries(ns).Delete(ctx, se.GetName(), metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("istio: failed to delete ServiceEntry %s: %w", se.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) reconcileIstioConfigurations(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	comHosts []dtclient.CommunicationHost, role string) (bool, error) {
 
-	add, err := c.reconcileIstioCreateConfigurations(instance, comHosts, role)
+	add, err := c.reconcileIstioCreateConfigurations(ctx, instance, comHosts, role)
 	if err != nil {
 		return false, err
 	}
-	rem, err := c.reconcileIstioRemoveConfigurations(instance, comHosts, role)
+	rem, err := c.reconcileIstioRemoveConfigurations(ctx, instance, comHosts, role)
 	if err != nil {
 		return false, err
 	}
@@ -120,7 +168,7 @@ func (c *Controller) reconcileIstioConfigurations(instance dynatracev1alpha1.Bas
 	return add || rem, nil
 }
 
-func (c *Controller) reconcileIstioRemoveConfigurations(instance dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) reconcileIstioRemoveConfigurations(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	comHosts []dtclient.CommunicationHost, role string) (bool, error) {
 
 	labels := labels.SelectorFromSet(buildIstioLabels(instance.GetName(), role)).String()
@@ -133,11 +181,11 @@ func (c *Controller) reconcileIstioRemoveConfigurations(instance dynatracev1alph
 		seen[buildNameForEndpoint(instance.GetName(), ch.Protocol, ch.Host, ch.Port)] = true
 	}
 
-	vsUpd, err := c.removeIstioConfigurationForVirtualService(listOps, seen, instance.GetNamespace())
+	vsUpd, err := c.removeIstioConfigurationForVirtualService(ctx, listOps, seen, instance.GetNamespace())
 	if err != nil {
 		return false, err
 	}
-	seUpd, err := c.removeIstioConfigurationForServiceEntry(listOps, seen, instance.GetNamespace())
+	seUpd, err := c.removeIstioConfigurationForServiceEntry(ctx, listOps, seen, instance.GetNamespace())
 	if err != nil {
 		return false, err
 	}
@@ -145,10 +193,10 @@ func (c *Controller) reconcileIstioRemoveConfigurations(instance dynatracev1alph
 	return vsUpd || seUpd, nil
 }
 
-func (c *Controller) removeIstioConfigurationForServiceEntry(listOps *metav1.ListOptions,
+func (c *Controller) removeIstioConfigurationForServiceEntry(ctx context.Context, listOps *metav1.ListOptions,
 	seen map[string]bool, namespace string) (bool, error) {
 
-	list, err := c.istioClient.NetworkingV1alpha3().ServiceEntries(namespace).List(context.TODO(), *listOps)
+	list, err := c.istioClient.NetworkingV1alpha3().ServiceEntries(namespace).List(ctx, *listOps)
 	if err != nil {
 		c.logger.Error(err, fmt.Sprintf("istio: error listing service entries, %v", err))
 		return false, err
@@ -160,7 +208,7 @@ func (c *Controller) removeIstioConfigurationForServiceEntry(listOps *metav1.Lis
 			c.logger.Info(fmt.Sprintf("istio: removing %s: %v", se.Kind, se.GetName()))
 			err = c.istioClient.NetworkingV1alpha3().
 				ServiceEntries(namespace).
-				Delete(context.TODO(), se.GetName(), metav1.DeleteOptions{})
+				Delete(ctx, se.GetName(), metav1.DeleteOptions{})
 			if err != nil {
 				c.logger.Error(err, fmt.Sprintf("istio: error deleting service entry, %s : %v", se.GetName(), err))
 				continue
@@ -172,10 +220,10 @@ func (c *Controller) removeIstioConfigurationForServiceEntry(listOps *metav1.Lis
 	return del, nil
 }
 
-func (c *Controller) removeIstioConfigurationForVirtualService(listOps *metav1.ListOptions,
+func (c *Controller) removeIstioConfigurationForVirtualService(ctx context.Context, listOps *metav1.ListOptions,
 	seen map[string]bool, namespace string) (bool, error) {
 
-	list, err := c.istioClient.NetworkingV1alpha3().VirtualServices(namespace).List(context.TODO(), *listOps)
+	list, err := c.istioClient.NetworkingV1alpha3().VirtualServices(namespace).List(ctx, *listOps)
 	if err != nil {
 		c.logger.Error(err, fmt.Sprintf("istio: error listing virtual service, %v", err))
 		return false, err
@@ -187,7 +235,7 @@ func (c *Controller) removeIstioConfigurationForVirtualService(listOps *metav1.L
 			c.logger.Info(fmt.Sprintf("istio: removing %s: %v", vs.Kind, vs.GetName()))
 			err = c.istioClient.NetworkingV1alpha3().
 				VirtualServices(namespace).
-				Delete(context.TODO(), vs.GetName(), metav1.DeleteOptions{})
+				Delete(ctx, vs.GetName(), metav1.DeleteOptions{})
 			if err != nil {
 				c.logger.Error(err, fmt.Sprintf("istio: error deleting virtual service, %s : %v", vs.GetName(), err))
 				continue
@@ -199,10 +247,10 @@ func (c *Controller) removeIstioConfigurationForVirtualService(listOps *metav1.L
 	return del, nil
 }
 
-func (c *Controller) reconcileIstioCreateConfigurations(instance dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) reconcileIstioCreateConfigurations(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	communicationHosts []dtclient.CommunicationHost, role string) (bool, error) {
 
-	crdProbe := c.verifyIstioCrdAvailability(instance)
+	crdProbe := c.verifyIstioCrdAvailability(ctx, instance)
 	if crdProbe != probeTypeFound {
 		c.logger.Info("istio: failed to lookup CRD for ServiceEntry/VirtualService: Did you install Istio recently? Please restart the Operator.")
 		return false, nil
@@ -212,11 +260,11 @@ func (c *Controller) reconcileIstioCreateConfigurations(instance dynatracev1alph
 	for _, commHost := range communicationHosts {
 		name := buildNameForEndpoint(instance.GetName(), commHost.Protocol, commHost.Host, commHost.Port)
 
-		createdServiceEntry, err := c.handleIstioConfigurationForServiceEntry(instance, name, commHost, role)
+		createdServiceEntry, err := c.handleIstioConfigurationForServiceEntry(ctx, instance, name, commHost, role)
 		if err != nil {
 			return false, err
 		}
-		createdVirtualService, err := c.handleIstioConfigurationForVirtualService(instance, name, commHost, role)
+		createdVirtualService, err := c.handleIstioConfigurationForVirtualService(ctx, instance, name, commHost, role)
 		if err != nil {
 			return false, err
 		}
@@ -227,15 +275,15 @@ func (c *Controller) reconcileIstioCreateConfigurations(instance dynatracev1alph
 	return configurationUpdated, nil
 }
 
-func (c *Controller) verifyIstioCrdAvailability(instance dynatracev1alpha1.BaseOneAgent) probeResult {
+func (c *Controller) verifyIstioCrdAvailability(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent) probeResult {
 	var probe probeResult
 
-	probe, _ = c.kubernetesObjectProbe(ServiceEntryGVK, instance.GetNamespace(), "")
+	probe, _ = c.kubernetesObjectProbe(ctx, ServiceEntryGVK, instance.GetNamespace(), "")
 	if probe == probeTypeNotFound {
 		return probe
 	}
 
-	probe, _ = c.kubernetesObjectProbe(VirtualServiceGVK, instance.GetNamespace(), "")
+	probe, _ = c.kubernetesObjectProbe(ctx, VirtualServiceGVK, instance.GetNamespace(), "")
 	if probe == probeTypeNotFound {
 		return probe
 	}
@@ -243,10 +291,10 @@ func (c *Controller) verifyIstioCrdAvailability(instance dynatracev1alpha1.BaseO
 	return probeTypeFound
 }
 
-func (c *Controller) handleIstioConfigurationForVirtualService(instance dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) handleIstioConfigurationForVirtualService(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	name string, communicationHost dtclient.CommunicationHost, role string) (bool, error) {
 
-	probe, err := c.kubernetesObjectProbe(VirtualServiceGVK, instance.GetNamespace(), name)
+	probe, err := c.kubernetesObjectProbe(ctx, VirtualServiceGVK, instance.GetNamespace(), name)
 	if probe == probeObjectFound {
 		return false, nil
 	} else if probe == probeUnknown {
@@ -260,7 +308,7 @@ func (c *Controller) handleIstioConfigurationForVirtualService(instance dynatrac
 		return false, nil
 	}
 
-	err = c.createIstioConfigurationForVirtualService(instance, virtualService, role)
+	err = c.createIstioConfigurationForVirtualService(ctx, instance, virtualService, role)
 	if err != nil {
 		c.logger.Error(err, "istio: failed to create VirtualService")
 		return false, err
@@ -271,10 +319,10 @@ func (c *Controller) handleIstioConfigurationForVirtualService(instance dynatrac
 	return true, nil
 }
 
-func (c *Controller) handleIstioConfigurationForServiceEntry(instance dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) handleIstioConfigurationForServiceEntry(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent,
 	name string, communicationHost dtclient.CommunicationHost, role string) (bool, error) {
 
-	probe, err := c.kubernetesObjectProbe(ServiceEntryGVK, instance.GetNamespace(), name)
+	probe, err := c.kubernetesObjectProbe(ctx, ServiceEntryGVK, instance.GetNamespace(), name)
 	if probe == probeObjectFound {
 		return false, nil
 	} else if probe == probeUnknown {
@@ -283,7 +331,7 @@ func (c *Controller) handleIstioConfigurationForServiceEntry(instance dynatracev
 	}
 
 	serviceEntry := buildServiceEntry(name, communicationHost.Host, communicationHost.Protocol, communicationHost.Port)
-	err = c.createIstioConfigurationForServiceEntry(instance, serviceEntry, role)
+	err = c.createIstioConfigurationForServiceEntry(ctx, instance, serviceEntry, role)
 	if err != nil {
 		c.logger.Error(err, "istio: failed to create ServiceEntry")
 		return false, err
@@ -293,14 +341,22 @@ func (c *Controller) handleIstioConfigurationForServiceEntry(instance dynatracev
 	return true, nil
 }
 
-func (c *Controller) createIstioConfigurationForServiceEntry(oneagent dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) createIstioConfigurationForServiceEntry(ctx context.Context, oneagent dynatracev1alpha1.BaseOneAgent,
 	serviceEntry *istiov1alpha3.ServiceEntry, role string) error {
 
 	serviceEntry.Labels = buildIstioLabels(oneagent.GetName(), role)
 	if err := controllerutil.SetControllerReference(oneagent, serviceEntry, c.scheme); err != nil {
 		return err
 	}
-	sve, err := c.istioClient.NetworkingV1alpha3().ServiceEntries(oneagent.GetNamespace()).Create(context.TODO(), serviceEntry, metav1.CreateOptions{})
+	serviceEntry.SetGroupVersionKind(ServiceEntryGVK)
+	data, err := json.Marshal(serviceEntry)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	sve, err := c.istioClient.NetworkingV1alpha3().ServiceEntries(oneagent.GetNamespace()).Patch(ctx, serviceEntry.Name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: utils.OperatorFieldManager, Force: &force})
 	if err != nil {
 		return err
 	}
@@ -311,14 +367,22 @@ func (c *Controller) createIstioConfigurationForServiceEntry(oneagent dynatracev
 	return nil
 }
 
-func (c *Controller) createIstioConfigurationForVirtualService(oneagent dynatracev1alpha1.BaseOneAgent,
+func (c *Controller) createIstioConfigurationForVirtualService(ctx context.Context, oneagent dynatracev1alpha1.BaseOneAgent,
 	virtualService *istiov1alpha3.VirtualService, role string) error {
 
 	virtualService.Labels = buildIstioLabels(oneagent.GetName(), role)
 	if err := controllerutil.SetControllerReference(oneagent, virtualService, c.scheme); err != nil {
 		return err
 	}
-	vs, err := c.istioClient.NetworkingV1alpha3().VirtualServices(oneagent.GetNamespace()).Create(context.TODO(), virtualService, metav1.CreateOptions{})
+	virtualService.SetGroupVersionKind(VirtualServiceGVK)
+	data, err := json.Marshal(virtualService)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	vs, err := c.istioClient.NetworkingV1alpha3().VirtualServices(oneagent.GetNamespace()).Patch(ctx, virtualService.Name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: utils.OperatorFieldManager, Force: &force})
 	if err != nil {
 		return err
 	}
@@ -329,7 +393,7 @@ func (c *Controller) createIstioConfigurationForVirtualService(oneagent dynatrac
 	return nil
 }
 
-func (c *Controller) kubernetesObjectProbe(gvk schema.GroupVersionKind,
+func (c *Controller) kubernetesObjectProbe(ctx context.Context, gvk schema.GroupVersionKind,
 	namespace string, name string) (probeResult, error) {
 
 	var objQuery unstructured.Unstructured
@@ -342,9 +406,9 @@ func (c *Controller) kubernetesObjectProbe(gvk schema.GroupVersionKind,
 		return probeUnknown, err
 	}
 	if name == "" {
-		err = runtimeClient.List(context.TODO(), &objQuery, client.InNamespace(namespace))
+		err = runtimeClient.List(ctx, &objQuery, client.InNamespace(namespace))
 	} else {
-		err = runtimeClient.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, &objQuery)
+		err = runtimeClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &objQuery)
 	}
 
 	return mapErrorToObjectProbeResult(err)
@@ -13,6 +13,8 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -28,6 +30,7 @@ func Add(mgr manager.Manager, ns string) error {
 		apiReader:               mgr.GetAPIReader(),
 		namespace:               ns,
 		logger:                  log.Log.WithName("namespaces.controller"),
+		recorder:                mgr.GetEventRecorderFor("dynatrace-oneagent-operator"),
 		pullSecretGeneratorFunc: utils.GeneratePullSecretData,
 	})
 }
@@ -45,15 +48,39 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch for changes to OneAgentAPMs and requeue their namespaces, e.g., to distribute rotated tokens
+	err = c.Watch(&source.Kind{Type: &dynatracev1alpha1.OneAgentAPM{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		var nsList corev1.NamespaceList
+		if err := mgr.GetClient().List(context.TODO(), &nsList, client.MatchingLabels{webhook.LabelInstance: obj.GetName()}); err != nil {
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(nsList.Items))
+		for _, ns := range nsList.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: ns.Name}})
+		}
+		return requests
+	}))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// Reasons of the events recorded on namespaces.
+const (
+	eventInjectionConfigUpdated = "InjectionConfigUpdated"
+	eventInjectionConfigFailed  = "InjectionConfigFailed"
+)
+
 type ReconcileNamespaces struct {
 	client                  client.Client
 	apiReader               client.Reader
 	logger                  logr.Logger
+	recorder                record.EventRecorder
 	namespace               string
-	pullSecretGeneratorFunc func(c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns *corev1.Secret) (map[string][]byte, error)
+	pullSecretGeneratorFunc func(ctx context.Context, c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns utils.Tokens) (map[string][]byte, error)
 }
 
 func (r *ReconcileNamespaces) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -78,14 +105,29 @@ func (r *ReconcileNamespaces) Reconcile(ctx context.Context, request reconcile.R
 		return reconcile.Result{}, nil
 	}
 
+	if err := r.reconcileInjection(ctx, log, &ns, oaName); err != nil {
+		r.recorder.Eventf(&ns, corev1.EventTypeWarning, eventInjectionConfigFailed, "Failed to configure injection for OneAgentAPM %s: %v", oaName, err)
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+// reconcileInjection creates or updates the secrets used to inject the OneAgent into the pods of the namespace.
+func (r *ReconcileNamespaces) reconcileInjection(ctx context.Context, log logr.Logger, ns *corev1.Namespace, oaName string) error {
 	var ims dynatracev1alpha1.OneAgentList
 	if err := r.client.List(ctx, &ims, client.InNamespace(r.namespace)); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to query OneAgentIMs: %w", err)
+		return fmt.Errorf("failed to query OneAgentIMs: %w", err)
 	}
 
 	var apm dynatracev1alpha1.OneAgentAPM
 	if err := r.client.Get(ctx, client.ObjectKey{Name: oaName, Namespace: r.namespace}, &apm); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to query OneAgentAPM: %w", err)
+		return fmt.Errorf("failed to query OneAgentAPM: %w", err)
+	}
+
+	// The secrets of OneAgentAPMs being deleted get removed by their finalizer.
+	if apm.DeletionTimestamp != nil {
+		return nil
 	}
 
 	imNodes := map[string]string{}
@@ -99,40 +141,74 @@ func (r *ReconcileNamespaces) Reconcile(ctx context.Context, request reconcile.R
 		}
 	}
 
-	var tkns corev1.Secret
-	if err := r.client.Get(ctx, client.ObjectKey{Name: utils.GetTokensName(&apm), Namespace: r.namespace}, &tkns); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to query tokens: %w", err)
+	tkns, err := utils.GetTokenSource(r.client, &apm).Tokens(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query tokens: %w", err)
+	}
+
+	// Rotated tokens are only distributed once the OneAgentAPM controller has validated them, the namespace gets
+	// requeued when that happens.
+	if apm.Status.TokenHash != "" && utils.TokensHash(tkns) != apm.Status.TokenHash {
+		log.Info("Tokens not yet validated, keeping current injection secrets", "oneagentapm", oaName)
+		return nil
 	}
 
 	script, err := newScript(ctx, r.client, apm, tkns, imNodes, r.namespace)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to generate init script: %w", err)
+		return fmt.Errorf("failed to generate init script: %w", err)
 	}
 
 	data, err := script.generate()
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to generate script: %w", err)
+		return fmt.Errorf("failed to generate script: %w", err)
 	}
 
 	// The default cache-based Client doesn't support cross-namespace queries, unless configured to do so in Manager
 	// Options. However, this is our only use-case for it, so using the non-cached Client instead.
-	err = utils.CreateOrUpdateSecretIfNotExists(r.client, r.apiReader, webhook.SecretConfigName, targetNS, data, corev1.SecretTypeOpaque, log)
+	upd, err := utils.CreateOrUpdateSecretIfNotExists(ctx, r.client, r.apiReader, webhook.SecretConfigName, ns.Name, data, corev1.SecretTypeOpaque, log)
 	if err != nil {
-		return reconcile.Result{}, err
+		return err
+	} else if upd {
+		r.recorder.Eventf(ns, corev1.EventTypeNormal, eventInjectionConfigUpdated, "Updated secret %s for OneAgentAPM %s", webhook.SecretConfigName, oaName)
 	}
 
 	if apm.Spec.Image == "" {
-		pullSecretData, err := r.pullSecretGeneratorFunc(r.client, &apm, &tkns)
+		pullSecretData, err := r.pullSecretGeneratorFunc(ctx, r.client, &apm, tkns)
 		if err != nil {
-			return reconcile.Result{}, err
+			return err
 		}
-		err = utils.CreateOrUpdateSecretIfNotExists(r.client, r.apiReader, webhook.PullSecretName, targetNS, pullSecretData, corev1.SecretTypeDockerConfigJson, log)
+		upd, err := utils.CreateOrUpdateSecretIfNotExists(ctx, r.client, r.apiReader, webhook.PullSecretName, ns.Name, pullSecretData, corev1.SecretTypeDockerConfigJson, log)
 		if err != nil {
-			return reconcile.Result{}, err
+			return err
+		} else if upd {
+			r.recorder.Eventf(ns, corev1.EventTypeNormal, eventInjectionConfigUpdated, "Updated secret %s for OneAgentAPM %s", webhook.PullSecretName, oaName)
 		}
 	}
 
-	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	return nil
+}
+
+// RemoveInjectionSecrets deletes the secrets used to inject the OneAgent from all namespaces assigned to the OneAgentAPM
+// named apmName.
+func RemoveInjectionSecrets(ctx context.Context, c client.Client, apmName string, log logr.Logger) error {
+	var nsList corev1.NamespaceList
+	if err := c.List(ctx, &nsList, client.MatchingLabels{webhook.LabelInstance: apmName}); err != nil {
+		return fmt.Errorf("failed to query Namespaces: %w", err)
+	}
+
+	for _, ns := range nsList.Items {
+		for _, name := range []string{webhook.SecretConfigName, webhook.PullSecretName} {
+			secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name}}
+			if err := c.Delete(ctx, &secret); errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to delete secret %s in namespace %s: %w", name, ns.Name, err)
+			}
+			log.Info("Deleted secret", "namespace", ns.Name, "secret", name)
+		}
+	}
+
+	return nil
 }
 
 type script struct {
@@ -144,7 +220,7 @@ type script struct {
 	IMNodes    map[string]string
 }
 
-func newScript(ctx context.Context, c client.Client, apm dynatracev1alpha1.OneAgentAPM, tkns corev1.Secret, imNodes map[string]string, ns string) (*script, error) {
+func newScript(ctx context.Context, c client.Client, apm dynatracev1alpha1.OneAgentAPM, tkns utils.Tokens, imNodes map[string]string, ns string) (*script, error) {
 	var kubeSystemNS corev1.Namespace
 	if err := c.Get(ctx, client.ObjectKey{Name: "kube-system"}, &kubeSystemNS); err != nil {
 		return nil, fmt.Errorf("failed to query for cluster ID: %w", err)
@@ -174,7 +250,7 @@ func newScript(ctx context.Context, c client.Client, apm dynatracev1alpha1.OneAg
 
 	return &script{
 		OneAgent:   &apm,
-		PaaSToken:  string(tkns.Data[utils.DynatracePaasToken]),
+		PaaSToken:  tkns[utils.DynatracePaasToken],
 		Proxy:      proxy,
 		TrustedCAs: trustedCAs,
 		ClusterID:  string(kubeSystemNS.UID),
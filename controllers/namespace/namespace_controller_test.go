@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -13,6 +15,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -75,12 +78,14 @@ func TestReconcileNamespace(t *testing.T) {
 		},
 	).Build()
 
+	recorder := record.NewFakeRecorder(10)
 	r := ReconcileNamespaces{
-		client:    c,
+		client:    utils.FakeApplyClient{Client: c},
 		apiReader: c,
 		logger:    zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)),
+		recorder:  recorder,
 		namespace: "dynatrace",
-		pullSecretGeneratorFunc: func(c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns *corev1.Secret) (map[string][]byte, error) {
+		pullSecretGeneratorFunc: func(_ context.Context, c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns utils.Tokens) (map[string][]byte, error) {
 			return map[string][]byte{".dockerconfigjson": []byte("{}")}, nil
 		},
 	}
@@ -88,6 +93,10 @@ func TestReconcileNamespace(t *testing.T) {
 	_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-namespace"}})
 	assert.NoError(t, err)
 
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Normal InjectionConfigUpdated Updated secret dynatrace-oneagent-config for OneAgentAPM oneagent", <-recorder.Events)
+	}
+
 	var nsSecret corev1.Secret
 	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{
 		Name:      "dynatrace-oneagent-config",
@@ -212,3 +221,75 @@ tenant ${host_tenant}">>${container_conf_file}
 done
 `, string(nsSecret.Data["init.sh"]))
 }
+
+func TestRemoveInjectionSecrets(t *testing.T) {
+	labeled := func(name, apm string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{webhook.LabelInstance: apm}}}
+	}
+	secret := func(name, ns string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		labeled("app1", "oneagent"),
+		labeled("app2", "oneagent"),
+		labeled("other", "other"),
+		secret(webhook.SecretConfigName, "app1"),
+		secret(webhook.PullSecretName, "app1"),
+		secret(webhook.SecretConfigName, "app2"),
+		secret(webhook.SecretConfigName, "other"),
+	).Build()
+
+	require.NoError(t, RemoveInjectionSecrets(context.TODO(), c, "oneagent", zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout))))
+
+	var secrets corev1.SecretList
+	require.NoError(t, c.List(context.TODO(), &secrets))
+	if assert.Len(t, secrets.Items, 1) {
+		assert.Equal(t, "other", secrets.Items[0].Namespace)
+	}
+}
+
+func TestReconcileNamespace_UnvalidatedTokens(t *testing.T) {
+	tkns := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Data:       map[string][]byte{"paasToken": []byte("43"), "apiToken": []byte("84")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&dynatracev1alpha1.OneAgentAPM{
+			ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+			Spec: dynatracev1alpha1.OneAgentAPMSpec{
+				BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{APIURL: "https://test-url/api"},
+			},
+			Status: dynatracev1alpha1.OneAgentAPMStatus{
+				BaseOneAgentStatus: dynatracev1alpha1.BaseOneAgentStatus{
+					EnvironmentID: "abc12345",
+					TokenHash:     utils.TokensHash(utils.Tokens{"paasToken": "42", "apiToken": "84"}),
+				},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-namespace", Labels: map[string]string{webhook.LabelInstance: "oneagent"}},
+		},
+		tkns,
+	).Build()
+
+	recorder := record.NewFakeRecorder(10)
+	r := ReconcileNamespaces{
+		client:    utils.FakeApplyClient{Client: c},
+		apiReader: c,
+		logger:    zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)),
+		recorder:  recorder,
+		namespace: "dynatrace",
+		pullSecretGeneratorFunc: func(_ context.Context, c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns utils.Tokens) (map[string][]byte, error) {
+			return map[string][]byte{".dockerconfigjson": []byte("{}")}, nil
+		},
+	}
+
+	_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-namespace"}})
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	var secrets corev1.SecretList
+	require.NoError(t, c.List(context.TODO(), &secrets, client.InNamespace("test-namespace")))
+	assert.Empty(t, secrets.Items)
+}
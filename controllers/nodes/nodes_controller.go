@@ -14,6 +14,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -27,12 +29,19 @@ const (
 
 var unschedulableTaints = []string{"ToBeDeletedByClusterAutoscaler"}
 
+// Reasons of the events recorded on nodes.
+const (
+	eventMarkedForTermination     = "MarkedForTermination"
+	eventMarkForTerminationFailed = "MarkForTerminationFailed"
+)
+
 type ReconcileNodes struct {
 	namespace    string
 	client       client.Client
 	cache        cache.Cache
 	scheme       *runtime.Scheme
 	logger       logr.Logger
+	recorder     record.EventRecorder
 	dtClientFunc utils.DynatraceClientFunc
 	local        bool
 }
@@ -46,16 +55,17 @@ func Add(mgr manager.Manager, ns string) error {
 		cache:        mgr.GetCache(),
 		scheme:       mgr.GetScheme(),
 		logger:       log.Log.WithName("nodes.controller"),
+		recorder:     mgr.GetEventRecorderFor("dynatrace-oneagent-operator"),
 		dtClientFunc: utils.BuildDynatraceClient,
 		local:        os.Getenv("RUN_LOCAL") == "true",
 	})
 }
 
 // Start starts the Nodes Reconciler, and will block until a stop signal is sent.
-func (r *ReconcileNodes) Start(stop context.Context) error {
-	r.cache.WaitForCacheSync(stop)
+func (r *ReconcileNodes) Start(ctx context.Context) error {
+	r.cache.WaitForCacheSync(ctx)
 
-	chDels, err := r.watchDeletions(stop.Done())
+	chDels, err := r.watchDeletions(ctx.Done())
 	if err != nil {
 		// I've seen watchDeletions() fail because the Cache Informers weren't ready. WaitForCacheSync()
 		// should block until they are, however, but I believe I saw this not being true once.
@@ -71,55 +81,55 @@ func (r *ReconcileNodes) Start(stop context.Context) error {
 		chUpdates = make(chan string)
 	}
 
-	chAll := watchTicks(stop.Done(), 5*time.Minute)
+	chAll := watchTicks(ctx.Done(), 5*time.Minute)
 
 	for {
 		select {
-		case <-stop.Done():
+		case <-ctx.Done():
 			r.logger.Info("stopping nodes controller")
 			return nil
 		case node := <-chDels:
-			if err := r.onDeletion(node); err != nil {
+			if err := r.onDeletion(ctx, node); err != nil {
 				r.logger.Error(err, "failed to reconcile deletion", "node", node)
 			}
 		case node := <-chUpdates:
-			if err := r.onUpdate(node); err != nil {
+			if err := r.onUpdate(ctx, node); err != nil {
 				r.logger.Error(err, "failed to reconcile updates", "node", node)
 			}
 		case <-chAll:
-			if err := r.reconcileAll(); err != nil {
+			if err := r.reconcileAll(ctx); err != nil {
 				r.logger.Error(err, "failed to reconcile nodes")
 			}
 		}
 	}
 }
 
-func (r *ReconcileNodes) onUpdate(node string) error {
-	c, err := r.getCache()
+func (r *ReconcileNodes) onUpdate(ctx context.Context, node string) error {
+	c, err := r.getCache(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err = r.updateNode(c, node); err != nil {
+	if err = r.updateNode(ctx, c, node); err != nil {
 		return err
 	}
 
-	return r.updateCache(c)
+	return r.updateCache(ctx, c)
 }
 
-func (r *ReconcileNodes) onDeletion(node string) error {
+func (r *ReconcileNodes) onDeletion(ctx context.Context, node string) error {
 	logger := r.logger.WithValues("node", node)
 
 	logger.Info("node deletion notification received")
 
-	c, err := r.getCache()
+	c, err := r.getCache(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err = r.removeNode(c, node, func(oaName string) (*dynatracev1alpha1.OneAgent, error) {
+	if err = r.removeNode(ctx, c, node, func(oaName string) (*dynatracev1alpha1.OneAgent, error) {
 		var oa dynatracev1alpha1.OneAgent
-		if err := r.client.Get(context.TODO(), client.ObjectKey{Name: oaName, Namespace: r.namespace}, &oa); err != nil {
+		if err := r.client.Get(ctx, client.ObjectKey{Name: oaName, Namespace: r.namespace}, &oa); err != nil {
 			return nil, err
 		}
 		return &oa, nil
@@ -127,29 +137,32 @@ func (r *ReconcileNodes) onDeletion(node string) error {
 		return err
 	}
 
-	return r.updateCache(c)
+	return r.updateCache(ctx, c)
 }
 
-func (r *ReconcileNodes) reconcileAll() error {
+func (r *ReconcileNodes) reconcileAll(ctx context.Context) error {
 	r.logger.Info("reconciling nodes")
 
 	var oaLst dynatracev1alpha1.OneAgentList
-	if err := r.client.List(context.TODO(), &oaLst, client.InNamespace(r.namespace)); err != nil {
+	if err := r.client.List(ctx, &oaLst, client.InNamespace(r.namespace)); err != nil {
 		return err
 	}
 
 	oas := make(map[string]*dynatracev1alpha1.OneAgent, len(oaLst.Items))
 	for i := range oaLst.Items {
-		oas[oaLst.Items[i].Name] = &oaLst.Items[i]
+		// The nodes of OneAgents being deleted get removed from the cache by their finalizer.
+		if oaLst.Items[i].DeletionTimestamp == nil {
+			oas[oaLst.Items[i].Name] = &oaLst.Items[i]
+		}
 	}
 
-	c, err := r.getCache()
+	c, err := r.getCache(ctx)
 	if err != nil {
 		return err
 	}
 
 	var nodeLst corev1.NodeList
-	if err := r.client.List(context.TODO(), &nodeLst); err != nil {
+	if err := r.client.List(ctx, &nodeLst); err != nil {
 		return err
 	}
 
@@ -161,7 +174,7 @@ func (r *ReconcileNodes) reconcileAll() error {
 		// Sometimes Azure does not cordon off nodes before deleting them since they use taints,
 		// this case is handled in the update event handler
 		if isUnschedulable(&node) {
-			if err = r.reconcileUnschedulableNode(&node, c); err != nil {
+			if err = r.reconcileUnschedulableNode(ctx, &node, c); err != nil {
 				return err
 			}
 		}
@@ -198,7 +211,7 @@ func (r *ReconcileNodes) reconcileAll() error {
 			continue
 		}
 
-		if err := r.removeNode(c, node, func(name string) (*dynatracev1alpha1.OneAgent, error) {
+		if err := r.removeNode(ctx, c, node, func(name string) (*dynatracev1alpha1.OneAgent, error) {
 			if oa, ok := oas[name]; ok {
 				return oa, nil
 			}
@@ -212,13 +225,13 @@ func (r *ReconcileNodes) reconcileAll() error {
 		}
 	}
 
-	return r.updateCache(c)
+	return r.updateCache(ctx, c)
 }
 
-func (r *ReconcileNodes) getCache() (*Cache, error) {
+func (r *ReconcileNodes) getCache(ctx context.Context) (*Cache, error) {
 	var cm corev1.ConfigMap
 
-	err := r.client.Get(context.TODO(), client.ObjectKey{Name: cacheName, Namespace: r.namespace}, &cm)
+	err := r.client.Get(ctx, client.ObjectKey{Name: cacheName, Namespace: r.namespace}, &cm)
 	if err == nil {
 		return &Cache{Obj: &cm}, nil
 	}
@@ -235,7 +248,7 @@ func (r *ReconcileNodes) getCache() (*Cache, error) {
 		}
 
 		if !r.local { // If running locally, don't set the controller.
-			deploy, err := utils.GetDeployment(r.client, r.namespace)
+			deploy, err := utils.GetDeployment(ctx, r.client, r.namespace)
 			if err != nil {
 				return nil, err
 			}
@@ -251,19 +264,41 @@ func (r *ReconcileNodes) getCache() (*Cache, error) {
 	return nil, err
 }
 
-func (r *ReconcileNodes) updateCache(c *Cache) error {
+// RemoveInstanceFromCache removes the nodes of the OneAgent named instance from the node cache in namespace, if any.
+func RemoveInstanceFromCache(ctx context.Context, clt client.Client, namespace, instance string) error {
+	var cm corev1.ConfigMap
+	if err := clt.Get(ctx, client.ObjectKey{Name: cacheName, Namespace: namespace}, &cm); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c := &Cache{Obj: &cm}
+	for _, node := range c.Keys() {
+		if entry, err := c.Get(node); err == nil && entry.Instance == instance {
+			c.Delete(node)
+		}
+	}
+
+	if !c.Changed() {
+		return nil
+	}
+	return clt.Update(ctx, c.Obj)
+}
+
+func (r *ReconcileNodes) updateCache(ctx context.Context, c *Cache) error {
 	if !c.Changed() {
 		return nil
 	}
 
 	if c.Create {
-		return r.client.Create(context.TODO(), c.Obj)
+		return r.client.Create(ctx, c.Obj)
 	}
 
-	return r.client.Update(context.TODO(), c.Obj)
+	return r.client.Update(ctx, c.Obj)
 }
 
-func (r *ReconcileNodes) removeNode(c *Cache, node string, oaFunc func(name string) (*dynatracev1alpha1.OneAgent, error)) error {
+func (r *ReconcileNodes) removeNode(ctx context.Context, c *Cache, node string, oaFunc func(name string) (*dynatracev1alpha1.OneAgent, error)) error {
 	logger := r.logger.WithValues("node", node)
 
 	nodeInfo, err := c.Get(node)
@@ -289,7 +324,7 @@ func (r *ReconcileNodes) removeNode(c *Cache, node string, oaFunc func(name stri
 			return err
 		}
 
-		err = r.markForTermination(c, oa, nodeInfo.IPAddress, node)
+		err = r.markForTermination(ctx, c, oa, nodeInfo.IPAddress, node)
 		if err != nil {
 			return err
 		}
@@ -299,9 +334,9 @@ func (r *ReconcileNodes) removeNode(c *Cache, node string, oaFunc func(name stri
 	return nil
 }
 
-func (r *ReconcileNodes) updateNode(c *Cache, nodeName string) error {
+func (r *ReconcileNodes) updateNode(ctx context.Context, c *Cache, nodeName string) error {
 	node := &corev1.Node{}
-	err := r.client.Get(context.TODO(), client.ObjectKey{Name: nodeName}, node)
+	err := r.client.Get(ctx, client.ObjectKey{Name: nodeName}, node)
 	if err != nil {
 		return err
 	}
@@ -310,22 +345,27 @@ func (r *ReconcileNodes) updateNode(c *Cache, nodeName string) error {
 		return nil
 	}
 
-	return r.reconcileUnschedulableNode(node, c)
+	return r.reconcileUnschedulableNode(ctx, node, c)
 }
 
-func (r *ReconcileNodes) sendMarkedForTermination(oa *dynatracev1alpha1.OneAgent, nodeIP string, lastSeen time.Time) error {
-	dtc, err := r.dtClientFunc(r.client, oa, true, true)
+func (r *ReconcileNodes) sendMarkedForTermination(ctx context.Context, oa *dynatracev1alpha1.OneAgent, nodeIP string, lastSeen time.Time) error {
+	tkns, err := utils.GetTokenSource(r.client, oa).Tokens(ctx)
 	if err != nil {
 		return err
 	}
 
-	entityID, err := dtc.GetEntityIDForIP(nodeIP)
+	dtc, err := r.dtClientFunc(ctx, r.client, oa, tkns, true, true)
+	if err != nil {
+		return err
+	}
+
+	entityID, err := dtc.GetEntityIDForIP(ctx, nodeIP)
 	if err != nil {
 		return err
 	}
 
 	ts := uint64(lastSeen.Add(-10*time.Minute).UnixNano()) / uint64(time.Millisecond)
-	return dtc.SendEvent(&dtclient.EventData{
+	return dtc.SendEvent(ctx, &dtclient.EventData{
 		EventType:     dtclient.MarkedForTerminationEvent,
 		Source:        "OneAgent Operator",
 		Description:   "Kubernetes node cordoned. Node might be drained or terminated.",
@@ -337,8 +377,8 @@ func (r *ReconcileNodes) sendMarkedForTermination(oa *dynatracev1alpha1.OneAgent
 	})
 }
 
-func (r *ReconcileNodes) reconcileUnschedulableNode(node *corev1.Node, c *Cache) error {
-	oneAgent, err := r.determineOneAgentForNode(node.Name)
+func (r *ReconcileNodes) reconcileUnschedulableNode(ctx context.Context, node *corev1.Node, c *Cache) error {
+	oneAgent, err := r.determineOneAgentForNode(ctx, node.Name)
 	if err != nil {
 		return err
 	}
@@ -365,10 +405,10 @@ func (r *ReconcileNodes) reconcileUnschedulableNode(node *corev1.Node, c *Cache)
 		}
 	}
 
-	return r.markForTermination(c, oneAgent, instance.IPAddress, node.Name)
+	return r.markForTermination(ctx, c, oneAgent, instance.IPAddress, node.Name)
 }
 
-func (r *ReconcileNodes) markForTermination(c *Cache, oneAgent *dynatracev1alpha1.OneAgent,
+func (r *ReconcileNodes) markForTermination(ctx context.Context, c *Cache, oneAgent *dynatracev1alpha1.OneAgent,
 	ipAddress string, nodeName string) error {
 	cachedNode, err := c.Get(nodeName)
 	if err != nil {
@@ -385,7 +425,21 @@ func (r *ReconcileNodes) markForTermination(c *Cache, oneAgent *dynatracev1alpha
 		return err
 	}
 
-	return r.sendMarkedForTermination(oneAgent, ipAddress, cachedNode.LastSeen)
+	if err := r.sendMarkedForTermination(ctx, oneAgent, ipAddress, cachedNode.LastSeen); err != nil {
+		r.recorder.Eventf(nodeReference(nodeName), corev1.EventTypeWarning, eventMarkForTerminationFailed,
+			"Failed to send mark for termination event to Dynatrace for OneAgent %s: %v", oneAgent.Name, err)
+		return err
+	}
+
+	r.recorder.Eventf(nodeReference(nodeName), corev1.EventTypeNormal, eventMarkedForTermination,
+		"Sent mark for termination event to Dynatrace for host %s of OneAgent %s", ipAddress, oneAgent.Name)
+	return nil
+}
+
+// nodeReference returns the reference to record events on a node. The node name is used as UID, as done by the
+// kubelet, so that the events are shown by kubectl describe.
+func nodeReference(name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{Kind: "Node", Name: name, UID: types.UID(name)}
 }
 
 func isUnschedulable(node *corev1.Node) bool {
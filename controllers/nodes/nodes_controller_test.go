@@ -16,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -38,7 +39,7 @@ func TestNodesReconciler_CreateCache(t *testing.T) {
 
 	ctrl := createDefaultReconciler(fakeClient, dtClient)
 
-	require.NoError(t, ctrl.reconcileAll())
+	require.NoError(t, ctrl.reconcileAll(context.TODO()))
 
 	var cm corev1.ConfigMap
 	require.NoError(t, fakeClient.Get(context.TODO(), testCacheKey, &cm))
@@ -63,8 +64,13 @@ func TestNodesReconciler_DeleteNode(t *testing.T) {
 
 	ctrl := createDefaultReconciler(fakeClient, dtClient)
 
-	require.NoError(t, ctrl.reconcileAll())
-	require.NoError(t, ctrl.onDeletion("node1"))
+	require.NoError(t, ctrl.reconcileAll(context.TODO()))
+	require.NoError(t, ctrl.onDeletion(context.TODO(), "node1"))
+
+	events := ctrl.recorder.(*record.FakeRecorder).Events
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "Normal MarkedForTermination Sent mark for termination event to Dynatrace for host 1.2.3.4 of OneAgent oneagent1", <-events)
+	}
 
 	var cm corev1.ConfigMap
 	require.NoError(t, fakeClient.Get(context.TODO(), testCacheKey, &cm))
@@ -87,11 +93,11 @@ func TestNodesReconciler_NodeNotFound(t *testing.T) {
 
 	ctrl := createDefaultReconciler(fakeClient, dtClient)
 
-	require.NoError(t, ctrl.reconcileAll())
+	require.NoError(t, ctrl.reconcileAll(context.TODO()))
 	var node2 corev1.Node
 	require.NoError(t, fakeClient.Get(context.TODO(), client.ObjectKey{Name: "node2"}, &node2))
 	require.NoError(t, fakeClient.Delete(context.TODO(), &node2))
-	require.NoError(t, ctrl.reconcileAll())
+	require.NoError(t, ctrl.reconcileAll(context.TODO()))
 
 	var cm corev1.ConfigMap
 	require.NoError(t, fakeClient.Get(context.TODO(), testCacheKey, &cm))
@@ -124,15 +130,15 @@ func TestNodeReconciler_NodeHasTaint(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Reconcile all to build cache
-	err = ctrl.reconcileAll()
+	err = ctrl.reconcileAll(context.TODO())
 	assert.NoError(t, err)
 
 	// Execute on update which triggers mark for termination
-	err = ctrl.onUpdate("node1")
+	err = ctrl.onUpdate(context.TODO(), "node1")
 	assert.NoError(t, err)
 
 	// Get node from cache
-	c, err := ctrl.getCache()
+	c, err := ctrl.getCache(context.TODO())
 	assert.NoError(t, err)
 	assert.NotNil(t, c)
 
@@ -152,6 +158,7 @@ func createDefaultReconciler(fakeClient client.Client, dtClient *dtclient.MockDy
 		client:       fakeClient,
 		scheme:       scheme.Scheme,
 		logger:       zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)),
+		recorder:     record.NewFakeRecorder(10),
 		dtClientFunc: utils.StaticDynatraceClient(dtClient),
 		local:        true,
 	}
@@ -181,5 +188,13 @@ func createDefaultFakeClientWithScheme() client.Client {
 			Status: dynatracev1alpha1.OneAgentStatus{
 				Instances: map[string]dynatracev1alpha1.OneAgentInstance{"node2": {IPAddress: "5.6.7.8"}},
 			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oneagent1", Namespace: testNamespace},
+			Data:       map[string][]byte{utils.DynatracePaasToken: []byte("42"), utils.DynatraceApiToken: []byte("84")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oneagent2", Namespace: testNamespace},
+			Data:       map[string][]byte{utils.DynatracePaasToken: []byte("42"), utils.DynatraceApiToken: []byte("84")},
 		}).Build()
 }
@@ -8,8 +8,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (r *ReconcileNodes) determineOneAgentForNode(nodeName string) (*dynatracev1alpha1.OneAgent, error) {
-	oneAgentList, err := r.getOneAgentList()
+func (r *ReconcileNodes) determineOneAgentForNode(ctx context.Context, nodeName string) (*dynatracev1alpha1.OneAgent, error) {
+	oneAgentList, err := r.getOneAgentList(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -17,11 +17,11 @@ func (r *ReconcileNodes) determineOneAgentForNode(nodeName string) (*dynatracev1
 	return r.filterOneAgentFromList(oneAgentList, nodeName), nil
 }
 
-func (r *ReconcileNodes) getOneAgentList() (*dynatracev1alpha1.OneAgentList, error) {
+func (r *ReconcileNodes) getOneAgentList(ctx context.Context) (*dynatracev1alpha1.OneAgentList, error) {
 	watchNamespace := os.Getenv("POD_NAMESPACE")
 
 	var oneAgentList dynatracev1alpha1.OneAgentList
-	err := r.client.List(context.TODO(), &oneAgentList, client.InNamespace(watchNamespace))
+	err := r.client.List(ctx, &oneAgentList, client.InNamespace(watchNamespace))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,80 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/nodes"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cleanup removes the objects derived from a deleted OneAgent which aren't garbage collected: the secrets, the Istio
+// objects and the entries of its nodes on the node cache. An event is sent to the hosts on Dynatrace afterwards, if
+// enabled.
+func (r *ReconcileOneAgent) cleanup(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent) error {
+	logger.Info("Removing objects of deleted OneAgent")
+
+	secrets := []string{instance.Name + "-pull-secret"}
+	if !utils.UsesTokensSecret(instance) {
+		secrets = append(secrets, getInstallerTokenName(instance))
+	}
+
+	for _, name := range secrets {
+		secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: instance.Namespace}}
+		if err := r.client.Delete(ctx, &secret); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete secret %s: %w", name, err)
+		}
+	}
+
+	if r.istioController != nil {
+		if err := r.istioController.RemoveIstioConfigurations(ctx, instance); err != nil {
+			return err
+		}
+	}
+
+	if err := nodes.RemoveInstanceFromCache(ctx, r.client, instance.Namespace, instance.Name); err != nil {
+		return fmt.Errorf("failed to remove nodes from cache: %w", err)
+	}
+
+	metrics.SetAgentVersions(instance.Namespace, instance.Name, nil)
+
+	if instance.Spec.SendDeletionEvent {
+		// The deletion shouldn't be blocked if Dynatrace can't be reached.
+		if err := r.sendDeletionEvent(ctx, instance); err != nil {
+			logger.Info("failed to send deletion event to Dynatrace", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// sendDeletionEvent sends an event for the deletion of instance to its hosts on Dynatrace.
+func (r *ReconcileOneAgent) sendDeletionEvent(ctx context.Context, instance *dynatracev1alpha1.OneAgent) error {
+	nodes := instanceNodes(instance)
+	if len(hostEntityIDs(instance, nodes)) == 0 {
+		return nil
+	}
+
+	dtf := r.dtcReconciler.DynatraceClientFunc
+	if dtf == nil {
+		dtf = utils.BuildDynatraceClient
+	}
+
+	tkns, err := utils.GetTokenSource(r.client, instance).Tokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	dtc, err := dtf(ctx, r.client, instance, tkns, true, false)
+	if err != nil {
+		return err
+	}
+
+	return sendHostEvent(ctx, dtc, instance, nodes, fmt.Sprintf("OneAgent %s deleted from the Kubernetes cluster.", instance.Name))
+}
@@ -0,0 +1,79 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcile_Cleanup(t *testing.T) {
+	now := metav1.Now()
+	instance := newOneAgent()
+	instance.DeletionTimestamp = &now
+	instance.Finalizers = []string{utils.CleanupFinalizer}
+	instance.Spec.SendDeletionEvent = true
+	instance.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{
+		"node1": {EntityID: "HOST-1"},
+		"node2": {EntityID: "HOST-2"},
+	}
+
+	pullSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: instance.Name + "-pull-secret", Namespace: instance.Namespace}}
+	nodeCache := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "dynatrace-node-cache", Namespace: instance.Namespace},
+		Data: map[string]string{
+			"node1": `{"instance":"my-oneagent","ip":"1.2.3.4"}`,
+			"node3": `{"instance":"other-oneagent","ip":"1.2.3.5"}`,
+		},
+	}
+
+	tokens := NewSecret(instance.Name, instance.Namespace, map[string]string{utils.DynatracePaasToken: "42", utils.DynatraceApiToken: "84"})
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, pullSecret, nodeCache, tokens).Build()
+
+	dtClient := &dtclient.MockDynatraceClient{}
+	dtClient.On("SendEvent", mock.MatchedBy(func(e *dtclient.EventData) bool {
+		return e.EventType == dtclient.CustomInfoEvent && assert.ObjectsAreEqual([]string{"HOST-1", "HOST-2"}, e.AttachRules.EntityIDs)
+	})).Return(nil)
+
+	r := &ReconcileOneAgent{
+		client:    c,
+		apiReader: c,
+		scheme:    scheme.Scheme,
+		logger:    consoleLogger,
+		recorder:  record.NewFakeRecorder(10),
+		dtcReconciler: &utils.DynatraceClientReconciler{
+			Client:              c,
+			DynatraceClientFunc: utils.StaticDynatraceClient(dtClient),
+		},
+	}
+
+	_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+	require.NoError(t, err)
+
+	assert.True(t, k8serrors.IsNotFound(c.Get(context.TODO(), client.ObjectKeyFromObject(pullSecret), &corev1.Secret{})))
+
+	var cache corev1.ConfigMap
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKeyFromObject(nodeCache), &cache))
+	assert.NotContains(t, cache.Data, "node1")
+	assert.Contains(t, cache.Data, "node3")
+
+	var actual dynatracev1alpha1.OneAgent
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKeyFromObject(instance), &actual))
+	assert.Empty(t, actual.Finalizers)
+
+	mock.AssertExpectationsForObjects(t, dtClient)
+}
@@ -0,0 +1,244 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileConditions updates the Available, Progressing, Degraded and UpToDate conditions from the DaemonSets and the
+// status of the instance, and the error of the reconciliation, if any.
+//
+// Returns true if the status has been modified.
+func (r *ReconcileOneAgent) reconcileConditions(ctx context.Context, instance *dynatracev1alpha1.OneAgent, reconcileErr error) (bool, error) {
+	conditions := &instance.Status.Conditions
+	upd := utils.SetCondition(conditions, degradedCondition(instance, reconcileErr))
+	upd = utils.SetCondition(conditions, upToDateCondition(instance)) || upd
+
+	statuses, err := r.getNodeGroupStatuses(ctx, instance)
+	if err != nil {
+		return upd, err
+	}
+
+	upd = utils.SetCondition(conditions, availableCondition(instance, statuses)) || upd
+	upd = utils.SetCondition(conditions, progressingCondition(instance, statuses)) || upd
+	return upd, nil
+}
+
+func availableCondition(instance *dynatracev1alpha1.OneAgent, statuses []dynatracev1alpha1.OneAgentNodeGroupStatus) metav1.Condition {
+	if groups := len(nodeGroups(instance)); len(statuses) < groups {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.AvailableConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonDaemonSetMissing,
+			Message: fmt.Sprintf("%d of %d DaemonSets have been created", len(statuses), groups),
+		}
+	}
+
+	var ready, desired int32
+	for _, sts := range statuses {
+		ready += sts.NumberReady
+		desired += sts.DesiredNumberScheduled
+	}
+
+	cond := metav1.Condition{
+		Type:    dynatracev1alpha1.AvailableConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonPodsReady,
+		Message: fmt.Sprintf("%d of %d OneAgent pods are ready", ready, desired),
+	}
+	if ready < desired {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = dynatracev1alpha1.ReasonPodsNotReady
+	}
+	return cond
+}
+
+func progressingCondition(instance *dynatracev1alpha1.OneAgent, statuses []dynatracev1alpha1.OneAgentNodeGroupStatus) metav1.Condition {
+	if isRolloutInProgress(instance) {
+		rs := instance.Status.Rollout
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.ProgressingConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonVersionRollingOut,
+			Message: fmt.Sprintf("Rolling out version %s, %d nodes updated", rs.TargetVersion, len(rs.UpdatedNodes)),
+		}
+	}
+
+	var updated, desired int32
+	for _, sts := range statuses {
+		updated += sts.UpdatedNumberScheduled
+		desired += sts.DesiredNumberScheduled
+	}
+
+	if updated < desired || len(statuses) < len(nodeGroups(instance)) {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.ProgressingConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonDaemonSetRollingOut,
+			Message: fmt.Sprintf("%d of %d OneAgent pods run the latest DaemonSet template", updated, desired),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    dynatracev1alpha1.ProgressingConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  dynatracev1alpha1.ReasonDeployed,
+		Message: "All OneAgent pods run the latest DaemonSet template",
+	}
+}
+
+func degradedCondition(instance *dynatracev1alpha1.OneAgent, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.DegradedConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonReconcileFailed,
+			Message: err.Error(),
+		}
+	}
+
+	if c := meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.UpdateFailedConditionType); c != nil && c.Status == metav1.ConditionTrue {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.DegradedConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  c.Reason,
+			Message: c.Message,
+		}
+	}
+
+	if rs := instance.Status.Rollout; rs != nil && rs.Phase == dynatracev1alpha1.RolloutHalted {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.DegradedConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonRolloutHalted,
+			Message: fmt.Sprintf("Rollout of version %s halted: %s", rs.TargetVersion, rs.Message),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    dynatracev1alpha1.DegradedConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  dynatracev1alpha1.ReasonAsExpected,
+		Message: "Reconciliation succeeded",
+	}
+}
+
+func upToDateCondition(instance *dynatracev1alpha1.OneAgent) metav1.Condition {
+	version, _ := currentVersion(instance)
+	if version == "" || len(instance.Status.Instances) == 0 {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.UpToDateConditionType,
+			Status:  metav1.ConditionUnknown,
+			Reason:  dynatracev1alpha1.ReasonVersionUnknown,
+			Message: "The desired version or the versions of the OneAgent instances aren't known yet",
+		}
+	}
+
+	outdated := 0
+	for _, inst := range instance.Status.Instances {
+		if inst.Version != version {
+			outdated++
+		}
+	}
+
+	if outdated > 0 {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.UpToDateConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonVersionOutdated,
+			Message: fmt.Sprintf("%d of %d OneAgent instances don't run version %s", outdated, len(instance.Status.Instances), version),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    dynatracev1alpha1.UpToDateConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonVersionUpToDate,
+		Message: fmt.Sprintf("All %d OneAgent instances run version %s", len(instance.Status.Instances), version),
+	}
+}
+
+// setIstioCondition updates the IstioConfigured condition with the result of the Istio reconciliation.
+func setIstioCondition(instance *dynatracev1alpha1.OneAgent, err error) bool {
+	if !instance.Spec.EnableIstio {
+		return utils.RemoveCondition(&instance.Status.Conditions, dynatracev1alpha1.IstioConfiguredConditionType)
+	}
+
+	if err != nil {
+		return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    dynatracev1alpha1.IstioConfiguredConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonIstioFailed,
+			Message: err.Error(),
+		})
+	}
+
+	return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.IstioConfiguredConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonIstioObjectsReady,
+		Message: "ServiceEntries and VirtualServices for the Dynatrace environment are up to date",
+	})
+}
+
+// setPullSecretCondition updates the PullSecretReady condition with the result of the pull secret reconciliation. The
+// condition is removed if the pull secret isn't managed by the Operator.
+func setPullSecretCondition(instance *dynatracev1alpha1.OneAgent, err error) bool {
+	if !instance.Status.UseImmutableImage || instance.Spec.Image != "" {
+		return utils.RemoveCondition(&instance.Status.Conditions, dynatracev1alpha1.PullSecretReadyConditionType)
+	}
+
+	if err != nil {
+		return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    dynatracev1alpha1.PullSecretReadyConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonPullSecretFailed,
+			Message: err.Error(),
+		})
+	}
+
+	return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.PullSecretReadyConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonPullSecretUpToDate,
+		Message: fmt.Sprintf("Pull secret %s is up to date", instance.Name+"-pull-secret"),
+	})
+}
+
+// setImageResolvedCondition updates the ImageResolved condition with the result of the image version lookup. The
+// condition is kept as is until the image has been looked up for the first time.
+func setImageResolvedCondition(instance *dynatracev1alpha1.OneAgent, err error) bool {
+	if !instance.Status.UseImmutableImage {
+		return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    dynatracev1alpha1.ImageResolvedConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonInstallerImage,
+			Message: "The OneAgent version is downloaded by the pods from the Dynatrace environment",
+		})
+	}
+
+	if err != nil {
+		return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    dynatracev1alpha1.ImageResolvedConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonImageVersionFailed,
+			Message: err.Error(),
+		})
+	}
+
+	if instance.Status.ImageVersion == "" {
+		return false
+	}
+
+	return utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.ImageResolvedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonImageVersionResolved,
+		Message: fmt.Sprintf("Found version %s of the OneAgent image", instance.Status.ImageVersion),
+	})
+}
@@ -0,0 +1,148 @@
+package oneagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileConditions(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.Version = "1.203.0"
+	instance.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{
+		"node1": {Version: "1.203.0"},
+		"node2": {Version: "1.202.0"},
+	}
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace},
+		Status: appsv1.DaemonSetStatus{
+			DesiredNumberScheduled: 2,
+			CurrentNumberScheduled: 2,
+			UpdatedNumberScheduled: 1,
+			NumberReady:            1,
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, ds).Build()
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	assertCondition := func(conditionType string, status metav1.ConditionStatus, reason, message string) {
+		cond := meta.FindStatusCondition(instance.Status.Conditions, conditionType)
+		if assert.NotNil(t, cond, conditionType) {
+			assert.Equal(t, status, cond.Status, conditionType)
+			assert.Equal(t, reason, cond.Reason, conditionType)
+			assert.Equal(t, message, cond.Message, conditionType)
+		}
+	}
+
+	upd, err := r.reconcileConditions(context.TODO(), instance, errors.New("failed to query for cluster ID"))
+	require.NoError(t, err)
+	assert.True(t, upd)
+
+	assertCondition(dynatracev1alpha1.AvailableConditionType, metav1.ConditionFalse, dynatracev1alpha1.ReasonPodsNotReady, "1 of 2 OneAgent pods are ready")
+	assertCondition(dynatracev1alpha1.ProgressingConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonDaemonSetRollingOut, "1 of 2 OneAgent pods run the latest DaemonSet template")
+	assertCondition(dynatracev1alpha1.DegradedConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonReconcileFailed, "failed to query for cluster ID")
+	assertCondition(dynatracev1alpha1.UpToDateConditionType, metav1.ConditionFalse, dynatracev1alpha1.ReasonVersionOutdated, "1 of 2 OneAgent instances don't run version 1.203.0")
+
+	upd, err = r.reconcileConditions(context.TODO(), instance, errors.New("failed to query for cluster ID"))
+	require.NoError(t, err)
+	assert.False(t, upd)
+
+	ds.Status.UpdatedNumberScheduled = 2
+	ds.Status.NumberReady = 2
+	require.NoError(t, c.Update(context.TODO(), ds))
+	instance.Status.Instances["node2"] = dynatracev1alpha1.OneAgentInstance{Version: "1.203.0"}
+
+	upd, err = r.reconcileConditions(context.TODO(), instance, nil)
+	require.NoError(t, err)
+	assert.True(t, upd)
+
+	assertCondition(dynatracev1alpha1.AvailableConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonPodsReady, "2 of 2 OneAgent pods are ready")
+	assertCondition(dynatracev1alpha1.ProgressingConditionType, metav1.ConditionFalse, dynatracev1alpha1.ReasonDeployed, "All OneAgent pods run the latest DaemonSet template")
+	assertCondition(dynatracev1alpha1.DegradedConditionType, metav1.ConditionFalse, dynatracev1alpha1.ReasonAsExpected, "Reconciliation succeeded")
+	assertCondition(dynatracev1alpha1.UpToDateConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonVersionUpToDate, "All 2 OneAgent instances run version 1.203.0")
+
+	// Rollouts in progress and halted ones take precedence over the DaemonSet state.
+	instance.Status.Rollout = &dynatracev1alpha1.OneAgentRolloutStatus{
+		TargetVersion: "1.204.0",
+		Phase:         dynatracev1alpha1.RolloutProgressing,
+		UpdatedNodes:  []string{"node1"},
+	}
+	_, err = r.reconcileConditions(context.TODO(), instance, nil)
+	require.NoError(t, err)
+	assertCondition(dynatracev1alpha1.ProgressingConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonVersionRollingOut, "Rolling out version 1.204.0, 1 nodes updated")
+
+	instance.Status.Rollout.Phase = dynatracev1alpha1.RolloutHalted
+	instance.Status.Rollout.Message = "pod on node node1 didn't get ready"
+	_, err = r.reconcileConditions(context.TODO(), instance, nil)
+	require.NoError(t, err)
+	assertCondition(dynatracev1alpha1.ProgressingConditionType, metav1.ConditionFalse, dynatracev1alpha1.ReasonDeployed, "All OneAgent pods run the latest DaemonSet template")
+	assertCondition(dynatracev1alpha1.DegradedConditionType, metav1.ConditionTrue, dynatracev1alpha1.ReasonRolloutHalted, "Rollout of version 1.204.0 halted: pod on node node1 didn't get ready")
+}
+
+func TestReconcileConditions_DaemonSetMissing(t *testing.T) {
+	instance := newOneAgent()
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance).Build()
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	_, err := r.reconcileConditions(context.TODO(), instance, nil)
+	require.NoError(t, err)
+
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, dynatracev1alpha1.AvailableConditionType))
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, dynatracev1alpha1.ProgressingConditionType))
+
+	cond := meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.UpToDateConditionType)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, metav1.ConditionUnknown, cond.Status)
+		assert.Equal(t, dynatracev1alpha1.ReasonVersionUnknown, cond.Reason)
+	}
+}
+
+func TestSetImageResolvedCondition(t *testing.T) {
+	instance := newOneAgent()
+
+	assert.True(t, setImageResolvedCondition(instance, nil))
+	assert.Equal(t, dynatracev1alpha1.ReasonInstallerImage, meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.ImageResolvedConditionType).Reason)
+
+	// Not looked up yet.
+	instance.Status.UseImmutableImage = true
+	assert.False(t, setImageResolvedCondition(instance, nil))
+
+	assert.True(t, setImageResolvedCondition(instance, errors.New("unauthorized")))
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, dynatracev1alpha1.ImageResolvedConditionType))
+
+	instance.Status.ImageVersion = "1.203.0"
+	assert.True(t, setImageResolvedCondition(instance, nil))
+	cond := meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.ImageResolvedConditionType)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "Found version 1.203.0 of the OneAgent image", cond.Message)
+}
+
+func TestSetPullSecretCondition(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.UseImmutableImage = true
+
+	assert.True(t, setPullSecretCondition(instance, errors.New("failed to query tokens")))
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, dynatracev1alpha1.PullSecretReadyConditionType))
+
+	assert.True(t, setPullSecretCondition(instance, nil))
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, dynatracev1alpha1.PullSecretReadyConditionType))
+	assert.False(t, setPullSecretCondition(instance, nil))
+
+	// The condition is removed with custom images, where the Operator doesn't manage the pull secret.
+	instance.Spec.Image = "registry.example.com/oneagent:latest"
+	assert.True(t, setPullSecretCondition(instance, nil))
+	assert.Nil(t, meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.PullSecretReadyConditionType))
+}
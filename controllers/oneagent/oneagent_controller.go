@@ -8,12 +8,14 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/istio"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -22,6 +24,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -34,6 +37,10 @@ import (
 
 // time between consecutive queries for a new pod to get ready
 const splayTimeSeconds = uint16(10)
+
+// number of times a pod gets deleted on a node when it doesn't get ready within WaitReadySeconds
+const maxRestartAttempts = int32(3)
+
 const annotationImageVersion = "internal.oneagent.dynatrace.com/image-version"
 const annotationTemplateHash = "internal.oneagent.dynatrace.com/template-hash"
 const defaultUpdateInterval = 15 * time.Minute
@@ -42,6 +49,18 @@ const imageProbeInterval = 15 * time.Minute
 const oneagentDockerImage = "docker.io/dynatrace/oneagent:latest"
 const oneagentRedhatImage = "registry.connect.redhat.com/dynatrace/oneagent:latest"
 
+// Reasons of the events recorded on OneAgent objects, in addition to the token condition reasons.
+const (
+	eventDaemonSetCreated  = "DaemonSetCreated"
+	eventDaemonSetUpdated  = "DaemonSetUpdated"
+	eventVersionChanged    = "VersionChanged"
+	eventPodRestarted      = "PodRestarted"
+	eventPodNotReady       = "PodNotReady"
+	eventValidationFailed  = "ValidationFailed"
+	eventValidationWarning = "ValidationWarning"
+	eventDriftDetected     = "DriftDetected"
+)
+
 // Add creates a new OneAgent Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager, _ string) error {
@@ -51,23 +70,26 @@ func Add(mgr manager.Manager, _ string) error {
 		mgr.GetScheme(),
 		mgr.GetConfig(),
 		log.Log.WithName("oneagent.controller"),
+		mgr.GetEventRecorderFor("dynatrace-oneagent-operator"),
 		utils.BuildDynatraceClient))
 }
 
 // NewOneAgentReconciler initializes a new ReconcileOneAgent instance
 func NewOneAgentReconciler(client client.Client, apiReader client.Reader, scheme *runtime.Scheme, config *rest.Config, logger logr.Logger,
-	dtcFunc utils.DynatraceClientFunc) *ReconcileOneAgent {
+	recorder record.EventRecorder, dtcFunc utils.DynatraceClientFunc) *ReconcileOneAgent {
 	return &ReconcileOneAgent{
 		client:    client,
 		apiReader: apiReader,
 		scheme:    scheme,
 		config:    config,
 		logger:    logger,
+		recorder:  recorder,
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			DynatraceClientFunc: dtcFunc,
 			Client:              client,
 			UpdatePaaSToken:     true,
 			UpdateAPIToken:      true,
+			Recorder:            recorder,
 		},
 		istioController: istio.NewController(config, scheme),
 	}
@@ -96,6 +118,25 @@ func add(mgr manager.Manager, r *ReconcileOneAgent) error {
 		return err
 	}
 
+	// Watch for changes to token secrets and requeue the OneAgents using them, to apply rotated tokens right away
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		var oaList dynatracev1alpha1.OneAgentList
+		if err := mgr.GetClient().List(context.TODO(), &oaList, client.InNamespace(obj.GetNamespace())); err != nil {
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range oaList.Items {
+			if utils.GetTokensName(&oaList.Items[i]) == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&oaList.Items[i])})
+			}
+		}
+		return requests
+	}))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -108,6 +149,10 @@ type ReconcileOneAgent struct {
 	scheme    *runtime.Scheme
 	config    *rest.Config
 	logger    logr.Logger
+	recorder  record.EventRecorder
+
+	// operatorImage is the image of the Operator pod, queried when first needed
+	operatorImage string
 
 	dtcReconciler   *utils.DynatraceClientReconciler
 	istioController *istio.Controller
@@ -128,16 +173,29 @@ func (r *ReconcileOneAgent) Reconcile(ctx context.Context, request reconcile.Req
 	// the OneAgent object is returned from the cache, but it has already been modified on the cluster side
 	if err := r.apiReader.Get(ctx, request.NamespacedName, instance); k8serrors.IsNotFound(err) {
 		// Request object not dsActual, could have been deleted after reconcile request.
-		// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+		// Owned objects are automatically garbage collected, the rest is removed by the cleanup finalizer.
 		// Return and don't requeue
+		metrics.SetAgentVersions(request.Namespace, request.Name, nil)
 		return reconcile.Result{}, nil
 	} else if err != nil {
 		return reconcile.Result{}, err
 	}
 
+	if deleted, err := utils.ReconcileCleanupFinalizer(ctx, r.client, r.recorder, instance, func(ctx context.Context) error {
+		return r.cleanup(ctx, logger, instance)
+	}); deleted || err != nil {
+		return reconcile.Result{}, err
+	}
+
 	rec := reconciliation{log: logger, instance: instance, requeueAfter: 30 * time.Minute}
 	r.reconcileImpl(ctx, &rec)
 
+	if upd, err := r.reconcileConditions(ctx, instance, rec.err); err != nil {
+		logger.Info("failed to determine status conditions", "error", err)
+	} else {
+		rec.Update(upd, rec.requeueAfter, "Status conditions updated")
+	}
+
 	if rec.err != nil {
 		if rec.update || instance.GetOneAgentStatus().SetPhaseOnError(rec.err) {
 			if errClient := r.updateCR(ctx, instance); errClient != nil {
@@ -198,17 +256,44 @@ func (rec *reconciliation) Update(upd bool, d time.Duration, cause string) bool
 
 func (r *ReconcileOneAgent) reconcileImpl(ctx context.Context, rec *reconciliation) {
 	if err := validate(rec.instance); rec.Error(err) {
+		r.recorder.Event(rec.instance, corev1.EventTypeWarning, eventValidationFailed, err.Error())
+		return
+	}
+
+	// Settings only rejected for new objects are still accepted here, so that existing objects keep working.
+	if errs := ValidateNewOneAgent(rec.instance); len(errs) > 0 {
+		r.recorder.Event(rec.instance, corev1.EventTypeWarning, eventValidationWarning, errs.ToAggregate().Error())
+	}
+
+	nextWindow, upd, err := reconcileMaintenanceWindow(rec.instance, time.Now())
+	rec.Update(upd, 5*time.Minute, "Maintenance window condition updated")
+	if rec.Error(err) {
 		return
 	}
 
-	dtc, upd, err := r.dtcReconciler.Reconcile(ctx, rec.instance)
+	if !nextWindow.IsZero() {
+		// Make sure that deferred changes get applied once the next maintenance window opens.
+		defer func() {
+			d := time.Until(nextWindow)
+			if d < time.Second {
+				d = time.Second
+			}
+			if d < rec.requeueAfter {
+				rec.requeueAfter = d
+			}
+		}()
+	}
+
+	dtc, tkns, upd, err := r.dtcReconciler.Reconcile(ctx, rec.instance)
 	rec.Update(upd, 5*time.Minute, "Token conditions updated")
 	if rec.Error(err) {
 		return
 	}
 
 	if rec.instance.GetOneAgentSpec().EnableIstio {
-		if upd, err := r.istioController.ReconcileIstio(rec.instance, dtc); err != nil {
+		upd, err := r.istioController.ReconcileIstio(ctx, rec.instance, dtc)
+		rec.Update(setIstioCondition(rec.instance, err), 5*time.Minute, "Istio condition updated")
+		if err != nil {
 			// If there are errors log them, but move on.
 			rec.log.Info("Istio: failed to reconcile objects", "error", err)
 		} else if upd {
@@ -216,19 +301,37 @@ func (r *ReconcileOneAgent) reconcileImpl(ctx context.Context, rec *reconciliati
 			rec.requeueAfter = 30 * time.Second
 			return
 		}
+	} else {
+		rec.Update(setIstioCondition(rec.instance, nil), 5*time.Minute, "Istio condition removed")
 	}
 
 	rec.Update(utils.SetUseImmutableImageStatus(rec.instance), 5*time.Minute, "UseImmutableImage changed")
 
-	upd, err = r.reconcileImageVersion(ctx, rec.instance, rec.log)
+	upd, err = r.reconcileImageVersion(ctx, rec.instance, dtc, rec.log)
 	rec.Update(upd, 5*time.Minute, "ImageVersion updated")
+	rec.Update(setImageResolvedCondition(rec.instance, err), 5*time.Minute, "Image condition updated")
 	rec.Error(err)
 
 	if rec.instance.GetOneAgentStatus().UseImmutableImage && rec.instance.GetOneAgentSpec().Image == "" {
-		err = r.reconcilePullSecret(ctx, rec.instance, rec.log)
+		err = r.reconcilePullSecret(ctx, rec.instance, tkns, rec.log)
+		rec.Update(setPullSecretCondition(rec.instance, err), 5*time.Minute, "Pull secret condition updated")
 		if rec.Error(err) {
 			return
 		}
+	} else {
+		rec.Update(setPullSecretCondition(rec.instance, nil), 5*time.Minute, "Pull secret condition removed")
+	}
+
+	if !rec.instance.GetOneAgentStatus().UseImmutableImage && !utils.UsesTokensSecret(rec.instance) {
+		if rec.Error(r.reconcileInstallerTokenSecret(ctx, rec.instance, tkns, rec.log)) {
+			return
+		}
+	}
+
+	upd, err = r.reconcileVersionHealth(ctx, rec.log, rec.instance, dtc)
+	rec.Update(upd, 5*time.Minute, "Version health reconciled")
+	if rec.Error(err) {
+		return
 	}
 
 	upd, err = r.reconcileRollout(ctx, rec.log, rec.instance, dtc)
@@ -236,6 +339,11 @@ func (r *ReconcileOneAgent) reconcileImpl(ctx context.Context, rec *reconciliati
 		return
 	}
 
+	upd, err = r.reconcileConfigChanges(ctx, rec.log, rec.instance, dtc)
+	if rec.Error(err) || rec.Update(upd, 5*time.Minute, "Config changes reconciled") {
+		return
+	}
+
 	now := metav1.Now()
 	updInterval := defaultUpdateInterval
 	if val := os.Getenv(updateEnvVar); val != "" {
@@ -247,7 +355,8 @@ func (r *ReconcileOneAgent) reconcileImpl(ctx context.Context, rec *reconciliati
 		}
 	}
 
-	if rec.instance.Status.LastUpdateProbeTimestamp == nil || rec.instance.Status.LastUpdateProbeTimestamp.Add(updInterval).Before(now.Time) {
+	probeDue := rec.instance.Status.LastUpdateProbeTimestamp == nil || rec.instance.Status.LastUpdateProbeTimestamp.Add(updInterval).Before(now.Time)
+	if probeDue {
 		rec.instance.Status.LastUpdateProbeTimestamp = &now
 		rec.Update(true, 5*time.Minute, "updated last update time stamp")
 
@@ -260,59 +369,56 @@ func (r *ReconcileOneAgent) reconcileImpl(ctx context.Context, rec *reconciliati
 			rec.log.Info("Automatic oneagent update is disabled")
 			return
 		}
+	}
 
+	// Staged rollouts continue on every reconciliation until done, not only when the update probe is due. This includes
+	// the one back to the last known good version after a rollback with OnDelete updates.
+	if probeDue || ((isRolloutInProgress(rec.instance) || isRollbackRolloutPending(rec.instance)) && !rec.instance.GetOneAgentSpec().DisableAgentUpdate) {
 		upd, err = r.reconcileVersion(ctx, rec.log, rec.instance, dtc)
-		if rec.Error(err) || rec.Update(upd, 5*time.Minute, "Versions reconciled") {
+
+		requeueAfter := 5 * time.Minute
+		if isRolloutInProgress(rec.instance) && (isInMaintenanceWindow(rec.instance) || isRolledBack(rec.instance) || rec.instance.Status.Rollout.Restart != nil) {
+			requeueAfter = rolloutRequeueAfter(rec.instance, now.Time)
+			rec.requeueAfter = requeueAfter
+		}
+
+		if rec.Error(err) || rec.Update(upd, requeueAfter, "Versions reconciled") {
 			return
 		}
 	}
 
 	// Finally we have to determine the correct non error phase
-	if upd, err = r.determineOneAgentPhase(rec.instance); !rec.Error(err) {
+	if upd, err = r.determineOneAgentPhase(ctx, rec.instance); !rec.Error(err) {
 		rec.Update(upd, 5*time.Minute, "Phase change")
 	}
 }
 
 func (r *ReconcileOneAgent) reconcileRollout(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client) (bool, error) {
-	updateCR := false
+	// Changed DaemonSets are tracked on the status until their pods have been updated, see reconcileConfigChanges.
+	pendingConfigChanges := len(instance.Status.PendingConfigChanges)
 
 	var kubeSystemNS corev1.Namespace
 	if err := r.client.Get(ctx, client.ObjectKey{Name: "kube-system"}, &kubeSystemNS); err != nil {
 		return false, fmt.Errorf("failed to query for cluster ID: %w", err)
 	}
 
-	// Define a new DaemonSet object
-	dsDesired, err := newDaemonSetBuilder(logger, instance, string(kubeSystemNS.UID)).newDaemonSetForCR()
-	if err != nil {
+	// DaemonSets of removed node groups are deleted first, so that their pods don't overlap with the ones of new groups.
+	if err := r.deleteStaleDaemonSets(ctx, logger, instance); err != nil {
 		return false, err
 	}
 
-	// Set OneAgent instance as the owner and controller
-	if err := controllerutil.SetControllerReference(instance, dsDesired, r.scheme); err != nil {
-		return false, err
-	}
-
-	// Check if this DaemonSet already exists
-	dsActual := &appsv1.DaemonSet{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: dsDesired.Name, Namespace: dsDesired.Namespace}, dsActual)
-	if err != nil && k8serrors.IsNotFound(err) {
-		logger.Info("Creating new daemonset")
-		if err = r.client.Create(ctx, dsDesired); err != nil {
-			return false, err
-		}
-	} else if err != nil {
-		return false, err
-	} else if hasDaemonSetChanged(dsDesired, dsActual) {
-		logger.Info("Updating existing daemonset")
-		if err = r.client.Update(ctx, dsDesired); err != nil {
+	for _, group := range nodeGroups(instance) {
+		if err := r.reconcileDaemonSet(ctx, logger, instance, dtc, group, string(kubeSystemNS.UID)); err != nil {
 			return false, err
 		}
 	}
 
+	updateCR := len(instance.Status.PendingConfigChanges) != pendingConfigChanges
+
 	if instance.GetOneAgentStatus().Version == "" {
-		if instance.GetOneAgentStatus().UseImmutableImage && instance.GetOneAgentSpec().Image == "" {
+		if instance.GetOneAgentStatus().UseImmutableImage && instance.GetOneAgentSpec().Image == "" && !hasVersionPolicy(instance) {
 			if instance.GetOneAgentSpec().AgentVersion == "" {
-				latest, err := dtc.GetLatestAgentVersion(dtclient.OsUnix, dtclient.InstallerTypeDefault)
+				latest, err := dtc.GetLatestAgentVersion(ctx, dtclient.OsUnix, dtclient.InstallerTypeDefault)
 				if err != nil {
 					return false, fmt.Errorf("failed to get desired version: %w", err)
 				}
@@ -321,7 +427,7 @@ func (r *ReconcileOneAgent) reconcileRollout(ctx context.Context, logger logr.Lo
 				instance.GetOneAgentStatus().Version = instance.GetOneAgentSpec().AgentVersion
 			}
 		} else {
-			desired, err := dtc.GetLatestAgentVersion(dtclient.OsUnix, dtclient.InstallerTypeDefault)
+			desired, err := resolveDesiredVersion(ctx, logger, instance, dtc, "")
 			if err != nil {
 				return false, fmt.Errorf("failed to get desired version: %w", err)
 			}
@@ -342,7 +448,83 @@ func (r *ReconcileOneAgent) reconcileRollout(ctx context.Context, logger logr.Lo
 	return updateCR, nil
 }
 
-func (r *ReconcileOneAgent) reconcileImageVersion(ctx context.Context, instance *dynatracev1alpha1.OneAgent, log logr.Logger) (bool, error) {
+// reconcileDaemonSet creates or updates the DaemonSet for the node group, or the default one if group is nil.
+func (r *ReconcileOneAgent) reconcileDaemonSet(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, group *dynatracev1alpha1.OneAgentNodeGroup, clusterID string) error {
+	// Define a new DaemonSet object
+	var err error
+	builder := newDaemonSetBuilder(logger, instance, clusterID)
+	builder.nodeGroup = group
+	if hasHostMetadataTemplates(instance) {
+		if builder.operatorImage, err = r.getOperatorImage(ctx); err != nil {
+			return fmt.Errorf("failed to determine image for host metadata init step: %w", err)
+		}
+	}
+	dsDesired, err := builder.newDaemonSetForCR()
+	if err != nil {
+		return err
+	}
+
+	// Set OneAgent instance as the owner and controller
+	if err := controllerutil.SetControllerReference(instance, dsDesired, r.scheme); err != nil {
+		return err
+	}
+
+	logger = logger.WithValues("daemonset", dsDesired.Name)
+
+	// Check if this DaemonSet already exists
+	dsActual := &appsv1.DaemonSet{}
+	err = r.client.Get(ctx, types.NamespacedName{Name: dsDesired.Name, Namespace: dsDesired.Namespace}, dsActual)
+	if err != nil && k8serrors.IsNotFound(err) {
+		logger.Info("Creating new daemonset")
+		if err = utils.Apply(ctx, r.client, dsDesired, utils.OperatorFieldManager, logger); err != nil {
+			return err
+		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventDaemonSetCreated, "Created DaemonSet %s", dsDesired.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	changed := hasDaemonSetChanged(dsDesired, dsActual)
+	drift, err := findDrift(dsDesired, dsActual)
+	if err != nil {
+		return err
+	}
+
+	if !changed && len(drift) == 0 {
+		return nil
+	} else if !isInMaintenanceWindow(instance) && !isRolledBack(instance) {
+		// Rollbacks are applied right away, since the failed version is already disrupting the nodes.
+		logger.Info("Daemonset changed, update deferred until next maintenance window")
+		return nil
+	}
+
+	if changed {
+		logger.Info("Updating existing daemonset")
+	} else {
+		logger.Info("Daemonset edited out of band, restoring desired state", "fields", drift)
+	}
+
+	if err = utils.Apply(ctx, r.client, dsDesired, utils.OperatorFieldManager, logger); err != nil {
+		return err
+	}
+
+	if changed {
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventDaemonSetUpdated, "Updated DaemonSet %s", dsDesired.Name)
+		r.sendDaemonSetEvent(ctx, logger, instance, dtc, dsDesired, fmt.Sprintf("OneAgent DaemonSet %s updated by the OneAgent Operator.", dsDesired.Name))
+	} else {
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, eventDriftDetected, "Restored DaemonSet %s edited out of band, changed fields: %s",
+			dsDesired.Name, strings.Join(drift, ", "))
+		r.sendDaemonSetEvent(ctx, logger, instance, dtc, dsDesired, fmt.Sprintf("OneAgent DaemonSet %s edited out of band, restored by the OneAgent Operator. Changed fields: %s.",
+			dsDesired.Name, strings.Join(drift, ", ")))
+	}
+	addPendingConfigChange(instance, dsDesired.Name)
+
+	return nil
+}
+
+func (r *ReconcileOneAgent) reconcileImageVersion(ctx context.Context, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, log logr.Logger) (bool, error) {
+	// Images are also probed outside of maintenance windows, only the DaemonSet update is deferred.
 	if !instance.Status.UseImmutableImage || instance.Spec.DisableAgentUpdate {
 		return false, nil
 	}
@@ -354,14 +536,22 @@ func (r *ReconcileOneAgent) reconcileImageVersion(ctx context.Context, instance
 
 	var err error
 
+	instance.Status.LastImageVersionProbeTimestamp = &now
+
 	image := instance.Spec.Image
 	if image == "" {
-		if image, err = utils.BuildOneAgentImage(instance.Spec.APIURL, instance.Spec.AgentVersion); err != nil {
-			return false, err
+		if hasVersionPolicy(instance) {
+			desired, err := resolveDesiredVersion(ctx, log, instance, dtc, instance.Status.ImageVersion)
+			if err != nil {
+				return true, fmt.Errorf("failed to get desired version: %w", err)
+			}
+			instance.Status.Version = desired
 		}
-	}
 
-	instance.Status.LastImageVersionProbeTimestamp = &now
+		if image, err = utils.BuildOneAgentImage(instance.Spec.APIURL, imageTag(instance)); err != nil {
+			return true, err
+		}
+	}
 
 	psName := instance.Name + "-pull-secret"
 	if instance.Spec.CustomPullSecret != "" {
@@ -384,7 +574,9 @@ func (r *ReconcileOneAgent) reconcileImageVersion(ctx context.Context, instance
 	}
 
 	oldVersion := instance.Status.ImageVersion
-	if ver.Version != oldVersion && (oldVersion == "" || isDesiredNewer(oldVersion, ver.Version, log)) {
+	if ver.Version == instance.Status.FailedVersion {
+		log.Info("image version failed health checks, waiting for a new version", "version", ver.Version)
+	} else if ver.Version != oldVersion && (oldVersion == "" || isDowngradeAllowed(instance) || isDesiredNewer(oldVersion, ver.Version, log)) {
 		log.Info("image update found",
 			"oldHash", instance.Status.ImageHash,
 			"newHash", ver.Hash,
@@ -394,21 +586,30 @@ func (r *ReconcileOneAgent) reconcileImageVersion(ctx context.Context, instance
 		// Only update hash in case of version changes.
 		instance.Status.ImageHash = ver.Hash
 		instance.Status.ImageVersion = ver.Version
+		instance.Status.FailedVersion = ""
 	}
 
 	return true, nil
 }
 
-func (r *ReconcileOneAgent) reconcilePullSecret(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent, log logr.Logger) error {
-	var tkns corev1.Secret
-	if err := r.client.Get(ctx, client.ObjectKey{Name: utils.GetTokensName(instance), Namespace: instance.GetNamespace()}, &tkns); err != nil {
-		return fmt.Errorf("failed to query tokens: %w", err)
-	}
-	pullSecretData, err := utils.GeneratePullSecretData(r.client, instance, &tkns)
+func (r *ReconcileOneAgent) reconcilePullSecret(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent, tkns utils.Tokens, log logr.Logger) error {
+	pullSecretData, err := utils.GeneratePullSecretData(ctx, r.client, instance, tkns)
 	if err != nil {
 		return fmt.Errorf("failed to generate pull secret data: %w", err)
 	}
-	err = utils.CreateOrUpdateSecretIfNotExists(r.client, r.client, instance.GetName()+"-pull-secret", instance.GetNamespace(), pullSecretData, corev1.SecretTypeDockerConfigJson, log)
+	_, err = utils.CreateOrUpdateSecretIfNotExists(ctx, r.client, r.client, instance.GetName()+"-pull-secret", instance.GetNamespace(), pullSecretData, corev1.SecretTypeDockerConfigJson, log)
+	if err != nil {
+		return fmt.Errorf("failed to create or update secret: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileInstallerTokenSecret keeps a copy of the PaaS token for the installer, if the tokens aren't read from a
+// secret which the DaemonSets can reference.
+func (r *ReconcileOneAgent) reconcileInstallerTokenSecret(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent, tkns utils.Tokens, log logr.Logger) error {
+	data := map[string][]byte{utils.DynatracePaasToken: []byte(tkns[utils.DynatracePaasToken])}
+	_, err := utils.CreateOrUpdateSecretIfNotExists(ctx, r.client, r.client, getInstallerTokenName(instance), instance.GetNamespace(), data, corev1.SecretTypeOpaque, log)
 	if err != nil {
 		return fmt.Errorf("failed to create or update secret: %w", err)
 	}
@@ -416,6 +617,14 @@ func (r *ReconcileOneAgent) reconcilePullSecret(ctx context.Context, instance dy
 	return nil
 }
 
+// getInstallerTokenName returns the name of the secret with the PaaS token used by the installer on the DaemonSets.
+func getInstallerTokenName(instance dynatracev1alpha1.BaseOneAgent) string {
+	if utils.UsesTokensSecret(instance) {
+		return utils.GetTokensName(instance)
+	}
+	return instance.GetName() + "-installer-token"
+}
+
 func (r *ReconcileOneAgent) getPods(ctx context.Context, instance *dynatracev1alpha1.OneAgent) ([]corev1.Pod, []client.ListOption, error) {
 	podList := &corev1.PodList{}
 	listOps := []client.ListOption{
@@ -437,13 +646,19 @@ func (r *ReconcileOneAgent) reconcileInstanceStatuses(ctx context.Context, logge
 		handlePodListError(logger, err, listOpts)
 	}
 
-	instanceStatuses, err := getInstanceStatuses(pods, dtc, instance)
+	instanceStatuses, err := getInstanceStatuses(ctx, pods, dtc, instance)
 	if err != nil {
 		if instanceStatuses == nil || len(instanceStatuses) <= 0 {
 			return false, err
 		}
 	}
 
+	versions := make(map[string]metrics.NodeVersion, len(instanceStatuses))
+	for node, st := range instanceStatuses {
+		versions[node] = metrics.NodeVersion{Desired: instance.Status.Version, Actual: st.Version}
+	}
+	metrics.SetAgentVersions(instance.Namespace, instance.Name, versions)
+
 	if instance.GetOneAgentStatus().Instances == nil || !reflect.DeepEqual(instance.GetOneAgentStatus().Instances, instanceStatuses) {
 		instance.GetOneAgentStatus().Instances = instanceStatuses
 		return true, err
@@ -452,22 +667,46 @@ func (r *ReconcileOneAgent) reconcileInstanceStatuses(ctx context.Context, logge
 	return false, err
 }
 
-func getInstanceStatuses(pods []corev1.Pod, dtc dtclient.Client, instance *dynatracev1alpha1.OneAgent) (map[string]dynatracev1alpha1.OneAgentInstance, error) {
+// getInstanceStatuses returns the state of the OneAgent pods, and of the hosts they run on as seen by Dynatrace, by
+// node.
+func getInstanceStatuses(ctx context.Context, pods []corev1.Pod, dtc dtclient.Client, instance *dynatracev1alpha1.OneAgent) (map[string]dynatracev1alpha1.OneAgentInstance, error) {
 	instanceStatuses := make(map[string]dynatracev1alpha1.OneAgentInstance)
+	desired, _ := currentVersion(instance)
 
 	for _, pod := range pods {
 		instanceStatus := dynatracev1alpha1.OneAgentInstance{
 			PodName:   pod.Name,
 			IPAddress: pod.Status.HostIP,
+			PodPhase:  pod.Status.Phase,
+			Ready:     len(pod.Status.ContainerStatuses) > 0 && getPodReadyState(&pod),
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			instanceStatus.RestartCount += cs.RestartCount
+			if t := cs.LastTerminationState.Terminated; t != nil && instanceStatus.LastRestartReason == "" {
+				instanceStatus.LastRestartReason = t.Reason
+			}
 		}
-		ver, err := dtc.GetAgentVersionForIP(pod.Status.HostIP)
+
+		host, err := dtc.GetHostInfoForIP(ctx, pod.Status.HostIP)
 		if err != nil {
 			if err = handleAgentVersionForIPError(err, instance, pod, &instanceStatus); err != nil {
 				return instanceStatuses, err
 			}
 		} else {
-			instanceStatus.Version = ver
+			instanceStatus.Version = host.AgentVersion
+			if i, ok := instance.Status.Instances[pod.Spec.NodeName]; ok && host.AgentVersion == "" {
+				// use last known version if available
+				instanceStatus.Version = i.Version
+			}
+			instanceStatus.EntityID = host.EntityID
+			instanceStatus.NetworkZone = host.NetworkZone
+			if !host.LastSeen.IsZero() {
+				lastSeen := metav1.NewTime(host.LastSeen)
+				instanceStatus.LastSeenTimestamp = &lastSeen
+			}
 		}
+
+		instanceStatus.Outdated = desired != "" && instanceStatus.Version != "" && instanceStatus.Version != desired
 		instanceStatuses[pod.Spec.NodeName] = instanceStatus
 	}
 	return instanceStatuses, nil
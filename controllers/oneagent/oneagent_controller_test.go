@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -68,15 +69,16 @@ func TestReconcileOneAgent_ReconcileOnEmptyEnvironmentAndDNSPolicy(t *testing.T)
 
 	dtClient := &dtclient.MockDynatraceClient{}
 	dtClient.On("GetLatestAgentVersion", "unix", "default").Return("42", nil)
-	dtClient.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}, nil)
-	dtClient.On("GetTokenScopes", "84").Return(dtclient.TokenScopes{dtclient.TokenScopeDataExport}, nil)
+	dtClient.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+	dtClient.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
 	dtClient.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
 
 	reconciler := &ReconcileOneAgent{
-		client:    fakeClient,
+		client:    utils.FakeApplyClient{Client: fakeClient},
 		apiReader: fakeClient,
 		scheme:    scheme.Scheme,
 		logger:    consoleLogger,
+		recorder:  &record.FakeRecorder{},
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              fakeClient,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtClient),
@@ -97,6 +99,70 @@ func TestReconcileOneAgent_ReconcileOnEmptyEnvironmentAndDNSPolicy(t *testing.T)
 	mock.AssertExpectationsForObjects(t, dtClient)
 }
 
+func TestReconcileOneAgent_ExistingObjectWithMalformedAgentVersion(t *testing.T) {
+	namespace := "dynatrace"
+	oaName := "oneagent"
+
+	// Earlier versions of the Operator accepted any agentVersion, existing objects keep being reconciled.
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			&dynatracev1alpha1.OneAgent{
+				ObjectMeta: metav1.ObjectMeta{Name: oaName, Namespace: namespace},
+				Spec: dynatracev1alpha1.OneAgentSpec{
+					BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+						APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+						Tokens: oaName,
+					},
+					AgentVersion: "latest",
+				},
+			},
+			NewSecret(oaName, namespace, map[string]string{utils.DynatracePaasToken: "42", utils.DynatraceApiToken: "84"}),
+			sampleKubeSystemNS,
+		).
+		Build()
+
+	dtClient := &dtclient.MockDynatraceClient{}
+	dtClient.On("GetLatestAgentVersion", "unix", "default").Return("42", nil)
+	dtClient.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+	dtClient.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
+	dtClient.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &ReconcileOneAgent{
+		client:    utils.FakeApplyClient{Client: fakeClient},
+		apiReader: fakeClient,
+		scheme:    scheme.Scheme,
+		logger:    consoleLogger,
+		recorder:  recorder,
+		dtcReconciler: &utils.DynatraceClientReconciler{
+			Client:              fakeClient,
+			DynatraceClientFunc: utils.StaticDynatraceClient(dtClient),
+			UpdatePaaSToken:     true,
+			UpdateAPIToken:      true,
+		},
+	}
+
+	_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: oaName, Namespace: namespace}})
+	assert.NoError(t, err)
+
+	var ds appsv1.DaemonSet
+	assert.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Name: oaName, Namespace: namespace}, &ds))
+
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	if assert.NotEmpty(t, events) {
+		assert.Contains(t, events[0], "Warning "+eventValidationWarning)
+		assert.Contains(t, events[0], `spec.agentVersion: Invalid value: "latest"`)
+	}
+	for _, e := range events {
+		assert.NotContains(t, e, eventValidationFailed)
+	}
+}
+
 func TestReconcile_PhaseSetCorrectly(t *testing.T) {
 	namespace := "dynatrace"
 	oaName := "oneagent"
@@ -150,10 +216,11 @@ func TestReconcile_PhaseSetCorrectly(t *testing.T) {
 	dtcMock.On("GetLatestAgentVersion", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return(version, nil)
 
 	reconciler := &ReconcileOneAgent{
-		client:    c,
+		client:    utils.FakeApplyClient{Client: c},
 		apiReader: c,
 		scheme:    scheme.Scheme,
 		logger:    consoleLogger,
+		recorder:  &record.FakeRecorder{},
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              c,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtcMock),
@@ -229,10 +296,11 @@ func TestReconcile_TokensSetCorrectly(t *testing.T) {
 	dtcMock.On("GetLatestAgentVersion", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return(version, nil)
 
 	reconciler := &ReconcileOneAgent{
-		client:    c,
+		client:    utils.FakeApplyClient{Client: c},
 		apiReader: c,
 		scheme:    scheme.Scheme,
 		logger:    consoleLogger,
+		recorder:  &record.FakeRecorder{},
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              c,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtcMock),
@@ -279,10 +347,11 @@ func TestReconcile_TokensSetCorrectly(t *testing.T) {
 			Build()
 
 		reconciler := &ReconcileOneAgent{
-			client:    c,
+			client:    utils.FakeApplyClient{Client: c},
 			apiReader: c,
 			scheme:    scheme.Scheme,
 			logger:    consoleLogger,
+			recorder:  &record.FakeRecorder{},
 			dtcReconciler: &utils.DynatraceClientReconciler{
 				Client:              c,
 				DynatraceClientFunc: utils.StaticDynatraceClient(dtcMock),
@@ -333,15 +402,16 @@ func TestReconcile_InstancesSet(t *testing.T) {
 	oldVersion := "1.186"
 	hostIP := "1.2.3.4"
 	dtcMock.On("GetLatestAgentVersion", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return(version, nil)
-	dtcMock.On("GetAgentVersionForIP", hostIP).Return(version, nil)
-	dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{utils.DynatracePaasToken}, nil)
-	dtcMock.On("GetTokenScopes", "84").Return(dtclient.TokenScopes{utils.DynatraceApiToken}, nil)
+	dtcMock.On("GetHostInfoForIP", hostIP).Return(dtclient.HostInfo{AgentVersion: version}, nil)
+	dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{utils.DynatracePaasToken}}, nil)
+	dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{utils.DynatraceApiToken}}, nil)
 
 	reconciler := &ReconcileOneAgent{
-		client:    c,
+		client:    utils.FakeApplyClient{Client: c},
 		apiReader: c,
 		scheme:    scheme.Scheme,
 		logger:    consoleLogger,
+		recorder:  &record.FakeRecorder{},
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              c,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtcMock),
@@ -409,6 +479,75 @@ func TestReconcile_InstancesSet(t *testing.T) {
 	})
 }
 
+func TestGetInstanceStatuses(t *testing.T) {
+	lastSeen := time.Date(2021, 3, 20, 3, 30, 0, 0, time.UTC)
+
+	dtc := &dtclient.MockDynatraceClient{}
+	dtc.On("GetHostInfoForIP", "10.0.0.1").Return(dtclient.HostInfo{
+		EntityID:     "HOST-1",
+		AgentVersion: "1.202.0",
+		NetworkZone:  "zone-a",
+		LastSeen:     lastSeen,
+	}, nil)
+	dtc.On("GetHostInfoForIP", "10.0.0.2").Return(dtclient.HostInfo{}, errors.New("host not found"))
+
+	oa := newOneAgent()
+	oa.Status.Version = "1.203.0"
+	oa.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{"node2": {Version: "1.203.0"}}
+
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-1"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+			Status: corev1.PodStatus{
+				HostIP: "10.0.0.1",
+				Phase:  corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Ready:                true,
+					RestartCount:         2,
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}},
+				}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-2"},
+			Spec:       corev1.PodSpec{NodeName: "node2"},
+			Status: corev1.PodStatus{
+				HostIP:            "10.0.0.2",
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{Ready: false}},
+			},
+		},
+	}
+
+	statuses, err := getInstanceStatuses(context.TODO(), pods, dtc, oa)
+	assert.NoError(t, err)
+
+	seen := metav1.NewTime(lastSeen)
+	assert.Equal(t, map[string]dynatracev1alpha1.OneAgentInstance{
+		"node1": {
+			PodName:           "pod-1",
+			Version:           "1.202.0",
+			IPAddress:         "10.0.0.1",
+			PodPhase:          corev1.PodRunning,
+			Ready:             true,
+			RestartCount:      2,
+			LastRestartReason: "OOMKilled",
+			EntityID:          "HOST-1",
+			LastSeenTimestamp: &seen,
+			NetworkZone:       "zone-a",
+			Outdated:          true,
+		},
+		// Dynatrace doesn't see the host, so only the last known version is kept.
+		"node2": {
+			PodName:   "pod-2",
+			Version:   "1.203.0",
+			IPAddress: "10.0.0.2",
+			PodPhase:  corev1.PodPending,
+		},
+	}, statuses)
+}
+
 func NewSecret(name, namespace string, kv map[string]string) *corev1.Secret {
 	data := make(map[string][]byte)
 	for k, v := range kv {
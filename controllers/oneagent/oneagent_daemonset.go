@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"strconv"
+	"strings"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
@@ -22,6 +23,12 @@ type daemonSetBuilder struct {
 	instance   *dynatracev1alpha1.OneAgent
 	clusterID  string
 	kubeSystem *kubesystem.KubeSystem
+
+	// nodeGroup whose settings override the ones on the instance, if any
+	nodeGroup *dynatracev1alpha1.OneAgentNodeGroup
+
+	// operatorImage is used for the host metadata init step, required if any host metadata needs to be rendered
+	operatorImage string
 }
 
 func newDaemonSetBuilder(logger logr.Logger, instance *dynatracev1alpha1.OneAgent, clusterID string) *daemonSetBuilder {
@@ -41,13 +48,17 @@ func (daemonSetBuilder *daemonSetBuilder) newDaemonSetForCR() (*appsv1.DaemonSet
 		unprivileged = *ptr
 	}
 
+	if hasHostMetadataTemplates(instance) && daemonSetBuilder.operatorImage == "" {
+		return nil, fmt.Errorf("operator image is required to render host metadata templates")
+	}
+
 	podSpec := daemonSetBuilder.newPodSpecForCR(unprivileged)
-	selectorLabels := buildLabels(instance.GetName())
+	selectorLabels := buildNodeGroupLabels(instance.GetName(), daemonSetBuilder.nodeGroup)
 	mergedLabels := mergeLabels(instance.GetOneAgentSpec().Labels, selectorLabels)
 
 	ds := &appsv1.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        instance.GetName(),
+			Name:        daemonSetName(instance, daemonSetBuilder.nodeGroup),
 			Namespace:   instance.GetNamespace(),
 			Labels:      mergedLabels,
 			Annotations: map[string]string{},
@@ -72,18 +83,28 @@ func (daemonSetBuilder *daemonSetBuilder) newDaemonSetForCR() (*appsv1.DaemonSet
 		}
 	}
 
+	if usesOnDeleteUpdates(instance) {
+		ds.Spec.UpdateStrategy = appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}
+	}
+
 	dsHash, err := generateDaemonSetHash(ds)
 	if err != nil {
 		return nil, err
 	}
 	ds.Annotations[annotationTemplateHash] = dsHash
 
+	if usesOnDeleteUpdates(instance) {
+		// Lets the Operator find the pods still running a previous template, see findPodsWithOutdatedTemplate.
+		ds.Spec.Template.Annotations[annotationTemplateHash] = dsHash
+	}
+
 	return ds, nil
 }
 
 func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) corev1.PodSpec {
 	logger := daemonSetBuilder.logger
 	instance := daemonSetBuilder.instance
+	group := daemonSetBuilder.nodeGroup
 	p := corev1.PodSpec{}
 
 	sa := "dynatrace-oneagent"
@@ -93,7 +114,10 @@ func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) cor
 		sa = "dynatrace-oneagent-unprivileged"
 	}
 
-	resources := instance.GetOneAgentSpec().Resources
+	resources := *instance.GetOneAgentSpec().Resources.DeepCopy()
+	if group != nil && group.Resources != nil {
+		resources = *group.Resources.DeepCopy()
+	}
 	if resources.Requests == nil {
 		resources.Requests = corev1.ResourceList{}
 	}
@@ -102,7 +126,12 @@ func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) cor
 		resources.Requests[corev1.ResourceCPU] = *resource.NewScaledQuantity(1, -1)
 	}
 
-	args := instance.GetOneAgentSpec().Args
+	args := append([]string{}, instance.GetOneAgentSpec().Args...)
+	if group != nil {
+		args = append(args, group.Args...)
+	}
+	args = append(args, hostMetadataArgs(instance, group)...)
+
 	if instance.GetOneAgentSpec().Proxy != nil && (instance.GetOneAgentSpec().Proxy.ValueFrom != "" || instance.GetOneAgentSpec().Proxy.Value != "") {
 		args = append(args, "--set-proxy=$(https_proxy)")
 	}
@@ -117,6 +146,15 @@ func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) cor
 
 	args = append(args, "--set-host-property=OperatorVersion="+version.Version)
 
+	nodeSelector := instance.GetOneAgentSpec().NodeSelector
+	tolerations := instance.GetOneAgentSpec().Tolerations
+	if group != nil && group.NodeSelector != nil {
+		nodeSelector = group.NodeSelector
+	}
+	if group != nil && group.Tolerations != nil {
+		tolerations = group.Tolerations
+	}
+
 	// K8s 1.18+ is expected to drop the "beta.kubernetes.io" labels in favor of "kubernetes.io" which was added on K8s 1.14.
 	// To support both older and newer K8s versions we use node affinity.
 
@@ -179,10 +217,10 @@ func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) cor
 		HostNetwork:        true,
 		HostPID:            true,
 		HostIPC:            true,
-		NodeSelector:       instance.GetOneAgentSpec().NodeSelector,
+		NodeSelector:       nodeSelector,
 		PriorityClassName:  instance.GetOneAgentSpec().PriorityClassName,
 		ServiceAccountName: sa,
-		Tolerations:        instance.GetOneAgentSpec().Tolerations,
+		Tolerations:        tolerations,
 		DNSPolicy:          instance.GetOneAgentSpec().DNSPolicy,
 		Affinity: &corev1.Affinity{
 			NodeAffinity: &corev1.NodeAffinity{
@@ -223,6 +261,10 @@ func (daemonSetBuilder *daemonSetBuilder) newPodSpecForCR(unprivileged bool) cor
 		Volumes: daemonSetBuilder.prepareVolumes(),
 	}
 
+	if hasHostMetadataTemplates(instance) {
+		p.InitContainers = []corev1.Container{newHostMetadataInitContainer(instance, daemonSetBuilder.operatorImage)}
+	}
+
 	if instance.GetOneAgentStatus().UseImmutableImage {
 		err := daemonSetBuilder.preparePodSpecImmutableImage(&p)
 		if err != nil {
@@ -264,15 +306,19 @@ func (daemonSetBuilder *daemonSetBuilder) preparePodSpecImmutableImage(p *corev1
 		Name: pullSecretName,
 	})
 
-	if instance.Spec.Image != "" {
-		p.Containers[0].Image = instance.Spec.Image
-		return nil
+	i := instance.Spec.Image
+	if i == "" {
+		var err error
+		if i, err = utils.BuildOneAgentImage(instance.GetSpec().APIURL, imageTag(instance)); err != nil {
+			return err
+		}
 	}
 
-	i, err := utils.BuildOneAgentImage(instance.GetSpec().APIURL, instance.GetOneAgentSpec().AgentVersion)
-	if err != nil {
-		return err
+	// Pin the image to the last known good one, otherwise the failed version would be pulled again.
+	if isRolledBack(instance) && !strings.Contains(i, "@") {
+		i += "@" + instance.Status.LastKnownGoodImageHash
 	}
+
 	p.Containers[0].Image = i
 
 	return nil
@@ -373,7 +419,7 @@ func (daemonSetBuilder *daemonSetBuilder) prepareEnvVars() []corev1.EnvVar {
 				Default: func(ev *corev1.EnvVar) {
 					ev.ValueFrom = &corev1.EnvVarSource{
 						SecretKeyRef: &corev1.SecretKeySelector{
-							LocalObjectReference: corev1.LocalObjectReference{Name: utils.GetTokensName(instance)},
+							LocalObjectReference: corev1.LocalObjectReference{Name: getInstallerTokenName(instance)},
 							Key:                  utils.DynatracePaasToken,
 						},
 					}
@@ -382,7 +428,13 @@ func (daemonSetBuilder *daemonSetBuilder) prepareEnvVars() []corev1.EnvVar {
 			reservedEnvVar{
 				Name: "ONEAGENT_INSTALLER_SCRIPT_URL",
 				Default: func(ev *corev1.EnvVar) {
-					ev.Value = fmt.Sprintf("%s/v1/deployment/installer/agent/unix/default/latest?Api-Token=$(ONEAGENT_INSTALLER_TOKEN)&arch=x86&flavor=default", instance.GetOneAgentSpec().APIURL)
+					version := "latest"
+					if isRolledBack(instance) {
+						version = "version/" + instance.Status.LastKnownGoodVersion
+					} else if hasVersionPolicy(instance) && instance.Status.Version != "" {
+						version = "version/" + instance.Status.Version
+					}
+					ev.Value = fmt.Sprintf("%s/v1/deployment/installer/agent/unix/default/%s?Api-Token=$(ONEAGENT_INSTALLER_TOKEN)&arch=x86&flavor=default", instance.GetOneAgentSpec().APIURL, version)
 				},
 			},
 			reservedEnvVar{
@@ -419,7 +471,12 @@ func (daemonSetBuilder *daemonSetBuilder) prepareEnvVars() []corev1.EnvVar {
 	// Split defined environment variables between those reserved and the rest
 
 	instanceEnv := instance.GetOneAgentSpec().Env
+	if group := daemonSetBuilder.nodeGroup; group != nil {
+		instanceEnv = mergeEnv(instanceEnv, group.Env)
+	}
 
+	// Reserved variables set on the spec replace the ones generated. New objects can't set these anymore, see
+	// ValidateNewOneAgent, but existing ones may still do.
 	var remaining []corev1.EnvVar
 	for i := range instanceEnv {
 		if p := reservedMap[instanceEnv[i].Name]; p != nil {
@@ -454,9 +511,12 @@ func generateDaemonSetHash(ds *appsv1.DaemonSet) (string, error) {
 		return "", err
 	}
 
+	return generateHash(data)
+}
+
+func generateHash(data []byte) (string, error) {
 	hasher := fnv.New32()
-	_, err = hasher.Write(data)
-	if err != nil {
+	if _, err := hasher.Write(data); err != nil {
 		return "", err
 	}
 
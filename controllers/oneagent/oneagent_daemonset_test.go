@@ -67,3 +67,32 @@ func TestPreparePodSpecInstaller(t *testing.T) {
 		assert.Equal(t, testImage, podSpec.Containers[0].Image)
 	})
 }
+
+func TestNewDaemonSetForCR_TokenSource(t *testing.T) {
+	installerToken := func(instance *v1alpha1.OneAgent) *v1.EnvVarSource {
+		ds, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		for _, ev := range ds.Spec.Template.Spec.Containers[0].Env {
+			if ev.Name == "ONEAGENT_INSTALLER_TOKEN" {
+				return ev.ValueFrom
+			}
+		}
+		return nil
+	}
+
+	instance := newOneAgent()
+	instance.Spec.Tokens = "tokens"
+	assert.Equal(t, &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+		LocalObjectReference: v1.LocalObjectReference{Name: "tokens"},
+		Key:                  "paasToken",
+	}}, installerToken(instance))
+
+	// The Operator keeps a copy of the PaaS token if it's read from elsewhere.
+	instance.Spec.TokenSource = &v1alpha1.TokenSource{File: &v1alpha1.FileTokenSource{Path: "oneagent"}}
+	assert.Equal(t, &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+		LocalObjectReference: v1.LocalObjectReference{Name: "my-oneagent-installer-token"},
+		Key:                  "paasToken",
+	}}, installerToken(instance))
+}
@@ -0,0 +1,116 @@
+package oneagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// driftFields returns the fields of the DaemonSet which are checked for out-of-band edits, by path. Only fields that
+// the Operator sets are included, and values get the defaults of the API server, so that the desired and the live
+// DaemonSets can be compared.
+func driftFields(ds *appsv1.DaemonSet) map[string]interface{} {
+	tpl := ds.Spec.Template
+	dnsPolicy := tpl.Spec.DNSPolicy
+	if dnsPolicy == "" {
+		dnsPolicy = corev1.DNSClusterFirst
+	}
+
+	fields := map[string]interface{}{
+		"spec.template.metadata.labels":         tpl.Labels,
+		"spec.template.spec.nodeSelector":       tpl.Spec.NodeSelector,
+		"spec.template.spec.tolerations":        tpl.Spec.Tolerations,
+		"spec.template.spec.affinity":           tpl.Spec.Affinity,
+		"spec.template.spec.serviceAccountName": tpl.Spec.ServiceAccountName,
+		"spec.template.spec.priorityClassName":  tpl.Spec.PriorityClassName,
+		"spec.template.spec.dnsPolicy":          dnsPolicy,
+		"spec.template.spec.hostNetwork":        tpl.Spec.HostNetwork,
+		"spec.template.spec.hostPID":            tpl.Spec.HostPID,
+		"spec.template.spec.hostIPC":            tpl.Spec.HostIPC,
+	}
+
+	addContainers := func(path string, containers []corev1.Container) {
+		names := make([]string, 0, len(containers))
+		for _, c := range containers {
+			names = append(names, c.Name)
+
+			p := fmt.Sprintf("%s[%s]", path, c.Name)
+			fields[p+".image"] = c.Image
+			fields[p+".args"] = c.Args
+			fields[p+".env"] = withDefaultFieldRefs(c.Env)
+			fields[p+".resources"] = c.Resources
+			fields[p+".securityContext"] = c.SecurityContext
+		}
+		fields[path] = names
+	}
+	addContainers("spec.template.spec.containers", tpl.Spec.Containers)
+	addContainers("spec.template.spec.initContainers", tpl.Spec.InitContainers)
+
+	return fields
+}
+
+// withDefaultFieldRefs returns the environment variables with the API version of field references set as done by the
+// API server.
+func withDefaultFieldRefs(env []corev1.EnvVar) []corev1.EnvVar {
+	out := make([]corev1.EnvVar, 0, len(env))
+	for _, ev := range env {
+		if ev.ValueFrom != nil && ev.ValueFrom.FieldRef != nil && ev.ValueFrom.FieldRef.APIVersion == "" {
+			ev = *ev.DeepCopy()
+			ev.ValueFrom.FieldRef.APIVersion = "v1"
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// findDrift compares the fields of the live DaemonSet returned by driftFields against the desired ones, returning the
+// paths of the fields that have been changed out of band, or nil if their hashes match.
+func findDrift(desired, actual *appsv1.DaemonSet) ([]string, error) {
+	want, err := hashDriftFields(driftFields(desired))
+	if err != nil {
+		return nil, err
+	}
+	got, err := hashDriftFields(driftFields(actual))
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for path, h := range want {
+		if got[path] != h {
+			changed = append(changed, path)
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// hashDriftFields returns the hash of each field, where empty lists and maps are the same as unset ones.
+func hashDriftFields(fields map[string]interface{}) (map[string]string, error) {
+	hashes := make(map[string]string, len(fields))
+	for path, value := range fields {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch string(data) {
+		case "[]", "{}", `""`, "false":
+			data = []byte("null")
+		}
+
+		if hashes[path], err = generateHash(data); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,95 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFindDrift(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+
+	desired, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+
+	// Defaults set by the API server aren't changes.
+	actual := desired.DeepCopy()
+	actual.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	for i, ev := range actual.Spec.Template.Spec.Containers[0].Env {
+		if ev.ValueFrom != nil && ev.ValueFrom.FieldRef != nil {
+			actual.Spec.Template.Spec.Containers[0].Env[i].ValueFrom.FieldRef.APIVersion = "v1"
+		}
+	}
+	actual.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+
+	drift, err := findDrift(desired, actual)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+
+	actual.Spec.Template.Spec.Containers[0].Image = "registry.example.com/oneagent:1.0"
+	actual.Spec.Template.Spec.NodeSelector = map[string]string{"pool": "edited"}
+
+	drift, err = findDrift(desired, actual)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"spec.template.spec.containers[dynatrace-oneagent].image",
+		"spec.template.spec.nodeSelector",
+	}, drift)
+}
+
+func TestReconcileDaemonSet_Drift(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+
+	desired, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+
+	// The spec gets edited, while the template hash is left untouched.
+	edited := desired.DeepCopy()
+	edited.Spec.Template.Spec.Containers[0].Args = append(edited.Spec.Template.Spec.Containers[0].Args, "--set-infra-only=true")
+
+	recorder := record.NewFakeRecorder(10)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, edited).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: recorder}
+
+	require.NoError(t, r.reconcileDaemonSet(context.TODO(), consoleLogger, instance, nil, nil, "cluster"))
+
+	var actual appsv1.DaemonSet
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &actual))
+	assert.Equal(t, desired.Spec.Template.Spec.Containers[0].Args, actual.Spec.Template.Spec.Containers[0].Args)
+	assert.Equal(t, "Warning DriftDetected Restored DaemonSet my-oneagent edited out of band, changed fields: spec.template.spec.containers[dynatrace-oneagent].args",
+		<-recorder.Events)
+
+	// Nothing to restore anymore.
+	require.NoError(t, r.reconcileDaemonSet(context.TODO(), consoleLogger, instance, nil, nil, "cluster"))
+	assert.Empty(t, recorder.Events)
+}
+
+func TestReconcileDaemonSet_Created(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.SendLifecycleEvents = true
+
+	recorder := record.NewFakeRecorder(10)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: recorder}
+
+	require.NoError(t, r.reconcileDaemonSet(context.TODO(), consoleLogger, instance, nil, nil, "cluster"))
+
+	assert.Equal(t, "Normal DaemonSetCreated Created DaemonSet my-oneagent", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+	assert.Empty(t, instance.Status.PendingConfigChanges)
+
+	var actual appsv1.DaemonSet
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &actual))
+}
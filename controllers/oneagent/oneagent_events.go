@@ -0,0 +1,165 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// sendLifecycleEvent sends an event with the description to the hosts on Dynatrace of the given nodes, if lifecycle
+// events are enabled on the instance. Failures are only logged, since Dynatrace being unreachable shouldn't hold back
+// the reconciliation.
+func (r *ReconcileOneAgent) sendLifecycleEvent(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, nodes []string, description string) {
+	if !instance.Spec.SendLifecycleEvents {
+		return
+	}
+
+	if err := sendHostEvent(ctx, dtc, instance, nodes, description); err != nil {
+		logger.Info("failed to send lifecycle event to Dynatrace", "error", err, "description", description)
+	}
+}
+
+// sendHostEvent sends an info event with the description to the hosts on Dynatrace of the given nodes. Nodes without
+// a known host are skipped, nothing is sent if none is left.
+func sendHostEvent(ctx context.Context, dtc dtclient.Client, instance *dynatracev1alpha1.OneAgent, nodes []string, description string) error {
+	entityIDs := hostEntityIDs(instance, nodes)
+	if len(entityIDs) == 0 {
+		return nil
+	}
+
+	ts := uint64(time.Now().UnixNano()) / uint64(time.Millisecond)
+	return dtc.SendEvent(ctx, &dtclient.EventData{
+		EventType:     dtclient.CustomInfoEvent,
+		Source:        "OneAgent Operator",
+		Description:   description,
+		StartInMillis: ts,
+		EndInMillis:   ts,
+		AttachRules: dtclient.EventDataAttachRules{
+			EntityIDs: entityIDs,
+		},
+	})
+}
+
+// hostEntityIDs returns the sorted IDs of the hosts on Dynatrace of the given nodes, skipping the ones not known yet.
+func hostEntityIDs(instance *dynatracev1alpha1.OneAgent, nodes []string) []string {
+	var entityIDs []string
+	for _, node := range nodes {
+		if id := instance.Status.Instances[node].EntityID; id != "" {
+			entityIDs = append(entityIDs, id)
+		}
+	}
+	sort.Strings(entityIDs)
+	return entityIDs
+}
+
+// instanceNodes returns the nodes on the status of the instance.
+func instanceNodes(instance *dynatracev1alpha1.OneAgent) []string {
+	nodes := make([]string, 0, len(instance.Status.Instances))
+	for node := range instance.Status.Instances {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// daemonSetNodes returns the nodes running pods of the DaemonSet.
+func (r *ReconcileOneAgent) daemonSetNodes(ctx context.Context, ds *appsv1.DaemonSet) ([]string, error) {
+	if ds.Spec.Selector == nil {
+		return nil, nil
+	}
+
+	var podList corev1.PodList
+	if err := r.client.List(ctx, &podList, client.InNamespace(ds.Namespace), client.MatchingLabels(ds.Spec.Selector.MatchLabels)); err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != "" {
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	return nodes, nil
+}
+
+// sendDaemonSetEvent sends a lifecycle event to the hosts of the nodes running pods of the DaemonSet.
+func (r *ReconcileOneAgent) sendDaemonSetEvent(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, ds *appsv1.DaemonSet, description string) {
+	if !instance.Spec.SendLifecycleEvents {
+		return
+	}
+
+	nodes, err := r.daemonSetNodes(ctx, ds)
+	if err != nil {
+		logger.Info("failed to find nodes for lifecycle event", "error", err, "daemonset", ds.Name)
+		return
+	}
+	r.sendLifecycleEvent(ctx, logger, instance, dtc, nodes, description)
+}
+
+// addPendingConfigChange keeps track of the changed DaemonSet until its pods have all been updated, if lifecycle
+// events are enabled.
+func addPendingConfigChange(instance *dynatracev1alpha1.OneAgent, name string) {
+	if !instance.Spec.SendLifecycleEvents {
+		return
+	}
+
+	if !containsString(instance.Status.PendingConfigChanges, name) {
+		instance.Status.PendingConfigChanges = append(instance.Status.PendingConfigChanges, name)
+	}
+}
+
+// reconcileConfigChanges sends an event to the hosts of each changed DaemonSet whose pods have all been updated and
+// are ready, and stops tracking it.
+//
+// Returns true if the status has been modified.
+func (r *ReconcileOneAgent) reconcileConfigChanges(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client) (bool, error) {
+	sts := &instance.Status
+	if len(sts.PendingConfigChanges) == 0 {
+		return false, nil
+	} else if !instance.Spec.SendLifecycleEvents {
+		sts.PendingConfigChanges = nil
+		return true, nil
+	}
+
+	var pending []string
+	for _, name := range sts.PendingConfigChanges {
+		var ds appsv1.DaemonSet
+		if err := r.client.Get(ctx, client.ObjectKey{Name: name, Namespace: instance.Namespace}, &ds); k8serrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		if !isDaemonSetRolledOut(&ds) {
+			pending = append(pending, name)
+			continue
+		}
+
+		logger.Info("configuration change took effect", "daemonset", name)
+		r.sendDaemonSetEvent(ctx, logger, instance, dtc, &ds,
+			fmt.Sprintf("Configuration change of OneAgent %s took effect on all nodes of DaemonSet %s.", instance.Name, name))
+	}
+
+	if len(pending) == len(sts.PendingConfigChanges) {
+		return false, nil
+	}
+	sts.PendingConfigChanges = pending
+	return true, nil
+}
+
+// isDaemonSetRolledOut returns true if the latest template of the DaemonSet runs on all of its nodes, and the pods are
+// ready.
+func isDaemonSetRolledOut(ds *appsv1.DaemonSet) bool {
+	sts := ds.Status
+	return sts.ObservedGeneration >= ds.Generation &&
+		sts.UpdatedNumberScheduled == sts.DesiredNumberScheduled &&
+		sts.NumberReady == sts.DesiredNumberScheduled
+}
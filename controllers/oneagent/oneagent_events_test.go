@@ -0,0 +1,142 @@
+package oneagent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileDaemonSet_LifecycleEvents(t *testing.T) {
+	ctx := context.TODO()
+
+	newInstance := func(enabled bool) *dynatracev1alpha1.OneAgent {
+		instance := newOneAgent()
+		instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+		instance.Spec.SendLifecycleEvents = enabled
+		instance.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{
+			"node1": {EntityID: "HOST-1"},
+			"node2": {EntityID: "HOST-2"},
+		}
+		return instance
+	}
+
+	setup := func(t *testing.T, instance *dynatracev1alpha1.OneAgent) (*ReconcileOneAgent, client.Client, *dtclient.MockDynatraceClient) {
+		desired, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+		require.NoError(t, err)
+
+		outdated := desired.DeepCopy()
+		outdated.Annotations[annotationTemplateHash] = "outdated"
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-oneagent-abcde", Namespace: instance.Namespace, Labels: buildLabels(instance.Name)},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, outdated, pod).Build()
+
+		// The events are sent with the client of the reconciliation, without building another one.
+		r := &ReconcileOneAgent{
+			client:    utils.FakeApplyClient{Client: c},
+			apiReader: c,
+			scheme:    scheme.Scheme,
+			logger:    consoleLogger,
+			recorder:  record.NewFakeRecorder(10),
+		}
+		return r, c, &dtclient.MockDynatraceClient{}
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		instance := newInstance(true)
+		r, c, dtClient := setup(t, instance)
+
+		dtClient.On("SendEvent", mock.MatchedBy(func(e *dtclient.EventData) bool {
+			return strings.Contains(e.Description, "updated by the OneAgent Operator") && assert.ObjectsAreEqual([]string{"HOST-1"}, e.AttachRules.EntityIDs)
+		})).Return(nil).Once()
+
+		require.NoError(t, r.reconcileDaemonSet(ctx, consoleLogger, instance, dtClient, nil, "cluster"))
+		assert.Equal(t, []string{instance.Name}, instance.Status.PendingConfigChanges)
+
+		// Pods haven't been updated yet.
+		var ds appsv1.DaemonSet
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &ds))
+		ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: ds.Generation, DesiredNumberScheduled: 1, UpdatedNumberScheduled: 0, NumberReady: 1}
+		require.NoError(t, c.Status().Update(ctx, &ds))
+
+		upd, err := r.reconcileConfigChanges(ctx, consoleLogger, instance, dtClient)
+		require.NoError(t, err)
+		assert.False(t, upd)
+
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &ds))
+		ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: ds.Generation, DesiredNumberScheduled: 1, UpdatedNumberScheduled: 1, NumberReady: 1}
+		require.NoError(t, c.Status().Update(ctx, &ds))
+
+		dtClient.On("SendEvent", mock.MatchedBy(func(e *dtclient.EventData) bool {
+			return e.Description == "Configuration change of OneAgent my-oneagent took effect on all nodes of DaemonSet my-oneagent." &&
+				assert.ObjectsAreEqual([]string{"HOST-1"}, e.AttachRules.EntityIDs)
+		})).Return(nil).Once()
+
+		upd, err = r.reconcileConfigChanges(ctx, consoleLogger, instance, dtClient)
+		require.NoError(t, err)
+		assert.True(t, upd)
+		assert.Empty(t, instance.Status.PendingConfigChanges)
+
+		mock.AssertExpectationsForObjects(t, dtClient)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		instance := newInstance(false)
+		r, _, dtClient := setup(t, instance)
+
+		require.NoError(t, r.reconcileDaemonSet(ctx, consoleLogger, instance, dtClient, nil, "cluster"))
+		assert.Empty(t, instance.Status.PendingConfigChanges)
+
+		// Changes tracked before lifecycle events got disabled are dropped.
+		instance.Status.PendingConfigChanges = []string{instance.Name}
+		upd, err := r.reconcileConfigChanges(ctx, consoleLogger, instance, dtClient)
+		require.NoError(t, err)
+		assert.True(t, upd)
+		assert.Empty(t, instance.Status.PendingConfigChanges)
+
+		dtClient.AssertNotCalled(t, "SendEvent", mock.Anything)
+	})
+}
+
+func TestRollbackVersion_LifecycleEvent(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.SendLifecycleEvents = true
+	instance.Status.LastKnownGoodVersion = "1.203.0"
+	instance.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{
+		"node1": {EntityID: "HOST-1"},
+		"node2": {EntityID: "HOST-2"},
+		"node3": {},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance).Build()
+	dtClient := &dtclient.MockDynatraceClient{}
+	dtClient.On("SendEvent", mock.MatchedBy(func(e *dtclient.EventData) bool {
+		return e.EventType == dtclient.CustomInfoEvent &&
+			e.Description == "OneAgent rollout failed: Version 1.205.0 failed health checks, rolled back to 1.203.0: pods failing on nodes: node2." &&
+			assert.ObjectsAreEqual([]string{"HOST-1", "HOST-2"}, e.AttachRules.EntityIDs)
+	})).Return(nil)
+
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: record.NewFakeRecorder(10)}
+
+	r.rollbackVersion(context.TODO(), consoleLogger, instance, dtClient, "1.205.0", "pods failing on nodes: node2")
+	assert.Equal(t, "1.205.0", instance.Status.FailedVersion)
+
+	mock.AssertExpectationsForObjects(t, dtClient)
+}
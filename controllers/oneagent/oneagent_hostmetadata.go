@@ -0,0 +1,269 @@
+package oneagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/hostmetadata"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	argHostGroup    = "--set-host-group"
+	argHostTag      = "--set-host-tag"
+	argHostProperty = "--set-host-property"
+)
+
+// hostGroup returns the host group for the node group, or the one on the instance if the group doesn't set any.
+func hostGroup(instance *dynatracev1alpha1.OneAgent, group *dynatracev1alpha1.OneAgentNodeGroup) string {
+	if group != nil && group.HostGroup != "" {
+		return group.HostGroup
+	}
+	return instance.Spec.HostGroup
+}
+
+// hostMetadataArgs returns the installer arguments for the host group, and the host tags and properties which don't
+// need to be rendered for each node.
+func hostMetadataArgs(instance *dynatracev1alpha1.OneAgent, group *dynatracev1alpha1.OneAgentNodeGroup) []string {
+	var args []string
+
+	if hg := hostGroup(instance, group); hg != "" {
+		args = append(args, argHostGroup+"="+hg)
+	}
+
+	for _, kv := range sortedPairs(instance.Spec.HostTags, false) {
+		args = append(args, argHostTag+"="+kv)
+	}
+
+	for _, kv := range sortedPairs(instance.Spec.HostProperties, false) {
+		args = append(args, argHostProperty+"="+kv)
+	}
+
+	return args
+}
+
+// hasHostMetadataTemplates returns true if any host tags or properties need to be rendered for each node.
+func hasHostMetadataTemplates(instance *dynatracev1alpha1.OneAgent) bool {
+	return len(sortedPairs(instance.Spec.HostTags, true)) > 0 || len(hostPropertyTemplates(instance)) > 0
+}
+
+// hostPropertyTemplates returns the host properties which need to be rendered for each node, as "<key>=<template>".
+// This includes the node labels and annotations to copy.
+func hostPropertyTemplates(instance *dynatracev1alpha1.OneAgent) []string {
+	templates := sortedPairs(instance.Spec.HostProperties, true)
+
+	for _, m := range nodeMetadataProperties(instance) {
+		templates = append(templates, fmt.Sprintf("%s={{ index .Node.%s %q }}", m.property, m.source, m.key))
+	}
+
+	return templates
+}
+
+// nodeMetadataProperty is a node label or annotation to copy into a host property.
+type nodeMetadataProperty struct {
+	// source is either "Labels" or "Annotations"
+	source   string
+	key      string
+	property string
+}
+
+// nodeMetadataProperties returns the node labels and annotations to copy into host properties, sorted by property.
+func nodeMetadataProperties(instance *dynatracev1alpha1.OneAgent) []nodeMetadataProperty {
+	nm := instance.Spec.NodeMetadata
+	if nm == nil {
+		return nil
+	}
+
+	var props []nodeMetadataProperty
+	for source, m := range map[string]map[string]string{"Labels": nm.Labels, "Annotations": nm.Annotations} {
+		for _, k := range sortedKeys(m) {
+			property := m[k]
+			if property == "" {
+				property = k
+			}
+			props = append(props, nodeMetadataProperty{source: source, key: k, property: property})
+		}
+	}
+
+	sort.Slice(props, func(i, j int) bool { return props[i].property < props[j].property })
+	return props
+}
+
+// newHostMetadataInitContainer returns the init step rendering the host tags and properties templates on the node of
+// the pod.
+func newHostMetadataInitContainer(instance *dynatracev1alpha1.OneAgent, image string) corev1.Container {
+	args := []string{hostmetadata.Subcommand, "--node=$(DT_K8S_NODE_NAME)"}
+
+	for _, kv := range sortedPairs(instance.Spec.HostTags, true) {
+		args = append(args, "--host-tag="+kv)
+	}
+
+	for _, kv := range hostPropertyTemplates(instance) {
+		args = append(args, "--host-property="+kv)
+	}
+
+	// The Operator image runs as a non-root user, which can't write the OneAgent configuration on the host.
+	rootUser := int64(0)
+	return corev1.Container{
+		Name:            "host-metadata",
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            args,
+		Env: []corev1.EnvVar{{
+			Name:      "DT_K8S_NODE_NAME",
+			ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+		}},
+		VolumeMounts:    []corev1.VolumeMount{{Name: "host-root", MountPath: "/mnt/root"}},
+		SecurityContext: &corev1.SecurityContext{RunAsUser: &rootUser},
+	}
+}
+
+// sortedPairs returns the entries formatted as "<key>=<value>" sorted by key, which are templates or not.
+func sortedPairs(m map[string]string, templates bool) []string {
+	var pairs []string
+	for k, v := range m {
+		if hostmetadata.IsTemplate(v) == templates {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// validateHostMetadata returns the issues found on the host group, tags and properties, including conflicts with the
+// installer arguments.
+func validateHostMetadata(instance *dynatracev1alpha1.OneAgent, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	groups := []*dynatracev1alpha1.OneAgentNodeGroup{nil}
+	for i := range instance.Spec.NodeGroups {
+		groups = append(groups, &instance.Spec.NodeGroups[i])
+	}
+
+	for i, group := range groups {
+		path, args, hg := fldPath, instance.Spec.Args, instance.Spec.HostGroup
+		if group != nil {
+			path, args, hg = fldPath.Child("nodeGroups").Index(i-1), group.Args, group.HostGroup
+		}
+
+		if hostmetadata.IsTemplate(hg) {
+			errs = append(errs, field.Invalid(path.Child("hostGroup"), hg, "can't be a template, since the host group is set on installation"))
+		}
+
+		conflict := func(option, key, with string) {
+			if j := findArg(args, option, key); j >= 0 {
+				errs = append(errs, field.Invalid(path.Child("args").Index(j), args[j], "conflicts with "+with))
+			}
+		}
+
+		// The arguments on the spec apply to all node groups.
+		if hostGroup(instance, group) != "" || (group == nil && anyGroupHostGroup(instance)) {
+			conflict(argHostGroup, "", "hostGroup")
+		}
+		for _, k := range sortedKeys(instance.Spec.HostTags) {
+			conflict(argHostTag, k, "hostTags")
+		}
+		for _, k := range sortedKeys(instance.Spec.HostProperties) {
+			conflict(argHostProperty, k, "hostProperties")
+		}
+		for _, m := range nodeMetadataProperties(instance) {
+			conflict(argHostProperty, m.property, "nodeMetadata")
+		}
+	}
+
+	for _, entries := range []struct {
+		name string
+		m    map[string]string
+	}{{"hostTags", instance.Spec.HostTags}, {"hostProperties", instance.Spec.HostProperties}} {
+		for _, k := range sortedKeys(entries.m) {
+			if k == "" || strings.ContainsAny(k, "= \t") {
+				errs = append(errs, field.Invalid(fldPath.Child(entries.name), k, "keys must not be empty or contain '=' or spaces"))
+			}
+			if _, err := hostmetadata.ParseTemplate(entries.m[k]); err != nil {
+				errs = append(errs, field.Invalid(fldPath.Child(entries.name).Key(k), entries.m[k], err.Error()))
+			}
+		}
+	}
+
+	properties := map[string]bool{}
+	for k := range instance.Spec.HostProperties {
+		properties[k] = true
+	}
+	for _, m := range nodeMetadataProperties(instance) {
+		path := fldPath.Child("nodeMetadata", strings.ToLower(m.source)).Key(m.key)
+		if strings.ContainsAny(m.property, "= \t") {
+			errs = append(errs, field.Invalid(path, m.property, "property must not contain '=' or spaces"))
+		}
+		if properties[m.property] {
+			errs = append(errs, field.Duplicate(path, m.property))
+		}
+		properties[m.property] = true
+	}
+
+	return errs
+}
+
+// findArg returns the index of the installer argument setting the option, optionally only for the given key, or -1 if
+// there is none.
+func findArg(args []string, option string, key string) int {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, option+"=") && arg != option {
+			continue
+		}
+
+		if key == "" {
+			return i
+		}
+
+		value := strings.TrimPrefix(strings.TrimPrefix(arg, option), "=")
+		if value == key || strings.HasPrefix(value, key+"=") {
+			return i
+		}
+	}
+	return -1
+}
+
+func anyGroupHostGroup(instance *dynatracev1alpha1.OneAgent) bool {
+	for _, group := range instance.Spec.NodeGroups {
+		if group.HostGroup != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getOperatorImage returns the image of the Operator pod, which is used for the host metadata init step.
+func (r *ReconcileOneAgent) getOperatorImage(ctx context.Context) (string, error) {
+	if r.operatorImage != "" {
+		return r.operatorImage, nil
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		return "", errors.New("POD_NAME environment variable does not exist")
+	}
+
+	var pod corev1.Pod
+	if err := r.apiReader.Get(ctx, client.ObjectKey{Name: podName, Namespace: os.Getenv("POD_NAMESPACE")}, &pod); err != nil {
+		return "", fmt.Errorf("failed to query operator pod: %w", err)
+	}
+
+	r.operatorImage = pod.Spec.Containers[0].Image
+	return r.operatorImage, nil
+}
@@ -0,0 +1,135 @@
+package oneagent
+
+import (
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestNewDaemonSetForCR_HostMetadata(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.HostGroup = "production"
+	instance.Spec.HostTags = map[string]string{"team": "payments", "zone": "{{ .Node.Labels.zone }}"}
+	instance.Spec.HostProperties = map[string]string{"Cluster": "prod-1"}
+
+	builder := newDaemonSetBuilder(consoleLogger, instance, "cluster")
+	_, err := builder.newDaemonSetForCR()
+	assert.Error(t, err, "operator image is needed for templates")
+
+	builder.operatorImage = "docker.io/dynatrace/dynatrace-oneagent-operator:snapshot"
+	ds, err := builder.newDaemonSetForCR()
+	require.NoError(t, err)
+
+	podSpec := ds.Spec.Template.Spec
+	assert.Subset(t, podSpec.Containers[0].Args, []string{
+		"--set-host-group=production",
+		"--set-host-tag=team=payments",
+		"--set-host-property=Cluster=prod-1",
+	})
+	assert.NotContains(t, podSpec.Containers[0].Args, "--set-host-tag=zone={{ .Node.Labels.zone }}")
+
+	if assert.Len(t, podSpec.InitContainers, 1) {
+		init := podSpec.InitContainers[0]
+		assert.Equal(t, builder.operatorImage, init.Image)
+		assert.Equal(t, []string{"host-metadata", "--node=$(DT_K8S_NODE_NAME)", "--host-tag=zone={{ .Node.Labels.zone }}"}, init.Args)
+		if assert.NotNil(t, init.SecurityContext) && assert.NotNil(t, init.SecurityContext.RunAsUser) {
+			assert.Equal(t, int64(0), *init.SecurityContext.RunAsUser, "needs to write on the host root filesystem")
+		}
+	}
+
+	// Node groups can override the host group.
+	builder.nodeGroup = &dynatracev1alpha1.OneAgentNodeGroup{Name: "gpu", HostGroup: "gpu"}
+	ds, err = builder.newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Contains(t, ds.Spec.Template.Spec.Containers[0].Args, "--set-host-group=gpu")
+	assert.NotContains(t, ds.Spec.Template.Spec.Containers[0].Args, "--set-host-group=production")
+
+	// Without templates, no init step is needed.
+	instance.Spec.HostTags = map[string]string{"team": "payments"}
+	ds, err = newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Empty(t, ds.Spec.Template.Spec.InitContainers)
+}
+
+func TestValidateHostMetadata(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.HostGroup = "production"
+	instance.Spec.HostTags = map[string]string{"zone": "{{ .Node.Labels.zone }}"}
+	instance.Spec.HostProperties = map[string]string{"Cluster": "prod-1"}
+	instance.Spec.Args = []string{"--set-host-tag=team=payments", "--set-app-log-content-access=true"}
+	assert.Empty(t, validateHostMetadata(instance, field.NewPath("spec")))
+
+	instance.Spec.Args = []string{"--set-host-group=staging", "--set-host-tag=zone", "--set-host-property=Cluster=prod-2"}
+	assert.Equal(t, []string{
+		`spec.args[0]: Invalid value: "--set-host-group=staging": conflicts with hostGroup`,
+		`spec.args[1]: Invalid value: "--set-host-tag=zone": conflicts with hostTags`,
+		`spec.args[2]: Invalid value: "--set-host-property=Cluster=prod-2": conflicts with hostProperties`,
+	}, errorStrings(validateHostMetadata(instance, field.NewPath("spec"))))
+
+	instance.Spec.Args = nil
+	instance.Spec.HostGroup = ""
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{
+		{Name: "linux", Args: []string{"--set-host-group=linux"}},
+		{Name: "gpu", HostGroup: "{{ .Node.Labels.pool }}", Args: []string{"--set-host-group=gpu"}},
+	}
+	assert.Equal(t, []string{
+		`spec.nodeGroups[1].hostGroup: Invalid value: "{{ .Node.Labels.pool }}": can't be a template, since the host group is set on installation`,
+		`spec.nodeGroups[1].args[0]: Invalid value: "--set-host-group=gpu": conflicts with hostGroup`,
+	}, errorStrings(validateHostMetadata(instance, field.NewPath("spec"))))
+
+	instance.Spec.NodeGroups = nil
+	instance.Spec.HostTags = map[string]string{"a=b": "c", "zone": "{{ .Node.Labels.zone"}
+	assert.Len(t, validateHostMetadata(instance, field.NewPath("spec")), 2)
+}
+
+func TestNewDaemonSetForCR_NodeMetadata(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.NodeMetadata = &dynatracev1alpha1.OneAgentNodeMetadata{
+		Labels: map[string]string{
+			"topology.kubernetes.io/zone":      "Zone",
+			"node.kubernetes.io/instance-type": "InstanceType",
+			"pool":                             "",
+		},
+		Annotations: map[string]string{"cluster-autoscaler.kubernetes.io/scale-down-disabled": "ScaleDownDisabled"},
+	}
+
+	builder := newDaemonSetBuilder(consoleLogger, instance, "cluster")
+	builder.operatorImage = "docker.io/dynatrace/dynatrace-oneagent-operator:snapshot"
+	ds, err := builder.newDaemonSetForCR()
+	require.NoError(t, err)
+
+	if assert.Len(t, ds.Spec.Template.Spec.InitContainers, 1) {
+		assert.Equal(t, []string{
+			"host-metadata",
+			"--node=$(DT_K8S_NODE_NAME)",
+			`--host-property=InstanceType={{ index .Node.Labels "node.kubernetes.io/instance-type" }}`,
+			`--host-property=ScaleDownDisabled={{ index .Node.Annotations "cluster-autoscaler.kubernetes.io/scale-down-disabled" }}`,
+			`--host-property=Zone={{ index .Node.Labels "topology.kubernetes.io/zone" }}`,
+			`--host-property=pool={{ index .Node.Labels "pool" }}`,
+		}, ds.Spec.Template.Spec.InitContainers[0].Args)
+	}
+}
+
+func TestValidateHostMetadata_NodeMetadata(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.HostProperties = map[string]string{"Zone": "eu"}
+	instance.Spec.NodeMetadata = &dynatracev1alpha1.OneAgentNodeMetadata{
+		Labels:      map[string]string{"pool": "Pool"},
+		Annotations: map[string]string{"owner": "Owner"},
+	}
+	instance.Spec.Args = []string{"--set-host-property=Owner=me"}
+
+	assert.Equal(t, []string{`spec.args[0]: Invalid value: "--set-host-property=Owner=me": conflicts with nodeMetadata`}, errorStrings(validateHostMetadata(instance, field.NewPath("spec"))))
+
+	instance.Spec.Args = nil
+	instance.Spec.NodeMetadata.Labels = map[string]string{"topology.kubernetes.io/zone": "Zone", "pool": "Node Pool"}
+	assert.Equal(t, []string{
+		`spec.nodeMetadata.labels[pool]: Invalid value: "Node Pool": property must not contain '=' or spaces`,
+		`spec.nodeMetadata.labels[topology.kubernetes.io/zone]: Duplicate value: "Zone"`,
+	}, errorStrings(validateHostMetadata(instance, field.NewPath("spec"))))
+}
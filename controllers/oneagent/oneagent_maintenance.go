@@ -0,0 +1,53 @@
+package oneagent
+
+import (
+	"fmt"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileMaintenanceWindow updates the MaintenanceWindow condition for the instance on the given time. If the windows
+// are closed, returns the time when the next one opens.
+//
+// Returns true if the status has been modified.
+func reconcileMaintenanceWindow(instance *dynatracev1alpha1.OneAgent, now time.Time) (time.Time, bool, error) {
+	if len(instance.Spec.MaintenanceWindows) == 0 {
+		return time.Time{}, utils.RemoveCondition(&instance.Status.Conditions, dynatracev1alpha1.MaintenanceWindowConditionType), nil
+	}
+
+	open, next, err := utils.IsInMaintenanceWindow(instance.Spec.MaintenanceWindows, now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if open {
+		return time.Time{}, utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    dynatracev1alpha1.MaintenanceWindowConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  dynatracev1alpha1.ReasonMaintenanceWindowOpen,
+			Message: "Pod restarts and DaemonSet updates are allowed",
+		}), nil
+	}
+
+	msg := "Pod restarts and DaemonSet updates are deferred, no upcoming maintenance window found"
+	if !next.IsZero() {
+		msg = fmt.Sprintf("Pod restarts and DaemonSet updates are deferred until %s", next.UTC().Format(time.RFC3339))
+	}
+
+	return next, utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.MaintenanceWindowConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  dynatracev1alpha1.ReasonMaintenanceWindowClosed,
+		Message: msg,
+	}), nil
+}
+
+// isInMaintenanceWindow returns false if pod restarts and DaemonSet updates need to be deferred, as last evaluated by
+// reconcileMaintenanceWindow.
+func isInMaintenanceWindow(instance *dynatracev1alpha1.OneAgent) bool {
+	return !meta.IsStatusConditionFalse(instance.Status.Conditions, dynatracev1alpha1.MaintenanceWindowConditionType)
+}
@@ -0,0 +1,115 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileMaintenanceWindow(t *testing.T) {
+	// Saturday
+	now := time.Date(2021, 3, 20, 3, 30, 0, 0, time.UTC)
+
+	instance := newOneAgent()
+	instance.Spec.MaintenanceWindows = []dynatracev1alpha1.MaintenanceWindow{
+		{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: time.Hour}},
+	}
+
+	next, upd, err := reconcileMaintenanceWindow(instance, now)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, time.Date(2021, 3, 27, 2, 0, 0, 0, time.UTC), next)
+	assert.False(t, isInMaintenanceWindow(instance))
+
+	cond := meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.MaintenanceWindowConditionType)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, dynatracev1alpha1.ReasonMaintenanceWindowClosed, cond.Reason)
+		assert.Contains(t, cond.Message, "2021-03-27T02:00:00Z")
+	}
+
+	_, upd, err = reconcileMaintenanceWindow(instance, now)
+	require.NoError(t, err)
+	assert.False(t, upd)
+
+	instance.Spec.MaintenanceWindows[0].Duration.Duration = 2 * time.Hour
+	next, upd, err = reconcileMaintenanceWindow(instance, now)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.True(t, next.IsZero())
+	assert.True(t, isInMaintenanceWindow(instance))
+
+	instance.Spec.MaintenanceWindows = nil
+	_, upd, err = reconcileMaintenanceWindow(instance, now)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Empty(t, instance.Status.Conditions)
+	assert.True(t, isInMaintenanceWindow(instance))
+}
+
+func TestReconcileRollout_DeferredDaemonSetUpdate(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.Version = "1.203.0"
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:   dynatracev1alpha1.MaintenanceWindowConditionType,
+		Status: metav1.ConditionFalse,
+		Reason: dynatracev1alpha1.ReasonMaintenanceWindowClosed,
+	})
+
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, ds, sampleKubeSystemNS).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	_, err := r.reconcileRollout(context.TODO(), consoleLogger, instance, &dtclient.MockDynatraceClient{})
+	require.NoError(t, err)
+
+	var actual appsv1.DaemonSet
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &actual))
+	assert.Empty(t, getTemplateHash(&actual))
+
+	meta.RemoveStatusCondition(&instance.Status.Conditions, dynatracev1alpha1.MaintenanceWindowConditionType)
+
+	_, err = r.reconcileRollout(context.TODO(), consoleLogger, instance, &dtclient.MockDynatraceClient{})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: instance.Name, Namespace: instance.Namespace}, &actual))
+	assert.NotEmpty(t, getTemplateHash(&actual))
+}
+
+func TestReconcileImageVersion_OutsideMaintenanceWindow(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.UseImmutableImage = true
+	instance.Spec.VersionPolicy = &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.205"}
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:   dynatracev1alpha1.MaintenanceWindowConditionType,
+		Status: metav1.ConditionFalse,
+		Reason: dynatracev1alpha1.ReasonMaintenanceWindowClosed,
+	})
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	dtc := &dtclient.MockDynatraceClient{}
+	dtc.On("GetAgentVersions", "unix", "default").Return([]string{"1.206.0.20210101-000000", "1.205.1.20201201-000000"}, nil)
+
+	// The image is still resolved, here up to the missing pull secret.
+	upd, err := r.reconcileImageVersion(context.TODO(), instance, dtc, consoleLogger)
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.True(t, upd)
+	assert.NotNil(t, instance.Status.LastImageVersionProbeTimestamp)
+	assert.Equal(t, "1.205.1.20201201-000000", instance.Status.Version)
+}
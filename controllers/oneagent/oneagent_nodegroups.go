@@ -0,0 +1,195 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// label set on the DaemonSets and pods of node groups, to tell them apart from each other
+const labelNodeGroup = "oneagent-group"
+
+// nodeGroups returns the node groups to deploy a DaemonSet for. A nil group stands for the default DaemonSet, which is
+// only deployed if there are no groups defined.
+func nodeGroups(instance *dynatracev1alpha1.OneAgent) []*dynatracev1alpha1.OneAgentNodeGroup {
+	if len(instance.Spec.NodeGroups) == 0 {
+		return []*dynatracev1alpha1.OneAgentNodeGroup{nil}
+	}
+
+	groups := make([]*dynatracev1alpha1.OneAgentNodeGroup, 0, len(instance.Spec.NodeGroups))
+	for i := range instance.Spec.NodeGroups {
+		groups = append(groups, &instance.Spec.NodeGroups[i])
+	}
+	return groups
+}
+
+// daemonSetName returns the name of the DaemonSet for the node group.
+func daemonSetName(instance *dynatracev1alpha1.OneAgent, group *dynatracev1alpha1.OneAgentNodeGroup) string {
+	if group == nil {
+		return instance.GetName()
+	}
+	return instance.GetName() + "-" + group.Name
+}
+
+// buildNodeGroupLabels returns the selector labels for the DaemonSet of the node group.
+func buildNodeGroupLabels(name string, group *dynatracev1alpha1.OneAgentNodeGroup) map[string]string {
+	labels := buildLabels(name)
+	if group != nil {
+		labels[labelNodeGroup] = group.Name
+	}
+	return labels
+}
+
+// mergeEnv returns the environment variables on base, with the ones on overrides replacing those with the same name.
+func mergeEnv(base []corev1.EnvVar, overrides []corev1.EnvVar) []corev1.EnvVar {
+	names := map[string]bool{}
+	for _, ev := range overrides {
+		names[ev.Name] = true
+	}
+
+	var env []corev1.EnvVar
+	for _, ev := range base {
+		if !names[ev.Name] {
+			env = append(env, ev)
+		}
+	}
+	return append(env, overrides...)
+}
+
+// validateNodeGroups returns the issues found on the node groups.
+func validateNodeGroups(instance *dynatracev1alpha1.OneAgent, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	names := map[string]bool{}
+	for i, group := range instance.Spec.NodeGroups {
+		namePath := fldPath.Index(i).Child("name")
+		if msg := validation.IsDNS1123Label(group.Name); len(msg) > 0 {
+			errs = append(errs, field.Invalid(namePath, group.Name, msg[0]))
+		} else if msg := validation.IsDNS1123Label(daemonSetName(instance, &group)); len(msg) > 0 {
+			errs = append(errs, field.Invalid(namePath, group.Name, "too long for the DaemonSet name: "+msg[0]))
+		}
+
+		if names[group.Name] {
+			errs = append(errs, field.Duplicate(namePath, group.Name))
+		}
+		names[group.Name] = true
+	}
+
+	// The DaemonSets of groups deploying to the same node would run two OneAgents on it.
+	if len(instance.Spec.NodeGroups) < 2 {
+		return errs
+	}
+
+	for i, group := range instance.Spec.NodeGroups {
+		selectorPath := fldPath.Index(i).Child("nodeSelector")
+		if len(group.NodeSelector) == 0 {
+			errs = append(errs, field.Required(selectorPath, "needed if there's more than one group, so that these deploy to different nodes"))
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			other := instance.Spec.NodeGroups[j].NodeSelector
+			if len(other) > 0 && selectorsOverlap(group.NodeSelector, other) {
+				errs = append(errs, field.Forbidden(selectorPath, fmt.Sprintf("can match the same nodes as %s", fldPath.Index(j).Child("nodeSelector"))))
+			}
+		}
+	}
+
+	return errs
+}
+
+// selectorsOverlap returns true if a node can match both node selectors, that is, if these don't require different
+// values for any label.
+func selectorsOverlap(a, b map[string]string) bool {
+	for key, value := range a {
+		if other, ok := b[key]; ok && other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findDaemonSets returns the DaemonSets owned by the instance.
+func (r *ReconcileOneAgent) findDaemonSets(ctx context.Context, instance *dynatracev1alpha1.OneAgent) ([]appsv1.DaemonSet, error) {
+	var dsList appsv1.DaemonSetList
+	if err := r.client.List(ctx, &dsList, client.InNamespace(instance.GetNamespace()), client.MatchingLabels(buildLabels(instance.GetName()))); err != nil {
+		return nil, err
+	}
+
+	var owned []appsv1.DaemonSet
+	for _, ds := range dsList.Items {
+		if metav1.IsControlledBy(&ds, instance) {
+			owned = append(owned, ds)
+		}
+	}
+	return owned, nil
+}
+
+// deleteStaleDaemonSets deletes the DaemonSets owned by the instance for node groups which don't exist anymore. This
+// includes the default DaemonSet once groups get defined, since its selector overlaps with the ones of the groups.
+func (r *ReconcileOneAgent) deleteStaleDaemonSets(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent) error {
+	desired := map[string]bool{}
+	for _, group := range nodeGroups(instance) {
+		desired[daemonSetName(instance, group)] = true
+	}
+
+	dsList, err := r.findDaemonSets(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	for i := range dsList {
+		if desired[dsList[i].Name] {
+			continue
+		}
+
+		logger.Info("Deleting daemonset of removed node group", "daemonset", dsList[i].Name)
+		if err := r.client.Delete(ctx, &dsList[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getNodeGroupStatuses returns the state of the DaemonSet for each node group. Groups whose DaemonSet doesn't exist yet
+// are left out.
+func (r *ReconcileOneAgent) getNodeGroupStatuses(ctx context.Context, instance *dynatracev1alpha1.OneAgent) ([]dynatracev1alpha1.OneAgentNodeGroupStatus, error) {
+	var statuses []dynatracev1alpha1.OneAgentNodeGroupStatus
+
+	for _, group := range nodeGroups(instance) {
+		var ds appsv1.DaemonSet
+		name := daemonSetName(instance, group)
+		if err := r.client.Get(ctx, client.ObjectKey{Name: name, Namespace: instance.GetNamespace()}, &ds); k8serrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sts := dynatracev1alpha1.OneAgentNodeGroupStatus{
+			DaemonSet:              name,
+			Phase:                  dynatracev1alpha1.Deploying,
+			DesiredNumberScheduled: ds.Status.DesiredNumberScheduled,
+			NumberReady:            ds.Status.NumberReady,
+			UpdatedNumberScheduled: ds.Status.UpdatedNumberScheduled,
+		}
+		if group != nil {
+			sts.Name = group.Name
+		}
+		if ds.Status.NumberReady == ds.Status.CurrentNumberScheduled {
+			sts.Phase = dynatracev1alpha1.Running
+		}
+		statuses = append(statuses, sts)
+	}
+
+	return statuses, nil
+}
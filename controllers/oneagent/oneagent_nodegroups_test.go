@@ -0,0 +1,183 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestNewDaemonSetForCR_NodeGroup(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.NodeSelector = map[string]string{"pool": "default"}
+	instance.Spec.Args = []string{"--set-app-log-content-access=true"}
+	instance.Spec.Env = []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}
+
+	group := &dynatracev1alpha1.OneAgentNodeGroup{
+		Name:         "gpu",
+		NodeSelector: map[string]string{"pool": "gpu"},
+		Tolerations:  []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}},
+		Resources: &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+		},
+		Args:      []string{"--set-infra-only=true"},
+		Env:       []corev1.EnvVar{{Name: "B", Value: "3"}},
+		HostGroup: "gpu-nodes",
+	}
+
+	builder := newDaemonSetBuilder(consoleLogger, instance, "cluster")
+	builder.nodeGroup = group
+	ds, err := builder.newDaemonSetForCR()
+	require.NoError(t, err)
+
+	assert.Equal(t, "my-oneagent-gpu", ds.Name)
+	assert.Equal(t, map[string]string{"dynatrace": "oneagent", "oneagent": "my-oneagent", labelNodeGroup: "gpu"}, ds.Spec.Selector.MatchLabels)
+
+	podSpec := ds.Spec.Template.Spec
+	assert.Equal(t, group.NodeSelector, podSpec.NodeSelector)
+	assert.Equal(t, group.Tolerations, podSpec.Tolerations)
+	assert.Equal(t, resource.MustParse("500m"), podSpec.Containers[0].Resources.Requests[corev1.ResourceCPU])
+	assert.Subset(t, podSpec.Containers[0].Args, []string{"--set-app-log-content-access=true", "--set-infra-only=true", "--set-host-group=gpu-nodes"})
+	assert.Subset(t, podSpec.Containers[0].Env, []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "3"}})
+	assert.NotContains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "B", Value: "2"})
+
+	// The instance settings are left untouched.
+	assert.Equal(t, []string{"--set-app-log-content-access=true"}, instance.Spec.Args)
+	assert.Empty(t, instance.Spec.Resources.Requests)
+}
+
+func TestReconcileRollout_NodeGroups(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.Version = "1.203.0"
+
+	// The default DaemonSet from before node groups were defined.
+	dsDefault := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace, Labels: buildLabels(instance.Name)},
+	}
+	require.NoError(t, controllerutil.SetControllerReference(instance, dsDefault, scheme.Scheme))
+
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{{Name: "linux"}, {Name: "gpu"}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, dsDefault, sampleKubeSystemNS).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	_, err := r.reconcileRollout(context.TODO(), consoleLogger, instance, &dtclient.MockDynatraceClient{})
+	require.NoError(t, err)
+
+	names := func() []string {
+		var dsList appsv1.DaemonSetList
+		require.NoError(t, c.List(context.TODO(), &dsList, client.InNamespace(instance.Namespace)))
+
+		var names []string
+		for _, ds := range dsList.Items {
+			names = append(names, ds.Name)
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"my-oneagent-linux", "my-oneagent-gpu"}, names())
+
+	// Removing a group deletes its DaemonSet.
+	instance.Spec.NodeGroups = instance.Spec.NodeGroups[:1]
+	_, err = r.reconcileRollout(context.TODO(), consoleLogger, instance, &dtclient.MockDynatraceClient{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"my-oneagent-linux"}, names())
+}
+
+func TestDetermineOneAgentPhase_NodeGroups(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{{Name: "linux"}, {Name: "gpu"}}
+
+	newDaemonSet := func(name string, scheduled, ready int32) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: instance.Namespace},
+			Status: appsv1.DaemonSetStatus{
+				DesiredNumberScheduled: scheduled,
+				CurrentNumberScheduled: scheduled,
+				UpdatedNumberScheduled: scheduled,
+				NumberReady:            ready,
+			},
+		}
+	}
+
+	gpu := newDaemonSet("my-oneagent-gpu", 2, 1)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, newDaemonSet("my-oneagent-linux", 3, 3), gpu).Build()
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+
+	upd, err := r.determineOneAgentPhase(context.TODO(), instance)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, dynatracev1alpha1.Deploying, instance.Status.Phase)
+	assert.Equal(t, []dynatracev1alpha1.OneAgentNodeGroupStatus{
+		{Name: "linux", DaemonSet: "my-oneagent-linux", Phase: dynatracev1alpha1.Running, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 3},
+		{Name: "gpu", DaemonSet: "my-oneagent-gpu", Phase: dynatracev1alpha1.Deploying, DesiredNumberScheduled: 2, NumberReady: 1, UpdatedNumberScheduled: 2},
+	}, instance.Status.NodeGroups)
+
+	gpu.Status.NumberReady = 2
+	require.NoError(t, c.Update(context.TODO(), gpu))
+
+	upd, err = r.determineOneAgentPhase(context.TODO(), instance)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, dynatracev1alpha1.Running, instance.Status.Phase)
+
+	upd, err = r.determineOneAgentPhase(context.TODO(), instance)
+	require.NoError(t, err)
+	assert.False(t, upd)
+}
+
+func TestValidateNodeGroups(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{
+		{Name: "linux", NodeSelector: map[string]string{"pool": "default"}},
+		{Name: "gpu", NodeSelector: map[string]string{"pool": "gpu", "zone": "a"}},
+	}
+	assert.Empty(t, validateNodeGroups(instance, field.NewPath("spec", "nodeGroups")))
+
+	// A single group may use the selector on the OneAgent spec.
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{{Name: "linux"}}
+	assert.Empty(t, validateNodeGroups(instance, field.NewPath("spec", "nodeGroups")))
+
+	selector := map[string]string{"pool": "default"}
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{
+		{Name: "linux", NodeSelector: selector}, {Name: "linux", NodeSelector: map[string]string{"pool": "other"}},
+		{Name: "GPU", NodeSelector: map[string]string{"pool": "gpu"}}, {Name: "", NodeSelector: map[string]string{"zone": "b"}},
+	}
+	// The last group also overlaps with all others.
+	assert.Len(t, validateNodeGroups(instance, field.NewPath("spec", "nodeGroups")), 6)
+
+	instance.Name = "a-very-long-oneagent-name-which-barely-fits-on-a-daemonset"
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{{Name: "workers"}}
+	assert.Len(t, validateNodeGroups(instance, field.NewPath("spec", "nodeGroups")), 1)
+}
+
+func TestValidateNodeGroups_Selectors(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.NodeSelector = map[string]string{"pool": "default"}
+	instance.Spec.NodeGroups = []dynatracev1alpha1.OneAgentNodeGroup{
+		{Name: "linux"},
+		{Name: "gpu", NodeSelector: map[string]string{"pool": "gpu"}},
+		{Name: "gpu-a", NodeSelector: map[string]string{"pool": "gpu", "zone": "a"}},
+		{Name: "zone-b", NodeSelector: map[string]string{"zone": "b"}},
+	}
+
+	assert.Equal(t, []string{
+		"spec.nodeGroups[0].nodeSelector: Required value: needed if there's more than one group, so that these deploy to different nodes",
+		"spec.nodeGroups[2].nodeSelector: Forbidden: can match the same nodes as spec.nodeGroups[1].nodeSelector",
+		"spec.nodeGroups[3].nodeSelector: Forbidden: can match the same nodes as spec.nodeGroups[1].nodeSelector",
+	}, errorStrings(validateNodeGroups(instance, field.NewPath("spec", "nodeGroups"))))
+}
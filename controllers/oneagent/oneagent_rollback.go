@@ -0,0 +1,246 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// number of container restarts after which a pod that isn't ready is considered to be failing
+const rollbackRestartThreshold = int32(3)
+
+// reconcileVersionHealth looks for failing pods running the current OneAgent version, and rolls back to the last known
+// good version if any are found. Otherwise, the current version is recorded as the last known good one once it's ready
+// on all nodes.
+//
+// Returns true if the status has been modified.
+func (r *ReconcileOneAgent) reconcileVersionHealth(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client) (bool, error) {
+	version, hash := currentVersion(instance)
+	if version == "" || instance.Status.FailedVersion != "" {
+		return false, nil
+	}
+
+	pods, err := r.findPods(ctx, instance)
+	if err != nil {
+		return false, err
+	}
+
+	if unhealthy := findUnhealthyPods(updatedPods(instance, pods, version), readyTimeout(instance), time.Now()); len(unhealthy) > 0 {
+		nodes := make([]string, 0, len(unhealthy))
+		for _, pod := range unhealthy {
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+		r.rollbackVersion(ctx, logger, instance, dtc, version, fmt.Sprintf("pods failing on nodes: %s", strings.Join(nodes, ", ")))
+		return true, nil
+	}
+
+	if version == instance.Status.LastKnownGoodVersion && hash == instance.Status.LastKnownGoodImageHash {
+		return false, nil
+	}
+
+	if ok, err := r.isVersionRolledOut(ctx, instance, pods, version); err != nil || !ok {
+		return false, err
+	}
+
+	logger.Info("version is ready on all nodes", "version", version)
+	instance.Status.LastKnownGoodVersion = version
+	instance.Status.LastKnownGoodImageHash = hash
+	utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.UpdateFailedConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  dynatracev1alpha1.ReasonUpdateSucceeded,
+		Message: fmt.Sprintf("Version %s is ready on all nodes", version),
+	})
+	return true, nil
+}
+
+// rollbackVersion marks the version as failed and reverts to the last known good version if available, in which case
+// the DaemonSet gets pinned to it. Sets the UpdateFailed condition and emits an event for the instance and its hosts.
+func (r *ReconcileOneAgent) rollbackVersion(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, failed string, cause string) {
+	sts := &instance.Status
+	sts.FailedVersion = failed
+
+	if sts.LastKnownGoodVersion == "" || (sts.UseImmutableImage && sts.LastKnownGoodImageHash == "") {
+		// The rollout of the failed version stops, same as when rolling back.
+		if rs := sts.Rollout; rs != nil && rs.TargetVersion == failed {
+			rs.Phase = dynatracev1alpha1.RolloutHalted
+			rs.Message = "no known good version to roll back to"
+			rs.PendingNodes = nil
+			rs.Restart = nil
+		}
+
+		msg := fmt.Sprintf("Version %s failed health checks, no known good version to roll back to: %s", failed, cause)
+		logger.Info("update failed", "version", failed, "cause", cause)
+		r.setUpdateFailed(instance, dynatracev1alpha1.ReasonNoKnownGoodVersion, msg)
+		r.sendLifecycleEvent(ctx, logger, instance, dtc, instanceNodes(instance), fmt.Sprintf("OneAgent rollout failed: %s.", msg))
+		return
+	}
+
+	if sts.UseImmutableImage {
+		sts.ImageVersion = sts.LastKnownGoodVersion
+		sts.ImageHash = sts.LastKnownGoodImageHash
+	}
+
+	if rs := sts.Rollout; rs != nil && rs.TargetVersion == failed {
+		rs.Phase = dynatracev1alpha1.RolloutHalted
+		rs.Message = fmt.Sprintf("rolled back to version %s", sts.LastKnownGoodVersion)
+		rs.PendingNodes = nil
+		rs.Restart = nil
+	}
+
+	msg := fmt.Sprintf("Version %s failed health checks, rolled back to %s: %s", failed, sts.LastKnownGoodVersion, cause)
+	logger.Info("update failed, rolling back", "version", failed, "lastKnownGood", sts.LastKnownGoodVersion, "cause", cause)
+	r.setUpdateFailed(instance, dynatracev1alpha1.ReasonRolledBack, msg)
+	r.sendLifecycleEvent(ctx, logger, instance, dtc, instanceNodes(instance), fmt.Sprintf("OneAgent rollout failed: %s.", msg))
+}
+
+func (r *ReconcileOneAgent) setUpdateFailed(instance *dynatracev1alpha1.OneAgent, reason, msg string) {
+	utils.SetCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.UpdateFailedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	})
+	r.recorder.Event(instance, corev1.EventTypeWarning, dynatracev1alpha1.UpdateFailedConditionType, msg)
+}
+
+// isVersionRolledOut returns true if all OneAgent pods run the version and are ready.
+func (r *ReconcileOneAgent) isVersionRolledOut(ctx context.Context, instance *dynatracev1alpha1.OneAgent, pods []corev1.Pod, version string) (bool, error) {
+	if !instance.Status.UseImmutableImage {
+		rs := instance.Status.Rollout
+		if rs == nil || rs.TargetVersion != version || rs.Phase != dynatracev1alpha1.RolloutCompleted || len(pods) == 0 {
+			return false, nil
+		}
+
+		for i := range pods {
+			if !getPodReadyState(&pods[i]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	for _, group := range nodeGroups(instance) {
+		var ds appsv1.DaemonSet
+		if err := r.client.Get(ctx, types.NamespacedName{Name: daemonSetName(instance, group), Namespace: instance.Namespace}, &ds); k8serrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		sts := ds.Status
+		if ds.Spec.Template.Annotations[annotationImageVersion] != version ||
+			sts.ObservedGeneration < ds.Generation ||
+			sts.UpdatedNumberScheduled != sts.DesiredNumberScheduled ||
+			sts.NumberReady != sts.DesiredNumberScheduled {
+			return false, nil
+		}
+	}
+
+	// Node groups may not have any nodes, but at least one pod needs to be ready.
+	return len(pods) > 0, nil
+}
+
+// currentVersion returns the OneAgent version, and image hash if using immutable images, currently deployed.
+func currentVersion(instance *dynatracev1alpha1.OneAgent) (string, string) {
+	if instance.Status.UseImmutableImage {
+		return instance.Status.ImageVersion, instance.Status.ImageHash
+	}
+	return instance.Status.Version, ""
+}
+
+// updatedPods returns the pods which have been updated to the version since the last known good one.
+func updatedPods(instance *dynatracev1alpha1.OneAgent, pods []corev1.Pod, version string) []corev1.Pod {
+	if version == instance.Status.LastKnownGoodVersion {
+		return nil
+	}
+
+	var updated []corev1.Pod
+
+	if instance.Status.UseImmutableImage {
+		for _, pod := range pods {
+			if pod.Annotations[annotationImageVersion] == version {
+				updated = append(updated, pod)
+			}
+		}
+		return updated
+	}
+
+	rs := instance.Status.Rollout
+	if rs == nil || rs.TargetVersion != version {
+		return nil
+	}
+
+	nodes := map[string]bool{}
+	for _, node := range rs.UpdatedNodes {
+		nodes[node] = true
+	}
+	if rs.Restart != nil {
+		nodes[rs.Restart.NodeName] = true
+	}
+
+	for _, pod := range pods {
+		if nodes[pod.Spec.NodeName] {
+			updated = append(updated, pod)
+		}
+	}
+	return updated
+}
+
+// findUnhealthyPods returns the pods which are crash looping, restarting repeatedly, or not getting ready within the
+// timeout.
+func findUnhealthyPods(pods []corev1.Pod, timeout time.Duration, now time.Time) []corev1.Pod {
+	var unhealthy []corev1.Pod
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || getPodReadyState(&pod) {
+			continue
+		}
+
+		failing := !pod.CreationTimestamp.IsZero() && pod.CreationTimestamp.Add(timeout).Before(now)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.RestartCount >= rollbackRestartThreshold || (cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff") {
+				failing = true
+			}
+		}
+
+		if failing {
+			unhealthy = append(unhealthy, pod)
+		}
+	}
+
+	return unhealthy
+}
+
+// readyTimeout returns how long pods are expected to take to get ready.
+func readyTimeout(instance *dynatracev1alpha1.OneAgent) time.Duration {
+	var waitSecs uint16 = 300
+	if instance.GetOneAgentSpec().WaitReadySeconds != nil {
+		waitSecs = *instance.GetOneAgentSpec().WaitReadySeconds
+	}
+	return time.Duration(waitSecs) * time.Second
+}
+
+// isRolledBack returns true if the DaemonSet needs to be pinned to the last known good version.
+func isRolledBack(instance *dynatracev1alpha1.OneAgent) bool {
+	sts := instance.Status
+	return sts.FailedVersion != "" && sts.LastKnownGoodVersion != "" && (!sts.UseImmutableImage || sts.LastKnownGoodImageHash != "")
+}
+
+// isRollbackRolloutPending returns true if the pods still need to be restarted by the Operator to get back to the last
+// known good version, since the DaemonSet uses OnDelete updates.
+func isRollbackRolloutPending(instance *dynatracev1alpha1.OneAgent) bool {
+	rs := instance.Status.Rollout
+	return isRolledBack(instance) && usesOnDeleteUpdates(instance) && (rs == nil || rs.TargetVersion != instance.Status.LastKnownGoodVersion)
+}
@@ -0,0 +1,174 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFindUnhealthyPods(t *testing.T) {
+	now := time.Now()
+	timeout := 5 * time.Minute
+
+	newPod := func(name string, created time.Time, ready bool, cs corev1.ContainerStatus) corev1.Pod {
+		cs.Ready = ready
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{cs}},
+		}
+	}
+
+	pods := []corev1.Pod{
+		newPod("ready", now.Add(-time.Hour), true, corev1.ContainerStatus{RestartCount: 5}),
+		newPod("starting", now.Add(-time.Minute), false, corev1.ContainerStatus{}),
+		newPod("crash-loop", now.Add(-time.Minute), false, corev1.ContainerStatus{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}),
+		newPod("restarting", now.Add(-time.Minute), false, corev1.ContainerStatus{RestartCount: rollbackRestartThreshold}),
+		newPod("not-ready", now.Add(-time.Hour), false, corev1.ContainerStatus{}),
+	}
+
+	var names []string
+	for _, pod := range findUnhealthyPods(pods, timeout, now) {
+		names = append(names, pod.Name)
+	}
+	assert.Equal(t, []string{"crash-loop", "restarting", "not-ready"}, names)
+}
+
+func TestReconcileVersionHealth_ImmutableImage(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Status.UseImmutableImage = true
+	instance.Status.ImageVersion = "1.203.0"
+	instance.Status.ImageHash = "sha256:203"
+
+	labels := buildLabels(instance.Name)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "oneagent-1",
+			Namespace:   instance.Namespace,
+			Labels:      labels,
+			Annotations: map[string]string{annotationImageVersion: "1.203.0"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node1"},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{Ready: true}},
+		},
+	}
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace},
+		Spec: appsv1.DaemonSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationImageVersion: "1.203.0"}},
+			},
+		},
+		Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 1, UpdatedNumberScheduled: 1, NumberReady: 1},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, pod, ds).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: recorder}
+
+	// Version gets ready on all nodes.
+	upd, err := r.reconcileVersionHealth(context.TODO(), consoleLogger, instance, nil)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, "1.203.0", instance.Status.LastKnownGoodVersion)
+	assert.Equal(t, "sha256:203", instance.Status.LastKnownGoodImageHash)
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, dynatracev1alpha1.UpdateFailedConditionType))
+
+	upd, err = r.reconcileVersionHealth(context.TODO(), consoleLogger, instance, nil)
+	require.NoError(t, err)
+	assert.False(t, upd)
+
+	// A new version is crash looping.
+	instance.Status.ImageVersion = "1.204.0"
+	instance.Status.ImageHash = "sha256:204"
+	pod.Annotations[annotationImageVersion] = "1.204.0"
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+	require.NoError(t, c.Update(context.TODO(), pod))
+
+	upd, err = r.reconcileVersionHealth(context.TODO(), consoleLogger, instance, nil)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, "1.204.0", instance.Status.FailedVersion)
+	assert.Equal(t, "1.203.0", instance.Status.ImageVersion)
+	assert.Equal(t, "sha256:203", instance.Status.ImageHash)
+	assert.True(t, isRolledBack(instance))
+
+	cond := meta.FindStatusCondition(instance.Status.Conditions, dynatracev1alpha1.UpdateFailedConditionType)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		assert.Equal(t, dynatracev1alpha1.ReasonRolledBack, cond.Reason)
+		assert.Contains(t, cond.Message, "node1")
+	}
+
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Warning UpdateFailed Version 1.204.0 failed health checks, rolled back to 1.203.0")
+	}
+
+	dsDesired, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Equal(t, "ENVIRONMENTID.live.dynatrace.com/linux/oneagent@sha256:203", dsDesired.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestReconcileVersionHealth_Installer(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Status.Version = "1.203.0"
+	instance.Status.Rollout = &dynatracev1alpha1.OneAgentRolloutStatus{
+		TargetVersion: "1.203.0",
+		Phase:         dynatracev1alpha1.RolloutCompleted,
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent-1", Namespace: instance.Namespace, Labels: buildLabels(instance.Name)},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Ready: true}}},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(instance, pod).Build()
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: record.NewFakeRecorder(10)}
+
+	upd, err := r.reconcileVersionHealth(context.TODO(), consoleLogger, instance, nil)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, "1.203.0", instance.Status.LastKnownGoodVersion)
+
+	// The pod restarted for the new version keeps failing.
+	instance.Status.Version = "1.204.0"
+	instance.Status.Rollout = &dynatracev1alpha1.OneAgentRolloutStatus{
+		TargetVersion: "1.204.0",
+		Phase:         dynatracev1alpha1.RolloutProgressing,
+		Restart:       &dynatracev1alpha1.OneAgentRestartStatus{NodeName: "node1", Attempt: 1},
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{RestartCount: rollbackRestartThreshold}}
+	require.NoError(t, c.Update(context.TODO(), pod))
+
+	upd, err = r.reconcileVersionHealth(context.TODO(), consoleLogger, instance, nil)
+	require.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, "1.204.0", instance.Status.FailedVersion)
+	assert.Equal(t, dynatracev1alpha1.RolloutHalted, instance.Status.Rollout.Phase)
+	assert.Nil(t, instance.Status.Rollout.Restart)
+
+	dsDesired, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Contains(t, dsDesired.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
+		Name:  "ONEAGENT_INSTALLER_SCRIPT_URL",
+		Value: "https://ENVIRONMENTID.live.dynatrace.com/api/v1/deployment/installer/agent/unix/default/version/1.203.0?Api-Token=$(ONEAGENT_INSTALLER_TOKEN)&arch=x86&flavor=default",
+	})
+}
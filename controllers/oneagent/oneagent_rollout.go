@@ -0,0 +1,147 @@
+package oneagent
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// prepareRollout returns the status of the rollout for the target version, starting a new one if the target version
+// changed since the last reconciliation.
+//
+// Returns true if the status has been modified.
+func prepareRollout(instance *dynatracev1alpha1.OneAgent, target string) (*dynatracev1alpha1.OneAgentRolloutStatus, bool) {
+	if rs := instance.Status.Rollout; rs != nil && rs.TargetVersion == target {
+		return rs, false
+	}
+
+	phase := dynatracev1alpha1.RolloutProgressing
+	if s := instance.Spec.RolloutStrategy; s != nil && s.Canary != nil {
+		phase = dynatracev1alpha1.RolloutCanary
+	}
+
+	instance.Status.Rollout = &dynatracev1alpha1.OneAgentRolloutStatus{
+		TargetVersion: target,
+		Phase:         phase,
+	}
+	return instance.Status.Rollout, true
+}
+
+// isRolloutInProgress returns true if a rollout has started but not yet completed or halted.
+func isRolloutInProgress(instance *dynatracev1alpha1.OneAgent) bool {
+	rs := instance.Status.Rollout
+	return rs != nil && (rs.Phase == dynatracev1alpha1.RolloutCanary || rs.Phase == dynatracev1alpha1.RolloutProgressing)
+}
+
+// rolloutPause returns the remaining time to wait before the next batch can be started.
+func rolloutPause(instance *dynatracev1alpha1.OneAgent, now time.Time) time.Duration {
+	s := instance.Spec.RolloutStrategy
+	rs := instance.Status.Rollout
+	if s == nil || s.PauseSeconds == nil || rs == nil || rs.LastBatchTimestamp == nil {
+		return 0
+	}
+
+	if next := rs.LastBatchTimestamp.Add(time.Duration(*s.PauseSeconds) * time.Second); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// rolloutRequeueAfter returns the delay until the next batch of the rollout should be attempted.
+func rolloutRequeueAfter(instance *dynatracev1alpha1.OneAgent, now time.Time) time.Duration {
+	if instance.Status.Rollout.Restart != nil {
+		return time.Duration(splayTimeSeconds) * time.Second
+	}
+	if d := rolloutPause(instance, now); d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// selectRolloutBatch returns the outdated pods to be restarted on the next batch, out of the total number of nodes
+// where OneAgent pods are running.
+func selectRolloutBatch(instance *dynatracev1alpha1.OneAgent, outdated []corev1.Pod, total int) ([]corev1.Pod, error) {
+	s := instance.Spec.RolloutStrategy
+	rs := instance.Status.Rollout
+
+	size := len(outdated)
+	if s != nil {
+		v := s.BatchSize
+		if rs != nil && rs.Phase == dynatracev1alpha1.RolloutCanary {
+			v = s.Canary
+		}
+
+		if v != nil {
+			n, err := intstr.GetValueFromIntOrPercent(v, total, true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rollout strategy: %w", err)
+			}
+			if n < 1 {
+				n = 1
+			}
+			if n < size {
+				size = n
+			}
+		}
+	}
+
+	// Sort by node name so that batches are stable across reconciliations.
+	batch := make([]corev1.Pod, len(outdated))
+	copy(batch, outdated)
+	sort.Slice(batch, func(i, j int) bool { return batch[i].Spec.NodeName < batch[j].Spec.NodeName })
+
+	return batch[:size], nil
+}
+
+// filterUpdatedNodes returns the outdated pods which are not on the nodes already restarted for the current rollout.
+func filterUpdatedNodes(instance *dynatracev1alpha1.OneAgent, outdated []corev1.Pod) []corev1.Pod {
+	updated := map[string]bool{}
+	for _, node := range instance.Status.Rollout.UpdatedNodes {
+		updated[node] = true
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range outdated {
+		if !updated[pod.Spec.NodeName] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// startRolloutBatch marks the nodes of the batch as pending to be restarted.
+func startRolloutBatch(instance *dynatracev1alpha1.OneAgent, batch []corev1.Pod) {
+	rs := instance.Status.Rollout
+	rs.PendingNodes = nil
+	for _, pod := range batch {
+		rs.PendingNodes = append(rs.PendingNodes, pod.Spec.NodeName)
+	}
+}
+
+// completeRolloutBatch records the end of the current batch, and moves the rollout out of the canary phase.
+func completeRolloutBatch(instance *dynatracev1alpha1.OneAgent, now metav1.Time) {
+	rs := instance.Status.Rollout
+	rs.PendingNodes = nil
+	rs.Batches++
+	rs.LastBatchTimestamp = &now
+	rs.Phase = dynatracev1alpha1.RolloutProgressing
+}
+
+// haltRollout stops the rollout if a rollout strategy is set and configured to do so when a batch failed. Returns true
+// if the rollout got halted.
+func haltRollout(instance *dynatracev1alpha1.OneAgent, err error) bool {
+	if s := instance.Spec.RolloutStrategy; s == nil || (s.HaltOnFailure != nil && !*s.HaltOnFailure) {
+		return false
+	}
+
+	rs := instance.Status.Rollout
+	rs.Phase = dynatracev1alpha1.RolloutHalted
+	rs.Message = err.Error()
+	rs.PendingNodes = nil
+	return true
+}
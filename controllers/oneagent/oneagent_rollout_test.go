@@ -0,0 +1,170 @@
+package oneagent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newRolloutPods(nodes ...string) []corev1.Pod {
+	pods := make([]corev1.Pod, len(nodes))
+	for i, n := range nodes {
+		pods[i] = corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "oneagent-" + n},
+			Spec:       corev1.PodSpec{NodeName: n},
+		}
+	}
+	return pods
+}
+
+func TestPrepareRollout(t *testing.T) {
+	t.Run("without strategy", func(t *testing.T) {
+		instance := dynatracev1alpha1.OneAgent{}
+
+		rs, upd := prepareRollout(&instance, "1.203.0")
+		assert.True(t, upd)
+		assert.Equal(t, "1.203.0", rs.TargetVersion)
+		assert.Equal(t, dynatracev1alpha1.RolloutProgressing, rs.Phase)
+		assert.True(t, isRolloutInProgress(&instance))
+
+		_, upd = prepareRollout(&instance, "1.203.0")
+		assert.False(t, upd)
+	})
+
+	t.Run("with canary, resets on new version", func(t *testing.T) {
+		canary := intstr.FromInt(1)
+		instance := dynatracev1alpha1.OneAgent{
+			Spec: dynatracev1alpha1.OneAgentSpec{
+				RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{Canary: &canary},
+			},
+			Status: dynatracev1alpha1.OneAgentStatus{
+				Rollout: &dynatracev1alpha1.OneAgentRolloutStatus{
+					TargetVersion: "1.203.0",
+					Phase:         dynatracev1alpha1.RolloutHalted,
+					UpdatedNodes:  []string{"node1"},
+					Batches:       1,
+				},
+			},
+		}
+
+		rs, upd := prepareRollout(&instance, "1.203.0")
+		assert.False(t, upd)
+		assert.Equal(t, dynatracev1alpha1.RolloutHalted, rs.Phase)
+		assert.False(t, isRolloutInProgress(&instance))
+
+		rs, upd = prepareRollout(&instance, "1.204.0")
+		assert.True(t, upd)
+		assert.Equal(t, dynatracev1alpha1.RolloutCanary, rs.Phase)
+		assert.Empty(t, rs.UpdatedNodes)
+		assert.Equal(t, int32(0), rs.Batches)
+	})
+}
+
+func TestSelectRolloutBatch(t *testing.T) {
+	outdated := newRolloutPods("node3", "node1", "node4", "node2")
+
+	t.Run("without strategy, all pods", func(t *testing.T) {
+		instance := dynatracev1alpha1.OneAgent{}
+		prepareRollout(&instance, "1.203.0")
+
+		batch, err := selectRolloutBatch(&instance, outdated, 10)
+		require.NoError(t, err)
+		assert.Len(t, batch, 4)
+		assert.Equal(t, "node1", batch[0].Spec.NodeName)
+		assert.Equal(t, "node4", batch[3].Spec.NodeName)
+	})
+
+	t.Run("canary, then batches by percentage", func(t *testing.T) {
+		canary := intstr.FromInt(1)
+		batchSize := intstr.FromString("25%")
+		instance := dynatracev1alpha1.OneAgent{
+			Spec: dynatracev1alpha1.OneAgentSpec{
+				RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{Canary: &canary, BatchSize: &batchSize},
+			},
+		}
+		prepareRollout(&instance, "1.203.0")
+
+		batch, err := selectRolloutBatch(&instance, outdated, 10)
+		require.NoError(t, err)
+		if assert.Len(t, batch, 1) {
+			assert.Equal(t, "node1", batch[0].Spec.NodeName)
+		}
+
+		startRolloutBatch(&instance, batch)
+		assert.Equal(t, []string{"node1"}, instance.Status.Rollout.PendingNodes)
+
+		completeRolloutBatch(&instance, metav1.Now())
+		assert.Equal(t, dynatracev1alpha1.RolloutProgressing, instance.Status.Rollout.Phase)
+		assert.Empty(t, instance.Status.Rollout.PendingNodes)
+		assert.Equal(t, int32(1), instance.Status.Rollout.Batches)
+
+		// 25% of 10 nodes, rounded up.
+		batch, err = selectRolloutBatch(&instance, newRolloutPods("node3", "node4", "node2"), 10)
+		require.NoError(t, err)
+		if assert.Len(t, batch, 3) {
+			assert.Equal(t, "node2", batch[0].Spec.NodeName)
+		}
+	})
+
+	t.Run("invalid batch size", func(t *testing.T) {
+		batchSize := intstr.FromString("many")
+		instance := dynatracev1alpha1.OneAgent{
+			Spec: dynatracev1alpha1.OneAgentSpec{
+				RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{BatchSize: &batchSize},
+			},
+		}
+		prepareRollout(&instance, "1.203.0")
+
+		_, err := selectRolloutBatch(&instance, outdated, 10)
+		assert.Error(t, err)
+	})
+}
+
+func TestRolloutPause(t *testing.T) {
+	var pause uint16 = 60
+	now := time.Now()
+	last := metav1.NewTime(now.Add(-20 * time.Second))
+
+	instance := dynatracev1alpha1.OneAgent{
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{PauseSeconds: &pause},
+		},
+		Status: dynatracev1alpha1.OneAgentStatus{
+			Rollout: &dynatracev1alpha1.OneAgentRolloutStatus{
+				Phase:              dynatracev1alpha1.RolloutProgressing,
+				LastBatchTimestamp: &last,
+			},
+		},
+	}
+
+	assert.Equal(t, 40*time.Second, rolloutPause(&instance, now))
+	assert.Equal(t, 40*time.Second, rolloutRequeueAfter(&instance, now))
+	assert.Equal(t, time.Duration(0), rolloutPause(&instance, now.Add(time.Minute)))
+	assert.Equal(t, 30*time.Second, rolloutRequeueAfter(&instance, now.Add(time.Minute)))
+}
+
+func TestHaltRollout(t *testing.T) {
+	err := errors.New("pod didn't get ready")
+
+	instance := dynatracev1alpha1.OneAgent{}
+	prepareRollout(&instance, "1.203.0")
+	assert.False(t, haltRollout(&instance, err))
+	assert.Equal(t, dynatracev1alpha1.RolloutProgressing, instance.Status.Rollout.Phase)
+
+	haltOnFailure := false
+	instance.Spec.RolloutStrategy = &dynatracev1alpha1.OneAgentRolloutStrategy{HaltOnFailure: &haltOnFailure}
+	assert.False(t, haltRollout(&instance, err))
+
+	instance.Spec.RolloutStrategy.HaltOnFailure = nil
+	assert.True(t, haltRollout(&instance, err))
+	assert.Equal(t, dynatracev1alpha1.RolloutHalted, instance.Status.Rollout.Phase)
+	assert.Equal(t, err.Error(), instance.Status.Rollout.Message)
+	assert.False(t, isRolloutInProgress(&instance))
+}
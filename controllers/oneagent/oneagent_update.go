@@ -2,15 +2,18 @@ package oneagent
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -24,66 +27,244 @@ func (r *ReconcileOneAgent) reconcileVersion(ctx context.Context, logger logr.Lo
 func (r *ReconcileOneAgent) reconcileVersionInstaller(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client) (bool, error) {
 	updateCR := false
 
-	desired, err := dtc.GetLatestAgentVersion(dtclient.OsUnix, dtclient.InstallerTypeDefault)
+	desired, err := resolveDesiredVersion(ctx, logger, instance, dtc, instance.Status.Version)
 	if err != nil {
 		return false, fmt.Errorf("failed to get desired version: %w", err)
 	} else if desired != "" && desired != instance.Status.Version {
+		logger.Info("new version available", "actual", instance.Status.Version, "desired", desired)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventVersionChanged, "Desired version changed from %s to %s", instance.Status.Version, desired)
 		instance.Status.Version = desired
 		updateCR = true
-		if isDesiredNewer(instance.Status.Version, desired, logger) {
-			logger.Info("new version available", "actual", instance.Status.Version, "desired", desired)
+		if desired != instance.Status.FailedVersion {
+			instance.Status.FailedVersion = ""
 		}
 	}
 
+	// Once rolled back with OnDelete updates, the pods are restarted by the Operator to get back to the last known good
+	// version, which the DaemonSet got pinned to. Otherwise the failed version isn't rolled out any further.
+	target := instance.Status.Version
+	rolledBack := instance.Status.FailedVersion != "" && isRolledBack(instance) && usesOnDeleteUpdates(instance)
+	if rolledBack {
+		target = instance.Status.LastKnownGoodVersion
+	} else if instance.Status.FailedVersion != "" {
+		logger.Info("version failed health checks, waiting for a new version", "version", instance.Status.FailedVersion)
+		return updateCR, nil
+	}
+
+	rollout, upd := prepareRollout(instance, target)
+	if upd && rolledBack {
+		// The failed version is already disrupting the nodes, so there's nothing to gain from a canary.
+		rollout.Phase = dynatracev1alpha1.RolloutProgressing
+	}
+	updateCR = updateCR || upd
+
+	if rollout.Restart != nil {
+		done, err := r.reconcilePodRestart(ctx, logger, instance)
+		if err != nil {
+			// Versions only get rolled back by the health checks, a single node failing to get ready is retried unless
+			// the rollout strategy halts on failures.
+			if haltRollout(instance, err) {
+				logger.Error(err, "rollout halted since pod failed to get ready", "version", rollout.TargetVersion)
+				r.sendLifecycleEvent(ctx, logger, instance, dtc, instanceNodes(instance),
+					fmt.Sprintf("OneAgent rollout of version %s halted: %s.", rollout.TargetVersion, err.Error()))
+				return true, nil
+			}
+			logger.Error(err, "failed to update version")
+			return true, err
+		}
+
+		if !done {
+			return true, nil
+		}
+		updateCR = true
+	}
+
 	podList, err := r.findPods(ctx, instance)
 	if err != nil {
 		logger.Error(err, "failed to list pods", "podList", podList)
 		return updateCR, err
 	}
 
-	podsToDelete, err := findOutdatedPodsInstaller(podList, dtc, instance, logger)
-	if err != nil {
-		return updateCR, err
+	// The agent versions are compared with the failed version, so only the template tells which pods to restart.
+	var podsToDelete []corev1.Pod
+	if !rolledBack {
+		podsToDelete, err = findOutdatedPodsInstaller(ctx, podList, dtc, instance, logger)
+		if err != nil {
+			return updateCR, err
+		}
 	}
 
-	var waitSecs uint16 = 300
-	if instance.GetOneAgentSpec().WaitReadySeconds != nil {
-		waitSecs = *instance.GetOneAgentSpec().WaitReadySeconds
+	// Skip the nodes already restarted, since the new agent version may not have been reported yet.
+	podsToDelete = filterUpdatedNodes(instance, podsToDelete)
+
+	if usesOnDeleteUpdates(instance) {
+		// The DaemonSet doesn't replace the pods by itself, including those running a previous configuration.
+		stale, err := r.findPodsWithOutdatedTemplate(ctx, instance, podList)
+		if err != nil {
+			return updateCR, err
+		}
+		podsToDelete = mergePods(podsToDelete, stale)
 	}
 
-	if len(podsToDelete) > 0 {
-		if instance.GetOneAgentStatus().SetPhase(dynatracev1alpha1.Deploying) {
-			err := r.updateCR(ctx, instance)
-			if err != nil {
-				logger.Error(err, fmt.Sprintf("failed to set phase to %s", dynatracev1alpha1.Deploying))
-			}
+	if len(podsToDelete) == 0 {
+		if rollout.Phase != dynatracev1alpha1.RolloutCompleted || len(rollout.PendingNodes) > 0 {
+			rollout.Phase = dynatracev1alpha1.RolloutCompleted
+			rollout.PendingNodes = nil
+			updateCR = true
+		}
+		return updateCR, nil
+	}
+
+	if rollout.Phase == dynatracev1alpha1.RolloutHalted {
+		logger.Info("rollout halted, waiting for a new version", "version", rollout.TargetVersion, "reason", rollout.Message)
+		return updateCR, nil
+	}
+
+	if !isInMaintenanceWindow(instance) && !rolledBack {
+		logger.Info("outdated pods found, restarts deferred until next maintenance window", "outdated", len(podsToDelete))
+		return updateCR, nil
+	}
+
+	if len(rollout.PendingNodes) == 0 {
+		if d := rolloutPause(instance, time.Now()); d > 0 {
+			logger.Info("waiting before starting next rollout batch", "remaining", d.String())
+			return updateCR, nil
 		}
+
+		batch, err := selectRolloutBatch(instance, podsToDelete, len(podList))
+		if err != nil {
+			return updateCR, err
+		}
+
+		logger.Info("starting rollout batch", "phase", rollout.Phase, "batch", rollout.Batches+1, "pods", len(batch), "outdated", len(podsToDelete))
+		startRolloutBatch(instance, batch)
+		updateCR = true
 	}
 
+	instance.GetOneAgentStatus().SetPhase(dynatracev1alpha1.Deploying)
+
 	// restart daemonset
-	err = r.deletePods(logger, podsToDelete, buildLabels(instance.GetName()), waitSecs)
-	if err != nil {
+	if err := r.restartNextPod(ctx, logger, instance, dtc, podsToDelete); err != nil {
 		logger.Error(err, "failed to update version")
-		return updateCR, err
+		return true, err
+	}
+
+	return true, nil
+}
+
+// reconcilePodRestart checks on the pod being restarted by the rollout, and deletes it again if it doesn't get ready in
+// time. Returns true once the new pod is ready.
+//
+// Returns an error if the pod failed to get ready after maxRestartAttempts.
+func (r *ReconcileOneAgent) reconcilePodRestart(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent) (bool, error) {
+	rollout := instance.Status.Rollout
+	restart := rollout.Restart
+
+	pods, err := r.findPodsOnNode(ctx, instance, restart.NodeName, restart.PodName)
+	if err != nil {
+		return false, err
+	}
+
+	if isPodRecreated(pods) {
+		logger.Info("pod recreated successfully on node", "node", restart.NodeName)
+		if !containsString(rollout.UpdatedNodes, restart.NodeName) {
+			rollout.UpdatedNodes = append(rollout.UpdatedNodes, restart.NodeName)
+		}
+		rollout.Restart = nil
+
+		if len(rollout.PendingNodes) == 0 {
+			completeRolloutBatch(instance, metav1.Now())
+		}
+		return true, nil
+	}
+
+	if restart.Deadline == nil || time.Now().Before(restart.Deadline.Time) {
+		logger.Info("waiting until pod is ready on node", "node", restart.NodeName, "attempt", restart.Attempt)
+		return false, nil
+	}
+
+	if restart.Attempt >= maxRestartAttempts {
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, eventPodNotReady, "Pod on node %s didn't get ready after %d attempts", restart.NodeName, restart.Attempt)
+		rollout.Restart = nil
+		if len(rollout.PendingNodes) == 0 {
+			completeRolloutBatch(instance, metav1.Now())
+		}
+		return false, fmt.Errorf("pod on node %s didn't get ready after %d attempts", restart.NodeName, restart.Attempt)
 	}
 
-	return updateCR, nil
+	logger.Info("pod didn't get ready on time, deleting it again", "node", restart.NodeName, "attempt", restart.Attempt)
+	for i := range pods {
+		if err := r.client.Delete(ctx, &pods[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return false, err
+		}
+		metrics.PodRestarts.WithLabelValues(instance.Namespace, instance.Name).Inc()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, eventPodNotReady, "Pod %s on node %s didn't get ready on time, restarting it again", pods[i].Name, restart.NodeName)
+		restart.PodName = pods[i].Name
+	}
+
+	restart.Attempt++
+	restart.Deadline = restartDeadline(instance)
+	return false, nil
+}
+
+// restartNextPod deletes the outdated pod on the next pending node of the current batch, and keeps track of it on the
+// status. Completes the batch if there are no pending nodes with outdated pods left.
+func (r *ReconcileOneAgent) restartNextPod(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, outdated []corev1.Pod) error {
+	rollout := instance.Status.Rollout
+
+	for len(rollout.PendingNodes) > 0 {
+		node := rollout.PendingNodes[0]
+		rollout.PendingNodes = rollout.PendingNodes[1:]
+
+		for i := range outdated {
+			pod := &outdated[i]
+			if pod.Spec.NodeName != node {
+				continue
+			}
+
+			logger.Info("deleting pod", "pod", pod.Name, "node", node)
+			if err := r.client.Delete(ctx, pod); err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+			metrics.PodRestarts.WithLabelValues(instance.Namespace, instance.Name).Inc()
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, eventPodRestarted, "Restarted pod %s on node %s to update to version %s", pod.Name, node, rollout.TargetVersion)
+			r.sendLifecycleEvent(ctx, logger, instance, dtc, []string{node},
+				fmt.Sprintf("OneAgent restarted by the OneAgent Operator to update to version %s.", rollout.TargetVersion))
+
+			rollout.Restart = &dynatracev1alpha1.OneAgentRestartStatus{
+				NodeName: node,
+				PodName:  pod.Name,
+				Attempt:  1,
+				Deadline: restartDeadline(instance),
+			}
+			return nil
+		}
+	}
+
+	completeRolloutBatch(instance, metav1.Now())
+	return nil
+}
+
+// restartDeadline returns the time until a restarted pod is expected to get ready.
+func restartDeadline(instance *dynatracev1alpha1.OneAgent) *metav1.Time {
+	deadline := metav1.NewTime(time.Now().Add(readyTimeout(instance)))
+	return &deadline
 }
 
 // findOutdatedPodsInstaller determines if a pod needs to be restarted in order to get the desired agent version
 // Returns an array of pods and an array of OneAgentInstance objects for status update
-func findOutdatedPodsInstaller(pods []corev1.Pod, dtc dtclient.Client, instance *dynatracev1alpha1.OneAgent, logger logr.Logger) ([]corev1.Pod, error) {
+func findOutdatedPodsInstaller(ctx context.Context, pods []corev1.Pod, dtc dtclient.Client, instance *dynatracev1alpha1.OneAgent, logger logr.Logger) ([]corev1.Pod, error) {
 	var doomedPods []corev1.Pod
 
 	for _, pod := range pods {
-		ver, err := dtc.GetAgentVersionForIP(pod.Status.HostIP)
+		ver, err := dtc.GetAgentVersionForIP(ctx, pod.Status.HostIP)
 		if err != nil {
 			err = handleAgentVersionForIPError(err, instance, pod, nil)
 			if err != nil {
 				return doomedPods, err
 			}
 		} else {
-			if isDesiredNewer(ver, instance.Status.Version, logger) {
+			if isOutdated(ver, instance, logger) {
 				doomedPods = append(doomedPods, pod)
 			}
 		}
@@ -92,6 +273,47 @@ func findOutdatedPodsInstaller(pods []corev1.Pod, dtc dtclient.Client, instance
 	return doomedPods, nil
 }
 
+// findPodsWithOutdatedTemplate returns the pods which don't run the current template of their DaemonSet.
+func (r *ReconcileOneAgent) findPodsWithOutdatedTemplate(ctx context.Context, instance *dynatracev1alpha1.OneAgent, pods []corev1.Pod) ([]corev1.Pod, error) {
+	hashes := map[string]string{}
+	for _, group := range nodeGroups(instance) {
+		var ds appsv1.DaemonSet
+		name := daemonSetName(instance, group)
+		if err := r.client.Get(ctx, client.ObjectKey{Name: name, Namespace: instance.Namespace}, &ds); k8serrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		hashes[name] = getTemplateHash(&ds)
+	}
+
+	var outdated []corev1.Pod
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(&pod)
+		if owner == nil || owner.Kind != "DaemonSet" {
+			continue
+		}
+		if hash, ok := hashes[owner.Name]; ok && pod.Annotations[annotationTemplateHash] != hash {
+			outdated = append(outdated, pod)
+		}
+	}
+	return outdated, nil
+}
+
+// mergePods returns the pods in a, followed by the ones in b which aren't in a.
+func mergePods(a, b []corev1.Pod) []corev1.Pod {
+	seen := map[string]bool{}
+	for _, pod := range a {
+		seen[pod.Name] = true
+	}
+	for _, pod := range b {
+		if !seen[pod.Name] {
+			a = append(a, pod)
+		}
+	}
+	return a
+}
+
 func (r *ReconcileOneAgent) findPods(ctx context.Context, instance *dynatracev1alpha1.OneAgent) ([]corev1.Pod, error) {
 	podList := &corev1.PodList{}
 	listOptions := []client.ListOption{
@@ -105,44 +327,38 @@ func (r *ReconcileOneAgent) findPods(ctx context.Context, instance *dynatracev1a
 	return podList.Items, nil
 }
 
-func isDesiredNewer(actual string, desired string, logger logr.Logger) bool {
-	aa := strings.Split(actual, ".")
-	da := strings.Split(desired, ".")
-
-	for i := 0; i < len(aa); i++ {
-		if i == len(aa)-1 {
-			if aa[i] < da[i] {
-				return true
-			} else if aa[i] > da[i] {
-				var err = errors.New("downgrade error")
-				logger.Error(err, "downgrade detected! downgrades are not supported")
-				return false
-			} else {
-				return false
-			}
-		}
+// isOutdated returns true if the pod needs to be restarted to get the desired version. Pods running a newer version
+// are only considered outdated if downgrades are allowed.
+func isOutdated(actual string, instance *dynatracev1alpha1.OneAgent, logger logr.Logger) bool {
+	if !isDowngradeAllowed(instance) {
+		return isDesiredNewer(actual, instance.Status.Version, logger)
+	}
 
-		av, err := strconv.Atoi(aa[i])
-		if err != nil {
-			logger.Error(err, "failed to parse actual version number", "actual", actual)
-			return false
-		}
+	a, err := utils.ParseAgentVersion(actual)
+	if err != nil {
+		logger.Error(err, "failed to parse actual version number", "actual", actual)
+		return false
+	}
 
-		dv, err := strconv.Atoi(da[i])
-		if err != nil {
-			logger.Error(err, "failed to parse desired version number", "desired", desired)
-			return false
-		}
+	d, err := utils.ParseAgentVersion(instance.Status.Version)
+	if err != nil {
+		logger.Error(err, "failed to parse desired version number", "desired", instance.Status.Version)
+		return false
+	}
 
-		if av < dv {
-			return true
-		}
-		if av > dv {
-			var err = errors.New("downgrade error")
-			logger.Error(err, "downgrade detected! downgrades are not supported")
-			return false
-		}
+	return a.Compare(d) != 0
+}
+
+func isDesiredNewer(actual string, desired string, logger logr.Logger) bool {
+	newer, err := utils.IsNewerAgentVersion(actual, desired)
+	if err != nil {
+		logger.Error(err, "failed to parse version numbers", "actual", actual, "desired", desired)
+		return false
+	}
+
+	if older, _ := utils.IsNewerAgentVersion(desired, actual); older {
+		logger.Info("downgrade detected! downgrades are only applied if allowed by the version policy", "actual", actual, "desired", desired)
 	}
 
-	return false
+	return newer
 }
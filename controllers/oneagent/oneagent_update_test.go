@@ -3,15 +3,20 @@ package oneagent
 import (
 	"context"
 	"testing"
+	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -81,14 +86,16 @@ func TestReconcile_InstallerDowngrade(t *testing.T) {
 	dtcMock.On("GetAgentVersionForIP", "1.2.3.3").Return("1.203.0.20190101-000000", nil)
 	dtcMock.On("GetAgentVersionForIP", "1.2.3.4").Return("1.202.0.20190101-000000", nil)
 	dtcMock.On("GetAgentVersionForIP", "1.2.3.5").Return("1.201.0.20190101-000000", nil)
-	dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{utils.DynatracePaasToken}, nil)
-	dtcMock.On("GetTokenScopes", "84").Return(dtclient.TokenScopes{utils.DynatraceApiToken}, nil)
+	dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{utils.DynatracePaasToken}}, nil)
+	dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{utils.DynatraceApiToken}}, nil)
 
+	recorder := record.NewFakeRecorder(10)
 	r := &ReconcileOneAgent{
-		client:    c,
+		client:    utils.FakeApplyClient{Client: c},
 		apiReader: c,
 		scheme:    scheme.Scheme,
 		logger:    consoleLogger,
+		recorder:  recorder,
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              c,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtcMock),
@@ -97,8 +104,8 @@ func TestReconcile_InstallerDowngrade(t *testing.T) {
 		},
 	}
 
-	// Fails because the Pod didn't get recreated. Ignore since that isn't what we're checking on this test.
-	r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	_, err := r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
 
 	// These Pods should not be restarted, so we should be able to query that the Pod is still there and get no errors.
 	assert.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "future-pod", Namespace: "dynatrace"}, &corev1.Pod{}))
@@ -106,4 +113,324 @@ func TestReconcile_InstallerDowngrade(t *testing.T) {
 
 	// Outdated Pod should be deleted.
 	assert.Error(t, c.Get(context.TODO(), types.NamespacedName{Name: "past-pod", Namespace: "dynatrace"}, &corev1.Pod{}))
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Contains(t, events, "Normal VersionChanged Desired version changed from 1.206.0.20200101-000000 to 1.202.0.20190101-000000")
+	assert.Contains(t, events, "Normal PodRestarted Restarted pod past-pod on node  to update to version 1.202.0.20190101-000000")
+}
+
+func TestReconcile_InstallerRestartStateMachine(t *testing.T) {
+	var wait uint16 = 60
+
+	namespace := "dynatrace"
+	oaName := "oneagent"
+	oa := dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: oaName, Namespace: namespace},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+				Tokens: oaName,
+			},
+			WaitReadySeconds: &wait,
+		},
+	}
+
+	labels := map[string]string{"dynatrace": "oneagent", "oneagent": oaName}
+
+	newPod := func(name, node, ip string, ready bool) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{
+				HostIP:            ip,
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Ready: ready}},
+			},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&oa,
+		newPod("pod-1", "node1", "1.2.3.1", true),
+		newPod("pod-2", "node2", "1.2.3.2", true),
+		sampleKubeSystemNS).Build()
+
+	dtcMock := &dtclient.MockDynatraceClient{}
+	dtcMock.On("GetLatestAgentVersion", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return("1.203.0.20200101-000000", nil)
+	dtcMock.On("GetAgentVersionForIP", "1.2.3.1").Return("1.202.0.20190101-000000", nil)
+	dtcMock.On("GetAgentVersionForIP", "1.2.3.2").Return("1.202.0.20190101-000000", nil)
+
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+	exists := func(name string) bool {
+		return c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Pod{}) == nil
+	}
+
+	// The first outdated pod gets deleted, without waiting for the new one.
+	upd, err := r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, upd)
+	assert.False(t, exists("pod-1"))
+	assert.True(t, exists("pod-2"))
+	assert.Equal(t, []string{"node2"}, oa.Status.Rollout.PendingNodes)
+	if assert.NotNil(t, oa.Status.Rollout.Restart) {
+		assert.Equal(t, "node1", oa.Status.Rollout.Restart.NodeName)
+		assert.Equal(t, int32(1), oa.Status.Rollout.Restart.Attempt)
+	}
+
+	// The new pod isn't ready yet.
+	assert.NoError(t, c.Create(context.TODO(), newPod("pod-1-new", "node1", "1.2.3.1", false)))
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, exists("pod-2"))
+	assert.Equal(t, "node1", oa.Status.Rollout.Restart.NodeName)
+
+	// After the deadline, the pod gets deleted again.
+	past := metav1.NewTime(time.Now().Add(-time.Second))
+	oa.Status.Rollout.Restart.Deadline = &past
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.False(t, exists("pod-1-new"))
+	assert.Equal(t, int32(2), oa.Status.Rollout.Restart.Attempt)
+	assert.Equal(t, "pod-1-new", oa.Status.Rollout.Restart.PodName)
+
+	// Once ready, the pod on the next node gets deleted.
+	assert.NoError(t, c.Create(context.TODO(), newPod("pod-1-newer", "node1", "1.2.3.1", true)))
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.False(t, exists("pod-2"))
+	assert.Equal(t, []string{"node1"}, oa.Status.Rollout.UpdatedNodes)
+	assert.Empty(t, oa.Status.Rollout.PendingNodes)
+	if assert.NotNil(t, oa.Status.Rollout.Restart) {
+		assert.Equal(t, "node2", oa.Status.Rollout.Restart.NodeName)
+	}
+
+	// Fails after too many attempts, and gets retried since there's no rollout strategy halting on failures.
+	oa.Status.Rollout.Restart.Attempt = maxRestartAttempts
+	oa.Status.Rollout.Restart.Deadline = &past
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.Error(t, err)
+	assert.Nil(t, oa.Status.Rollout.Restart)
+	assert.Equal(t, int32(1), oa.Status.Rollout.Batches)
+	assert.Empty(t, oa.Status.FailedVersion)
+
+	// With a rollout strategy, the rollout gets halted instead. Versions are only rolled back by the health checks.
+	oa.Spec.RolloutStrategy = &dynatracev1alpha1.OneAgentRolloutStrategy{}
+	oa.Status.LastKnownGoodVersion = "1.202.0.20190101-000000"
+	oa.Status.Rollout.Restart = &dynatracev1alpha1.OneAgentRestartStatus{NodeName: "node2", Attempt: maxRestartAttempts, Deadline: &past}
+	upd, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, upd)
+	assert.Equal(t, dynatracev1alpha1.RolloutHalted, oa.Status.Rollout.Phase)
+	assert.Empty(t, oa.Status.FailedVersion)
+}
+
+func TestReconcile_InstallerVersionPolicyCanary(t *testing.T) {
+	namespace := "dynatrace"
+	oaName := "oneagent"
+	canary := intstr.FromInt(1)
+	oa := dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: oaName, Namespace: namespace},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+				Tokens: oaName,
+			},
+			VersionPolicy:   &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"},
+			RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{Canary: &canary},
+		},
+		Status: dynatracev1alpha1.OneAgentStatus{Version: "1.203.0.20200101-000000"},
+	}
+
+	ds, err := newDaemonSetBuilder(consoleLogger, &oa, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	owner := metav1.NewControllerRef(ds, appsv1.SchemeGroupVersion.WithKind("DaemonSet"))
+
+	labels := map[string]string{"dynatrace": "oneagent", "oneagent": oaName}
+	newPod := func(name, node, ip, hash string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       namespace,
+				Labels:          labels,
+				Annotations:     map[string]string{annotationTemplateHash: hash},
+				OwnerReferences: []metav1.OwnerReference{*owner},
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{
+				HostIP:            ip,
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Ready: true}},
+			},
+		}
+	}
+
+	current := getTemplateHash(ds)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&oa,
+		ds,
+		newPod("pod-1", "node1", "1.2.3.1", "outdated"),
+		newPod("pod-2", "node2", "1.2.3.2", "outdated"),
+		newPod("pod-3", "node3", "1.2.3.3", current),
+		sampleKubeSystemNS).Build()
+
+	dtcMock := &dtclient.MockDynatraceClient{}
+	dtcMock.On("GetAgentVersions", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return([]string{"1.202.0.20190101-000000", "1.203.0.20200101-000000"}, nil)
+	dtcMock.On("GetAgentVersionForIP", "1.2.3.1").Return("1.202.0.20190101-000000", nil)
+	dtcMock.On("GetAgentVersionForIP", "1.2.3.2").Return("1.202.0.20190101-000000", nil)
+	dtcMock.On("GetAgentVersionForIP", "1.2.3.3").Return("1.203.0.20200101-000000", nil)
+
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+	exists := func(name string) bool {
+		return c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Pod{}) == nil
+	}
+
+	// Only the canary gets restarted by the Operator, the DaemonSet doesn't replace pods by itself.
+	assert.Equal(t, appsv1.OnDeleteDaemonSetStrategyType, ds.Spec.UpdateStrategy.Type)
+
+	upd, err := r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, upd)
+	assert.False(t, exists("pod-1"))
+	assert.True(t, exists("pod-2"))
+	assert.True(t, exists("pod-3"))
+	assert.Equal(t, dynatracev1alpha1.RolloutCanary, oa.Status.Rollout.Phase)
+	assert.Empty(t, oa.Status.Rollout.PendingNodes)
+	if assert.NotNil(t, oa.Status.Rollout.Restart) {
+		assert.Equal(t, "node1", oa.Status.Rollout.Restart.NodeName)
+	}
+
+	// Once the canary is ready, it counts as updated, which the version health checks rely on, and the remaining
+	// outdated pods follow. The pod already running the current template is left alone.
+	assert.NoError(t, c.Create(context.TODO(), newPod("pod-1-new", "node1", "1.2.3.1", current)))
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node1"}, oa.Status.Rollout.UpdatedNodes)
+	assert.Equal(t, dynatracev1alpha1.RolloutProgressing, oa.Status.Rollout.Phase)
+	assert.False(t, exists("pod-2"))
+	assert.True(t, exists("pod-3"))
+	if assert.NotNil(t, oa.Status.Rollout.Restart) {
+		assert.Equal(t, "node2", oa.Status.Rollout.Restart.NodeName)
+	}
+}
+
+func TestReconcile_InstallerVersionPolicyRollback(t *testing.T) {
+	namespace := "dynatrace"
+	oaName := "oneagent"
+	canary := intstr.FromInt(1)
+	oa := dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: oaName, Namespace: namespace},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+				Tokens: oaName,
+			},
+			VersionPolicy:   &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.205"},
+			RolloutStrategy: &dynatracev1alpha1.OneAgentRolloutStrategy{Canary: &canary},
+		},
+		// The canary failed health checks, and got rolled back.
+		Status: dynatracev1alpha1.OneAgentStatus{
+			Version:              "1.205.0.20200301-000000",
+			FailedVersion:        "1.205.0.20200301-000000",
+			LastKnownGoodVersion: "1.203.0.20200101-000000",
+			Rollout: &dynatracev1alpha1.OneAgentRolloutStatus{
+				TargetVersion: "1.205.0.20200301-000000",
+				Phase:         dynatracev1alpha1.RolloutHalted,
+				UpdatedNodes:  []string{"node1"},
+			},
+		},
+	}
+
+	// The DaemonSet is pinned to the last known good version.
+	ds, err := newDaemonSetBuilder(consoleLogger, &oa, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Equal(t, appsv1.OnDeleteDaemonSetStrategyType, ds.Spec.UpdateStrategy.Type)
+	owner := metav1.NewControllerRef(ds, appsv1.SchemeGroupVersion.WithKind("DaemonSet"))
+
+	labels := map[string]string{"dynatrace": "oneagent", "oneagent": oaName}
+	newPod := func(name, node, hash string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       namespace,
+				Labels:          labels,
+				Annotations:     map[string]string{annotationTemplateHash: hash},
+				OwnerReferences: []metav1.OwnerReference{*owner},
+			},
+			Spec:   corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{Ready: true}}},
+		}
+	}
+
+	current := getTemplateHash(ds)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&oa,
+		ds,
+		newPod("pod-1", "node1", "failed"),
+		newPod("pod-2", "node2", current),
+		newPod("pod-3", "node3", current),
+		sampleKubeSystemNS).Build()
+
+	dtcMock := &dtclient.MockDynatraceClient{}
+	dtcMock.On("GetAgentVersions", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return([]string{"1.203.0.20200101-000000", "1.205.0.20200301-000000"}, nil)
+
+	r := &ReconcileOneAgent{client: utils.FakeApplyClient{Client: c}, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger, recorder: &record.FakeRecorder{}}
+	exists := func(name string) bool {
+		return c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, &corev1.Pod{}) == nil
+	}
+
+	assert.True(t, isRollbackRolloutPending(&oa))
+
+	// The canary gets restarted right away, without starting over with a canary.
+	upd, err := r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, upd)
+	assert.False(t, exists("pod-1"))
+	assert.True(t, exists("pod-2"))
+	assert.True(t, exists("pod-3"))
+	assert.Equal(t, "1.205.0.20200301-000000", oa.Status.FailedVersion)
+	assert.Equal(t, "1.203.0.20200101-000000", oa.Status.Rollout.TargetVersion)
+	assert.Equal(t, dynatracev1alpha1.RolloutProgressing, oa.Status.Rollout.Phase)
+	if assert.NotNil(t, oa.Status.Rollout.Restart) {
+		assert.Equal(t, "node1", oa.Status.Rollout.Restart.NodeName)
+	}
+	assert.False(t, isRollbackRolloutPending(&oa))
+
+	// Once the pod runs the last known good version, the rollout completes.
+	assert.NoError(t, c.Create(context.TODO(), newPod("pod-1-new", "node1", current)))
+	_, err = r.reconcileVersionInstaller(context.TODO(), consoleLogger, &oa, dtcMock)
+	assert.NoError(t, err)
+	assert.True(t, exists("pod-2"))
+	assert.True(t, exists("pod-3"))
+	assert.Nil(t, oa.Status.Rollout.Restart)
+	assert.Equal(t, dynatracev1alpha1.RolloutCompleted, oa.Status.Rollout.Phase)
+}
+
+func TestFindPodsWithOutdatedTemplate(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.VersionPolicy = &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"}
+
+	ds, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Equal(t, getTemplateHash(ds), ds.Spec.Template.Annotations[annotationTemplateHash])
+
+	owner := *metav1.NewControllerRef(ds, appsv1.SchemeGroupVersion.WithKind("DaemonSet"))
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "current", OwnerReferences: []metav1.OwnerReference{owner},
+			Annotations: map[string]string{annotationTemplateHash: getTemplateHash(ds)}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "outdated", OwnerReferences: []metav1.OwnerReference{owner}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unowned"}},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ds).Build()
+	r := &ReconcileOneAgent{client: c, apiReader: c, scheme: scheme.Scheme, logger: consoleLogger}
+
+	outdated, err := r.findPodsWithOutdatedTemplate(context.TODO(), instance, pods)
+	require.NoError(t, err)
+	if assert.Len(t, outdated, 1) {
+		assert.Equal(t, "outdated", outdated[0].Name)
+	}
 }
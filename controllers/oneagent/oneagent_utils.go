@@ -2,17 +2,10 @@ package oneagent
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"strings"
-	"time"
+	"reflect"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
-	"github.com/go-logr/logr"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -46,29 +39,17 @@ func getPodReadyState(p *corev1.Pod) bool {
 	return ready
 }
 
-// validate sanity checks if essential fields in the custom resource are available
-//
-// Return an error in the following conditions
-// - APIURL empty
+// validate sanity checks the custom resource, see ValidateOneAgent.
 func validate(cr *dynatracev1alpha1.OneAgent) error {
-	var msg []string
-	if cr.GetOneAgentSpec().APIURL == "" {
-		msg = append(msg, ".spec.apiUrl is missing")
-	}
-	if len(msg) > 0 {
-		return errors.New(strings.Join(msg, ", "))
+	if errs := ValidateOneAgent(cr); len(errs) > 0 {
+		return errs.ToAggregate()
 	}
 	return nil
 }
 
-func (r *ReconcileOneAgent) determineOneAgentPhase(instance *dynatracev1alpha1.OneAgent) (bool, error) {
+func (r *ReconcileOneAgent) determineOneAgentPhase(ctx context.Context, instance *dynatracev1alpha1.OneAgent) (bool, error) {
 	var phaseChanged bool
-	dsActual := &appsv1.DaemonSet{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}, dsActual)
-
-	if k8serrors.IsNotFound(err) {
-		return false, nil
-	}
+	statuses, err := r.getNodeGroupStatuses(ctx, instance)
 
 	if err != nil {
 		phaseChanged = instance.GetOneAgentStatus().Phase != dynatracev1alpha1.Error
@@ -76,86 +57,72 @@ func (r *ReconcileOneAgent) determineOneAgentPhase(instance *dynatracev1alpha1.O
 		return phaseChanged, err
 	}
 
-	if dsActual.Status.NumberReady == dsActual.Status.CurrentNumberScheduled {
-		phaseChanged = instance.GetOneAgentStatus().Phase != dynatracev1alpha1.Running
-		instance.GetOneAgentStatus().Phase = dynatracev1alpha1.Running
-	} else {
-		phaseChanged = instance.GetOneAgentStatus().Phase != dynatracev1alpha1.Deploying
-		instance.GetOneAgentStatus().Phase = dynatracev1alpha1.Deploying
+	if len(statuses) == 0 {
+		return false, nil
+	}
+
+	if len(instance.Spec.NodeGroups) == 0 {
+		statuses = nil
 	}
+	if !reflect.DeepEqual(instance.Status.NodeGroups, statuses) {
+		instance.Status.NodeGroups = statuses
+		phaseChanged = true
+	}
+
+	phase := dynatracev1alpha1.Running
+	for _, sts := range statuses {
+		if sts.Phase != dynatracev1alpha1.Running {
+			phase = dynatracev1alpha1.Deploying
+		}
+	}
+	if len(statuses) < len(instance.Spec.NodeGroups) {
+		phase = dynatracev1alpha1.Deploying
+	}
+
+	phaseChanged = phaseChanged || instance.GetOneAgentStatus().Phase != phase
+	instance.GetOneAgentStatus().Phase = phase
 
 	return phaseChanged, nil
 }
 
-func (r *ReconcileOneAgent) waitPodReadyState(pod corev1.Pod, labels map[string]string, waitSecs uint16) error {
-	var status error
-
+// findPodsOnNode returns the OneAgent pods on the node which aren't being deleted, excluding the pod with the given
+// name.
+func (r *ReconcileOneAgent) findPodsOnNode(ctx context.Context, instance *dynatracev1alpha1.OneAgent, node string, exclude string) ([]corev1.Pod, error) {
+	// The actual selector we need is,
+	// "spec.nodeName=<node>,metadata.name!=<exclude>"
+	//
+	// However, the client falls back to a cached implementation for .List() after the first attempt, which
+	// is not able to handle our query so the function fails. Because of this, we're getting all the pods and
+	// filtering it ourselves.
+	podList := &corev1.PodList{}
 	listOps := []client.ListOption{
-		client.InNamespace(pod.Namespace),
-		client.MatchingLabels(labels),
+		client.InNamespace(instance.GetNamespace()),
+		client.MatchingLabels(buildLabels(instance.GetName())),
+	}
+	if err := r.client.List(ctx, podList, listOps...); err != nil {
+		return nil, err
 	}
 
-	for splay := uint16(0); splay < waitSecs; splay += splayTimeSeconds {
-		time.Sleep(time.Duration(splayTimeSeconds) * time.Second)
-
-		// The actual selector we need is,
-		// "spec.nodeName=<pod.Spec.NodeName>,status.phase=Running,metadata.name!=<pod.Name>"
-		//
-		// However, the client falls back to a cached implementation for .List() after the first attempt, which
-		// is not able to handle our query so the function fails. Because of this, we're getting all the pods and
-		// filtering it ourselves.
-		podList := &corev1.PodList{}
-		status = r.client.List(context.TODO(), podList, listOps...)
-		if status != nil {
-			continue
-		}
-
-		var foundPods []*corev1.Pod
-		for i := range podList.Items {
-			p := &podList.Items[i]
-			if p.Spec.NodeName != pod.Spec.NodeName || p.Status.Phase != corev1.PodRunning ||
-				p.ObjectMeta.Name == pod.Name {
-				continue
-			}
-			foundPods = append(foundPods, p)
-		}
-
-		if n := len(foundPods); n == 0 {
-			status = fmt.Errorf("waiting for pod to be recreated on node: %s", pod.Spec.NodeName)
-		} else if n == 1 && getPodReadyState(foundPods[0]) {
-			break
-		} else if n > 1 {
-			status = fmt.Errorf("too many pods found: expected=1 actual=%d", n)
+	var pods []corev1.Pod
+	for _, p := range podList.Items {
+		if p.Spec.NodeName == node && p.Name != exclude && p.DeletionTimestamp == nil {
+			pods = append(pods, p)
 		}
 	}
-
-	return status
+	return pods, nil
 }
 
-// deletePods deletes a list of pods
-//
-// Returns an error in the following conditions:
-//  - failure on object deletion
-//  - timeout on waiting for ready state
-func (r *ReconcileOneAgent) deletePods(logger logr.Logger, pods []corev1.Pod, labels map[string]string, waitSecs uint16) error {
-	for _, pod := range pods {
-		logger.Info("deleting pod", "pod", pod.Name, "node", pod.Spec.NodeName)
-
-		// delete pod
-		err := r.client.Delete(context.TODO(), &pod)
-		if err != nil {
-			return err
-		}
-
-		logger.Info("waiting until pod is ready on node", "node", pod.Spec.NodeName)
+// isPodRecreated returns true if the only pod found is running and ready.
+func isPodRecreated(pods []corev1.Pod) bool {
+	return len(pods) == 1 && pods[0].Status.Phase == corev1.PodRunning && getPodReadyState(&pods[0])
+}
 
-		// wait for pod on node to get "Running" again
-		if err := r.waitPodReadyState(pod, labels, waitSecs); err != nil {
-			return err
+// containsString returns true if s is one of the values.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
 		}
-
-		logger.Info("pod recreated successfully on node", "node", pod.Spec.NodeName)
 	}
-
-	return nil
+	return false
 }
@@ -1,8 +1,10 @@
 package oneagent
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
@@ -45,6 +47,8 @@ func TestOneAgent_Validate(t *testing.T) {
 	assert.Error(t, validate(oa))
 	oa.Spec.APIURL = "https://f.q.d.n/api"
 	assert.NoError(t, validate(oa))
+	oa.Spec.MaintenanceWindows = []dynatracev1alpha1.MaintenanceWindow{{Schedule: "0 2 * *", Duration: metav1.Duration{Duration: time.Hour}}}
+	assert.Error(t, validate(oa))
 }
 
 func TestMigrationForDaemonSetWithoutAnnotation(t *testing.T) {
@@ -189,7 +193,7 @@ func TestGetPodsToRestart(t *testing.T) {
 	oa := newOneAgent()
 	oa.Status.Version = "1.2.3"
 	oa.Status.Instances = map[string]dynatracev1alpha1.OneAgentInstance{"node-3": {Version: "outdated"}}
-	doomed, err := findOutdatedPodsInstaller(pods, dtc, oa, consoleLogger)
+	doomed, err := findOutdatedPodsInstaller(context.TODO(), pods, dtc, oa, consoleLogger)
 	assert.Lenf(t, doomed, 1, "list of pods to restart")
 	assert.Equalf(t, doomed[0], pods[1], "list of pods to restart")
 	assert.Equal(t, nil, err)
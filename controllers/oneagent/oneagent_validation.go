@@ -0,0 +1,95 @@
+package oneagent
+
+import (
+	"fmt"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateOneAgent returns the issues found on the OneAgent object. These are checked on reconciliation, and by the
+// validating webhook to reject invalid objects on admission.
+func ValidateOneAgent(cr *dynatracev1alpha1.OneAgent) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	errs := utils.ValidateBaseSpec(&cr.Spec.BaseOneAgentSpec, spec)
+
+	// A custom immutable image is used as is, so its version can't be chosen.
+	if cr.Spec.UseImmutableImage && cr.Spec.Image != "" && hasVersionPolicy(cr) {
+		errs = append(errs, field.Forbidden(spec.Child("versionPolicy"), "can't be set together with image, since the version is given by the image"))
+	}
+
+	for i, mw := range cr.Spec.MaintenanceWindows {
+		if _, err := utils.ParseMaintenanceWindow(mw); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("maintenanceWindows").Index(i), mw.Schedule, err.Error()))
+		}
+	}
+
+	errs = append(errs, validateVersionPolicy(cr.Spec.VersionPolicy, spec.Child("versionPolicy"))...)
+	errs = append(errs, validateNodeGroups(cr, spec.Child("nodeGroups"))...)
+	errs = append(errs, validateHostMetadata(cr, spec)...)
+
+	return errs
+}
+
+// ValidateNewOneAgent returns the issues found on settings of the OneAgent object which earlier versions of the Operator
+// accepted, either without checking their format, ignoring them or letting them override the values it manages. The
+// validating webhook rejects these for new objects, while existing objects keep being reconciled with a warning.
+func ValidateNewOneAgent(cr *dynatracev1alpha1.OneAgent) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	errs := utils.ValidateNewBaseSpec(&cr.Spec.BaseOneAgentSpec, spec)
+	errs = append(errs, utils.ValidateImage(cr.Spec.Image, spec.Child("image"))...)
+	errs = append(errs, utils.ValidateAgentVersion(cr.Spec.AgentVersion, spec.Child("agentVersion"))...)
+
+	if cr.Spec.UseImmutableImage && cr.Spec.Image != "" && cr.Spec.AgentVersion != "" {
+		errs = append(errs, field.Forbidden(spec.Child("agentVersion"), "can't be set together with image, since the version is given by the image"))
+	}
+
+	reserved := reservedEnvVars(cr)
+	errs = append(errs, validateEnv(cr.Spec.Env, reserved, spec.Child("env"))...)
+	for i, group := range cr.Spec.NodeGroups {
+		errs = append(errs, validateEnv(group.Env, reserved, spec.Child("nodeGroups").Index(i).Child("env"))...)
+	}
+
+	return errs
+}
+
+// reservedEnvVars returns the environment variables on the OneAgent pods which are managed by the Operator, with the
+// reason why they can't be set.
+func reservedEnvVars(cr *dynatracev1alpha1.OneAgent) map[string]string {
+	reserved := map[string]string{
+		"DT_K8S_NODE_NAME":  "it's set to the node of the pod",
+		"DT_K8S_CLUSTER_ID": "it's set to the UID of the kube-system namespace",
+	}
+
+	if !cr.Spec.UseImmutableImage {
+		reserved["ONEAGENT_INSTALLER_TOKEN"] = "it's read from the PaaS token on the tokens secret"
+		if hasVersionPolicy(cr) {
+			reserved["ONEAGENT_INSTALLER_SCRIPT_URL"] = "the installer version is chosen by versionPolicy"
+		}
+	}
+
+	if cr.Spec.WebhookInjection {
+		reserved["ONEAGENT_DISABLE_CONTAINER_INJECTION"] = "it's set by webhookInjection"
+	}
+
+	if p := cr.Spec.Proxy; p != nil && (p.Value != "" || p.ValueFrom != "") {
+		reserved["https_proxy"] = "it's set by proxy"
+	}
+
+	return reserved
+}
+
+func validateEnv(env []corev1.EnvVar, reserved map[string]string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, ev := range env {
+		if reason, ok := reserved[ev.Name]; ok {
+			errs = append(errs, field.Forbidden(fldPath.Index(i).Child("name"),
+				fmt.Sprintf("%s is managed by the Operator, since %s", ev.Name, reason)))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,140 @@
+package oneagent
+
+import (
+	"context"
+	"fmt"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// hasVersionPolicy returns true if the version to deploy is chosen by a policy other than always using the latest one,
+// on which case the version gets pinned on the DaemonSet.
+func hasVersionPolicy(instance *dynatracev1alpha1.OneAgent) bool {
+	p := instance.Spec.VersionPolicy
+	return p != nil && p.Mode != "" && p.Mode != dynatracev1alpha1.VersionPolicyLatest
+}
+
+// usesOnDeleteUpdates returns true if the OneAgent pods only get replaced when the Operator restarts them, so that the
+// rollout strategy also applies to the versions pinned on the installer URL by a version policy.
+func usesOnDeleteUpdates(instance *dynatracev1alpha1.OneAgent) bool {
+	return hasVersionPolicy(instance) && !instance.Status.UseImmutableImage && !instance.Spec.DisableAgentUpdate
+}
+
+// isDowngradeAllowed returns true if the version policy allows to deploy versions older than the current one.
+func isDowngradeAllowed(instance *dynatracev1alpha1.OneAgent) bool {
+	return instance.Spec.VersionPolicy != nil && instance.Spec.VersionPolicy.AllowDowngrade
+}
+
+// resolveDesiredVersion returns the OneAgent version to deploy according to the version policy. If the version is
+// older than current, and downgrades aren't allowed, then current is returned instead.
+func resolveDesiredVersion(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgent, dtc dtclient.Client, current string) (string, error) {
+	if !hasVersionPolicy(instance) {
+		return dtc.GetLatestAgentVersion(ctx, dtclient.OsUnix, dtclient.InstallerTypeDefault)
+	}
+
+	available, err := dtc.GetAgentVersions(ctx, dtclient.OsUnix, dtclient.InstallerTypeDefault)
+	if err != nil {
+		return "", err
+	}
+
+	desired, err := selectVersion(instance.Spec.VersionPolicy, utils.SortAgentVersions(available))
+	if err != nil {
+		return "", err
+	}
+
+	if current != "" && !isDowngradeAllowed(instance) {
+		if older, err := utils.IsNewerAgentVersion(desired, current); err == nil && older {
+			logger.Info("version policy selected an older version, keeping current one since downgrades aren't allowed",
+				"current", current, "selected", desired)
+			return current, nil
+		}
+	}
+
+	return desired, nil
+}
+
+// selectVersion picks the version to deploy from the available versions, sorted in descending order.
+func selectVersion(policy *dynatracev1alpha1.OneAgentVersionPolicy, available []utils.AgentVersion) (string, error) {
+	switch policy.Mode {
+	case dynatracev1alpha1.VersionPolicyPinned, dynatracev1alpha1.VersionPolicyRange:
+		constraint := policy.Range
+		if policy.Mode == dynatracev1alpha1.VersionPolicyPinned {
+			constraint = policy.Version
+		}
+
+		c, err := utils.ParseVersionConstraint(constraint)
+		if err != nil {
+			return "", err
+		}
+
+		for _, v := range available {
+			if c.Matches(v) {
+				return v.String(), nil
+			}
+		}
+		return "", fmt.Errorf("no available version matches '%s'", constraint)
+
+	case dynatracev1alpha1.VersionPolicyLatestMinus:
+		releases := int32(0)
+		for i, v := range available {
+			if i > 0 && (v.Major != available[i-1].Major || v.Minor != available[i-1].Minor) {
+				releases++
+			}
+			if releases == policy.LatestMinus {
+				return v.String(), nil
+			}
+		}
+		return "", fmt.Errorf("less than %d releases available", policy.LatestMinus+1)
+	}
+
+	if len(available) == 0 {
+		return "", fmt.Errorf("no versions available")
+	}
+	return available[0].String(), nil
+}
+
+// imageTag returns the tag for the OneAgent image, which is the version chosen by the version policy if any.
+func imageTag(instance *dynatracev1alpha1.OneAgent) string {
+	if hasVersionPolicy(instance) && instance.Status.Version != "" {
+		if v, err := utils.ParseAgentVersion(instance.Status.Version); err == nil {
+			return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+		}
+	}
+	return instance.Spec.AgentVersion
+}
+
+// validateVersionPolicy returns the issues found on the version policy.
+func validateVersionPolicy(policy *dynatracev1alpha1.OneAgentVersionPolicy, fldPath *field.Path) field.ErrorList {
+	if policy == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	switch policy.Mode {
+	case dynatracev1alpha1.VersionPolicyPinned:
+		if _, err := utils.ParseAgentVersion(policy.Version); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("version"), policy.Version, err.Error()))
+		}
+	case dynatracev1alpha1.VersionPolicyRange:
+		if _, err := utils.ParseVersionConstraint(policy.Range); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("range"), policy.Range, err.Error()))
+		}
+	case dynatracev1alpha1.VersionPolicyLatestMinus:
+		if policy.LatestMinus < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child("latestMinus"), policy.LatestMinus, "must not be negative"))
+		}
+	case "", dynatracev1alpha1.VersionPolicyLatest:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("mode"), policy.Mode, []string{
+			string(dynatracev1alpha1.VersionPolicyLatest),
+			string(dynatracev1alpha1.VersionPolicyPinned),
+			string(dynatracev1alpha1.VersionPolicyRange),
+			string(dynatracev1alpha1.VersionPolicyLatestMinus),
+		}))
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+package oneagent
+
+import (
+	"context"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var sampleAgentVersions = []string{
+	"1.201.0.20200915-100000",
+	"1.203.0.20201020-120000",
+	"1.203.2.20201103-090000",
+	"1.205.0.20201117-110000",
+	"1.204.1.20201110-080000",
+	"1.204.0.20201103-100000",
+}
+
+func TestResolveDesiredVersion(t *testing.T) {
+	dtc := &dtclient.MockDynatraceClient{}
+	dtc.On("GetLatestAgentVersion", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return("1.205.0.20201117-110000", nil)
+	dtc.On("GetAgentVersions", dtclient.OsUnix, dtclient.InstallerTypeDefault).Return(sampleAgentVersions, nil)
+
+	resolve := func(policy *dynatracev1alpha1.OneAgentVersionPolicy, current string) (string, error) {
+		instance := newOneAgent()
+		instance.Spec.VersionPolicy = policy
+		return resolveDesiredVersion(context.TODO(), consoleLogger, instance, dtc, current)
+	}
+
+	t.Run("latest", func(t *testing.T) {
+		v, err := resolve(nil, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.205.0.20201117-110000", v)
+
+		v, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatest}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.205.0.20201117-110000", v)
+	})
+
+	t.Run("pinned", func(t *testing.T) {
+		v, err := resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.203.2.20201103-090000", v)
+
+		v, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203.0.20201020-120000"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.203.0.20201020-120000", v)
+
+		_, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.202"}, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		v, err := resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyRange, Range: ">=1.203 <1.205"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.204.1.20201110-080000", v)
+
+		v, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyRange, Range: "~1.204.0"}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.204.1.20201110-080000", v)
+	})
+
+	t.Run("latest minus", func(t *testing.T) {
+		v, err := resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatestMinus}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.205.0.20201117-110000", v)
+
+		v, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatestMinus, LatestMinus: 2}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "1.203.2.20201103-090000", v)
+
+		_, err = resolve(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatestMinus, LatestMinus: 4}, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("downgrade", func(t *testing.T) {
+		policy := &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"}
+
+		v, err := resolve(policy, "1.205.0.20201117-110000")
+		require.NoError(t, err)
+		assert.Equal(t, "1.205.0.20201117-110000", v)
+
+		policy.AllowDowngrade = true
+		v, err = resolve(policy, "1.205.0.20201117-110000")
+		require.NoError(t, err)
+		assert.Equal(t, "1.203.2.20201103-090000", v)
+	})
+}
+
+func TestIsOutdated(t *testing.T) {
+	instance := newOneAgent()
+	instance.Status.Version = "1.203.2.20201103-090000"
+
+	assert.True(t, isOutdated("1.203.0.20201020-120000", instance, consoleLogger))
+	assert.False(t, isOutdated("1.203.2.20201103-090000", instance, consoleLogger))
+	assert.False(t, isOutdated("1.205.0.20201117-110000", instance, consoleLogger))
+
+	instance.Spec.VersionPolicy = &dynatracev1alpha1.OneAgentVersionPolicy{
+		Mode:           dynatracev1alpha1.VersionPolicyPinned,
+		Version:        "1.203",
+		AllowDowngrade: true,
+	}
+	assert.True(t, isOutdated("1.203.0.20201020-120000", instance, consoleLogger))
+	assert.False(t, isOutdated("1.203.2.20201103-090000", instance, consoleLogger))
+	assert.True(t, isOutdated("1.205.0.20201117-110000", instance, consoleLogger))
+	assert.False(t, isOutdated("invalid", instance, consoleLogger))
+}
+
+func TestValidateVersionPolicy(t *testing.T) {
+	path := field.NewPath("spec", "versionPolicy")
+	assert.Empty(t, validateVersionPolicy(nil, path))
+	assert.Empty(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatest}, path))
+	assert.Empty(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"}, path))
+	assert.Empty(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyRange, Range: "^1.203"}, path))
+
+	assert.Len(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203.x"}, path), 1)
+	assert.Len(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyRange}, path), 1)
+	assert.Len(t, validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyLatestMinus, LatestMinus: -1}, path), 1)
+	assert.Equal(t, []string{
+		`spec.versionPolicy.mode: Unsupported value: "Oldest": supported values: "Latest", "Pinned", "Range", "LatestMinus"`,
+	}, errorStrings(validateVersionPolicy(&dynatracev1alpha1.OneAgentVersionPolicy{Mode: "Oldest"}, path)))
+}
+
+func TestNewDaemonSetForCR_VersionPolicy(t *testing.T) {
+	instance := newOneAgent()
+	instance.Spec.APIURL = "https://ENVIRONMENTID.live.dynatrace.com/api"
+	instance.Spec.VersionPolicy = &dynatracev1alpha1.OneAgentVersionPolicy{Mode: dynatracev1alpha1.VersionPolicyPinned, Version: "1.203"}
+	instance.Status.Version = "1.203.2.20201103-090000"
+
+	ds, err := newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Contains(t, ds.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
+		Name:  "ONEAGENT_INSTALLER_SCRIPT_URL",
+		Value: "https://ENVIRONMENTID.live.dynatrace.com/api/v1/deployment/installer/agent/unix/default/version/1.203.2.20201103-090000?Api-Token=$(ONEAGENT_INSTALLER_TOKEN)&arch=x86&flavor=default",
+	})
+	assert.Equal(t, appsv1.OnDeleteDaemonSetStrategyType, ds.Spec.UpdateStrategy.Type, "rollout strategy applies to pinned versions")
+
+	instance.Status.UseImmutableImage = true
+	ds, err = newDaemonSetBuilder(consoleLogger, instance, "cluster").newDaemonSetForCR()
+	require.NoError(t, err)
+	assert.Equal(t, "ENVIRONMENTID.live.dynatrace.com/linux/oneagent:1.203.2", ds.Spec.Template.Spec.Containers[0].Image)
+	assert.Empty(t, ds.Spec.UpdateStrategy.Type)
+}
@@ -2,18 +2,20 @@ package oneagentapm
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/istio"
+	nscontroller "github.com/Dynatrace/dynatrace-oneagent-operator/controllers/namespace"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -23,12 +25,20 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// Reasons of the events recorded on OneAgentAPM objects, in addition to the token condition reasons.
+const (
+	eventValidationFailed  = "ValidationFailed"
+	eventValidationWarning = "ValidationWarning"
+	eventIstioFailed       = "IstioReconcileFailed"
+)
+
 // Add creates a new OneAgentAPM Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager, _ string) error {
 	client := mgr.GetClient()
 	config := mgr.GetConfig()
 	scheme := mgr.GetScheme()
+	recorder := mgr.GetEventRecorderFor("dynatrace-oneagent-operator")
 
 	return add(mgr, &ReconcileOneAgentAPM{
 		client:    client,
@@ -36,10 +46,12 @@ func Add(mgr manager.Manager, _ string) error {
 		scheme:    scheme,
 		config:    config,
 		logger:    log.Log.WithName("oneagentapm.controller"),
+		recorder:  recorder,
 
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:          client,
 			UpdatePaaSToken: true,
+			Recorder:        recorder,
 		},
 		istioController: istio.NewController(config, scheme),
 	})
@@ -54,7 +66,26 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	}
 
 	// Watch for changes to primary resource OneAgentAPM
-	return c.Watch(&source.Kind{Type: &dynatracev1alpha1.OneAgentAPM{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &dynatracev1alpha1.OneAgentAPM{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to token secrets and requeue the OneAgentAPMs using them, to apply rotated tokens right away
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		var apmList dynatracev1alpha1.OneAgentAPMList
+		if err := mgr.GetClient().List(context.TODO(), &apmList, client.InNamespace(obj.GetNamespace())); err != nil {
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range apmList.Items {
+			if utils.GetTokensName(&apmList.Items[i]) == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&apmList.Items[i])})
+			}
+		}
+		return requests
+	}))
 }
 
 // ReconcileOneAgentAPM reconciles a OneAgentAPM object
@@ -66,6 +97,7 @@ type ReconcileOneAgentAPM struct {
 	scheme    *runtime.Scheme
 	config    *rest.Config
 	logger    logr.Logger
+	recorder  record.EventRecorder
 
 	dtcReconciler   *utils.DynatraceClientReconciler
 	istioController *istio.Controller
@@ -90,8 +122,20 @@ func (r *ReconcileOneAgentAPM) Reconcile(ctx context.Context, request reconcile.
 		return reconcile.Result{}, err
 	}
 
-	if instance.Spec.APIURL == "" {
-		return reconcile.Result{}, errors.New(".spec.apiUrl is missing")
+	if deleted, err := utils.ReconcileCleanupFinalizer(ctx, r.client, r.recorder, instance, func(ctx context.Context) error {
+		return r.cleanup(ctx, logger, instance)
+	}); deleted || err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if errs := ValidateOneAgentAPM(instance); len(errs) > 0 {
+		r.recorder.Event(instance, corev1.EventTypeWarning, eventValidationFailed, errs.ToAggregate().Error())
+		return reconcile.Result{}, errs.ToAggregate()
+	}
+
+	// Settings only rejected for new objects are still accepted here, so that existing objects keep working.
+	if errs := ValidateNewOneAgentAPM(instance); len(errs) > 0 {
+		r.recorder.Event(instance, corev1.EventTypeWarning, eventValidationWarning, errs.ToAggregate().Error())
 	}
 
 	dtcRec := *r.dtcReconciler
@@ -99,7 +143,7 @@ func (r *ReconcileOneAgentAPM) Reconcile(ctx context.Context, request reconcile.
 		dtcRec.UpdateAPIToken = true
 	}
 
-	dtc, upd, err := dtcRec.Reconcile(ctx, instance)
+	dtc, _, upd, err := dtcRec.Reconcile(ctx, instance)
 
 	upd = upd || utils.SetUseImmutableImageStatus(instance)
 
@@ -121,9 +165,10 @@ func (r *ReconcileOneAgentAPM) Reconcile(ctx context.Context, request reconcile.
 	}
 
 	if instance.Spec.EnableIstio {
-		if upd, err := r.istioController.ReconcileIstio(instance, dtc); err != nil {
+		if upd, err := r.istioController.ReconcileIstio(ctx, instance, dtc); err != nil {
 			// If there are errors log them, but move on.
 			logger.Info("istio: failed to reconcile objects", "error", err)
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, eventIstioFailed, "Failed to reconcile Istio objects: %v", err)
 		} else if upd {
 			return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
 		}
@@ -131,3 +176,18 @@ func (r *ReconcileOneAgentAPM) Reconcile(ctx context.Context, request reconcile.
 
 	return reconcile.Result{RequeueAfter: 30 * time.Minute}, nil
 }
+
+// cleanup removes the objects derived from a deleted OneAgentAPM which aren't garbage collected: the secrets on the
+// namespaces assigned to it and the Istio objects.
+func (r *ReconcileOneAgentAPM) cleanup(ctx context.Context, logger logr.Logger, instance *dynatracev1alpha1.OneAgentAPM) error {
+	logger.Info("Removing objects of deleted OneAgentAPM")
+
+	if err := nscontroller.RemoveInjectionSecrets(ctx, r.client, instance.Name, logger); err != nil {
+		return err
+	}
+
+	if r.istioController != nil {
+		return r.istioController.RemoveIstioConfigurations(ctx, instance)
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -49,7 +50,7 @@ func TestReconcileOneAgentAPM(t *testing.T) {
 	).Build()
 
 	dtClient := &dtclient.MockDynatraceClient{}
-	dtClient.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}, nil)
+	dtClient.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
 	dtClient.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
 
 	reconciler := &ReconcileOneAgentAPM{
@@ -57,6 +58,7 @@ func TestReconcileOneAgentAPM(t *testing.T) {
 		apiReader: fakeClient,
 		scheme:    scheme.Scheme,
 		logger:    zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)),
+		recorder:  &record.FakeRecorder{},
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              fakeClient,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtClient),
@@ -90,22 +92,28 @@ func TestReconcileOneAgentAPM_MissingToken(t *testing.T) {
 	).Build()
 
 	dtClient := &dtclient.MockDynatraceClient{}
+	recorder := record.NewFakeRecorder(10)
 
 	reconciler := &ReconcileOneAgentAPM{
 		client:    fakeClient,
 		apiReader: fakeClient,
 		scheme:    scheme.Scheme,
 		logger:    zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)),
+		recorder:  recorder,
 		dtcReconciler: &utils.DynatraceClientReconciler{
 			Client:              fakeClient,
 			DynatraceClientFunc: utils.StaticDynatraceClient(dtClient),
 			UpdatePaaSToken:     true,
+			Recorder:            recorder,
 		},
 	}
 
 	_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
 	assert.NotNil(t, err)
 	assert.Equal(t, "Secret 'dynatrace:oneagent' not found", err.Error())
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Equal(t, "Warning TokenSecretNotFound Secret 'dynatrace:oneagent' not found", <-recorder.Events)
+	}
 
 	var result dynatracev1alpha1.OneAgentAPM
 	assert.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, &result))
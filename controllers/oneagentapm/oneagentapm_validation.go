@@ -0,0 +1,44 @@
+package oneagentapm
+
+import (
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateOneAgentAPM returns the issues found on the OneAgentAPM object. These are checked on reconciliation, and by
+// the validating webhook to reject invalid objects on admission.
+func ValidateOneAgentAPM(cr *dynatracev1alpha1.OneAgentAPM) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	errs := utils.ValidateBaseSpec(&cr.Spec.BaseOneAgentSpec, spec)
+
+	switch cr.Spec.Flavor {
+	case "", "default", "musl":
+	default:
+		errs = append(errs, field.NotSupported(spec.Child("flavor"), cr.Spec.Flavor, []string{"default", "musl"}))
+	}
+
+	return errs
+}
+
+// ValidateNewOneAgentAPM returns the issues found on settings of the OneAgentAPM object which earlier versions of the
+// Operator accepted, either without checking their format or ignoring them. The validating webhook rejects these for
+// new objects, while existing objects keep being reconciled with a warning.
+func ValidateNewOneAgentAPM(cr *dynatracev1alpha1.OneAgentAPM) field.ErrorList {
+	spec := field.NewPath("spec")
+
+	errs := utils.ValidateNewBaseSpec(&cr.Spec.BaseOneAgentSpec, spec)
+	errs = append(errs, utils.ValidateImage(cr.Spec.Image, spec.Child("image"))...)
+	errs = append(errs, utils.ValidateAgentVersion(cr.Spec.AgentVersion, spec.Child("agentVersion"))...)
+
+	if cr.Spec.Image != "" {
+		if !cr.Spec.UseImmutableImage {
+			errs = append(errs, field.Forbidden(spec.Child("image"), "is only used together with useImmutableImage"))
+		} else if cr.Spec.AgentVersion != "" {
+			errs = append(errs, field.Forbidden(spec.Child("agentVersion"), "can't be set together with image, since the version is given by the image"))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,44 @@
+package oneagentapm
+
+import (
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateOneAgentAPM(t *testing.T) {
+	apm := &dynatracev1alpha1.OneAgentAPM{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: dynatracev1alpha1.OneAgentAPMSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{APIURL: apiURL, UseImmutableImage: true},
+			AgentVersion:     "1.203.0",
+			Flavor:           "musl",
+		},
+	}
+	assert.Empty(t, ValidateOneAgentAPM(apm))
+	assert.Empty(t, ValidateNewOneAgentAPM(apm))
+
+	apm.Spec.APIURL = ""
+	apm.Spec.Proxy = &dynatracev1alpha1.OneAgentProxy{Value: "proxy:3128", ValueFrom: "proxy-secret"}
+	apm.Spec.Image = "registry.example.com/codemodules:1.203.0"
+	apm.Spec.Flavor = "alpine"
+
+	var msg []string
+	for _, err := range ValidateOneAgentAPM(apm) {
+		msg = append(msg, err.Error())
+	}
+	assert.Equal(t, []string{
+		"spec.apiUrl: Required value: the Dynatrace API URL is needed, e.g., https://ENVIRONMENTID.live.dynatrace.com/api",
+		`spec.flavor: Unsupported value: "alpine": supported values: "default", "musl"`,
+	}, msg)
+
+	// Settings ignored by earlier versions are only rejected for new objects.
+	assert.Equal(t, "[spec.proxy.valueFrom: Forbidden: can't be set together with value, "+
+		"spec.agentVersion: Forbidden: can't be set together with image, since the version is given by the image]",
+		ValidateNewOneAgentAPM(apm).ToAggregate().Error())
+
+	apm.Spec.UseImmutableImage = false
+	assert.Contains(t, ValidateNewOneAgentAPM(apm).ToAggregate().Error(), "spec.image: Forbidden: is only used together with useImmutableImage")
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AgentVersion is a parsed OneAgent version, formatted as "<major>.<minor>.<patch>.<timestamp>", e.g.,
+// "1.203.0.20201020-120000". The patch and timestamp components are optional.
+type AgentVersion struct {
+	Major     int
+	Minor     int
+	Patch     int
+	Timestamp string
+
+	// components is the number of components set on the parsed string.
+	components int
+}
+
+// ParseAgentVersion parses the version string.
+func ParseAgentVersion(s string) (AgentVersion, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 4)
+	if len(parts) < 2 {
+		return AgentVersion{}, fmt.Errorf("invalid version '%s': expected at least major and minor components", s)
+	}
+
+	var nums [3]int
+	for i := 0; i < len(parts) && i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return AgentVersion{}, fmt.Errorf("invalid version '%s': component '%s' is not a number", s, parts[i])
+		}
+		nums[i] = n
+	}
+
+	v := AgentVersion{Major: nums[0], Minor: nums[1], Patch: nums[2], components: len(parts)}
+	if len(parts) == 4 {
+		if parts[3] == "" || strings.Trim(parts[3], "0123456789-") != "" {
+			return AgentVersion{}, fmt.Errorf("invalid version '%s': invalid timestamp '%s'", s, parts[3])
+		}
+		v.Timestamp = parts[3]
+	}
+
+	return v, nil
+}
+
+// String returns the version formatted as on ParseAgentVersion.
+func (v AgentVersion) String() string {
+	switch v.components {
+	case 2:
+		return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	case 4:
+		return fmt.Sprintf("%d.%d.%d.%s", v.Major, v.Minor, v.Patch, v.Timestamp)
+	default:
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	}
+}
+
+// Compare returns -1, 0, or 1 if v is lower, equal, or greater than o. Missing timestamps are lower than any other.
+func (v AgentVersion) Compare(o AgentVersion) int {
+	return v.compare(o, 4)
+}
+
+// compare works as Compare, only taking into account the first n components.
+func (v AgentVersion) compare(o AgentVersion, n int) int {
+	for i, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if i >= n {
+			return 0
+		}
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	if n < 4 {
+		return 0
+	}
+	return compareTimestamps(v.Timestamp, o.Timestamp)
+}
+
+// compareTimestamps compares timestamps as "20201020-120000" by each of their numeric parts.
+func compareTimestamps(a, b string) int {
+	ap, bp := strings.Split(a, "-"), strings.Split(b, "-")
+	if a == "" || b == "" {
+		return sign(len(a) - len(b))
+	}
+
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, _ := strconv.ParseUint(ap[i], 10, 64)
+		bn, _ := strconv.ParseUint(bp[i], 10, 64)
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return sign(len(ap) - len(bp))
+}
+
+func sign(d int) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
+
+// IsNewerAgentVersion returns true if desired is a newer version than actual. Returns an error if any can't be parsed.
+func IsNewerAgentVersion(actual, desired string) (bool, error) {
+	a, err := ParseAgentVersion(actual)
+	if err != nil {
+		return false, err
+	}
+
+	d, err := ParseAgentVersion(desired)
+	if err != nil {
+		return false, err
+	}
+
+	return d.Compare(a) > 0, nil
+}
+
+// versionComparator is a single comparison against a version, only taking into account its first n components.
+type versionComparator struct {
+	op      string
+	version AgentVersion
+	n       int
+}
+
+func (c versionComparator) matches(v AgentVersion) bool {
+	r := v.compare(c.version, c.n)
+	switch c.op {
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	default:
+		return r == 0
+	}
+}
+
+// VersionConstraint is a set of comparisons which versions need to fulfill.
+type VersionConstraint struct {
+	comparators []versionComparator
+}
+
+// ParseVersionConstraint parses a list of space separated comparisons, all of them required to match. Comparisons
+// can be made with the operators '=', '>', '>=', '<' and '<=' against full or partial versions, e.g., ">=1.200 <1.210".
+// Additionally, the following shorthands are supported:
+//   - "1.203.x" or "1.203.*", for any version with the given prefix.
+//   - "~1.203", for patch updates within the given minor version.
+//   - "^1.203", for minor and patch updates within the given major version, starting from the given version.
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	var c VersionConstraint
+
+	for _, field := range strings.Fields(s) {
+		op, rest := "=", field
+		for _, o := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(field, o) {
+				op, rest = o, strings.TrimPrefix(field, o)
+				break
+			}
+		}
+
+		wildcard := false
+		for _, w := range []string{".x", ".*"} {
+			if strings.HasSuffix(rest, w) {
+				rest, wildcard = strings.TrimSuffix(rest, w), true
+			}
+		}
+		if wildcard && op != "=" {
+			return c, fmt.Errorf("invalid version constraint '%s': wildcards can't be used with '%s'", field, op)
+		}
+
+		n := strings.Count(rest, ".") + 1
+
+		// Allow a single major version with wildcards, e.g., "1.x".
+		if wildcard && n == 1 {
+			rest += ".0"
+		}
+
+		v, err := ParseAgentVersion(rest)
+		if err != nil {
+			return c, fmt.Errorf("invalid version constraint '%s': %w", field, err)
+		}
+
+		switch {
+		case wildcard:
+			c.comparators = append(c.comparators, versionComparator{op: "=", version: v, n: n})
+		case op == "~":
+			c.comparators = append(c.comparators,
+				versionComparator{op: ">=", version: v, n: n},
+				versionComparator{op: "=", version: v, n: 2})
+		case op == "^":
+			c.comparators = append(c.comparators,
+				versionComparator{op: ">=", version: v, n: n},
+				versionComparator{op: "=", version: v, n: 1})
+		default:
+			c.comparators = append(c.comparators, versionComparator{op: op, version: v, n: n})
+		}
+	}
+
+	if len(c.comparators) == 0 {
+		return c, fmt.Errorf("invalid version constraint '%s': no comparisons found", s)
+	}
+
+	return c, nil
+}
+
+// Matches returns true if the version fulfills all the comparisons on the constraint.
+func (c VersionConstraint) Matches(v AgentVersion) bool {
+	for _, cmp := range c.comparators {
+		if !cmp.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortAgentVersions parses and sorts the versions in descending order. Versions which can't be parsed are skipped.
+func SortAgentVersions(versions []string) []AgentVersion {
+	parsed := make([]AgentVersion, 0, len(versions))
+	for _, s := range versions {
+		if v, err := ParseAgentVersion(s); err == nil {
+			parsed = append(parsed, v)
+		}
+	}
+
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].Compare(parsed[j]) > 0 })
+	return parsed
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAgentVersion(t *testing.T) {
+	for _, s := range []string{"1.203", "1.203.0", "1.203.0.20201020-120000", "1.203.0.20201020"} {
+		v, err := ParseAgentVersion(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, s, v.String())
+		}
+	}
+
+	v, err := ParseAgentVersion("1.203.4.20201020-120000")
+	require.NoError(t, err)
+	assert.Equal(t, AgentVersion{Major: 1, Minor: 203, Patch: 4, Timestamp: "20201020-120000", components: 4}, v)
+
+	for _, s := range []string{"", "1", "a.b", "1.203.x", "1.-2.0", "1.203.0.", "1.203.0.2020-abc"} {
+		_, err := ParseAgentVersion(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestAgentVersion_Compare(t *testing.T) {
+	compare := func(a, b string) int {
+		va, err := ParseAgentVersion(a)
+		require.NoError(t, err)
+		vb, err := ParseAgentVersion(b)
+		require.NoError(t, err)
+		return va.Compare(vb)
+	}
+
+	assert.Equal(t, 0, compare("1.203.0.20201020-120000", "1.203.0.20201020-120000"))
+	assert.Equal(t, -1, compare("1.203.0", "1.204.0"))
+	assert.Equal(t, 1, compare("2.0.0", "1.999.0"))
+	assert.Equal(t, 1, compare("1.203.10", "1.203.9"))
+	assert.Equal(t, 1, compare("1.203.0.20201020-120000", "1.203.0.20201020-115959"))
+	assert.Equal(t, 1, compare("1.203.0.20201021-000000", "1.203.0.20201020-235959"))
+	assert.Equal(t, 1, compare("1.203.0.20201020-120000", "1.203.0"))
+	assert.Equal(t, 0, compare("1.203", "1.203.0"))
+}
+
+func TestIsNewerAgentVersion(t *testing.T) {
+	newer, err := IsNewerAgentVersion("1.203.0.20201020-120000", "1.204.0.20201103-090000")
+	assert.NoError(t, err)
+	assert.True(t, newer)
+
+	newer, err = IsNewerAgentVersion("1.204.0.20201103-090000", "1.203.0.20201020-120000")
+	assert.NoError(t, err)
+	assert.False(t, newer)
+
+	_, err = IsNewerAgentVersion("latest", "1.203.0")
+	assert.Error(t, err)
+}
+
+func TestVersionConstraint_Matches(t *testing.T) {
+	matches := func(constraint, version string) bool {
+		c, err := ParseVersionConstraint(constraint)
+		require.NoError(t, err, constraint)
+		v, err := ParseAgentVersion(version)
+		require.NoError(t, err, version)
+		return c.Matches(v)
+	}
+
+	assert.True(t, matches("1.203", "1.203.0.20201020-120000"))
+	assert.False(t, matches("=1.203.0", "1.203.1"))
+	assert.True(t, matches(">=1.200 <1.210", "1.205.0"))
+	assert.False(t, matches(">=1.200 <1.210", "1.210.0"))
+	assert.False(t, matches(">=1.200 <1.210", "1.199.3"))
+	assert.True(t, matches("<=1.203", "1.203.9"))
+	assert.False(t, matches(">1.203", "1.203.9"))
+	assert.True(t, matches(">1.203", "1.204.0"))
+
+	assert.True(t, matches("1.203.x", "1.203.5.20201020-120000"))
+	assert.True(t, matches("1.203.*", "1.203.0"))
+	assert.False(t, matches("1.203.x", "1.204.0"))
+	assert.True(t, matches("1.x", "1.210.0"))
+	assert.False(t, matches("1.x", "2.0.0"))
+
+	assert.True(t, matches("~1.203.2", "1.203.5"))
+	assert.False(t, matches("~1.203.2", "1.203.1"))
+	assert.False(t, matches("~1.203.2", "1.204.0"))
+
+	assert.True(t, matches("^1.203", "1.210.0"))
+	assert.False(t, matches("^1.203", "1.202.0"))
+	assert.False(t, matches("^1.203", "2.0.0"))
+}
+
+func TestParseVersionConstraint_Invalid(t *testing.T) {
+	for _, s := range []string{"", "  ", "latest", ">=1.x", "~1.*", "1.203 <abc", "x"} {
+		_, err := ParseVersionConstraint(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSortAgentVersions(t *testing.T) {
+	sorted := SortAgentVersions([]string{
+		"1.203.0.20201020-120000",
+		"invalid",
+		"1.205.0.20201103-090000",
+		"1.203.2.20201027-080000",
+		"1.204.0.20201027-080000",
+	})
+
+	var actual []string
+	for _, v := range sorted {
+		actual = append(actual, v.String())
+	}
+	assert.Equal(t, []string{
+		"1.205.0.20201103-090000",
+		"1.204.0.20201027-080000",
+		"1.203.2.20201027-080000",
+		"1.203.0.20201020-120000",
+	}, actual)
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// Field managers of the objects applied by the Operator and the webhook.
+const (
+	OperatorFieldManager = "dynatrace-oneagent-operator"
+	WebhookFieldManager  = "dynatrace-oneagent-webhook"
+)
+
+// legacyFieldManager owns the fields written with updates by earlier versions of the Operator and the webhook, which
+// the API server names after the binary.
+const legacyFieldManager = "dynatrace-oneagent-operator"
+
+// Apply creates or updates obj with server-side apply, with fieldManager as the owner of the fields set on it. Fields
+// not set on obj are kept as they are, so that changes by other controllers aren't reverted.
+//
+// If other managers own some of the fields, the conflicts are logged and the fields get taken over, since the objects
+// applied are managed by the Operator. On success, obj is updated with the state returned by the server.
+//
+// Fields written by earlier versions of the Operator are first handed over to fieldManager, see migrateManagedFields.
+func Apply(ctx context.Context, c client.Client, obj client.Object, fieldManager string, logger logr.Logger) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return err
+	}
+
+	if err := migrateManagedFields(ctx, c, obj, gvk, fieldManager, logger); err != nil {
+		return err
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+
+	err = c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager))
+	if !k8serrors.IsConflict(err) {
+		return err
+	}
+
+	logger.Info("Taking over fields managed by others", "kind", gvk.Kind, "name", obj.GetName(), "conflicts", err.Error())
+	return c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// migrateManagedFields hands the fields written with updates by earlier versions of the Operator over to fieldManager
+// on an existing object. Otherwise these would stay owned by the update manager, and fields no longer set by the
+// Operator wouldn't be removed when applying.
+func migrateManagedFields(ctx context.Context, c client.Client, obj client.Object, gvk schema.GroupVersionKind, fieldManager string, logger logr.Logger) error {
+	ro, err := c.Scheme().New(gvk)
+	if err != nil {
+		return err
+	}
+
+	existing, ok := ro.(client.Object)
+	if !ok {
+		return fmt.Errorf("%s is not an object", gvk)
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	entries, upd, err := upgradeManagedFields(existing.GetManagedFields(), fieldManager, gvk.GroupVersion().String())
+	if err != nil || !upd {
+		return err
+	}
+
+	// The resource version is tested so that fields written in the meantime aren't lost.
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": existing.GetResourceVersion()},
+		{"op": "replace", "path": "/metadata/managedFields", "value": entries},
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Migrating fields written by earlier versions", "kind", gvk.Kind, "name", obj.GetName(), "manager", fieldManager)
+	return c.Patch(ctx, existing, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// upgradeManagedFields returns the managed fields with the entries of legacyFieldManager for updates merged into the
+// apply entry of fieldManager, and true if any has been found.
+func upgradeManagedFields(entries []metav1.ManagedFieldsEntry, fieldManager, apiVersion string) ([]metav1.ManagedFieldsEntry, bool, error) {
+	var out []metav1.ManagedFieldsEntry
+	var legacy []*metav1.FieldsV1
+	applied := -1
+
+	for _, entry := range entries {
+		switch {
+		case entry.Manager == legacyFieldManager && entry.Operation == metav1.ManagedFieldsOperationUpdate:
+			legacy = append(legacy, entry.FieldsV1)
+			continue
+		case entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply:
+			applied = len(out)
+		}
+		out = append(out, entry)
+	}
+
+	if len(legacy) == 0 {
+		return entries, false, nil
+	}
+
+	if applied < 0 {
+		now := metav1.Now()
+		out = append(out, metav1.ManagedFieldsEntry{
+			Manager:    fieldManager,
+			Operation:  metav1.ManagedFieldsOperationApply,
+			APIVersion: apiVersion,
+			Time:       &now,
+			FieldsType: "FieldsV1",
+		})
+		applied = len(out) - 1
+	}
+
+	fields := &fieldpath.Set{}
+	for _, f := range append(legacy, out[applied].FieldsV1) {
+		if f == nil {
+			continue
+		}
+
+		var set fieldpath.Set
+		if err := set.FromJSON(bytes.NewReader(f.Raw)); err != nil {
+			return nil, false, err
+		}
+		fields = fields.Union(&set)
+	}
+
+	raw, err := fields.ToJSON()
+	if err != nil {
+		return nil, false, err
+	}
+	out[applied].FieldsV1 = &metav1.FieldsV1{Raw: raw}
+
+	return out, true, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var logger = log.Log.WithName("apply_test")
+
+// conflictingClient returns a conflict for apply patches which don't force the ownership of the fields.
+type conflictingClient struct {
+	client.Client
+	patches []client.PatchOptions
+}
+
+func (c *conflictingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	var po client.PatchOptions
+	po.ApplyOptions(opts)
+	c.patches = append(c.patches, po)
+
+	if po.Force == nil || !*po.Force {
+		return k8serrors.NewConflict(schema.GroupResource{Resource: "secrets"}, obj.GetName(),
+			errors.New(`conflict with "kubectl": .data.token`))
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApply(t *testing.T) {
+	key := client.ObjectKey{Name: "my-secret", Namespace: "dynatrace"}
+	c := FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()}
+
+	require.NoError(t, Apply(context.TODO(), c, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Data:       map[string][]byte{"token": []byte("abc")},
+	}, OperatorFieldManager, logger))
+
+	// Fields set by others are kept.
+	var secret corev1.Secret
+	require.NoError(t, c.Get(context.TODO(), key, &secret))
+	secret.Annotations = map[string]string{"example.com/owner": "someone"}
+	require.NoError(t, c.Update(context.TODO(), &secret))
+
+	applied := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Data:       map[string][]byte{"token": []byte("xyz")},
+	}
+	require.NoError(t, Apply(context.TODO(), c, &applied, OperatorFieldManager, logger))
+	assert.Equal(t, "Secret", applied.Kind)
+
+	require.NoError(t, c.Get(context.TODO(), key, &secret))
+	assert.Equal(t, map[string][]byte{"token": []byte("xyz")}, secret.Data)
+	assert.Equal(t, map[string]string{"example.com/owner": "someone"}, secret.Annotations)
+}
+
+func TestApply_Conflict(t *testing.T) {
+	c := &conflictingClient{Client: FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()}}
+
+	require.NoError(t, Apply(context.TODO(), c, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "dynatrace"},
+	}, WebhookFieldManager, logger))
+
+	if assert.Len(t, c.patches, 2) {
+		assert.Equal(t, WebhookFieldManager, c.patches[0].FieldManager)
+		assert.Nil(t, c.patches[0].Force)
+		assert.Equal(t, WebhookFieldManager, c.patches[1].FieldManager)
+		assert.True(t, *c.patches[1].Force)
+	}
+}
+
+func TestApply_MigrateManagedFields(t *testing.T) {
+	key := client.ObjectKey{Name: "my-secret", Namespace: "dynatrace"}
+	time := metav1.Now()
+
+	// Written with updates by an earlier version of the Operator, and then labeled by someone else.
+	c := FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            key.Name,
+			Namespace:       key.Namespace,
+			ResourceVersion: "1",
+			Labels:          map[string]string{"example.com/team": "a"},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{
+					Manager:    legacyFieldManager,
+					Operation:  metav1.ManagedFieldsOperationUpdate,
+					APIVersion: "v1",
+					Time:       &time,
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:data":{".":{},"f:old":{},"f:token":{}}}`)},
+				},
+				{
+					Manager:    "kubectl",
+					Operation:  metav1.ManagedFieldsOperationUpdate,
+					APIVersion: "v1",
+					Time:       &time,
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{".":{},"f:example.com/team":{}}}}`)},
+				},
+			},
+		},
+		Data: map[string][]byte{"old": []byte("1"), "token": []byte("abc")},
+	}).Build()}
+
+	require.NoError(t, Apply(context.TODO(), c, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Data:       map[string][]byte{"token": []byte("xyz")},
+	}, OperatorFieldManager, logger))
+
+	var secret corev1.Secret
+	require.NoError(t, c.Get(context.TODO(), key, &secret))
+
+	var managers []string
+	for _, entry := range secret.ManagedFields {
+		managers = append(managers, entry.Manager+" "+string(entry.Operation))
+	}
+	assert.Equal(t, []string{"kubectl Update", OperatorFieldManager + " Apply"}, managers)
+
+	if assert.Len(t, secret.ManagedFields, 2) {
+		assert.Equal(t, "v1", secret.ManagedFields[1].APIVersion)
+		assert.JSONEq(t, `{"f:data":{".":{},"f:old":{},"f:token":{}}}`, string(secret.ManagedFields[1].FieldsV1.Raw))
+	}
+
+	// Nothing left to migrate.
+	_, upd, err := upgradeManagedFields(secret.ManagedFields, OperatorFieldManager, "v1")
+	require.NoError(t, err)
+	assert.False(t, upd)
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CleanupFinalizer is set on OneAgent and OneAgentAPM objects, so that the objects derived from them which aren't
+// garbage collected, like the secrets in other namespaces, get removed before the deletion completes.
+const CleanupFinalizer = "oneagent.dynatrace.com/cleanup"
+
+// CleanupTimeout is the time after which the finalizer gets removed from a deleted object even if the cleanup keeps
+// failing, to not block the deletion forever.
+const CleanupTimeout = 5 * time.Minute
+
+// Reasons of the events recorded for the cleanup of deleted objects.
+const (
+	eventCleanupFailed   = "CleanupFailed"
+	eventCleanupTimedOut = "CleanupTimedOut"
+)
+
+// ReconcileCleanupFinalizer adds the cleanup finalizer to obj, or runs cleanup and removes the finalizer if obj is
+// being deleted. If cleanup fails, the error is returned so that the request gets retried, until CleanupTimeout has
+// passed since the deletion.
+//
+// Returns true if obj is being deleted, in which case it shouldn't be reconciled any further.
+func ReconcileCleanupFinalizer(ctx context.Context, c client.Client, recorder record.EventRecorder, obj client.Object,
+	cleanup func(ctx context.Context) error) (bool, error) {
+
+	deleted := obj.GetDeletionTimestamp()
+	if deleted == nil {
+		if controllerutil.ContainsFinalizer(obj, CleanupFinalizer) {
+			return false, nil
+		}
+		controllerutil.AddFinalizer(obj, CleanupFinalizer)
+		return false, c.Update(ctx, obj)
+	}
+
+	if !controllerutil.ContainsFinalizer(obj, CleanupFinalizer) {
+		return true, nil
+	}
+
+	if err := cleanup(ctx); err != nil {
+		if time.Since(deleted.Time) < CleanupTimeout {
+			recorder.Eventf(obj, corev1.EventTypeWarning, eventCleanupFailed, "Failed to remove derived objects: %v", err)
+			return true, err
+		}
+		recorder.Eventf(obj, corev1.EventTypeWarning, eventCleanupTimedOut,
+			"Giving up removing derived objects after %s, these must be removed manually: %v", CleanupTimeout, err)
+	}
+
+	controllerutil.RemoveFinalizer(obj, CleanupFinalizer)
+	return true, c.Update(ctx, obj)
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileCleanupFinalizer(t *testing.T) {
+	ctx := context.TODO()
+	key := client.ObjectKey{Name: "oneagent", Namespace: "dynatrace"}
+	failing := func(context.Context) error { return errors.New("forbidden") }
+
+	t.Run("finalizer added", func(t *testing.T) {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm).Build()
+
+		deleted, err := ReconcileCleanupFinalizer(ctx, c, record.NewFakeRecorder(10), cm, failing)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+
+		var actual corev1.ConfigMap
+		require.NoError(t, c.Get(ctx, key, &actual))
+		assert.Equal(t, []string{CleanupFinalizer}, actual.Finalizers)
+	})
+
+	t.Run("cleanup failed", func(t *testing.T) {
+		now := metav1.Now()
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: key.Name, Namespace: key.Namespace, DeletionTimestamp: &now, Finalizers: []string{CleanupFinalizer},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm).Build()
+		recorder := record.NewFakeRecorder(10)
+
+		deleted, err := ReconcileCleanupFinalizer(ctx, c, recorder, cm, failing)
+		assert.EqualError(t, err, "forbidden")
+		assert.True(t, deleted)
+		assert.Equal(t, "Warning CleanupFailed Failed to remove derived objects: forbidden", <-recorder.Events)
+
+		var actual corev1.ConfigMap
+		require.NoError(t, c.Get(ctx, key, &actual))
+		assert.Equal(t, []string{CleanupFinalizer}, actual.Finalizers)
+	})
+
+	t.Run("cleanup timed out", func(t *testing.T) {
+		deletedAt := metav1.NewTime(time.Now().Add(-CleanupTimeout))
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: key.Name, Namespace: key.Namespace, DeletionTimestamp: &deletedAt, Finalizers: []string{CleanupFinalizer},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm).Build()
+		recorder := record.NewFakeRecorder(10)
+
+		deleted, err := ReconcileCleanupFinalizer(ctx, c, recorder, cm, failing)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		assert.Equal(t, "Warning CleanupTimedOut Giving up removing derived objects after 5m0s, these must be removed manually: forbidden",
+			<-recorder.Events)
+
+		var actual corev1.ConfigMap
+		require.NoError(t, c.Get(ctx, key, &actual))
+		assert.Empty(t, actual.Finalizers)
+	})
+
+	t.Run("cleanup succeeded", func(t *testing.T) {
+		now := metav1.Now()
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: key.Name, Namespace: key.Namespace, DeletionTimestamp: &now, Finalizers: []string{CleanupFinalizer, "example.com/other"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm).Build()
+
+		cleaned := false
+		deleted, err := ReconcileCleanupFinalizer(ctx, c, record.NewFakeRecorder(10), cm, func(context.Context) error {
+			cleaned = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		assert.True(t, cleaned)
+
+		var actual corev1.ConfigMap
+		require.NoError(t, c.Get(ctx, key, &actual))
+		assert.Equal(t, []string{"example.com/other"}, actual.Finalizers)
+	})
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultEnvironmentRateLimit is the number of requests per second done to a Dynatrace environment by all clients.
+	defaultEnvironmentRateLimit = 5
+	defaultEnvironmentBurst     = 10
+
+	defaultHostCacheTTL     = 5 * time.Minute
+	defaultClientIdleExpiry = 30 * time.Minute
+)
+
+// dynatraceClients is the pool used by BuildDynatraceClient.
+var dynatraceClients = NewDynatraceClientPool()
+
+// dynatraceClientKey holds the settings a Dynatrace client is created with.
+type dynatraceClientKey struct {
+	apiURL        string
+	apiToken      string
+	paasToken     string
+	skipCertCheck bool
+	proxy         string
+	certs         string
+	networkZone   string
+}
+
+type pooledClient struct {
+	client   dtclient.Client
+	lastUsed time.Time
+}
+
+// DynatraceClientPool keeps Dynatrace clients for reuse across reconciliations and controllers, keyed by API URL,
+// tokens and connection settings. Pooled clients keep their connections and host cache, which is refreshed after a
+// TTL, and the clients for the same environment share a rate limiter. Clients which haven't been used for a while,
+// e.g., after a token got rotated, are discarded.
+type DynatraceClientPool struct {
+	lock     sync.Mutex
+	clients  map[dynatraceClientKey]*pooledClient
+	limiters map[string]*rate.Limiter
+
+	rateLimit    rate.Limit
+	burst        int
+	hostCacheTTL time.Duration
+	idleExpiry   time.Duration
+
+	// Set for testing purposes.
+	newClient func(url, apiToken, paasToken string, opts ...dtclient.Option) (dtclient.Client, error)
+	now       func() time.Time
+}
+
+// NewDynatraceClientPool creates an empty DynatraceClientPool with the default settings.
+func NewDynatraceClientPool() *DynatraceClientPool {
+	return &DynatraceClientPool{
+		clients:      make(map[dynatraceClientKey]*pooledClient),
+		limiters:     make(map[string]*rate.Limiter),
+		rateLimit:    defaultEnvironmentRateLimit,
+		burst:        defaultEnvironmentBurst,
+		hostCacheTTL: defaultHostCacheTTL,
+		idleExpiry:   defaultClientIdleExpiry,
+		newClient:    dtclient.NewClient,
+		now:          time.Now,
+	}
+}
+
+// BuildDynatraceClient returns a Dynatrace client using the settings configured on the given instance, reusing a
+// pooled one if available. It implements DynatraceClientFunc.
+func (p *DynatraceClientPool) BuildDynatraceClient(ctx context.Context, rtc client.Client, instance dynatracev1alpha1.BaseOneAgent, tkns Tokens, hasAPIToken, hasPaaSToken bool) (dtclient.Client, error) {
+	ns := instance.GetNamespace()
+	spec := instance.GetSpec()
+
+	key := dynatraceClientKey{
+		apiURL:        spec.APIURL,
+		skipCertCheck: spec.SkipCertCheck,
+		networkZone:   spec.NetworkZone,
+	}
+
+	if pr := spec.Proxy; pr != nil {
+		if pr.ValueFrom != "" {
+			proxySecret := &corev1.Secret{}
+			err := rtc.Get(ctx, client.ObjectKey{Name: pr.ValueFrom, Namespace: ns}, proxySecret)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get proxy secret")
+			}
+
+			if key.proxy, err = extractToken(proxySecret, "proxy"); err != nil {
+				return nil, errors.Wrap(err, "failed to extract proxy secret field")
+			}
+		} else {
+			key.proxy = pr.Value
+		}
+	}
+
+	if spec.TrustedCAs != "" {
+		certs := &corev1.ConfigMap{}
+		if err := rtc.Get(ctx, client.ObjectKey{Namespace: ns, Name: spec.TrustedCAs}, certs); err != nil {
+			return nil, errors.Wrap(err, "failed to get certificate configmap")
+		}
+		if certs.Data["certs"] == "" {
+			return nil, errors.Errorf("failed to extract certificate configmap field: missing field certs")
+		}
+		key.certs = certs.Data["certs"]
+	}
+
+	var err error
+
+	if hasAPIToken {
+		if key.apiToken, err = tkns.extract(DynatraceApiToken); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if hasPaaSToken {
+		if key.paasToken, err = tkns.extract(DynatracePaasToken); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return p.get(key)
+}
+
+func (p *DynatraceClientPool) get(key dynatraceClientKey) (dtclient.Client, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+
+	for k, pc := range p.clients {
+		if now.Sub(pc.lastUsed) > p.idleExpiry {
+			delete(p.clients, k)
+		}
+	}
+
+	if pc, ok := p.clients[key]; ok {
+		pc.lastUsed = now
+		return pc.client, nil
+	}
+
+	limiter, ok := p.limiters[key.apiURL]
+	if !ok {
+		limiter = rate.NewLimiter(p.rateLimit, p.burst)
+		p.limiters[key.apiURL] = limiter
+	}
+
+	opts := []dtclient.Option{dtclient.RateLimiter(limiter), dtclient.HostCacheTTL(p.hostCacheTTL)}
+	if key.skipCertCheck {
+		opts = append(opts, dtclient.SkipCertificateValidation(true))
+	}
+	if key.proxy != "" {
+		opts = append(opts, dtclient.Proxy(key.proxy))
+	}
+	if key.certs != "" {
+		opts = append(opts, dtclient.Certs([]byte(key.certs)))
+	}
+	if key.networkZone != "" {
+		opts = append(opts, dtclient.NetworkZone(key.networkZone))
+	}
+
+	c, err := p.newClient(key.apiURL, key.apiToken, key.paasToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.clients[key] = &pooledClient{client: c, lastUsed: now}
+	return c, nil
+}
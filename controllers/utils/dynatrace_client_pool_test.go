@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDynatraceClientPool(t *testing.T) {
+	namespace := "dynatrace"
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var created int
+	pool := NewDynatraceClientPool()
+	pool.now = func() time.Time { return now }
+	pool.newClient = func(url, apiToken, paasToken string, opts ...dtclient.Option) (dtclient.Client, error) {
+		created++
+		return dtclient.NewClient(url, apiToken, paasToken, opts...)
+	}
+
+	newOneAgent := func(name, apiURL string) *dynatracev1alpha1.OneAgent {
+		return &dynatracev1alpha1.OneAgent{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: dynatracev1alpha1.OneAgentSpec{
+				BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{APIURL: apiURL, Tokens: "tokens"},
+			},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	tokens := Tokens{"paasToken": "42", "apiToken": "43"}
+
+	first := newOneAgent("first", "https://ENVIRONMENTID.live.dynatrace.com/api")
+	second := newOneAgent("second", "https://ENVIRONMENTID.live.dynatrace.com/api")
+	other := newOneAgent("other", "https://OTHER.live.dynatrace.com/api")
+
+	dtc1, err := pool.BuildDynatraceClient(context.TODO(), c, first, tokens, true, true)
+	require.NoError(t, err)
+
+	// Same settings on another instance, the client is reused.
+	dtc2, err := pool.BuildDynatraceClient(context.TODO(), c, second, tokens, true, true)
+	require.NoError(t, err)
+	assert.Same(t, dtc1, dtc2)
+	assert.Equal(t, 1, created)
+
+	// Different tokens need a different client, sharing the rate limiter of the environment.
+	dtc3, err := pool.BuildDynatraceClient(context.TODO(), c, first, tokens, false, true)
+	require.NoError(t, err)
+	assert.NotSame(t, dtc1, dtc3)
+	assert.Equal(t, 2, created)
+	assert.Len(t, pool.limiters, 1)
+
+	_, err = pool.BuildDynatraceClient(context.TODO(), c, other, tokens, true, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, created)
+	assert.Len(t, pool.limiters, 2)
+
+	// Rotated tokens are picked up with a new client.
+	rotated := Tokens{"paasToken": "42", "apiToken": "44"}
+	dtc4, err := pool.BuildDynatraceClient(context.TODO(), c, first, rotated, true, true)
+	require.NoError(t, err)
+	assert.NotSame(t, dtc1, dtc4)
+	assert.Equal(t, 4, created)
+	assert.Len(t, pool.clients, 4)
+
+	// Clients not used for a while are discarded.
+	now = now.Add(time.Hour)
+	_, err = pool.BuildDynatraceClient(context.TODO(), c, first, rotated, true, true)
+	require.NoError(t, err)
+	assert.Len(t, pool.clients, 1)
+}
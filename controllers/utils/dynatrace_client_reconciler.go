@@ -2,18 +2,24 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
 	corev1 "k8s.io/api/core/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -23,15 +29,45 @@ type DynatraceClientReconciler struct {
 	Now                 metav1.Time
 	UpdatePaaSToken     bool
 	UpdateAPIToken      bool
+
+	// Recorder, if set, gets events for the changes on the token conditions.
+	Recorder record.EventRecorder
+
+	// ExpiryWarning is the time before the expiration of a token from which on it's reported. Defaults to the days
+	// set on ONEAGENT_OPERATOR_TOKEN_EXPIRY_WARNING_DAYS, or 14 days.
+	ExpiryWarning time.Duration
 }
 
+const (
+	tokenExpiryWarningEnvVar      = "ONEAGENT_OPERATOR_TOKEN_EXPIRY_WARNING_DAYS"
+	defaultTokenExpiryWarningDays = 14
+)
+
 type tokenConfig struct {
 	Type              string
 	Key, Value, Scope string
 	Timestamp         **metav1.Time
+
+	// Optional are the scopes needed by features which are disabled without them.
+	Optional []optionalScope
+
+	// Info is set if the token has been probed successfully on this reconciliation.
+	Info *dtclient.TokenInfo
+}
+
+type optionalScope struct {
+	Scope, Feature string
 }
 
-func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent) (dtclient.Client, bool, error) {
+// apiTokenOptionalScopes are the scopes on the API token needed by some features.
+var apiTokenOptionalScopes = []optionalScope{
+	{Scope: dtclient.TokenScopeEntitiesRead, Feature: "host entity lookups with the Environment API v2"},
+	{Scope: dtclient.TokenScopeDataImport, Feature: "events for hosts marked for termination, for deleted OneAgents and for OneAgent lifecycle changes"},
+}
+
+// Reconcile reads and probes the tokens of the instance, setting the token conditions on its status. Returns the
+// Dynatrace client and the tokens read, to be used for the rest of the reconciliation, and whether the status changed.
+func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dynatracev1alpha1.BaseOneAgent) (dtclient.Client, Tokens, bool, error) {
 	now := r.Now
 	if now.IsZero() {
 		now = metav1.Now()
@@ -44,7 +80,6 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 
 	sts := instance.GetStatus()
 	ns := instance.GetNamespace()
-	secretName := GetTokensName(instance)
 
 	var tokens []*tokenConfig
 
@@ -63,6 +98,7 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 			Key:       DynatraceApiToken,
 			Scope:     dtclient.TokenScopeDataExport,
 			Timestamp: &sts.LastAPITokenProbeTimestamp,
+			Optional:  apiTokenOptionalScopes,
 		})
 	}
 
@@ -76,13 +112,14 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 		}
 	}
 
-	secretKey := ns + ":" + secretName
-	secret := &corev1.Secret{}
-	if err := r.Client.Get(ctx, client.ObjectKey{Name: secretName, Namespace: ns}, secret); k8serrors.IsNotFound(err) {
-		message := fmt.Sprintf("Secret '%s' not found", secretKey)
+	src := GetTokenSource(r.Client, instance)
+	source := src.String()
+	tkns, err := src.Tokens(ctx)
+	if IsTokensNotFound(err) {
+		message := err.Error()
 
 		for _, t := range tokens {
-			updateCR = setCondition(&sts.Conditions, metav1.Condition{
+			updateCR = r.setCondition(instance, metav1.Condition{
 				Type:    t.Type,
 				Status:  metav1.ConditionFalse,
 				Reason:  dynatracev1alpha1.ReasonTokenSecretNotFound,
@@ -90,37 +127,37 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 			}) || updateCR
 		}
 
-		return nil, updateCR, fmt.Errorf(message)
+		return nil, nil, updateCR, fmt.Errorf(message)
 	} else if err != nil {
-		return nil, updateCR, err
+		return nil, nil, updateCR, err
 	}
 
 	valid := true
 
 	for _, t := range tokens {
-		v := secret.Data[t.Key]
+		v := tkns[t.Key]
 		if len(v) == 0 {
-			updateCR = setCondition(&sts.Conditions, metav1.Condition{
+			updateCR = r.setCondition(instance, metav1.Condition{
 				Type:    t.Type,
 				Status:  metav1.ConditionFalse,
 				Reason:  dynatracev1alpha1.ReasonTokenMissing,
-				Message: fmt.Sprintf("Token %s on secret %s missing", t.Key, secretKey),
+				Message: fmt.Sprintf("Token %s on %s missing", t.Key, source),
 			}) || updateCR
 			valid = false
 		}
-		t.Value = string(v)
+		t.Value = v
 	}
 
 	if !valid {
-		return nil, updateCR, fmt.Errorf("issues found with tokens, see status")
+		return nil, nil, updateCR, fmt.Errorf("issues found with tokens, see status")
 	}
 
-	dtc, err := dtf(r.Client, instance, r.UpdateAPIToken, r.UpdatePaaSToken)
+	dtc, err := dtf(ctx, r.Client, instance, tkns, r.UpdateAPIToken, r.UpdatePaaSToken)
 	if err != nil {
 		message := fmt.Sprintf("Failed to create Dynatrace API Client: %s", err)
 
 		for _, t := range tokens {
-			updateCR = setCondition(&sts.Conditions, metav1.Condition{
+			updateCR = r.setCondition(instance, metav1.Condition{
 				Type:    t.Type,
 				Status:  metav1.ConditionFalse,
 				Reason:  dynatracev1alpha1.ReasonTokenError,
@@ -128,16 +165,26 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 			}) || updateCR
 		}
 
-		return nil, updateCR, err
+		return nil, nil, updateCR, err
+	}
+
+	// Rotated tokens are probed right away, and only activated if valid, so that the derived secrets keep the previous
+	// tokens otherwise.
+	hash := TokensHash(tkns)
+	rotated := sts.TokenHash != "" && sts.TokenHash != hash
+	if rotated {
+		for _, t := range tokens {
+			*t.Timestamp = nil
+		}
 	}
 
 	for _, t := range tokens {
 		if strings.TrimSpace(t.Value) != t.Value {
-			updateCR = setCondition(&sts.Conditions, metav1.Condition{
+			updateCR = r.setCondition(instance, metav1.Condition{
 				Type:    t.Type,
 				Status:  metav1.ConditionFalse,
 				Reason:  dynatracev1alpha1.ReasonTokenUnauthorized,
-				Message: fmt.Sprintf("Token on secret %s has leading and/or trailing spaces", secretKey),
+				Message: fmt.Sprintf("Token on %s has leading and/or trailing spaces", source),
 			}) || updateCR
 			continue
 		}
@@ -151,66 +198,243 @@ func (r *DynatraceClientReconciler) Reconcile(ctx context.Context, instance dyna
 		nowCopy := now
 		*t.Timestamp = &nowCopy
 		updateCR = true
-		ss, err := dtc.GetTokenScopes(t.Value)
 
-		var serr dtclient.ServerError
-		if ok := errors.As(err, &serr); ok && serr.Code == http.StatusUnauthorized {
-			setCondition(&sts.Conditions, metav1.Condition{
-				Type:    t.Type,
-				Status:  metav1.ConditionFalse,
-				Reason:  dynatracev1alpha1.ReasonTokenUnauthorized,
-				Message: fmt.Sprintf("Token on secret %s unauthorized", secretKey),
-			})
+		condition := probeToken(ctx, dtc, t, source, sts)
+		r.setCondition(instance, condition)
+		metrics.TokenProbes.WithLabelValues(ns, instance.GetName(), t.Key, condition.Reason).Inc()
+	}
+
+	for _, t := range tokens {
+		if t.Info == nil {
 			continue
 		}
+		if t.Info.Expires.IsZero() {
+			metrics.TokenExpiry.DeleteLabelValues(ns, instance.GetName(), t.Key)
+		} else {
+			metrics.TokenExpiry.WithLabelValues(ns, instance.GetName(), t.Key).Set(float64(t.Info.Expires.Unix()))
+		}
+	}
 
-		if err != nil {
-			setCondition(&sts.Conditions, metav1.Condition{
-				Type:    t.Type,
-				Status:  metav1.ConditionFalse,
-				Reason:  dynatracev1alpha1.ReasonTokenError,
-				Message: fmt.Sprintf("error when querying token on secret %s: %v", secretKey, err),
-			})
-			continue
+	if probed(tokens) {
+		updateCR = r.setCondition(instance, expiryCondition(tokens, source, now.Time, r.expiryWarning())) || updateCR
+
+		if c, ok := optionalScopesCondition(tokens, source); ok {
+			updateCR = r.setCondition(instance, c) || updateCR
 		}
+	}
 
-		if !ss.Contains(t.Scope) {
-			setCondition(&sts.Conditions, metav1.Condition{
-				Type:    t.Type,
-				Status:  metav1.ConditionFalse,
-				Reason:  dynatracev1alpha1.ReasonTokenScopeMissing,
-				Message: fmt.Sprintf("Token on secret %s missing scope %s", secretKey, t.Scope),
-			})
-			continue
+	if rotated {
+		var issues []string
+		for _, t := range tokens {
+			if c := meta.FindStatusCondition(sts.Conditions, t.Type); c != nil && c.Status != metav1.ConditionTrue {
+				issues = append(issues, c.Message)
+			}
+		}
+
+		if len(issues) > 0 {
+			updateCR = r.setCondition(instance, metav1.Condition{
+				Type:   dynatracev1alpha1.TokensActiveConditionType,
+				Status: metav1.ConditionFalse,
+				Reason: dynatracev1alpha1.ReasonTokensRejected,
+				Message: fmt.Sprintf("New tokens on %s rejected, keeping generation %d: %s",
+					source, sts.TokenGeneration, strings.Join(issues, ", ")),
+			}) || updateCR
+			return nil, nil, updateCR, fmt.Errorf("new tokens on %s rejected", source)
+		}
+	}
+
+	if sts.TokenHash != hash {
+		sts.TokenHash = hash
+		sts.TokenGeneration++
+		updateCR = true
+	}
+
+	updateCR = r.setCondition(instance, metav1.Condition{
+		Type:    dynatracev1alpha1.TokensActiveConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonTokensActivated,
+		Message: fmt.Sprintf("Tokens of generation %d on %s are in use", sts.TokenGeneration, source),
+	}) || updateCR
+
+	return dtc, tkns, updateCR, nil
+}
+
+// TokensHash returns a hash identifying the tokens, to detect when these get rotated.
+func TokensHash(tkns Tokens) string {
+	h := sha256.New()
+	for _, key := range []string{DynatracePaasToken, DynatraceApiToken} {
+		h.Write([]byte(tkns[key]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// probed returns true if all tokens have been probed successfully on this reconciliation.
+func probed(tokens []*tokenConfig) bool {
+	for _, t := range tokens {
+		if t.Info == nil {
+			return false
 		}
+	}
+	return len(tokens) > 0
+}
 
-		if t.Key == DynatracePaasToken {
-			ci, err := dtc.GetConnectionInfo()
-			if err != nil {
-				setCondition(&sts.Conditions, metav1.Condition{
-					Type:    t.Type,
-					Status:  metav1.ConditionFalse,
-					Reason:  dynatracev1alpha1.ReasonTokenError,
-					Message: fmt.Sprintf("error when connection info with token on secret %s: %v", secretKey, err),
-				})
-				continue
+// expiryCondition returns the TokenExpiry condition for the probed tokens, warning about the ones expiring within the
+// given period.
+func expiryCondition(tokens []*tokenConfig, source string, now time.Time, warning time.Duration) metav1.Condition {
+	var expiring []string
+	for _, t := range tokens {
+		if exp := t.Info.Expires; !exp.IsZero() && exp.Before(now.Add(warning)) {
+			msg := fmt.Sprintf("%s expires on %s", t.Key, exp.Format(time.RFC3339))
+			if t.Info.Owner != "" {
+				msg += ", owned by " + t.Info.Owner
 			}
+			expiring = append(expiring, msg)
+		}
+	}
 
-			sts.EnvironmentID = ci.TenantUUID
+	if len(expiring) > 0 {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.TokenExpiryConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonTokenExpiring,
+			Message: fmt.Sprintf("Tokens on %s expiring soon: %s", source, strings.Join(expiring, "; ")),
 		}
+	}
 
-		setCondition(&sts.Conditions, metav1.Condition{
+	return metav1.Condition{
+		Type:    dynatracev1alpha1.TokenExpiryConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonTokensNotExpiring,
+		Message: fmt.Sprintf("No tokens on %s expire within %d days", source, int(warning.Hours()/24)),
+	}
+}
+
+// optionalScopesCondition returns the OptionalScopes condition for the probed tokens, listing the missing optional
+// scopes and the features disabled. Returns false if none of the tokens have optional scopes.
+func optionalScopesCondition(tokens []*tokenConfig, source string) (metav1.Condition, bool) {
+	var missing []string
+	found := false
+	for _, t := range tokens {
+		for _, o := range t.Optional {
+			found = true
+			if !t.Info.Scopes.Contains(o.Scope) {
+				missing = append(missing, fmt.Sprintf("%s on %s (%s)", o.Scope, t.Key, o.Feature))
+			}
+		}
+	}
+
+	if !found {
+		return metav1.Condition{}, false
+	}
+
+	if len(missing) > 0 {
+		return metav1.Condition{
+			Type:    dynatracev1alpha1.OptionalScopesConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonOptionalScopesMissing,
+			Message: fmt.Sprintf("Tokens on %s missing optional scopes, disabling features: %s", source, strings.Join(missing, ", ")),
+		}, true
+	}
+
+	return metav1.Condition{
+		Type:    dynatracev1alpha1.OptionalScopesConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonOptionalScopesGranted,
+		Message: fmt.Sprintf("Tokens on %s have all optional scopes", source),
+	}, true
+}
+
+// expiryWarning returns the time before the expiration of a token from which on it's reported.
+func (r *DynatraceClientReconciler) expiryWarning() time.Duration {
+	if r.ExpiryWarning > 0 {
+		return r.ExpiryWarning
+	}
+
+	days := defaultTokenExpiryWarningDays
+	if val := os.Getenv(tokenExpiryWarningEnvVar); val != "" {
+		if x, err := strconv.Atoi(val); err == nil && x >= 0 {
+			days = x
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// probeToken queries the Dynatrace API to verify the token, and returns the resulting condition. The environment ID
+// is set on the status when probing the PaaS token.
+func probeToken(ctx context.Context, dtc dtclient.Client, t *tokenConfig, source string, sts *dynatracev1alpha1.BaseOneAgentStatus) metav1.Condition {
+	info, err := dtc.GetTokenInfo(ctx, t.Value)
+
+	var serr dtclient.ServerError
+	if ok := errors.As(err, &serr); ok && serr.Code == http.StatusUnauthorized {
+		return metav1.Condition{
 			Type:    t.Type,
-			Status:  metav1.ConditionTrue,
-			Reason:  dynatracev1alpha1.ReasonTokenReady,
-			Message: "Ready",
-		})
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonTokenUnauthorized,
+			Message: fmt.Sprintf("Token on %s unauthorized", source),
+		}
+	}
+
+	if err != nil {
+		return metav1.Condition{
+			Type:    t.Type,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonTokenError,
+			Message: fmt.Sprintf("error when querying token on %s: %v", source, err),
+		}
+	}
+
+	if !info.Scopes.Contains(t.Scope) {
+		return metav1.Condition{
+			Type:    t.Type,
+			Status:  metav1.ConditionFalse,
+			Reason:  dynatracev1alpha1.ReasonTokenScopeMissing,
+			Message: fmt.Sprintf("Token on %s missing scope %s", source, t.Scope),
+		}
+	}
+
+	if t.Key == DynatracePaasToken {
+		ci, err := dtc.GetConnectionInfo(ctx)
+		if err != nil {
+			return metav1.Condition{
+				Type:    t.Type,
+				Status:  metav1.ConditionFalse,
+				Reason:  dynatracev1alpha1.ReasonTokenError,
+				Message: fmt.Sprintf("error when connection info with token on %s: %v", source, err),
+			}
+		}
+
+		sts.EnvironmentID = ci.TenantUUID
+	}
+
+	t.Info = &info
+
+	return metav1.Condition{
+		Type:    t.Type,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonTokenReady,
+		Message: "Ready",
 	}
+}
 
-	return dtc, updateCR, nil
+// setCondition sets the token condition on the instance status, and records an event for it if it has changed.
+func (r *DynatraceClientReconciler) setCondition(instance dynatracev1alpha1.BaseOneAgent, condition metav1.Condition) bool {
+	if !SetCondition(&instance.GetStatus().Conditions, condition) {
+		return false
+	}
+
+	if obj, ok := instance.(runtime.Object); ok && r.Recorder != nil {
+		eventType := corev1.EventTypeNormal
+		if condition.Status != metav1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Event(obj, eventType, condition.Reason, condition.Message)
+	}
+	return true
 }
 
-func setCondition(conditions *[]metav1.Condition, condition metav1.Condition) bool {
+// SetCondition adds or updates the condition on the list, returns true if it has changed.
+func SetCondition(conditions *[]metav1.Condition, condition metav1.Condition) bool {
 	c := meta.FindStatusCondition(*conditions, condition.Type)
 	if c != nil && c.Reason == condition.Reason && c.Message == condition.Message && c.Status == condition.Status {
 		return false
@@ -219,3 +443,13 @@ func setCondition(conditions *[]metav1.Condition, condition metav1.Condition) bo
 	meta.SetStatusCondition(conditions, condition)
 	return true
 }
+
+// RemoveCondition removes the condition of the given type, returning true if it was set.
+func RemoveCondition(conditions *[]metav1.Condition, conditionType string) bool {
+	if meta.FindStatusCondition(*conditions, conditionType) == nil {
+		return false
+	}
+
+	meta.RemoveStatusCondition(conditions, conditionType)
+	return true
+}
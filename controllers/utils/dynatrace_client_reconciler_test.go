@@ -8,6 +8,8 @@ import (
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/dtclient"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -15,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -44,7 +47,7 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Now:                 metav1.Now(),
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Nil(t, dtc)
 		assert.True(t, ucr)
 		assert.Error(t, err)
@@ -73,7 +76,7 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Now:                 metav1.Now(),
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Nil(t, dtc)
 		assert.True(t, ucr)
 		assert.Error(t, err)
@@ -94,8 +97,8 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Build()
 
 		dtcMock := &dtclient.MockDynatraceClient{}
-		dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes(nil), dtclient.ServerError{Code: 401, Message: "Token Authentication failed"})
-		dtcMock.On("GetTokenScopes", "84").Return(dtclient.TokenScopes(nil), fmt.Errorf("random error"))
+		dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{}, dtclient.ServerError{Code: 401, Message: "Token Authentication failed"})
+		dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{}, fmt.Errorf("random error"))
 
 		rec := &DynatraceClientReconciler{
 			Client:              c,
@@ -105,7 +108,7 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Now:                 metav1.Now(),
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Equal(t, dtcMock, dtc)
 		assert.True(t, ucr)
 		assert.NoError(t, err)
@@ -126,7 +129,7 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Build()
 
 		dtcMock := &dtclient.MockDynatraceClient{}
-		dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeDataExport}, nil)
+		dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
 
 		rec := &DynatraceClientReconciler{
 			Client:              c,
@@ -136,7 +139,7 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Now:                 metav1.Now(),
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Equal(t, dtcMock, dtc)
 		assert.True(t, ucr)
 		assert.NoError(t, err)
@@ -157,20 +160,27 @@ func TestReconcileDynatraceClient_TokenValidation(t *testing.T) {
 			Build()
 
 		dtcMock := &dtclient.MockDynatraceClient{}
-		dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}, nil)
-		dtcMock.On("GetTokenScopes", "84").Return(dtclient.TokenScopes{dtclient.TokenScopeDataExport}, nil)
+		dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+		dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
 		dtcMock.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
 
+		// The tokens are read once, and passed on to the client.
+		var built Tokens
 		rec := &DynatraceClientReconciler{
-			Client:              c,
-			DynatraceClientFunc: StaticDynatraceClient(dtcMock),
-			UpdatePaaSToken:     true,
-			UpdateAPIToken:      true,
-			Now:                 metav1.Now(),
+			Client: c,
+			DynatraceClientFunc: func(_ context.Context, _ client.Client, _ dynatracev1alpha1.BaseOneAgent, tkns Tokens, _, _ bool) (dtclient.Client, error) {
+				built = tkns
+				return dtcMock, nil
+			},
+			UpdatePaaSToken: true,
+			UpdateAPIToken:  true,
+			Now:             metav1.Now(),
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, tkns, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Equal(t, dtcMock, dtc)
+		assert.Equal(t, Tokens{DynatracePaasToken: "42", DynatraceApiToken: "84"}, tkns)
+		assert.Equal(t, tkns, built)
 		assert.True(t, ucr)
 		assert.NoError(t, err)
 
@@ -231,7 +241,7 @@ func TestReconcileDynatraceClient_MigrateConditions(t *testing.T) {
 		Now:                 now,
 	}
 
-	dtc, ucr, err := rec.Reconcile(context.TODO(), &oa)
+	dtc, _, ucr, err := rec.Reconcile(context.TODO(), &oa)
 	assert.Equal(t, dtcMock, dtc)
 	assert.True(t, ucr)
 	assert.NoError(t, err)
@@ -269,10 +279,20 @@ func TestReconcileDynatraceClient_ProbeRequests(t *testing.T) {
 		Reason:  dynatracev1alpha1.ReasonTokenReady,
 		Message: "Ready",
 	})
+	meta.SetStatusCondition(&base.Status.Conditions, metav1.Condition{
+		Type:    dynatracev1alpha1.TokensActiveConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  dynatracev1alpha1.ReasonTokensActivated,
+		Message: "Tokens of generation 1 on secret dynatrace:oneagent are in use",
+	})
+
+	secret := NewSecret(oaName, namespace, map[string]string{DynatracePaasToken: "42", DynatraceApiToken: "84"})
+	base.Status.TokenGeneration = 1
+	base.Status.TokenHash = TokensHash(Tokens{DynatracePaasToken: "42", DynatraceApiToken: "84"})
 
 	c := fake.NewClientBuilder().
 		WithScheme(scheme.Scheme).
-		WithObjects(NewSecret(oaName, namespace, map[string]string{DynatracePaasToken: "42", DynatraceApiToken: "84"})).
+		WithObjects(secret).
 		Build()
 
 	t.Run("No request if last probe was recent", func(t *testing.T) {
@@ -293,7 +313,7 @@ func TestReconcileDynatraceClient_ProbeRequests(t *testing.T) {
 			Now:                 now,
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Equal(t, dtcMock, dtc)
 		assert.False(t, ucr)
 		assert.NoError(t, err)
@@ -315,8 +335,8 @@ func TestReconcileDynatraceClient_ProbeRequests(t *testing.T) {
 		oa.Status.LastPaaSTokenProbeTimestamp = &lastPaaSProbe
 
 		dtcMock := &dtclient.MockDynatraceClient{}
-		dtcMock.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}, nil)
-		dtcMock.On("GetTokenScopes", "84").Return(dtclient.TokenScopes{dtclient.TokenScopeDataExport}, nil)
+		dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+		dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
 		dtcMock.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
 
 		rec := &DynatraceClientReconciler{
@@ -327,7 +347,7 @@ func TestReconcileDynatraceClient_ProbeRequests(t *testing.T) {
 			Now:                 now,
 		}
 
-		dtc, ucr, err := rec.Reconcile(context.TODO(), oa)
+		dtc, _, ucr, err := rec.Reconcile(context.TODO(), oa)
 		assert.Equal(t, dtcMock, dtc)
 		assert.True(t, ucr)
 		assert.NoError(t, err)
@@ -362,3 +382,130 @@ func NewSecret(name, namespace string, kv map[string]string) *corev1.Secret {
 	}
 	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Data: data}
 }
+
+func TestReconcileDynatraceClient_TokenRotation(t *testing.T) {
+	now := metav1.Now()
+	oa := &dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+			},
+		},
+	}
+
+	secret := NewSecret("oneagent", "dynatrace", map[string]string{DynatracePaasToken: "42", DynatraceApiToken: "84"})
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+
+	dtcMock := &dtclient.MockDynatraceClient{}
+	dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+	dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
+	dtcMock.On("GetTokenInfo", "43").Return(dtclient.TokenInfo{}, dtclient.ServerError{Code: 401, Message: "Token Authentication failed"})
+	dtcMock.On("GetTokenInfo", "44").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+	dtcMock.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
+
+	rec := &DynatraceClientReconciler{
+		Client:              c,
+		DynatraceClientFunc: StaticDynatraceClient(dtcMock),
+		UpdatePaaSToken:     true,
+		UpdateAPIToken:      true,
+		Now:                 now,
+	}
+
+	assertActive := func(status metav1.ConditionStatus, message string) {
+		cond := meta.FindStatusCondition(oa.Status.Conditions, dynatracev1alpha1.TokensActiveConditionType)
+		if assert.NotNil(t, cond) {
+			assert.Equal(t, status, cond.Status)
+			assert.Equal(t, message, cond.Message)
+		}
+	}
+
+	rotate := func(paasToken string) {
+		secret.Data[DynatracePaasToken] = []byte(paasToken)
+		require.NoError(t, c.Update(context.TODO(), secret))
+	}
+
+	// The tokens found initially are activated as they are.
+	_, _, _, err := rec.Reconcile(context.TODO(), oa)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), oa.Status.TokenGeneration)
+	assertActive(metav1.ConditionTrue, "Tokens of generation 1 on secret dynatrace:oneagent are in use")
+
+	// Rotated tokens are probed right away, even if the last probe was recent.
+	rotate("43")
+	_, _, upd, err := rec.Reconcile(context.TODO(), oa)
+	assert.EqualError(t, err, "new tokens on secret dynatrace:oneagent rejected")
+	assert.True(t, upd)
+	assert.Equal(t, int64(1), oa.Status.TokenGeneration)
+	assertActive(metav1.ConditionFalse, "New tokens on secret dynatrace:oneagent rejected, keeping generation 1: Token on secret dynatrace:oneagent unauthorized")
+
+	rotate("44")
+	_, _, _, err = rec.Reconcile(context.TODO(), oa)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), oa.Status.TokenGeneration)
+	assert.Equal(t, TokensHash(Tokens{DynatracePaasToken: "44", DynatraceApiToken: "84"}), oa.Status.TokenHash)
+	assertActive(metav1.ConditionTrue, "Tokens of generation 2 on secret dynatrace:oneagent are in use")
+
+	mock.AssertExpectationsForObjects(t, dtcMock)
+}
+
+func TestReconcileDynatraceClient_TokenMetadata(t *testing.T) {
+	now := metav1.NewTime(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	oa := &dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
+				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(NewSecret("oneagent", "dynatrace", map[string]string{DynatracePaasToken: "42", DynatraceApiToken: "84"})).
+		Build()
+
+	dtcMock := &dtclient.MockDynatraceClient{}
+	dtcMock.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{
+		Owner:   "owner@example.com",
+		Expires: time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC),
+		Scopes:  dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload},
+	}, nil)
+	dtcMock.On("GetTokenInfo", "84").Return(dtclient.TokenInfo{
+		Expires: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Scopes:  dtclient.TokenScopes{dtclient.TokenScopeDataExport, dtclient.TokenScopeDataImport},
+	}, nil)
+	dtcMock.On("GetConnectionInfo").Return(dtclient.ConnectionInfo{TenantUUID: "abc123456"}, nil)
+
+	rec := &DynatraceClientReconciler{
+		Client:              c,
+		DynatraceClientFunc: StaticDynatraceClient(dtcMock),
+		UpdatePaaSToken:     true,
+		UpdateAPIToken:      true,
+		Now:                 now,
+	}
+
+	_, _, _, err := rec.Reconcile(context.TODO(), oa)
+	require.NoError(t, err)
+
+	AssertCondition(t, oa, dynatracev1alpha1.TokenExpiryConditionType, false, dynatracev1alpha1.ReasonTokenExpiring,
+		"Tokens on secret dynatrace:oneagent expiring soon: paasToken expires on 2021-06-10T00:00:00Z, owned by owner@example.com")
+	AssertCondition(t, oa, dynatracev1alpha1.OptionalScopesConditionType, false, dynatracev1alpha1.ReasonOptionalScopesMissing,
+		"Tokens on secret dynatrace:oneagent missing optional scopes, disabling features: "+
+			"entities.read on apiToken (host entity lookups with the Environment API v2)")
+	assert.Equal(t, float64(time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC).Unix()),
+		testutil.ToFloat64(metrics.TokenExpiry.WithLabelValues("dynatrace", "oneagent", DynatracePaasToken)))
+
+	// With a shorter warning period, the token isn't reported yet.
+	oa.Status.LastPaaSTokenProbeTimestamp = nil
+	oa.Status.LastAPITokenProbeTimestamp = nil
+	rec.ExpiryWarning = 7 * 24 * time.Hour
+
+	_, _, _, err = rec.Reconcile(context.TODO(), oa)
+	require.NoError(t, err)
+
+	AssertCondition(t, oa, dynatracev1alpha1.TokenExpiryConditionType, true, dynatracev1alpha1.ReasonTokensNotExpiring,
+		"No tokens on secret dynatrace:oneagent expire within 7 days")
+
+	mock.AssertExpectationsForObjects(t, dtcMock)
+}
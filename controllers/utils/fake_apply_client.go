@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FakeApplyClient wraps a client not supporting server-side apply, like the fake client of controller-runtime, to
+// emulate apply patches for tests. Objects are created if not found, and otherwise merge patched with the applied
+// configuration, without the status. Unlike on the API server, fields removed from the configuration are kept.
+type FakeApplyClient struct {
+	client.Client
+}
+
+func (c FakeApplyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	delete(cfg, "status")
+	if data, err = json.Marshal(cfg); err != nil {
+		return err
+	}
+
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing); k8serrors.IsNotFound(err) {
+		return c.Client.Create(ctx, obj)
+	} else if err != nil {
+		return err
+	}
+
+	return c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
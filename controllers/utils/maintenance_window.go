@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+)
+
+// cronField defines the allowed range for each of the fields of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// CronSchedule is a parsed cron expression with the standard five fields: minute, hour, day of month, month, and day
+// of week. Each field supports '*', single values, ranges ('1-5'), steps ('*/15', '0-30/10') and lists ('1,15').
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	location                      *time.Location
+}
+
+// ParseCronSchedule parses the cron expression in spec, to be evaluated on the given location.
+func ParseCronSchedule(spec string, loc *time.Location) (*CronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields on cron expression '%s', got %d", len(cronFields), spec, len(fields))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// Both 0 and 7 represent Sunday.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return &CronSchedule{
+		minute:   bits[0],
+		hour:     bits[1],
+		dom:      bits[2],
+		month:    bits[3],
+		dow:      bits[4],
+		domStar:  fields[2] == "*",
+		dowStar:  fields[4] == "*",
+		location: loc,
+	}, nil
+}
+
+func parseCronField(field string, def cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step '%s' for %s", part[i+1:], def.name)
+			}
+			rng, step = part[:i], s
+		}
+
+		lo, hi := def.min, def.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value '%s' for %s", bounds[0], def.name)
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value '%s' for %s", bounds[1], def.name)
+				}
+			} else if step > 1 {
+				hi = def.max
+			}
+		}
+
+		if lo < def.min || hi > def.max || lo > hi {
+			return 0, fmt.Errorf("value '%s' out of range [%d-%d] for %s", rng, def.min, def.max, def.name)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func hasBit(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := hasBit(s.dom, t.Day()), hasBit(s.dow, int(t.Weekday()))
+
+	// As on cron, if both fields are restricted, the day matches if any of them does.
+	if !s.domStar && !s.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next returns the earliest time at or after t matching the schedule, or a zero time if none can be found within the
+// next five years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	if t.Second() != 0 || t.Nanosecond() != 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+	}
+
+	// Moves t forward to next, or by a single minute if next isn't after t (e.g., on DST transitions.)
+	advance := func(next time.Time) time.Time {
+		if !next.After(t) {
+			return t.Truncate(time.Minute).Add(time.Minute)
+		}
+		return next
+	}
+
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		if !hasBit(s.month, int(t.Month())) {
+			t = advance(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location))
+		} else if !s.dayMatches(t) {
+			t = advance(time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location))
+		} else if !hasBit(s.hour, t.Hour()) {
+			t = advance(time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location))
+		} else if !hasBit(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// MaintenanceWindow is a parsed dynatracev1alpha1.MaintenanceWindow.
+type MaintenanceWindow struct {
+	schedule *CronSchedule
+	duration time.Duration
+}
+
+// ParseMaintenanceWindow parses and validates the maintenance window.
+func ParseMaintenanceWindow(mw dynatracev1alpha1.MaintenanceWindow) (*MaintenanceWindow, error) {
+	loc := time.UTC
+	if mw.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(mw.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone '%s': %w", mw.TimeZone, err)
+		}
+	}
+
+	schedule, err := ParseCronSchedule(mw.Schedule, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if mw.Duration.Duration <= 0 {
+		return nil, fmt.Errorf("duration for maintenance window '%s' must be positive", mw.Schedule)
+	}
+
+	return &MaintenanceWindow{schedule: schedule, duration: mw.Duration.Duration}, nil
+}
+
+// IsOpen returns true if now is within the maintenance window. Otherwise, it returns the time when the window opens
+// next.
+func (w *MaintenanceWindow) IsOpen(now time.Time) (bool, time.Time) {
+	// The latest window that may still be open started at most a duration ago.
+	start := w.schedule.Next(now.Add(-w.duration).Add(time.Nanosecond))
+	if !start.IsZero() && !start.After(now) {
+		return true, time.Time{}
+	}
+	return false, start
+}
+
+// IsInMaintenanceWindow returns true if no maintenance windows are configured, or if now is within any of them.
+// Otherwise, returns the earliest time when any of the windows opens.
+func IsInMaintenanceWindow(windows []dynatracev1alpha1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	if len(windows) == 0 {
+		return true, time.Time{}, nil
+	}
+
+	var next time.Time
+	for _, mw := range windows {
+		w, err := ParseMaintenanceWindow(mw)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+
+		open, n := w.IsOpen(now)
+		if open {
+			return true, time.Time{}, nil
+		}
+
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+
+	return false, next, nil
+}
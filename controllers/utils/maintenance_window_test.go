@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "0 2 * * 6", "*/15 0-6 1,15 * 1-5", "30 22 * 1-12/3 7", "5/20 * * * *"} {
+		_, err := ParseCronSchedule(spec, nil)
+		assert.NoError(t, err, spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := ParseCronSchedule(spec, nil)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	// Wednesday
+	now := time.Date(2021, 3, 17, 10, 20, 30, 0, time.UTC)
+
+	next := func(spec string, loc *time.Location) time.Time {
+		s, err := ParseCronSchedule(spec, loc)
+		require.NoError(t, err)
+		return s.Next(now)
+	}
+
+	assert.Equal(t, time.Date(2021, 3, 17, 10, 21, 0, 0, time.UTC), next("* * * * *", nil).UTC())
+	assert.Equal(t, time.Date(2021, 3, 17, 10, 30, 0, 0, time.UTC), next("*/15 * * * *", nil).UTC())
+	assert.Equal(t, time.Date(2021, 3, 20, 2, 0, 0, 0, time.UTC), next("0 2 * * 6", nil).UTC())
+	assert.Equal(t, time.Date(2021, 3, 21, 2, 0, 0, 0, time.UTC), next("0 2 * * 0", nil).UTC())
+	assert.Equal(t, time.Date(2021, 3, 21, 2, 0, 0, 0, time.UTC), next("0 2 * * 7", nil).UTC())
+	assert.Equal(t, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), next("0 0 1 * *", nil).UTC())
+	assert.Equal(t, time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), next("0 0 1 2 *", nil).UTC())
+
+	// Either the day of month or the day of week need to match if both are set.
+	assert.Equal(t, time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC), next("0 0 1 * 4", nil).UTC())
+
+	vienna, err := time.LoadLocation("Europe/Vienna")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 3, 18, 1, 0, 0, 0, time.UTC), next("0 2 * * *", vienna).UTC())
+
+	// Vienna switches to DST on 2021-03-28 02:00, so the window starts at 01:00 UTC before, and 00:00 UTC after.
+	s, err := ParseCronSchedule("0 2 * * 0", vienna)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 4, 4, 0, 0, 0, 0, time.UTC), s.Next(time.Date(2021, 3, 28, 0, 0, 0, 0, time.UTC)).UTC())
+
+	// February 30th never happens.
+	assert.True(t, next("0 0 30 2 *", nil).IsZero())
+}
+
+func TestIsInMaintenanceWindow(t *testing.T) {
+	// Saturday
+	now := time.Date(2021, 3, 20, 3, 30, 0, 0, time.UTC)
+
+	t.Run("no windows", func(t *testing.T) {
+		open, _, err := IsInMaintenanceWindow(nil, now)
+		assert.NoError(t, err)
+		assert.True(t, open)
+	})
+
+	t.Run("open", func(t *testing.T) {
+		open, _, err := IsInMaintenanceWindow([]dynatracev1alpha1.MaintenanceWindow{
+			{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+		}, now)
+		assert.NoError(t, err)
+		assert.True(t, open)
+	})
+
+	t.Run("closed, returns earliest", func(t *testing.T) {
+		open, next, err := IsInMaintenanceWindow([]dynatracev1alpha1.MaintenanceWindow{
+			{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: time.Hour}},
+			{Schedule: "0 21 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "America/New_York"},
+		}, now)
+		assert.NoError(t, err)
+		assert.False(t, open)
+		assert.Equal(t, time.Date(2021, 3, 21, 1, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := IsInMaintenanceWindow([]dynatracev1alpha1.MaintenanceWindow{
+			{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Olympus"},
+		}, now)
+		assert.Error(t, err)
+
+		_, _, err = IsInMaintenanceWindow([]dynatracev1alpha1.MaintenanceWindow{{Schedule: "0 2 * * 6"}}, now)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// tokensDirEnvVar overrides the directory the paths of file token sources are relative to.
+	tokensDirEnvVar  = "ONEAGENT_OPERATOR_TOKENS_DIR"
+	defaultTokensDir = "/var/run/dynatrace/tokens"
+
+	httpTokenSourceTimeout = 30 * time.Second
+	vaultTokenHeader       = "X-Vault-Token"
+)
+
+// Tokens holds the API and PaaS tokens by key, i.e., DynatraceApiToken and DynatracePaasToken.
+type Tokens map[string]string
+
+// extract returns the token with the given key, without surrounding spaces.
+func (t Tokens) extract(key string) (string, error) {
+	value, ok := t[key]
+	if !ok {
+		return "", fmt.Errorf("missing token %s", key)
+	}
+
+	return strings.TrimSpace(value), nil
+}
+
+// TokenSource provides the tokens of a OneAgent or OneAgentAPM.
+type TokenSource interface {
+	// Tokens returns the current tokens. If these don't exist, the error returned satisfies IsTokensNotFound.
+	Tokens(ctx context.Context) (Tokens, error)
+
+	// String describes where the tokens are read from for messages, e.g., "secret dynatrace:oneagent".
+	String() string
+}
+
+// GetTokenSource returns the TokenSource configured on the instance: the secret given by its tokens field, unless a
+// tokenSource is set.
+func GetTokenSource(c client.Client, instance dynatracev1alpha1.BaseOneAgent) TokenSource {
+	if ts := instance.GetSpec().TokenSource; ts != nil {
+		if ts.File != nil {
+			return NewFileTokenSource(tokensDir(), ts.File.Path)
+		}
+		if ts.HTTP != nil {
+			return &httpTokenSource{client: c, namespace: instance.GetNamespace(), spec: *ts.HTTP}
+		}
+	}
+
+	return &secretTokenSource{client: c, key: client.ObjectKey{Name: GetTokensName(instance), Namespace: instance.GetNamespace()}}
+}
+
+// UsesTokensSecret returns true if the tokens of the instance are read from a Kubernetes secret, which can then be
+// referenced by the DaemonSets.
+func UsesTokensSecret(instance dynatracev1alpha1.BaseOneAgent) bool {
+	ts := instance.GetSpec().TokenSource
+	return ts == nil || (ts.File == nil && ts.HTTP == nil)
+}
+
+// tokensNotFoundError is returned by TokenSources when the tokens don't exist.
+type tokensNotFoundError struct {
+	message string
+}
+
+func (e tokensNotFoundError) Error() string {
+	return e.message
+}
+
+// IsTokensNotFound returns true if err has been returned by a TokenSource because the tokens don't exist.
+func IsTokensNotFound(err error) bool {
+	var nf tokensNotFoundError
+	return errors.As(err, &nf)
+}
+
+// secretTokenSource reads the tokens from a Kubernetes secret.
+type secretTokenSource struct {
+	client client.Reader
+	key    client.ObjectKey
+}
+
+func (s *secretTokenSource) Tokens(ctx context.Context) (Tokens, error) {
+	var secret corev1.Secret
+	if err := s.client.Get(ctx, s.key, &secret); k8serrors.IsNotFound(err) {
+		return nil, tokensNotFoundError{fmt.Sprintf("Secret '%s:%s' not found", s.key.Namespace, s.key.Name)}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+
+	tkns := Tokens{}
+	for _, key := range []string{DynatraceApiToken, DynatracePaasToken} {
+		if v, ok := secret.Data[key]; ok {
+			tkns[key] = string(v)
+		}
+	}
+	return tkns, nil
+}
+
+func (s *secretTokenSource) String() string {
+	return fmt.Sprintf("secret %s:%s", s.key.Namespace, s.key.Name)
+}
+
+// fileTokenSource reads the tokens from the apiToken and paasToken files on a directory.
+type fileTokenSource struct {
+	dir string
+}
+
+// NewFileTokenSource creates a TokenSource reading the tokens from the directory at path within baseDir. The path
+// can't refer to directories outside of baseDir.
+func NewFileTokenSource(baseDir, path string) TokenSource {
+	return &fileTokenSource{dir: filepath.Join(baseDir, filepath.Clean("/"+path))}
+}
+
+func (s *fileTokenSource) Tokens(context.Context) (Tokens, error) {
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		return nil, tokensNotFoundError{fmt.Sprintf("Directory '%s' not found", s.dir)}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+
+	tkns := Tokens{}
+	for _, key := range []string{DynatraceApiToken, DynatracePaasToken} {
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, key))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read token %s: %w", key, err)
+		}
+		// Files written by secret drivers or editors commonly end with a newline.
+		tkns[key] = strings.TrimSpace(string(data))
+	}
+	return tkns, nil
+}
+
+func (s *fileTokenSource) String() string {
+	return "directory " + s.dir
+}
+
+// httpTokenSource reads the tokens from a secret on a Vault-compatible HTTP secret store. The secret is expected as
+// JSON object with the apiToken and paasToken fields, optionally wrapped in a data field, or two for a KV version 2
+// secret engine.
+type httpTokenSource struct {
+	client    client.Reader
+	namespace string
+	spec      dynatracev1alpha1.HTTPTokenSource
+}
+
+func (s *httpTokenSource) Tokens(ctx context.Context) (Tokens, error) {
+	httpClient, err := s.httpClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer httpClient.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.spec.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request to secret store: %w", err)
+	}
+
+	if s.spec.AuthSecretName != "" {
+		var auth corev1.Secret
+		if err := s.client.Get(ctx, client.ObjectKey{Name: s.spec.AuthSecretName, Namespace: s.namespace}, &auth); err != nil {
+			return nil, fmt.Errorf("failed to query secret store credentials: %w", err)
+		}
+		token, err := extractToken(&auth, "token")
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract secret store credentials: %w", err)
+		}
+		req.Header.Set(vaultTokenHeader, token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secret store: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, tokensNotFoundError{fmt.Sprintf("Secret '%s' not found", s.spec.URL)}
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secret store responded with status %d", resp.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to parse secret from secret store: %w", err)
+	}
+
+	// Unwrap the data fields of Vault responses.
+	for i := 0; i < 2; i++ {
+		data, ok := body["data"].(map[string]interface{})
+		if !ok {
+			break
+		}
+		body = data
+	}
+
+	tkns := Tokens{}
+	for _, key := range []string{DynatraceApiToken, DynatracePaasToken} {
+		if v, ok := body[key].(string); ok {
+			tkns[key] = v
+		}
+	}
+	return tkns, nil
+}
+
+func (s *httpTokenSource) httpClient(ctx context.Context) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if s.spec.TrustedCAs != "" {
+		var certs corev1.ConfigMap
+		if err := s.client.Get(ctx, client.ObjectKey{Name: s.spec.TrustedCAs, Namespace: s.namespace}, &certs); err != nil {
+			return nil, fmt.Errorf("failed to get secret store certificate configmap: %w", err)
+		}
+
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM([]byte(certs.Data["certs"])) {
+			return nil, errors.New("failed to extract secret store certificate configmap field: no certificates on field certs")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &http.Client{Transport: transport, Timeout: httpTokenSourceTimeout}, nil
+}
+
+func (s *httpTokenSource) String() string {
+	return "secret store " + s.spec.URL
+}
+
+// tokensDir returns the directory the paths of file token sources are relative to.
+func tokensDir() string {
+	if dir := os.Getenv(tokensDirEnvVar); dir != "" {
+		return dir
+	}
+	return defaultTokensDir
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSecretTokenSource(t *testing.T) {
+	oa := &dynatracev1alpha1.OneAgent{ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"}}
+	oa.Spec.Tokens = "tokens"
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	src := GetTokenSource(c, oa)
+	assert.Equal(t, "secret dynatrace:tokens", src.String())
+
+	_, err := src.Tokens(context.TODO())
+	assert.True(t, IsTokensNotFound(err))
+	assert.EqualError(t, err, "Secret 'dynatrace:tokens' not found")
+
+	require.NoError(t, c.Create(context.TODO(), NewSecret("tokens", "dynatrace", map[string]string{DynatracePaasToken: "42", "other": "x"})))
+	tkns, err := src.Tokens(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Tokens{DynatracePaasToken: "42"}, tkns)
+}
+
+func TestFileTokenSource(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "oneagent"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "oneagent", DynatracePaasToken), []byte("42\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "oneagent", DynatraceApiToken), []byte("84"), 0600))
+
+	tkns, err := NewFileTokenSource(dir, "oneagent").Tokens(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Tokens{DynatracePaasToken: "42", DynatraceApiToken: "84"}, tkns)
+
+	// Paths can't escape the base directory.
+	src := NewFileTokenSource(dir, "../../oneagent")
+	assert.Equal(t, "directory "+filepath.Join(dir, "oneagent"), src.String())
+
+	_, err = NewFileTokenSource(dir, "missing").Tokens(context.TODO())
+	assert.True(t, IsTokensNotFound(err))
+
+	require.NoError(t, os.Setenv(tokensDirEnvVar, dir))
+	defer os.Unsetenv(tokensDirEnvVar)
+
+	oa := &dynatracev1alpha1.OneAgent{ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"}}
+	oa.Spec.TokenSource = &dynatracev1alpha1.TokenSource{File: &dynatracev1alpha1.FileTokenSource{Path: "oneagent"}}
+	assert.False(t, UsesTokensSecret(oa))
+
+	tkns, err = GetTokenSource(nil, oa).Tokens(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "42", tkns[DynatracePaasToken])
+}
+
+func TestHTTPTokenSource(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s3cr3t" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/dynatrace":
+			_, _ = w.Write([]byte(`{"data":{"data":{"apiToken":"84","paasToken":"42"},"metadata":{"version":3}}}`))
+		case "/v1/kv/dynatrace":
+			_, _ = w.Write([]byte(`{"data":{"apiToken":"84"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	certs := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		NewSecret("vault", "dynatrace", map[string]string{"token": "s3cr3t"}),
+		NewSecret("other-vault", "dynatrace", map[string]string{"token": "invalid"}),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-ca", Namespace: "dynatrace"},
+			Data:       map[string]string{"certs": string(certs)},
+		},
+	).Build()
+
+	tokensAt := func(path, authSecret string) (Tokens, error) {
+		oa := &dynatracev1alpha1.OneAgentAPM{ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"}}
+		oa.Spec.TokenSource = &dynatracev1alpha1.TokenSource{HTTP: &dynatracev1alpha1.HTTPTokenSource{
+			URL: srv.URL + path, AuthSecretName: authSecret, TrustedCAs: "vault-ca",
+		}}
+		return GetTokenSource(c, oa).Tokens(context.TODO())
+	}
+
+	tkns, err := tokensAt("/v1/secret/data/dynatrace", "vault")
+	require.NoError(t, err)
+	assert.Equal(t, Tokens{DynatracePaasToken: "42", DynatraceApiToken: "84"}, tkns)
+
+	tkns, err = tokensAt("/v1/kv/dynatrace", "vault")
+	require.NoError(t, err)
+	assert.Equal(t, Tokens{DynatraceApiToken: "84"}, tkns)
+
+	_, err = tokensAt("/v1/secret/data/missing", "vault")
+	assert.True(t, IsTokensNotFound(err))
+
+	_, err = tokensAt("/v1/secret/data/dynatrace", "other-vault")
+	assert.EqualError(t, err, "secret store responded with status 403")
+
+	_, err = tokensAt("/v1/secret/data/dynatrace", "missing")
+	assert.Error(t, err)
+	assert.False(t, IsTokensNotFound(err))
+}
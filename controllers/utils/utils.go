@@ -25,74 +25,14 @@ const (
 	DynatraceApiToken  = "apiToken"
 )
 
-// DynatraceClientFunc defines handler func for dynatrace client
-type DynatraceClientFunc func(rtc client.Client, instance dynatracev1alpha1.BaseOneAgent, hasAPIToken, hasPaaSToken bool) (dtclient.Client, error)
-
-// BuildDynatraceClient creates a new Dynatrace client using the settings configured on the given instance.
-func BuildDynatraceClient(rtc client.Client, instance dynatracev1alpha1.BaseOneAgent, hasAPIToken, hasPaaSToken bool) (dtclient.Client, error) {
-	ns := instance.GetNamespace()
-	spec := instance.GetSpec()
-
-	secret := &corev1.Secret{}
-	err := rtc.Get(context.TODO(), client.ObjectKey{Name: GetTokensName(instance), Namespace: ns}, secret)
-	if err != nil && !k8serrors.IsNotFound(err) {
-		return nil, errors.WithStack(err)
-	}
-
-	// initialize dynatrace client
-	var opts []dtclient.Option
-	if spec.SkipCertCheck {
-		opts = append(opts, dtclient.SkipCertificateValidation(true))
-	}
-
-	if p := spec.Proxy; p != nil {
-		if p.ValueFrom != "" {
-			proxySecret := &corev1.Secret{}
-			err := rtc.Get(context.TODO(), client.ObjectKey{Name: p.ValueFrom, Namespace: ns}, proxySecret)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to get proxy secret")
-			}
-
-			proxyURL, err := extractToken(proxySecret, "proxy")
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to extract proxy secret field")
-			}
-			opts = append(opts, dtclient.Proxy(proxyURL))
-		} else if p.Value != "" {
-			opts = append(opts, dtclient.Proxy(p.Value))
-		}
-	}
-
-	if spec.TrustedCAs != "" {
-		certs := &corev1.ConfigMap{}
-		if err := rtc.Get(context.TODO(), client.ObjectKey{Namespace: ns, Name: spec.TrustedCAs}, certs); err != nil {
-			return nil, errors.Wrap(err, "failed to get certificate configmap")
-		}
-		if certs.Data["certs"] == "" {
-			return nil, errors.Errorf("failed to extract certificate configmap field: missing field certs")
-		}
-		opts = append(opts, dtclient.Certs([]byte(certs.Data["certs"])))
-	}
-
-	if spec.NetworkZone != "" {
-		opts = append(opts, dtclient.NetworkZone(spec.NetworkZone))
-	}
-
-	var apiToken string
-	if hasAPIToken {
-		if apiToken, err = extractToken(secret, DynatraceApiToken); err != nil {
-			return nil, errors.WithStack(err)
-		}
-	}
-
-	var paasToken string
-	if hasPaaSToken {
-		if paasToken, err = extractToken(secret, DynatracePaasToken); err != nil {
-			return nil, errors.WithStack(err)
-		}
-	}
-
-	return dtclient.NewClient(spec.APIURL, apiToken, paasToken, opts...)
+// DynatraceClientFunc defines handler func for dynatrace client. The tokens are the ones read from the token source of
+// the instance by the caller.
+type DynatraceClientFunc func(ctx context.Context, rtc client.Client, instance dynatracev1alpha1.BaseOneAgent, tkns Tokens, hasAPIToken, hasPaaSToken bool) (dtclient.Client, error)
+
+// BuildDynatraceClient returns a Dynatrace client using the settings configured on the given instance. Clients are
+// taken from a pool shared by all controllers, see DynatraceClientPool.
+func BuildDynatraceClient(ctx context.Context, rtc client.Client, instance dynatracev1alpha1.BaseOneAgent, tkns Tokens, hasAPIToken, hasPaaSToken bool) (dtclient.Client, error) {
+	return dynatraceClients.BuildDynatraceClient(ctx, rtc, instance, tkns, hasAPIToken, hasPaaSToken)
 }
 
 func extractToken(secret *corev1.Secret, key string) (string, error) {
@@ -107,7 +47,7 @@ func extractToken(secret *corev1.Secret, key string) (string, error) {
 
 // StaticDynatraceClient creates a DynatraceClientFunc always returning c.
 func StaticDynatraceClient(c dtclient.Client) DynatraceClientFunc {
-	return func(_ client.Client, oa dynatracev1alpha1.BaseOneAgent, _, _ bool) (dtclient.Client, error) {
+	return func(_ context.Context, _ client.Client, oa dynatracev1alpha1.BaseOneAgent, _ Tokens, _, _ bool) (dtclient.Client, error) {
 		return c, nil
 	}
 }
@@ -120,14 +60,14 @@ func GetTokensName(obj dynatracev1alpha1.BaseOneAgent) string {
 }
 
 // GetDeployment returns the Deployment object who is the owner of this pod.
-func GetDeployment(c client.Client, ns string) (*appsv1.Deployment, error) {
+func GetDeployment(ctx context.Context, c client.Client, ns string) (*appsv1.Deployment, error) {
 	var pod corev1.Pod
 	podName := os.Getenv("POD_NAME")
 	if podName == "" {
 		return nil, errors.New("POD_NAME environment variable does not exist")
 	}
 
-	err := c.Get(context.TODO(), client.ObjectKey{Name: podName, Namespace: ns}, &pod)
+	err := c.Get(ctx, client.ObjectKey{Name: podName, Namespace: ns}, &pod)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -140,7 +80,7 @@ func GetDeployment(c client.Client, ns string) (*appsv1.Deployment, error) {
 	}
 
 	var rs appsv1.ReplicaSet
-	if err := c.Get(context.TODO(), client.ObjectKey{Name: rsOwner.Name, Namespace: ns}, &rs); err != nil {
+	if err := c.Get(ctx, client.ObjectKey{Name: rsOwner.Name, Namespace: ns}, &rs); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
@@ -152,48 +92,51 @@ func GetDeployment(c client.Client, ns string) (*appsv1.Deployment, error) {
 	}
 
 	var d appsv1.Deployment
-	if err := c.Get(context.TODO(), client.ObjectKey{Name: dOwner.Name, Namespace: ns}, &d); err != nil {
+	if err := c.Get(ctx, client.ObjectKey{Name: dOwner.Name, Namespace: ns}, &d); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	return &d, nil
 }
 
-// CreateOrUpdateSecretIfNotExists creates a secret in case it does not exist or updates it if there are changes
-func CreateOrUpdateSecretIfNotExists(c client.Client, r client.Reader, secretName string, targetNS string, data map[string][]byte, secretType corev1.SecretType, log logr.Logger) error {
+// CreateOrUpdateSecretIfNotExists creates a secret in case it does not exist or updates it if there are changes.
+// Returns true if the secret was created or updated.
+func CreateOrUpdateSecretIfNotExists(ctx context.Context, c client.Client, r client.Reader, secretName string, targetNS string, data map[string][]byte, secretType corev1.SecretType, log logr.Logger) (bool, error) {
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: targetNS,
+		},
+		Type: secretType,
+		Data: data,
+	}
+
 	var cfg corev1.Secret
-	err := r.Get(context.TODO(), client.ObjectKey{Name: secretName, Namespace: targetNS}, &cfg)
+	err := r.Get(ctx, client.ObjectKey{Name: secretName, Namespace: targetNS}, &cfg)
 	if k8serrors.IsNotFound(err) {
 		log.Info("Creating OneAgent config secret")
-		if err := c.Create(context.TODO(), &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      secretName,
-				Namespace: targetNS,
-			},
-			Type: secretType,
-			Data: data,
-		}); err != nil {
-			return errors.Wrapf(err, "failed to create secret %s", secretName)
+		if err := Apply(ctx, c, &secret, OperatorFieldManager, log); err != nil {
+			return false, errors.Wrapf(err, "failed to create secret %s", secretName)
 		}
-		return nil
+		return true, nil
 	}
 
 	if err != nil {
-		return errors.Wrapf(err, "failed to query for secret %s", secretName)
+		return false, errors.Wrapf(err, "failed to query for secret %s", secretName)
 	}
 
 	if !reflect.DeepEqual(data, cfg.Data) {
 		log.Info(fmt.Sprintf("Updating secret %s", secretName))
-		cfg.Data = data
-		if err := c.Update(context.TODO(), &cfg); err != nil {
-			return errors.Wrapf(err, "failed to update secret %s", secretName)
+		if err := Apply(ctx, c, &secret, OperatorFieldManager, log); err != nil {
+			return false, errors.Wrapf(err, "failed to update secret %s", secretName)
 		}
+		return true, nil
 	}
 
-	return nil
+	return false, nil
 }
 
 // GeneratePullSecretData generates the secret data for the PullSecret
-func GeneratePullSecretData(c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns *corev1.Secret) (map[string][]byte, error) {
+func GeneratePullSecretData(ctx context.Context, c client.Client, oa dynatracev1alpha1.BaseOneAgent, tkns Tokens) (map[string][]byte, error) {
 	type auths struct {
 		Username string
 		Password string
@@ -204,12 +147,12 @@ func GeneratePullSecretData(c client.Client, oa dynatracev1alpha1.BaseOneAgent,
 		Auths map[string]auths
 	}
 
-	dtc, err := BuildDynatraceClient(c, oa, false, true)
+	dtc, err := BuildDynatraceClient(ctx, c, oa, tkns, false, true)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	ci, err := dtc.GetConnectionInfo()
+	ci, err := dtc.GetConnectionInfo(ctx)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -219,12 +162,12 @@ func GeneratePullSecretData(c client.Client, oa dynatracev1alpha1.BaseOneAgent,
 		return nil, errors.WithStack(err)
 	}
 
-	a := fmt.Sprintf("%s:%s", ci.TenantUUID, string(tkns.Data[DynatracePaasToken]))
+	a := fmt.Sprintf("%s:%s", ci.TenantUUID, tkns[DynatracePaasToken])
 	a = b64.StdEncoding.EncodeToString([]byte(a))
 
 	auth := auths{
 		Username: ci.TenantUUID,
-		Password: string(tkns.Data[DynatracePaasToken]),
+		Password: tkns[DynatracePaasToken],
 		Auth:     a,
 	}
 
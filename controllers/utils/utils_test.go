@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -53,10 +54,8 @@ func TestExtractToken(t *testing.T) {
 }
 
 func TestBuildDynatraceClient(t *testing.T) {
-	namespace := "dynatrace"
-
 	oa := &dynatracev1alpha1.OneAgent{
-		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: namespace},
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
 		Spec: dynatracev1alpha1.OneAgentSpec{
 			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{
 				APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api",
@@ -64,41 +63,24 @@ func TestBuildDynatraceClient(t *testing.T) {
 			},
 		},
 	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
 
 	{
-		fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
-			&corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{Name: "custom-token", Namespace: namespace},
-				Type:       corev1.SecretTypeOpaque,
-				Data: map[string][]byte{
-					"paasToken": []byte("42"),
-					"apiToken":  []byte("43"),
-				},
-			},
-		).Build()
-
-		_, err := BuildDynatraceClient(fakeClient, oa, true, true)
+		_, err := BuildDynatraceClient(context.TODO(), fakeClient, oa, Tokens{"paasToken": "42", "apiToken": "43"}, true, true)
 		assert.NoError(t, err)
 	}
 
 	{
-		fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
-		_, err := BuildDynatraceClient(fakeClient, oa, true, true)
+		_, err := BuildDynatraceClient(context.TODO(), fakeClient, oa, Tokens{}, true, true)
 		assert.Error(t, err)
 	}
 
 	{
-		fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
-			&corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{Name: "custom-token", Namespace: namespace},
-				Type:       corev1.SecretTypeOpaque,
-				Data: map[string][]byte{
-					"paasToken": []byte("42"),
-				},
-			},
-		).Build()
-		_, err := BuildDynatraceClient(fakeClient, oa, true, true)
+		_, err := BuildDynatraceClient(context.TODO(), fakeClient, oa, Tokens{"paasToken": "42"}, true, true)
 		assert.Error(t, err)
+
+		_, err = BuildDynatraceClient(context.TODO(), fakeClient, oa, Tokens{"paasToken": "42"}, false, true)
+		assert.NoError(t, err)
 	}
 }
 
@@ -138,7 +120,7 @@ func TestGetDeployment(t *testing.T) {
 			}).
 		Build()
 
-	deploy, err := GetDeployment(fakeClient, "dynatrace")
+	deploy, err := GetDeployment(context.TODO(), fakeClient, "dynatrace")
 	require.NoError(t, err)
 	assert.Equal(t, "mydeployment", deploy.Name)
 	assert.Equal(t, "dynatrace", deploy.Namespace)
@@ -1,17 +1,19 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 )
 
-func (dc *dynatraceClient) GetAgentVersionForIP(ip string) (string, error) {
+func (dc *dynatraceClient) GetAgentVersionForIP(ctx context.Context, ip string) (string, error) {
 	if len(ip) == 0 {
 		return "", errors.New("ip is invalid")
 	}
 
-	hostInfo, err := dc.getHostInfoForIP(ip)
+	hostInfo, err := dc.getHostInfoForIP(ctx, ip)
 	if err != nil {
 		return "", err
 	}
@@ -23,13 +25,13 @@ func (dc *dynatraceClient) GetAgentVersionForIP(ip string) (string, error) {
 }
 
 // GetVersionForLatest gets the latest agent version for the given OS and installer type.
-func (dc *dynatraceClient) GetLatestAgentVersion(os, installerType string) (string, error) {
+func (dc *dynatraceClient) GetLatestAgentVersion(ctx context.Context, os, installerType string) (string, error) {
 	if len(os) == 0 || len(installerType) == 0 {
 		return "", errors.New("os or installerType is empty")
 	}
 
 	url := fmt.Sprintf("%s/v1/deployment/installer/agent/%s/%s/latest/metainfo", dc.url, os, installerType)
-	resp, err := dc.makeRequest(url, dynatracePaaSToken)
+	resp, err := dc.makeRequest(ctx, url, dynatracePaaSToken)
 	if err != nil {
 		return "", err
 	}
@@ -43,12 +45,59 @@ func (dc *dynatraceClient) GetLatestAgentVersion(os, installerType string) (stri
 	return dc.readResponseForLatestVersion(responseData)
 }
 
-func (dc *dynatraceClient) GetEntityIDForIP(ip string) (string, error) {
+// GetAgentVersions gets the agent versions available for the given OS and installer type.
+func (dc *dynatraceClient) GetAgentVersions(ctx context.Context, os, installerType string) ([]string, error) {
+	if len(os) == 0 || len(installerType) == 0 {
+		return nil, errors.New("os or installerType is empty")
+	}
+
+	url := fmt.Sprintf("%s/v1/deployment/installer/agent/versions/%s/%s", dc.url, os, installerType)
+	resp, err := dc.makeRequest(ctx, url, dynatracePaaSToken)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseData, err := dc.getServerResponseData(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return dc.readResponseForAgentVersions(responseData)
+}
+
+// HostInfo has the details of a host monitored by Dynatrace.
+type HostInfo struct {
+	EntityID     string
+	AgentVersion string
+	NetworkZone  string
+	LastSeen     time.Time
+}
+
+func (dc *dynatraceClient) GetHostInfoForIP(ctx context.Context, ip string) (HostInfo, error) {
+	if len(ip) == 0 {
+		return HostInfo{}, errors.New("ip is invalid")
+	}
+
+	hostInfo, err := dc.getHostInfoForIP(ctx, ip)
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	return HostInfo{
+		EntityID:     hostInfo.entityID,
+		AgentVersion: hostInfo.version,
+		NetworkZone:  hostInfo.networkZone,
+		LastSeen:     hostInfo.lastSeen,
+	}, nil
+}
+
+func (dc *dynatraceClient) GetEntityIDForIP(ctx context.Context, ip string) (string, error) {
 	if len(ip) == 0 {
 		return "", errors.New("ip is invalid")
 	}
 
-	hostInfo, err := dc.getHostInfoForIP(ip)
+	hostInfo, err := dc.getHostInfoForIP(ctx, ip)
 	if err != nil {
 		return "", err
 	}
@@ -79,3 +128,19 @@ func (dc *dynatraceClient) readResponseForLatestVersion(response []byte) (string
 
 	return v, nil
 }
+
+// readResponseForAgentVersions reads the available agent versions from the given server response reader.
+func (dc *dynatraceClient) readResponseForAgentVersions(response []byte) ([]string, error) {
+	type jsonResponse struct {
+		AvailableVersions []string
+	}
+
+	jr := &jsonResponse{}
+	err := json.Unmarshal(response, jr)
+	if err != nil {
+		dc.logger.Error(err, "error unmarshalling json response")
+		return nil, err
+	}
+
+	return jr.AvailableVersions, nil
+}
@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -76,41 +77,55 @@ func TestResponseForLatestVersion(t *testing.T) {
 
 func testAgentVersionGetLatestAgentVersion(t *testing.T, dynatraceClient Client) {
 	{
-		_, err := dynatraceClient.GetLatestAgentVersion("", InstallerTypeDefault)
+		_, err := dynatraceClient.GetLatestAgentVersion(context.TODO(), "", InstallerTypeDefault)
 
 		assert.Error(t, err, "empty OS")
 	}
 	{
-		_, err := dynatraceClient.GetLatestAgentVersion(OsUnix, "")
+		_, err := dynatraceClient.GetLatestAgentVersion(context.TODO(), OsUnix, "")
 
 		assert.Error(t, err, "empty installer type")
 	}
 	{
-		latestAgentVersion, err := dynatraceClient.GetLatestAgentVersion(OsUnix, InstallerTypeDefault)
+		latestAgentVersion, err := dynatraceClient.GetLatestAgentVersion(context.TODO(), OsUnix, InstallerTypeDefault)
 
 		assert.NoError(t, err)
 		assert.Equal(t, "17", latestAgentVersion, "latest agent version equals expected version")
 	}
 }
 
+func testAgentVersionGetAgentVersions(t *testing.T, dynatraceClient Client) {
+	{
+		_, err := dynatraceClient.GetAgentVersions(context.TODO(), "", InstallerTypeDefault)
+
+		assert.Error(t, err, "empty OS")
+	}
+	{
+		versions, err := dynatraceClient.GetAgentVersions(context.TODO(), OsUnix, InstallerTypeDefault)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.203.0.20200923-153112", "1.205.0.20201020-180202"}, versions)
+	}
+}
+
 func testAgentVersionGetAgentVersionForIP(t *testing.T, dynatraceClient Client) {
 	{
-		_, err := dynatraceClient.GetAgentVersionForIP("")
+		_, err := dynatraceClient.GetAgentVersionForIP(context.TODO(), "")
 
 		assert.Error(t, err, "lookup empty ip")
 	}
 	{
-		_, err := dynatraceClient.GetAgentVersionForIP(unknownIP)
+		_, err := dynatraceClient.GetAgentVersionForIP(context.TODO(), unknownIP)
 
 		assert.Error(t, err, "lookup unknown ip")
 	}
 	{
-		_, err := dynatraceClient.GetAgentVersionForIP(unsetIP)
+		_, err := dynatraceClient.GetAgentVersionForIP(context.TODO(), unsetIP)
 
 		assert.Error(t, err, "lookup unset ip")
 	}
 	{
-		version, err := dynatraceClient.GetAgentVersionForIP(goodIP)
+		version, err := dynatraceClient.GetAgentVersionForIP(context.TODO(), goodIP)
 
 		assert.NoError(t, err, "lookup good ip")
 		assert.Equal(t, "1.142.0.20180313-173634", version, "version matches for lookup good ip")
@@ -137,3 +152,14 @@ func handleLatestAgentVersion(request *http.Request, writer http.ResponseWriter)
 		writeError(writer, http.StatusMethodNotAllowed)
 	}
 }
+
+func handleAgentVersions(request *http.Request, writer http.ResponseWriter) {
+	switch request.Method {
+	case "GET":
+		writer.WriteHeader(http.StatusOK)
+		out, _ := json.Marshal(map[string][]string{"availableVersions": {"1.203.0.20200923-153112", "1.205.0.20201020-180202"}})
+		_, _ = writer.Write(out)
+	default:
+		writeError(writer, http.StatusMethodNotAllowed)
+	}
+}
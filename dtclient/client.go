@@ -1,13 +1,16 @@
 package dtclient
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"golang.org/x/time/rate"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -21,7 +24,16 @@ type Client interface {
 	//  - IO error or unexpected response
 	//  - error response from the server (e.g. authentication failure)
 	//  - the agent version is not set or empty
-	GetLatestAgentVersion(os, installerType string) (string, error)
+	GetLatestAgentVersion(ctx context.Context, os, installerType string) (string, error)
+
+	// GetAgentVersions gets the agent versions available for the given OS and installer type.
+	// Returns the versions as received from the server on success.
+	//
+	// Returns an error for the following conditions:
+	//  - os or installerType is empty
+	//  - IO error or unexpected response
+	//  - error response from the server (e.g. authentication failure)
+	GetAgentVersions(ctx context.Context, os, installerType string) ([]string, error)
 
 	// GetAgentVersionForIP returns the agent version running on the host with the given IP address.
 	// Returns the version string formatted as "Major.Minor.Revision.Timestamp" on success.
@@ -33,33 +45,45 @@ type Client interface {
 	//  - a host with the given IP cannot be found
 	//  - the agent version for the host is not set
 	//
-	// The list of all hosts with their IP addresses is cached the first time this method is called. Use a new
-	// client instance to fetch a new list from the server.
-	GetAgentVersionForIP(ip string) (string, error)
+	// Hosts are looked up with the entities API of the Environment API v2 if the API token has the entities.read
+	// scope, caching each host found. Otherwise, the list of all hosts with their IP addresses is fetched from the
+	// v1 API and cached the first time this method is called. Hosts are fetched again from the server once the
+	// HostCacheTTL passed. Without a TTL, use a new client instance to fetch them again.
+	GetAgentVersionForIP(ctx context.Context, ip string) (string, error)
+
+	// GetHostInfoForIP returns the details of the host with the given IP address, looked up as for
+	// GetAgentVersionForIP.
+	//
+	// Returns an error if the IP is empty, the lookup failed, or a host with the given IP cannot be found.
+	GetHostInfoForIP(ctx context.Context, ip string) (HostInfo, error)
 
 	// GetCommunicationHosts returns, on success, the list of communication hosts used for available
 	// communication endpoints that the Dynatrace OneAgent can use to connect to.
 	//
 	// Returns an error if there was also an error response from the server.
-	GetConnectionInfo() (ConnectionInfo, error)
+	GetConnectionInfo(ctx context.Context) (ConnectionInfo, error)
 
 	// GetCommunicationHostForClient returns a CommunicationHost for the client's API URL. Or error, if failed to be parsed.
 	GetCommunicationHostForClient() (CommunicationHost, error)
 
 	// SendEvent posts events to dynatrace API
-	SendEvent(eventData *EventData) error
+	SendEvent(ctx context.Context, eventData *EventData) error
 
 	// GetEntityIDForIP returns the entity id for a given IP address.
 	//
 	// Returns an error in case the lookup failed.
-	GetEntityIDForIP(ip string) (string, error)
+	GetEntityIDForIP(ctx context.Context, ip string) (string, error)
 
 	// GetTokenScopes returns the list of scopes assigned to a token if successful.
-	GetTokenScopes(token string) (TokenScopes, error)
+	GetTokenScopes(ctx context.Context, token string) (TokenScopes, error)
+
+	// GetTokenInfo returns the metadata of a token if successful, including its owner, creation and expiration dates,
+	// and all the scopes assigned to it.
+	GetTokenInfo(ctx context.Context, token string) (TokenInfo, error)
 
 	// GetClusterInfo returns the following information about the cluster:
 	// * Version
-	GetClusterInfo() (*ClusterInfo, error)
+	GetClusterInfo(ctx context.Context) (*ClusterInfo, error)
 }
 
 // Known OS values.
@@ -82,14 +106,20 @@ const (
 const (
 	TokenScopeInstallerDownload = "InstallerDownload"
 	TokenScopeDataExport        = "DataExport"
+	TokenScopeEntitiesRead      = "entities.read"
+	TokenScopeDataImport        = "DataImport"
 )
 
+// defaultRequestTimeout is the timeout for each request done by clients created by NewClient, unless replaced with the
+// RequestTimeout option.
+const defaultRequestTimeout = 30 * time.Second
+
 // NewClient creates a REST client for the given API base URL and authentication tokens.
 // Returns an error if a token or the URL is empty.
 //
 // The API base URL is different for managed and SaaS environments:
-//  - SaaS: https://{environment-id}.live.dynatrace.com/api
-//  - Managed: https://{domain}/e/{environment-id}/api
+//   - SaaS: https://{environment-id}.live.dynatrace.com/api
+//   - Managed: https://{domain}/e/{environment-id}/api
 //
 // opts can be used to customize the created client, entries must not be nil.
 func NewClient(url, apiToken, paasToken string, opts ...Option) (Client, error) {
@@ -113,7 +143,9 @@ func NewClient(url, apiToken, paasToken string, opts ...Option) (Client, error)
 		hostCache: make(map[string]hostInfo),
 		httpClient: &http.Client{
 			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   defaultRequestTimeout,
 		},
+		retryPolicy: DefaultRetryPolicy,
 	}
 
 	for _, opt := range opts {
@@ -171,3 +203,27 @@ func NetworkZone(networkZone string) Option {
 		c.networkZone = networkZone
 	}
 }
+
+// RequestTimeout creates an Option that sets the timeout for each request, i.e., for each attempt when retried. The
+// time for a whole call is limited by the Deadline of the RetryPolicy, and by the context given to it.
+func RequestTimeout(timeout time.Duration) Option {
+	return func(c *dynatraceClient) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// RateLimiter creates an Option that makes the client wait on the given limiter before each request, including
+// retries. A limiter can be shared between clients to limit the requests to an environment.
+func RateLimiter(limiter *rate.Limiter) Option {
+	return func(c *dynatraceClient) {
+		c.limiter = limiter
+	}
+}
+
+// HostCacheTTL creates an Option that sets how long the list of hosts is cached by the client. The list is kept
+// until the client is discarded if zero, which is the default.
+func HostCacheTTL(ttl time.Duration) Option {
+	return func(c *dynatraceClient) {
+		c.hostCacheTTL = ttl
+	}
+}
@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -13,10 +14,10 @@ type ClusterInfo struct {
 	Version string `json:"version"`
 }
 
-func (dc *dynatraceClient) GetClusterInfo() (*ClusterInfo, error) {
+func (dc *dynatraceClient) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
 	result := ClusterInfo{}
 	url := fmt.Sprintf("%s%s", dc.url, clusterVersionEndpoint)
-	resp, err := dc.makeRequest(url, dynatraceApiToken)
+	resp, err := dc.makeRequest(ctx, url, dynatraceApiToken)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -19,7 +20,7 @@ func TestDynatraceClient_GetClusterVersion_MockEndpoint(t *testing.T) {
 		dtc, err := NewClient(dynatraceServerMock.URL, apiToken, paasToken)
 
 		assert.NoError(t, err)
-		clusterInfo, err := dtc.GetClusterInfo()
+		clusterInfo, err := dtc.GetClusterInfo(context.TODO())
 
 		assert.NoError(t, err)
 		assert.NotNil(t, clusterInfo)
@@ -31,7 +32,7 @@ func TestDynatraceClient_GetClusterVersion_MockEndpoint(t *testing.T) {
 		dtc, err := NewClient(dynatraceServerMock.URL, apiToken, paasToken)
 
 		assert.NoError(t, err)
-		clusterInfo, err := dtc.GetClusterInfo()
+		clusterInfo, err := dtc.GetClusterInfo(context.TODO())
 
 		assert.Error(t, err)
 		assert.Nil(t, clusterInfo)
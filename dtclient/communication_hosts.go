@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -25,9 +26,9 @@ func (dc *dynatraceClient) GetCommunicationHostForClient() (CommunicationHost, e
 	return dc.parseEndpoint(dc.url)
 }
 
-func (dc *dynatraceClient) GetConnectionInfo() (ConnectionInfo, error) {
+func (dc *dynatraceClient) GetConnectionInfo(ctx context.Context) (ConnectionInfo, error) {
 	url := fmt.Sprintf("%s/v1/deployment/installer/agent/connectioninfo", dc.url)
-	resp, err := dc.makeRequest(url, dynatracePaaSToken)
+	resp, err := dc.makeRequest(ctx, url, dynatracePaaSToken)
 	if err != nil {
 		return ConnectionInfo{}, err
 	}
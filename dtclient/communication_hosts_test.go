@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
@@ -138,7 +139,7 @@ func TestParseEndpoints(t *testing.T) {
 }
 
 func testCommunicationHostsGetCommunicationHosts(t *testing.T, dynatraceClient Client) {
-	res, err := dynatraceClient.GetConnectionInfo()
+	res, err := dynatraceClient.GetConnectionInfo(context.TODO())
 
 	assert.NoError(t, err)
 	assert.ObjectsAreEqualValues(res.CommunicationHosts, []CommunicationHost{
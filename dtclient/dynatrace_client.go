@@ -1,19 +1,24 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
 )
 
 type hostInfo struct {
-	version  string
-	entityID string
+	version     string
+	entityID    string
+	networkZone string
+	lastSeen    time.Time
 }
 
 // client implements the Client interface.
@@ -25,9 +30,19 @@ type dynatraceClient struct {
 
 	networkZone string
 
-	httpClient *http.Client
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+
+	limiter *rate.Limiter
+
+	hostCache          map[string]hostInfo
+	hostCacheTimestamp time.Time
+	hostCacheTTL       time.Duration
+	hostCacheLock      sync.Mutex
 
-	hostCache map[string]hostInfo
+	hostsAPI          hostsAPI
+	hostsAPICheckedAt time.Time
+	hostEntityCache   map[string]cachedHostInfo
 
 	// Set for testing purposes, leave the default zero value to use the current time.
 	now time.Time
@@ -42,8 +57,8 @@ const (
 
 // makeRequest does an HTTP request by formatting the URL from the given arguments and returns the response.
 // The response body must be closed by the caller when no longer used.
-func (dc *dynatraceClient) makeRequest(url string, tokenType tokenType) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (dc *dynatraceClient) makeRequest(ctx context.Context, url string, tokenType tokenType) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing http request: %s", err.Error())
 	}
@@ -67,7 +82,7 @@ func (dc *dynatraceClient) makeRequest(url string, tokenType tokenType) (*http.R
 
 	req.Header.Add("Authorization", authHeader)
 
-	return dc.httpClient.Do(req)
+	return dc.doRequest(req)
 }
 
 func (dc *dynatraceClient) getServerResponseData(response *http.Response) ([]byte, error) {
@@ -92,9 +107,28 @@ func (dc *dynatraceClient) handleErrorResponseFromAPI(response []byte, statusCod
 	return se.ErrorMessage
 }
 
-func (dc *dynatraceClient) getHostInfoForIP(ip string) (*hostInfo, error) {
-	if len(dc.hostCache) == 0 {
-		err := dc.buildHostCache()
+func (dc *dynatraceClient) getHostInfoForIP(ctx context.Context, ip string) (*hostInfo, error) {
+	// Clients may be shared between controllers, so the cache is built only once when queried concurrently.
+	dc.hostCacheLock.Lock()
+	defer dc.hostCacheLock.Unlock()
+
+	// The API is chosen again with the cache expiration, to follow changes on the token scopes.
+	if dc.hostsAPI == hostsAPIUnknown || dc.hostCacheExpired(dc.hostsAPICheckedAt) {
+		dc.selectHostsAPI(ctx)
+	}
+
+	if dc.hostsAPI == hostsAPIv2 {
+		info, err := dc.getHostInfoFromEntities(ctx, ip)
+		if !errors.Is(err, errEntitiesAPIUnavailable) {
+			return info, err
+		}
+
+		dc.logger.Info("falling back to hosts API v1", "error", err.Error())
+		dc.hostsAPI = hostsAPIv1
+	}
+
+	if len(dc.hostCache) == 0 || dc.hostCacheExpired(dc.hostCacheTimestamp) {
+		err := dc.buildHostCache(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("error building hostcache from dynatrace cluster: %w", err)
 		}
@@ -108,9 +142,14 @@ func (dc *dynatraceClient) getHostInfoForIP(ip string) (*hostInfo, error) {
 	}
 }
 
-func (dc *dynatraceClient) buildHostCache() error {
+// hostCacheExpired returns true if an entry cached at the given time must be fetched again from the server.
+func (dc *dynatraceClient) hostCacheExpired(timestamp time.Time) bool {
+	return dc.hostCacheTTL > 0 && time.Since(timestamp) >= dc.hostCacheTTL
+}
+
+func (dc *dynatraceClient) buildHostCache(ctx context.Context) error {
 	url := fmt.Sprintf("%s/v1/entity/infrastructure/hosts?includeDetails=false", dc.url)
-	resp, err := dc.makeRequest(url, dynatraceApiToken)
+	resp, err := dc.makeRequest(ctx, url, dynatraceApiToken)
 	if err != nil {
 		return err
 	}
@@ -126,18 +165,14 @@ func (dc *dynatraceClient) buildHostCache() error {
 		return err
 	}
 
+	dc.hostCacheTimestamp = time.Now()
 	return nil
 }
 
 func (dc *dynatraceClient) setHostCacheFromResponse(response []byte) error {
 	type hostInfoResponse struct {
-		IPAddresses  []string
-		AgentVersion *struct {
-			Major     int
-			Minor     int
-			Revision  int
-			Timestamp string
-		}
+		IPAddresses       []string
+		AgentVersion      *agentVersion
 		EntityID          string
 		NetworkZoneID     string
 		LastSeenTimestamp int64
@@ -152,27 +187,20 @@ func (dc *dynatraceClient) setHostCacheFromResponse(response []byte) error {
 		return err
 	}
 
-	now := dc.now
-	if now.IsZero() {
-		now = time.Now().UTC()
-	}
-
 	var inactive []string
 
 	for _, info := range hostInfoResponses {
-		// If we haven't seen this host in the last 30 minutes, ignore it.
-		if tm := time.Unix(info.LastSeenTimestamp/1000, 0).UTC(); tm.Before(now.Add(-30 * time.Minute)) {
+		if !dc.isRecentlySeen(info.LastSeenTimestamp) {
 			inactive = append(inactive, info.EntityID)
 			continue
 		}
 
-		nz := info.NetworkZoneID
-
-		if (dc.networkZone != "" && nz == dc.networkZone) || (dc.networkZone == "" && (nz == "default" || nz == "")) {
-			hostInfo := hostInfo{entityID: info.EntityID}
-
-			if v := info.AgentVersion; v != nil {
-				hostInfo.version = fmt.Sprintf("%d.%d.%d.%s", v.Major, v.Minor, v.Revision, v.Timestamp)
+		if dc.isInNetworkZone(info.NetworkZoneID) {
+			hostInfo := hostInfo{
+				entityID:    info.EntityID,
+				version:     info.AgentVersion.String(),
+				networkZone: info.NetworkZoneID,
+				lastSeen:    fromMillis(info.LastSeenTimestamp),
 			}
 
 			for _, ip := range info.IPAddresses {
@@ -192,6 +220,44 @@ func (dc *dynatraceClient) setHostCacheFromResponse(response []byte) error {
 	return nil
 }
 
+// isRecentlySeen returns false for hosts we haven't seen in the last 30 minutes, given the timestamp in milliseconds.
+func (dc *dynatraceClient) isRecentlySeen(lastSeenTimestamp int64) bool {
+	now := dc.now
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	return !fromMillis(lastSeenTimestamp).Before(now.Add(-30 * time.Minute))
+}
+
+// fromMillis returns the time for the given Unix timestamp in milliseconds, as returned by the Dynatrace API.
+func fromMillis(timestamp int64) time.Time {
+	return time.Unix(timestamp/1000, 0).UTC()
+}
+
+// isInNetworkZone returns true if a host in the given network zone belongs to the client's network zone.
+func (dc *dynatraceClient) isInNetworkZone(nz string) bool {
+	if dc.networkZone != "" {
+		return nz == dc.networkZone
+	}
+	return nz == "default" || nz == ""
+}
+
+type agentVersion struct {
+	Major     int
+	Minor     int
+	Revision  int
+	Timestamp string
+}
+
+// String formats the version as "Major.Minor.Revision.Timestamp", or returns an empty string if it's not set.
+func (v *agentVersion) String() string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d.%s", v.Major, v.Minor, v.Revision, v.Timestamp)
+}
+
 type serverErrorResponse struct {
 	ErrorMessage ServerError `json:"error"`
 }
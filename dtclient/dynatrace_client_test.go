@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -34,12 +35,12 @@ func TestMakeRequest(t *testing.T) {
 
 	{
 		url := fmt.Sprintf("%s/v1/deployment/installer/agent/connectioninfo", dc.url)
-		resp, err := dc.makeRequest(url, dynatraceApiToken)
+		resp, err := dc.makeRequest(context.TODO(), url, dynatraceApiToken)
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 	}
 	{
-		resp, err := dc.makeRequest("%s/v1/deployment/installer/agent/connectioninfo", dynatraceApiToken)
+		resp, err := dc.makeRequest(context.TODO(), "%s/v1/deployment/installer/agent/connectioninfo", dynatraceApiToken)
 		assert.Error(t, err, "unsupported protocol scheme")
 		assert.Nil(t, resp)
 	}
@@ -63,7 +64,7 @@ func TestGetResponseOrServerError(t *testing.T) {
 
 	reqURL := fmt.Sprintf("%s/v1/deployment/installer/agent/connectioninfo", dc.url)
 	{
-		resp, err := dc.makeRequest(reqURL, dynatraceApiToken)
+		resp, err := dc.makeRequest(context.TODO(), reqURL, dynatraceApiToken)
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 
@@ -90,13 +91,13 @@ func TestBuildHostCache(t *testing.T) {
 	require.NotNil(t, dc)
 
 	{
-		err := dc.buildHostCache()
+		err := dc.buildHostCache(context.TODO())
 		assert.Error(t, err, "error querying dynatrace server")
 		assert.Empty(t, dc.hostCache)
 	}
 	{
 		dc.apiToken = apiToken
-		err := dc.buildHostCache()
+		err := dc.buildHostCache(context.TODO())
 		assert.NoError(t, err)
 		assert.NotZero(t, len(dc.hostCache))
 		assert.ObjectsAreEqualValues(dc.hostCache, map[string]hostInfo{
@@ -106,6 +107,43 @@ func TestBuildHostCache(t *testing.T) {
 	}
 }
 
+func TestHostCacheTTL(t *testing.T) {
+	var requests int
+	dynatraceServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/tokens/lookup" {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		requests++
+		_, _ = w.Write([]byte(hostsResponse))
+	}))
+	defer dynatraceServer.Close()
+
+	dc := &dynatraceClient{
+		url:       dynatraceServer.URL,
+		apiToken:  apiToken,
+		paasToken: paasToken,
+		now:       time.Unix(1521540000, 0),
+		logger:    consoleLogger,
+
+		hostCache:    make(map[string]hostInfo),
+		hostCacheTTL: time.Hour,
+		httpClient:   http.DefaultClient,
+	}
+
+	_, err := dc.GetEntityIDForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	_, err = dc.GetEntityIDForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	// Once expired, the list of hosts is fetched again.
+	dc.hostCacheTimestamp = dc.hostCacheTimestamp.Add(-time.Hour)
+	_, err = dc.GetEntityIDForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
 func TestServerError(t *testing.T) {
 	{
 		se := &ServerError{Code: 401, Message: "Unauthorized"}
@@ -137,10 +175,12 @@ func TestDynatraceClientWithServer(t *testing.T) {
 	require.NotNil(t, dtc)
 
 	testAgentVersionGetLatestAgentVersion(t, dtc)
+	testAgentVersionGetAgentVersions(t, dtc)
 	testAgentVersionGetAgentVersionForIP(t, dtc)
 	testCommunicationHostsGetCommunicationHosts(t, dtc)
 	testSendEvent(t, dtc)
 	testGetTokenScopes(t, dtc)
+	testGetTokenInfo(t, dtc)
 }
 
 func dynatraceServerHandler() http.HandlerFunc {
@@ -157,10 +197,13 @@ func dynatraceServerHandler() http.HandlerFunc {
 
 func handleRequest(request *http.Request, writer http.ResponseWriter) {
 	latestAgentVersion := fmt.Sprintf("/v1/deployment/installer/agent/%s/%s/latest/metainfo", OsUnix, InstallerTypeDefault)
+	agentVersions := fmt.Sprintf("/v1/deployment/installer/agent/versions/%s/%s", OsUnix, InstallerTypeDefault)
 
 	switch request.URL.Path {
 	case latestAgentVersion:
 		handleLatestAgentVersion(request, writer)
+	case agentVersions:
+		handleAgentVersions(request, writer)
 	case "/v1/entity/infrastructure/hosts":
 		handleVersionForIP(request, writer)
 	case "/v1/deployment/installer/agent/connectioninfo":
@@ -229,8 +272,10 @@ func TestIgnoreNonCurrentlySeenHosts(t *testing.T) {
 	}
 ]`)))
 
-	info, err := c.getHostInfoForIP("1.1.1.1")
+	info, err := c.getHostInfoForIP(context.TODO(), "1.1.1.1")
 	require.NoError(t, err)
 	require.Equal(t, "HOST-42", info.entityID)
 	require.Equal(t, "1.195.0.20200515-045253", info.version)
+	require.Equal(t, "default", info.networkZone)
+	require.Equal(t, time.Unix(1589969061, 0).UTC(), info.lastSeen)
 }
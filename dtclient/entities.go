@@ -0,0 +1,170 @@
+package dtclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// hostsAPI is the API used to look up hosts by their IP addresses.
+type hostsAPI int
+
+const (
+	// hostsAPIUnknown means that the API hasn't been chosen yet from the scopes of the API token.
+	hostsAPIUnknown hostsAPI = iota
+
+	// hostsAPIv1 fetches the list of all hosts from /v1/entity/infrastructure/hosts, and caches it.
+	hostsAPIv1
+
+	// hostsAPIv2 queries /v2/entities for the host with the given IP address, and caches it.
+	hostsAPIv2
+)
+
+// entitiesPageSize is the number of entities requested on each page from the Environment API v2.
+const entitiesPageSize = 100
+
+var errEntitiesAPIUnavailable = errors.New("entities API v2 not available")
+
+type cachedHostInfo struct {
+	hostInfo
+	timestamp time.Time
+}
+
+type entitiesResponse struct {
+	Entities    []entity `json:"entities"`
+	NextPageKey string   `json:"nextPageKey"`
+}
+
+type entity struct {
+	EntityID    string `json:"entityId"`
+	LastSeenTms int64  `json:"lastSeenTms"`
+	Properties  struct {
+		IPAddress    []string      `json:"ipAddress"`
+		NetworkZone  string        `json:"networkZone"`
+		AgentVersion *agentVersion `json:"agentVersion"`
+	} `json:"properties"`
+}
+
+// selectHostsAPI chooses the API for host lookups, the entities API v2 is used if the API token has the
+// entities.read scope. The v1 API is used until it's checked again if the scopes can't be queried.
+func (dc *dynatraceClient) selectHostsAPI(ctx context.Context) {
+	dc.hostsAPI, dc.hostsAPICheckedAt = hostsAPIv1, time.Now()
+
+	if dc.apiToken == "" {
+		return
+	}
+
+	scopes, err := dc.GetTokenScopes(ctx, dc.apiToken)
+	if err != nil {
+		dc.logger.Info("failed to query API token scopes, using hosts API v1", "error", err.Error())
+		return
+	}
+
+	if scopes.Contains(TokenScopeEntitiesRead) {
+		dc.hostsAPI = hostsAPIv2
+	}
+}
+
+// getHostInfoFromEntities looks up the host with the given IP address with the entities API v2, keeping it in the
+// cache until the HostCacheTTL passed. Returns an error wrapping errEntitiesAPIUnavailable if the API can't be used.
+func (dc *dynatraceClient) getHostInfoFromEntities(ctx context.Context, ip string) (*hostInfo, error) {
+	if cached, ok := dc.hostEntityCache[ip]; ok && !dc.hostCacheExpired(cached.timestamp) {
+		return &cached.hostInfo, nil
+	}
+
+	selector := fmt.Sprintf(`type("HOST"),ipAddress("%s")`, ip)
+	if dc.networkZone != "" {
+		selector += fmt.Sprintf(`,networkZoneId("%s")`, dc.networkZone)
+	}
+
+	query := url.Values{}
+	query.Set("entitySelector", selector)
+	query.Set("fields", "+lastSeenTms,+properties.ipAddress,+properties.networkZone,+properties.agentVersion")
+	query.Set("pageSize", strconv.Itoa(entitiesPageSize))
+
+	var found *hostInfo
+
+	for {
+		page, err := dc.getEntitiesPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range page.Entities {
+			// The selector matches hosts which had the IP address at any time, so they're checked as for the v1 API.
+			if !dc.isRecentlySeen(e.LastSeenTms) || !dc.isInNetworkZone(e.Properties.NetworkZone) ||
+				!containsString(e.Properties.IPAddress, ip) {
+				continue
+			}
+
+			info := hostInfo{
+				entityID:    e.EntityID,
+				version:     e.Properties.AgentVersion.String(),
+				networkZone: e.Properties.NetworkZone,
+				lastSeen:    fromMillis(e.LastSeenTms),
+			}
+			if found != nil {
+				dc.logger.Info("Hosts lookup: replacing host", "ip", ip, "new", info.entityID, "old", found.entityID)
+			}
+			found = &info
+		}
+
+		if page.NextPageKey == "" {
+			break
+		}
+
+		// Later pages are requested only with the key, which includes the original query.
+		query = url.Values{}
+		query.Set("nextPageKey", page.NextPageKey)
+	}
+
+	if found == nil {
+		return nil, errors.New("host not found")
+	}
+
+	if dc.hostEntityCache == nil {
+		dc.hostEntityCache = make(map[string]cachedHostInfo)
+	}
+	dc.hostEntityCache[ip] = cachedHostInfo{hostInfo: *found, timestamp: time.Now()}
+
+	return found, nil
+}
+
+func (dc *dynatraceClient) getEntitiesPage(ctx context.Context, query url.Values) (*entitiesResponse, error) {
+	resp, err := dc.makeRequest(ctx, fmt.Sprintf("%s/v2/entities?%s", dc.url, query.Encode()), dynatraceApiToken)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Older clusters don't have the endpoint, and tokens may lack permissions for it despite the scope.
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: status code %d", errEntitiesAPIUnavailable, resp.StatusCode)
+	}
+
+	data, err := dc.getServerResponseData(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var page entitiesResponse
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("error unmarshalling json response: %w", err)
+	}
+
+	return &page, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package dtclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const entitiesFirstPage = `{
+	"totalCount": 3,
+	"pageSize": 2,
+	"nextPageKey": "page-2",
+	"entities": [
+		{
+			"entityId": "HOST-OLD",
+			"lastSeenTms": 1521500000000,
+			"properties": {"ipAddress": ["10.0.0.1"], "networkZone": "default"}
+		},
+		{
+			"entityId": "HOST-OTHER-ZONE",
+			"lastSeenTms": 1521539900000,
+			"properties": {"ipAddress": ["10.0.0.1"], "networkZone": "other"}
+		}
+	]
+}`
+
+const entitiesSecondPage = `{
+	"totalCount": 3,
+	"pageSize": 2,
+	"entities": [
+		{
+			"entityId": "HOST-42",
+			"lastSeenTms": 1521539900000,
+			"properties": {
+				"ipAddress": ["10.0.0.1", "192.168.0.10"],
+				"agentVersion": {"major": 1, "minor": 203, "revision": 0, "timestamp": "20200909-123456"}
+			}
+		}
+	]
+}`
+
+func newEntitiesTestServer(t *testing.T, scopes string, requests map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/v1/tokens/lookup":
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"scopes": [%s]}`, scopes)))
+		case "/v1/entity/infrastructure/hosts":
+			_, _ = w.Write([]byte(hostsResponse))
+		case "/v2/entities":
+			switch key := r.URL.Query().Get("nextPageKey"); key {
+			case "":
+				_, _ = w.Write([]byte(entitiesFirstPage))
+			case "page-2":
+				// Only the key is sent for later pages.
+				assert.Len(t, r.URL.Query(), 1)
+				_, _ = w.Write([]byte(entitiesSecondPage))
+			default:
+				writeError(w, http.StatusBadRequest)
+			}
+		default:
+			writeError(w, http.StatusNotFound)
+		}
+	}))
+}
+
+func newEntitiesTestClient(url string) *dynatraceClient {
+	return &dynatraceClient{
+		url:        url,
+		apiToken:   apiToken,
+		logger:     consoleLogger,
+		now:        time.Unix(1521540000, 0),
+		hostCache:  make(map[string]hostInfo),
+		httpClient: http.DefaultClient,
+	}
+}
+
+func TestGetHostInfoForIP_EntitiesAPI(t *testing.T) {
+	requests := map[string]int{}
+	server := newEntitiesTestServer(t, `"DataExport", "entities.read"`, requests)
+	defer server.Close()
+
+	dc := newEntitiesTestClient(server.URL)
+
+	info, err := dc.getHostInfoForIP(context.TODO(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, hostInfo{entityID: "HOST-42", version: "1.203.0.20200909-123456", lastSeen: time.Unix(1521539900, 0).UTC()}, *info)
+	assert.Equal(t, 2, requests["/v2/entities"])
+
+	// The host is cached, and the token scopes aren't queried again.
+	host, err := dc.GetHostInfoForIP(context.TODO(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, HostInfo{EntityID: "HOST-42", AgentVersion: "1.203.0.20200909-123456", LastSeen: time.Unix(1521539900, 0).UTC()}, host)
+	assert.Equal(t, 2, requests["/v2/entities"])
+	assert.Equal(t, 1, requests["/v1/tokens/lookup"])
+	assert.Zero(t, requests["/v1/entity/infrastructure/hosts"])
+}
+
+func TestGetHostInfoForIP_EntitiesAPINotFound(t *testing.T) {
+	requests := map[string]int{}
+	server := newEntitiesTestServer(t, `"DataExport", "entities.read"`, requests)
+	defer server.Close()
+
+	dc := newEntitiesTestClient(server.URL)
+
+	_, err := dc.getHostInfoForIP(context.TODO(), "10.0.0.2")
+	assert.EqualError(t, err, "host not found")
+	assert.Equal(t, hostsAPIv2, dc.hostsAPI)
+}
+
+func TestGetHostInfoForIP_FallbackWithoutScope(t *testing.T) {
+	requests := map[string]int{}
+	server := newEntitiesTestServer(t, `"DataExport"`, requests)
+	defer server.Close()
+
+	dc := newEntitiesTestClient(server.URL)
+
+	info, err := dc.getHostInfoForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	assert.Equal(t, "1.142.0.20180313-173634", info.version)
+	assert.Equal(t, hostsAPIv1, dc.hostsAPI)
+	assert.Zero(t, requests["/v2/entities"])
+}
+
+func TestGetHostInfoForIP_FallbackWhenUnavailable(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/v1/tokens/lookup":
+			_, _ = w.Write([]byte(`{"scopes": ["entities.read"]}`))
+		case "/v1/entity/infrastructure/hosts":
+			_, _ = w.Write([]byte(hostsResponse))
+		default:
+			writeError(w, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dc := newEntitiesTestClient(server.URL)
+
+	info, err := dc.getHostInfoForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	assert.Equal(t, "1.142.0.20180313-173634", info.version)
+	assert.Equal(t, hostsAPIv1, dc.hostsAPI)
+
+	// The entities API isn't tried again.
+	_, err = dc.getHostInfoForIP(context.TODO(), goodIP)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests["/v2/entities"])
+}
+
+func TestGetHostInfoForIP_NetworkZone(t *testing.T) {
+	var selector string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/tokens/lookup":
+			_, _ = w.Write([]byte(`{"scopes": ["entities.read"]}`))
+		case "/v2/entities":
+			selector = r.URL.Query().Get("entitySelector")
+			_, _ = w.Write([]byte(entitiesFirstPage[:len(entitiesFirstPage)-1] + `, "nextPageKey": ""}`))
+		}
+	}))
+	defer server.Close()
+
+	dc := newEntitiesTestClient(server.URL)
+	dc.networkZone = "other"
+
+	info, err := dc.getHostInfoForIP(context.TODO(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "HOST-OTHER-ZONE", info.entityID)
+	assert.Equal(t, `type("HOST"),ipAddress("10.0.0.1"),networkZoneId("other")`, selector)
+}
@@ -1,23 +1,38 @@
 package dtclient
 
-import "github.com/stretchr/testify/mock"
+import (
+	"context"
 
-// MockDynatraceClient implements a Dynatrace REST API Client mock
+	"github.com/stretchr/testify/mock"
+)
+
+// MockDynatraceClient implements a Dynatrace REST API Client mock. The contexts aren't recorded as arguments of the
+// calls, so expectations are set only on the remaining ones.
 type MockDynatraceClient struct {
 	mock.Mock
 }
 
-func (o *MockDynatraceClient) GetAgentVersionForIP(ip string) (string, error) {
+func (o *MockDynatraceClient) GetAgentVersionForIP(_ context.Context, ip string) (string, error) {
 	args := o.Called(ip)
 	return args.String(0), args.Error(1)
 }
 
-func (o *MockDynatraceClient) GetLatestAgentVersion(os, installerType string) (string, error) {
+func (o *MockDynatraceClient) GetHostInfoForIP(_ context.Context, ip string) (HostInfo, error) {
+	args := o.Called(ip)
+	return args.Get(0).(HostInfo), args.Error(1)
+}
+
+func (o *MockDynatraceClient) GetLatestAgentVersion(_ context.Context, os, installerType string) (string, error) {
 	args := o.Called(os, installerType)
 	return args.String(0), args.Error(1)
 }
 
-func (o *MockDynatraceClient) GetConnectionInfo() (ConnectionInfo, error) {
+func (o *MockDynatraceClient) GetAgentVersions(_ context.Context, os, installerType string) ([]string, error) {
+	args := o.Called(os, installerType)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (o *MockDynatraceClient) GetConnectionInfo(_ context.Context) (ConnectionInfo, error) {
 	args := o.Called()
 	return args.Get(0).(ConnectionInfo), args.Error(1)
 }
@@ -27,22 +42,27 @@ func (o *MockDynatraceClient) GetCommunicationHostForClient() (CommunicationHost
 	return args.Get(0).(CommunicationHost), args.Error(1)
 }
 
-func (o *MockDynatraceClient) SendEvent(event *EventData) error {
+func (o *MockDynatraceClient) SendEvent(_ context.Context, event *EventData) error {
 	args := o.Called(event)
 	return args.Error(0)
 }
 
-func (o *MockDynatraceClient) GetEntityIDForIP(ip string) (string, error) {
+func (o *MockDynatraceClient) GetEntityIDForIP(_ context.Context, ip string) (string, error) {
 	args := o.Called(ip)
 	return args.String(0), args.Error(1)
 }
 
-func (o *MockDynatraceClient) GetTokenScopes(token string) (TokenScopes, error) {
+func (o *MockDynatraceClient) GetTokenScopes(_ context.Context, token string) (TokenScopes, error) {
 	args := o.Called(token)
 	return args.Get(0).(TokenScopes), args.Error(1)
 }
 
-func (o *MockDynatraceClient) GetClusterInfo() (*ClusterInfo, error) {
+func (o *MockDynatraceClient) GetTokenInfo(_ context.Context, token string) (TokenInfo, error) {
+	args := o.Called(token)
+	return args.Get(0).(TokenInfo), args.Error(1)
+}
+
+func (o *MockDynatraceClient) GetClusterInfo(_ context.Context) (*ClusterInfo, error) {
 	args := o.Called()
 	return args.Get(0).(*ClusterInfo), args.Error(1)
 }
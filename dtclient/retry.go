@@ -0,0 +1,197 @@
+package dtclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
+)
+
+// RetryPolicy defines how requests to the Dynatrace API are retried on transient failures, i.e., connection errors,
+// 5xx responses, and 429 responses.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for each call, including the first one. Values lower than 2
+	// disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the base delay before the first retry, doubled on each later one. A random jitter of up to
+	// half of the delay is subtracted to spread retries from several clients.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts, other than the one requested by Retry-After headers.
+	MaxBackoff time.Duration
+
+	// Deadline is the maximum time for each call, including all attempts and delays. No deadline is set if zero.
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by clients created by NewClient, unless replaced with the Retries option.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Deadline:       time.Minute,
+}
+
+// Retries creates an Option that sets the RetryPolicy for requests done by the client.
+func Retries(policy RetryPolicy) Option {
+	return func(c *dynatraceClient) {
+		c.retryPolicy = policy
+	}
+}
+
+// doRequest sends the request, retrying it according to the client's RetryPolicy. The last response is returned if
+// all attempts failed, so that callers can handle the server error. The response body must be closed by the caller.
+func (dc *dynatraceClient) doRequest(req *http.Request) (*http.Response, error) {
+	policy := dc.retryPolicy
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if policy.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+	}
+
+	finish := func(resp *http.Response, err error) (*http.Response, error) {
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		// The deadline applies to reading the body too, so the context is released once it's closed.
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		if dc.limiter != nil {
+			if err := dc.limiter.Wait(ctx); err != nil {
+				return finish(nil, err)
+			}
+		}
+
+		r := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return finish(nil, err)
+			}
+			r.Body = body
+		}
+
+		start := time.Now()
+		resp, err := dc.httpClient.Do(r)
+		dc.observeRequest(req, resp, time.Since(start))
+
+		// Requests with a body which can't be read again are sent only once.
+		if attempt >= policy.MaxAttempts || (req.Body != nil && req.GetBody == nil) || !isRetryable(resp, err) {
+			return finish(resp, err)
+		}
+
+		delay := policy.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp); ok {
+				delay = d
+			}
+		}
+
+		// Don't wait for a retry that wouldn't be done before the deadline.
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return finish(resp, err)
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+			dc.logger.Info("retrying request", "url", req.URL.Redacted(), "status", resp.StatusCode, "attempt", attempt, "delay", delay)
+		} else {
+			dc.logger.Info("retrying request", "url", req.URL.Redacted(), "error", err.Error(), "attempt", attempt, "delay", delay)
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return finish(nil, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// observeRequest records the request on the Dynatrace API metrics, with the endpoint as the path relative to the
+// client's API URL.
+func (dc *dynatraceClient) observeRequest(req *http.Request, resp *http.Response, duration time.Duration) {
+	endpoint := req.URL.Path
+	if base, err := url.Parse(dc.url); err == nil {
+		endpoint = strings.TrimPrefix(endpoint, strings.TrimSuffix(base.Path, "/"))
+	}
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	metrics.ObserveDynatraceRequest(endpoint, statusCode, duration)
+}
+
+// backoff returns the delay before the retry following the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// Errors from the request context aren't transient.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter returns the delay given by the Retry-After header of the response, either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// cancelOnClose releases the context of a request when its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,172 @@
+package dtclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRetryTestClient(url string, policy RetryPolicy) *dynatraceClient {
+	return &dynatraceClient{
+		url:         url,
+		apiToken:    apiToken,
+		paasToken:   paasToken,
+		logger:      consoleLogger,
+		hostCache:   make(map[string]hostInfo),
+		httpClient:  http.DefaultClient,
+		retryPolicy: policy,
+	}
+}
+
+func TestDoRequest_RetriesTransientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writeError(w, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version": "1.203.0"}`))
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+	info, err := dc.GetClusterInfo(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "1.203.0", info.Version)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestDoRequest_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeError(w, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	_, err := dc.GetClusterInfo(context.TODO())
+	var serr ServerError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, http.StatusTooManyRequests, serr.Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestDoRequest_NoRetriesOnClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeError(w, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	_, err := dc.GetClusterInfo(context.TODO())
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDoRequest_RetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version": "1.203.0"}`))
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	start := time.Now()
+	_, err := dc.GetClusterInfo(context.TODO())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestDoRequest_Deadline(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Deadline: time.Second})
+
+	// The requested delay goes beyond the deadline, so the error is returned right away.
+	start := time.Now()
+	_, err := dc.GetClusterInfo(context.TODO())
+	var serr ServerError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, http.StatusTooManyRequests, serr.Code)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDoRequest_ResendsBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			writeError(w, http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	dc := newRetryTestClient(server.URL, RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	require.NoError(t, dc.SendEvent(context.TODO(), &EventData{EventType: MarkedForTerminationEvent, Source: "OneAgent Operator"}))
+	require.Len(t, bodies, 2)
+	assert.NotEmpty(t, bodies[0])
+	assert.Equal(t, bodies[0], bodies[1])
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		d := p.backoff(attempt)
+		assert.LessOrEqual(t, int64(d), int64(max), "attempt %d", attempt)
+		assert.GreaterOrEqual(t, int64(d), int64(max/2), "attempt %d", attempt)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+
+	_, ok := retryAfter(resp)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "120")
+	d, ok := retryAfter(resp)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	d, ok = retryAfter(resp)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(d), float64(5*time.Second))
+
+	resp.Header.Set("Retry-After", "soon")
+	_, ok = retryAfter(resp)
+	assert.False(t, ok)
+}
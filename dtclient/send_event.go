@@ -2,6 +2,7 @@ package dtclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 
 const (
 	MarkedForTerminationEvent = "MARKED_FOR_TERMINATION"
+	CustomInfoEvent           = "CUSTOM_INFO"
 )
 
 // EventData struct which defines what event payload should contain
@@ -26,7 +28,7 @@ type EventDataAttachRules struct {
 	EntityIDs []string `json:"entityIds"`
 }
 
-func (dc *dynatraceClient) SendEvent(eventData *EventData) error {
+func (dc *dynatraceClient) SendEvent(ctx context.Context, eventData *EventData) error {
 	if eventData == nil {
 		return errors.New("no data found in eventData payload")
 	}
@@ -41,17 +43,18 @@ func (dc *dynatraceClient) SendEvent(eventData *EventData) error {
 	}
 
 	url := fmt.Sprintf("%s/v1/events", dc.url)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonStr))
 	if err != nil {
 		return fmt.Errorf("error initializing http request: %s", err.Error())
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", fmt.Sprintf("Api-Token %s", dc.apiToken))
 
-	response, err := dc.httpClient.Do(req)
+	response, err := dc.doRequest(req)
 	if err != nil {
 		return fmt.Errorf("error making post request to dynatrace api: %s", err.Error())
 	}
+	defer response.Body.Close()
 
 	_, err = dc.getServerResponseData(response)
 	return err
@@ -1,6 +1,7 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -48,7 +49,7 @@ func testSendEvent(t *testing.T, dynatraceClient Client) {
 		err := json.Unmarshal(testValidEventData, &testEventData)
 		assert.NoError(t, err)
 
-		err = dynatraceClient.SendEvent(&testEventData)
+		err = dynatraceClient.SendEvent(context.TODO(), &testEventData)
 		assert.NoError(t, err)
 	}
 	{
@@ -65,7 +66,7 @@ func testSendEvent(t *testing.T, dynatraceClient Client) {
 		err := json.Unmarshal(testInvalidEventData, &testEventData)
 		assert.NoError(t, err)
 
-		err = dynatraceClient.SendEvent(&testEventData)
+		err = dynatraceClient.SendEvent(context.TODO(), &testEventData)
 		assert.Error(t, err, "no eventType set")
 	}
 	{
@@ -84,7 +85,7 @@ func testSendEvent(t *testing.T, dynatraceClient Client) {
 		err := json.Unmarshal(testExtraKeysEventData, &testEventData)
 		assert.NoError(t, err)
 
-		err = dynatraceClient.SendEvent(&testEventData)
+		err = dynatraceClient.SendEvent(context.TODO(), &testEventData)
 		assert.NoError(t, err)
 	}
 }
@@ -2,9 +2,11 @@ package dtclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // TokenScopes is a list of scopes assigned to a token
@@ -20,7 +22,34 @@ func (s TokenScopes) Contains(scope string) bool {
 	return false
 }
 
-func (dc *dynatraceClient) GetTokenScopes(token string) (TokenScopes, error) {
+// TokenInfo holds the metadata of a token.
+type TokenInfo struct {
+	ID     string
+	Name   string
+	UserID string
+	Owner  string
+
+	// Created is when the token was created, zero if unknown.
+	Created time.Time
+
+	// Expires is when the token expires, zero if it doesn't expire.
+	Expires time.Time
+
+	// LastUse is when the token was last used, zero if unknown.
+	LastUse time.Time
+
+	Scopes TokenScopes
+}
+
+func (dc *dynatraceClient) GetTokenScopes(ctx context.Context, token string) (TokenScopes, error) {
+	info, err := dc.GetTokenInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return info.Scopes, nil
+}
+
+func (dc *dynatraceClient) GetTokenInfo(ctx context.Context, token string) (TokenInfo, error) {
 	var model struct {
 		Token string `json:"token"`
 	}
@@ -28,38 +57,83 @@ func (dc *dynatraceClient) GetTokenScopes(token string) (TokenScopes, error) {
 
 	jsonStr, err := json.Marshal(model)
 	if err != nil {
-		return nil, err
+		return TokenInfo{}, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/tokens/lookup", dc.url), bytes.NewBuffer(jsonStr))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/v1/tokens/lookup", dc.url), bytes.NewBuffer(jsonStr))
 	if err != nil {
-		return nil, fmt.Errorf("error initializing http request: %w", err)
+		return TokenInfo{}, fmt.Errorf("error initializing http request: %w", err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", fmt.Sprintf("Api-Token %s", token))
 
-	resp, err := dc.httpClient.Do(req)
+	resp, err := dc.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making post request to dynatrace api: %w", err)
+		return TokenInfo{}, fmt.Errorf("error making post request to dynatrace api: %w", err)
 	}
 	defer resp.Body.Close()
 
 	data, err := dc.getServerResponseData(resp)
 	if err != nil {
-		return nil, err
+		return TokenInfo{}, err
 	}
 
-	return dc.readResponseForTokenScopes(data)
+	return dc.readResponseForTokenInfo(data)
 }
 
-func (dc *dynatraceClient) readResponseForTokenScopes(response []byte) (TokenScopes, error) {
+func (dc *dynatraceClient) readResponseForTokenInfo(response []byte) (TokenInfo, error) {
 	var jr struct {
-		Scopes []string `json:"scopes"`
+		ID      string         `json:"id"`
+		Name    string         `json:"name"`
+		UserID  string         `json:"userId"`
+		Owner   string         `json:"owner"`
+		Created tokenTimestamp `json:"created"`
+		Expires tokenTimestamp `json:"expires"`
+		LastUse tokenTimestamp `json:"lastUse"`
+		Scopes  []string       `json:"scopes"`
 	}
 
 	if err := json.Unmarshal(response, &jr); err != nil {
-		return nil, fmt.Errorf("error unmarshalling json response: %w", err)
+		return TokenInfo{}, fmt.Errorf("error unmarshalling json response: %w", err)
+	}
+
+	return TokenInfo{
+		ID:      jr.ID,
+		Name:    jr.Name,
+		UserID:  jr.UserID,
+		Owner:   jr.Owner,
+		Created: time.Time(jr.Created),
+		Expires: time.Time(jr.Expires),
+		LastUse: time.Time(jr.LastUse),
+		Scopes:  jr.Scopes,
+	}, nil
+}
+
+// tokenTimestamp parses the timestamps on token metadata, given either as milliseconds since the epoch or as RFC 3339
+// strings depending on the cluster version.
+type tokenTimestamp time.Time
+
+func (t *tokenTimestamp) UnmarshalJSON(data []byte) error {
+	var millis int64
+	if err := json.Unmarshal(data, &millis); err == nil {
+		if millis > 0 {
+			*t = tokenTimestamp(fromMillis(millis))
+		}
+		return nil
+	}
+
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid timestamp: %s", data)
+	}
+	if s == nil || *s == "" {
+		return nil
 	}
 
-	return jr.Scopes, nil
+	parsed, err := time.Parse(time.RFC3339, *s)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	*t = tokenTimestamp(parsed.UTC())
+	return nil
 }
@@ -1,28 +1,57 @@
 package dtclient
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func testGetTokenScopes(t *testing.T, dynatraceClient Client) {
 	{
-		scopes, err := dynatraceClient.GetTokenScopes("good-token")
+		scopes, err := dynatraceClient.GetTokenScopes(context.TODO(), "good-token")
 		assert.NoError(t, err)
 		assert.ElementsMatch(t, []string{"DataExport", "LogExport"}, scopes)
 	}
 	{
-		scopes, err := dynatraceClient.GetTokenScopes("bad-token")
+		scopes, err := dynatraceClient.GetTokenScopes(context.TODO(), "bad-token")
 		assert.Nil(t, scopes)
 		assert.Error(t, err)
 		assert.Exactly(t, ServerError{Code: 401, Message: "error received from server"}, err)
 	}
 }
 
+func testGetTokenInfo(t *testing.T, dynatraceClient Client) {
+	{
+		info, err := dynatraceClient.GetTokenInfo(context.TODO(), "good-token")
+		assert.NoError(t, err)
+		assert.Equal(t, TokenInfo{
+			ID:      "f7060574-e8cf-4bc2-a9e0-307517ca9957",
+			Name:    "the-token",
+			UserID:  "the-user",
+			Owner:   "owner@example.com",
+			Created: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			Expires: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			Scopes:  TokenScopes{"DataExport", "LogExport"},
+		}, info)
+	}
+	{
+		info, err := dynatraceClient.GetTokenInfo(context.TODO(), "iso-token")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC), info.Created)
+		assert.True(t, info.Expires.IsZero())
+		assert.Equal(t, TokenScopes{"InstallerDownload"}, info.Scopes)
+	}
+	{
+		_, err := dynatraceClient.GetTokenInfo(context.TODO(), "bad-token")
+		assert.Exactly(t, ServerError{Code: 401, Message: "error received from server"}, err)
+	}
+}
+
 func handleTokenScopes(request *http.Request, writer http.ResponseWriter) {
 	var model struct {
 		Token string `json:"token"`
@@ -44,11 +73,22 @@ func handleTokenScopes(request *http.Request, writer http.ResponseWriter) {
 			"id": "f7060574-e8cf-4bc2-a9e0-307517ca9957",
 			"name": "the-token",
 			"userId": "the-user",
+			"owner": "owner@example.com",
+			"created": 1609459200000,
+			"expires": 1640995200000,
 			"scopes": [
 				"DataExport",
 				"LogExport"
 			]
 		}`))
+	case "iso-token":
+		writer.WriteHeader(http.StatusOK)
+		writer.Write([]byte(`{
+			"id": "00000000-0000-0000-0000-000000000000",
+			"created": "2021-06-01T12:00:00Z",
+			"expires": null,
+			"scopes": ["InstallerDownload"]
+		}`))
 	default:
 		writeError(writer, http.StatusUnauthorized)
 	}
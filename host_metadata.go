@@ -0,0 +1,38 @@
+/*
+Copyright 2020 Dynatrace LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	"github.com/Dynatrace/dynatrace-oneagent-operator/hostmetadata"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var hostMetadataOptions hostmetadata.Options
+
+// runHostMetadata runs the init step of OneAgent pods which renders host metadata for their node.
+func runHostMetadata(cfg *rest.Config) error {
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	log.Info("rendering host metadata", "node", hostMetadataOptions.NodeName)
+	return hostmetadata.Run(context.TODO(), c, hostMetadataOptions)
+}
@@ -0,0 +1,170 @@
+// Package hostmetadata renders host tags and properties for OneAgent from the Kubernetes node it runs on. Since a
+// DaemonSet template is the same for all nodes, this runs as an init step on every OneAgent pod, which writes the
+// rendered values into the OneAgent configuration on the host.
+package hostmetadata
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Subcommand is the operator subcommand running the init step.
+	Subcommand = "host-metadata"
+
+	// ConfigDir is the directory with the OneAgent configuration, relative to the host root.
+	ConfigDir = "/var/lib/dynatrace/oneagent/agent/config"
+
+	tagsFile       = "hostautotag.conf"
+	propertiesFile = "hostcustomproperties.conf"
+)
+
+// Node is the data about the node available on templates, e.g., "{{ .Node.Labels.zone }}".
+type Node struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+type templateData struct {
+	Node Node
+}
+
+// IsTemplate returns true if the value needs to be rendered for each node.
+func IsTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// ParseTemplate parses the value as a template on the node.
+func ParseTemplate(value string) (*template.Template, error) {
+	return template.New("").Option("missingkey=zero").Parse(value)
+}
+
+// Render renders the template for the node.
+func Render(value string, node *corev1.Node) (string, error) {
+	tmpl, err := ParseTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{Node: Node{
+		Name:        node.Name,
+		Labels:      node.Labels,
+		Annotations: node.Annotations,
+	}}); err != nil {
+		return "", err
+	}
+
+	// The configuration files separate entries by spaces.
+	return strings.Join(strings.Fields(buf.String()), "_"), nil
+}
+
+// Options defines the host metadata to render on a node.
+type Options struct {
+	// NodeName is the node to render the templates on.
+	NodeName string
+
+	// Tags and Properties contain templates as "<key>=<value>".
+	Tags       []string
+	Properties []string
+
+	// HostRoot is where the root of the host filesystem is mounted.
+	HostRoot string
+}
+
+// Run renders the host tags and properties for the node, and writes them into the OneAgent configuration.
+func Run(ctx context.Context, c client.Reader, opts Options) error {
+	var node corev1.Node
+	if err := c.Get(ctx, client.ObjectKey{Name: opts.NodeName}, &node); err != nil {
+		return fmt.Errorf("failed to query node: %w", err)
+	}
+
+	tags, err := renderAll(opts.Tags, &node)
+	if err != nil {
+		return fmt.Errorf("failed to render host tags: %w", err)
+	}
+
+	props, err := renderAll(opts.Properties, &node)
+	if err != nil {
+		return fmt.Errorf("failed to render host properties: %w", err)
+	}
+
+	dir := filepath.Join(opts.HostRoot, ConfigDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := writeConfig(filepath.Join(dir, tagsFile), tags); err != nil {
+		return err
+	}
+	return writeConfig(filepath.Join(dir, propertiesFile), props)
+}
+
+// renderAll renders the values of "<key>=<value>" pairs, skipping those which render to an empty value.
+func renderAll(pairs []string, node *corev1.Node) (map[string]string, error) {
+	out := map[string]string{}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid key-value pair '%s'", pair)
+		}
+
+		v, err := Render(kv[1], node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for '%s': %w", kv[0], err)
+		}
+		if v != "" {
+			out[kv[0]] = v
+		}
+	}
+	return out, nil
+}
+
+// writeConfig merges the entries into the configuration file, replacing those with the same keys.
+func writeConfig(path string, entries map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	merged := map[string]string{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, field := range strings.Fields(string(data)) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 {
+			merged[kv[0]] = kv[1]
+		} else {
+			merged[kv[0]] = ""
+		}
+	}
+
+	for k, v := range entries {
+		merged[k] = v
+	}
+
+	fields := make([]string, 0, len(merged))
+	for k, v := range merged {
+		if v == "" {
+			fields = append(fields, k)
+		} else {
+			fields = append(fields, k+"="+v)
+		}
+	}
+	sort.Strings(fields)
+
+	return ioutil.WriteFile(path, []byte(strings.Join(fields, " ")+"\n"), 0644)
+}
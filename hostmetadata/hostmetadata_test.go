@@ -0,0 +1,73 @@
+package hostmetadata
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var sampleNode = &corev1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "node1",
+		Labels: map[string]string{
+			"zone":                             "eu-west-1a",
+			"node.kubernetes.io/instance-type": "m5.large",
+		},
+		Annotations: map[string]string{"owner": "team a"},
+	},
+}
+
+func TestRender(t *testing.T) {
+	render := func(tmpl string) string {
+		v, err := Render(tmpl, sampleNode)
+		require.NoError(t, err)
+		return v
+	}
+
+	assert.Equal(t, "eu-west-1a", render("{{ .Node.Labels.zone }}"))
+	assert.Equal(t, "m5.large", render(`{{ index .Node.Labels "node.kubernetes.io/instance-type" }}`))
+	assert.Equal(t, "node1-eu-west-1a", render("{{ .Node.Name }}-{{ .Node.Labels.zone }}"))
+	assert.Equal(t, "team_a", render("{{ .Node.Annotations.owner }}"))
+	assert.Equal(t, "", render("{{ .Node.Labels.missing }}"))
+
+	_, err := Render("{{ .Node.Labels.zone", sampleNode)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	root, err := ioutil.TempDir("", "hostmetadata")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, ConfigDir)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, tagsFile), []byte("manual zone=unknown\n"), 0644))
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(sampleNode).Build()
+	require.NoError(t, Run(context.TODO(), c, Options{
+		NodeName:   "node1",
+		Tags:       []string{"zone={{ .Node.Labels.zone }}", "empty={{ .Node.Labels.missing }}"},
+		Properties: []string{"InstanceType={{ index .Node.Labels \"node.kubernetes.io/instance-type\" }}"},
+		HostRoot:   root,
+	}))
+
+	tags, err := ioutil.ReadFile(filepath.Join(dir, tagsFile))
+	require.NoError(t, err)
+	assert.Equal(t, "manual zone=eu-west-1a\n", string(tags))
+
+	props, err := ioutil.ReadFile(filepath.Join(dir, propertiesFile))
+	require.NoError(t, err)
+	assert.Equal(t, "InstanceType=m5.large\n", string(props))
+
+	assert.Error(t, Run(context.TODO(), c, Options{NodeName: "node2", HostRoot: root}))
+	assert.Error(t, Run(context.TODO(), c, Options{NodeName: "node1", Tags: []string{"invalid"}, HostRoot: root}))
+}
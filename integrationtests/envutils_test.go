@@ -18,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -153,7 +154,7 @@ func newTestEnvironment() (*ControllerTestEnvironment, error) {
 		CommunicationHosts: communicationHosts,
 	}
 	environment.Reconciler = oneagent.NewOneAgentReconciler(kubernetesClient, kubernetesClient, scheme.Scheme, cfg,
-		zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)), mockDynatraceClientFunc(&environment.CommunicationHosts))
+		zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout)), &record.FakeRecorder{}, mockDynatraceClientFunc(&environment.CommunicationHosts))
 
 	return environment, nil
 }
@@ -182,7 +183,7 @@ func newReconciliationRequest(oaName string) reconcile.Request {
 }
 
 func mockDynatraceClientFunc(communicationHosts *[]string) utils.DynatraceClientFunc {
-	return func(client client.Client, oa dynatracev1alpha1.BaseOneAgent, _, _ bool) (dtclient.Client, error) {
+	return func(_ context.Context, client client.Client, oa dynatracev1alpha1.BaseOneAgent, _ utils.Tokens, _, _ bool) (dtclient.Client, error) {
 		commHosts := make([]dtclient.CommunicationHost, len(*communicationHosts))
 		for i, c := range *communicationHosts {
 			commHosts[i] = dtclient.CommunicationHost{Protocol: "https", Host: c, Port: 443}
@@ -201,8 +202,8 @@ func mockDynatraceClientFunc(communicationHosts *[]string) utils.DynatraceClient
 			Host:     DefaultTestAPIURL,
 			Port:     443,
 		}, nil)
-		dtc.On("GetTokenScopes", "42").Return(dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}, nil)
-		dtc.On("GetTokenScopes", "43").Return(dtclient.TokenScopes{dtclient.TokenScopeDataExport}, nil)
+		dtc.On("GetTokenInfo", "42").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeInstallerDownload}}, nil)
+		dtc.On("GetTokenInfo", "43").Return(dtclient.TokenInfo{Scopes: dtclient.TokenScopes{dtclient.TokenScopeDataExport}}, nil)
 
 		return dtc, nil
 	}
@@ -23,10 +23,13 @@ import (
 	"runtime"
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	dynatracev1beta1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1beta1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/hostmetadata"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/logger"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/version"
 	"github.com/spf13/pflag"
 	istiov1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -48,7 +51,7 @@ var subcmdCallbacks = map[string]func(ns string, cfg *rest.Config) (manager.Mana
 	"webhook-server":       startWebhookServer,
 }
 
-var errBadSubcmd = errors.New("subcommand must be operator, webhook-bootstrapper, or webhook-server")
+var errBadSubcmd = errors.New("subcommand must be operator, webhook-bootstrapper, webhook-server, or host-metadata")
 
 var (
 	certsDir string
@@ -60,7 +63,9 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(dynatracev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(dynatracev1beta1.AddToScheme(scheme))
 	utilruntime.Must(istiov1alpha3.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -70,7 +75,14 @@ func main() {
 	webhookServerFlags.StringVar(&certFile, "cert", "tls.crt", "File name for the public certificate.")
 	webhookServerFlags.StringVar(&keyFile, "cert-key", "tls.key", "File name for the private key.")
 
+	hostMetadataFlags := pflag.NewFlagSet(hostmetadata.Subcommand, pflag.ExitOnError)
+	hostMetadataFlags.StringVar(&hostMetadataOptions.NodeName, "node", "", "Node to render the host metadata for.")
+	hostMetadataFlags.StringArrayVar(&hostMetadataOptions.Tags, "host-tag", nil, "Host tag template, as <key>=<template>.")
+	hostMetadataFlags.StringArrayVar(&hostMetadataOptions.Properties, "host-property", nil, "Host property template, as <key>=<template>.")
+	hostMetadataFlags.StringVar(&hostMetadataOptions.HostRoot, "host-root", "/mnt/root", "Directory where the host root is mounted.")
+
 	pflag.CommandLine.AddFlagSet(webhookServerFlags)
+	pflag.CommandLine.AddFlagSet(hostMetadataFlags)
 	pflag.Parse()
 
 	ctrl.SetLogger(logger.NewDTLogger())
@@ -83,7 +95,7 @@ func main() {
 	}
 
 	subcmdFn := subcmdCallbacks[subcmd]
-	if subcmdFn == nil {
+	if subcmdFn == nil && subcmd != hostmetadata.Subcommand {
 		log.Error(errBadSubcmd, "Unknown subcommand", "command", subcmd)
 		os.Exit(1)
 	}
@@ -96,6 +108,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The host metadata init step runs once, instead of starting a manager.
+	if subcmd == hostmetadata.Subcommand {
+		if err := runHostMetadata(cfg); err != nil {
+			log.Error(err, "failed to render host metadata")
+			os.Exit(1)
+		}
+		return
+	}
+
 	mgr, err := subcmdFn(namespace, cfg)
 	if err != nil {
 		log.Error(err, "")
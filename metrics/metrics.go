@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "dynatrace_oneagent_operator"
+
+var (
+	// DynatraceRequests counts the requests to the Dynatrace API, including each retry, by endpoint and status code.
+	// The status code is "error" if no response was received.
+	DynatraceRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dynatrace_api_requests_total",
+		Help:      "Number of requests to the Dynatrace API by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	// DynatraceRequestDuration observes the latency of the requests to the Dynatrace API, by endpoint and status code.
+	DynatraceRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dynatrace_api_request_duration_seconds",
+		Help:      "Latency of requests to the Dynatrace API by endpoint and status code.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint", "code"})
+
+	// TokenProbes counts the probes of the tokens of OneAgent and OneAgentAPM objects, by the reason of the resulting
+	// token condition.
+	TokenProbes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_probes_total",
+		Help:      "Number of token probes against the Dynatrace API by object, token and result.",
+	}, []string{"namespace", "name", "token", "result"})
+
+	// PodRestarts counts the OneAgent pods deleted by the Operator to update them to the desired version.
+	PodRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pod_restarts_total",
+		Help:      "Number of OneAgent pods restarted for updates by object.",
+	}, []string{"namespace", "name"})
+
+	// AgentVersions is set to 1 for the desired and actual agent versions on each node of a OneAgent object.
+	AgentVersions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "agent_version_info",
+		Help:      "Desired and actual OneAgent versions by object and node.",
+	}, []string{"namespace", "name", "node", "desired_version", "actual_version"})
+
+	// WebhookInjections counts the pods handled by the webhook server, by namespace and outcome, i.e., "injected",
+	// "skipped", or "error".
+	WebhookInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_injections_total",
+		Help:      "Number of pods handled by the webhook server by namespace and outcome.",
+	}, []string{"namespace", "outcome"})
+
+	// CertificateExpiry is the expiration time of the webhook certificates, by certificate, i.e., "root" or "server".
+	CertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "webhook_certificate_expiry_timestamp_seconds",
+		Help:      "Expiration time of the webhook certificates as Unix timestamp.",
+	}, []string{"certificate"})
+
+	// TokenExpiry is the expiration time of the tokens of OneAgent and OneAgentAPM objects which expire, by token.
+	TokenExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "token_expiry_timestamp_seconds",
+		Help:      "Expiration time of the tokens by object and token as Unix timestamp.",
+	}, []string{"namespace", "name", "token"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		DynatraceRequests,
+		DynatraceRequestDuration,
+		TokenProbes,
+		PodRestarts,
+		AgentVersions,
+		WebhookInjections,
+		CertificateExpiry,
+		TokenExpiry,
+	)
+}
+
+// ObserveDynatraceRequest records a request to the given endpoint of the Dynatrace API, with a status code of zero if
+// no response was received.
+func ObserveDynatraceRequest(endpoint string, statusCode int, duration time.Duration) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	DynatraceRequests.WithLabelValues(endpoint, code).Inc()
+	DynatraceRequestDuration.WithLabelValues(endpoint, code).Observe(duration.Seconds())
+}
+
+// NodeVersion has the desired and actual agent versions for a node.
+type NodeVersion struct {
+	Desired string
+	Actual  string
+}
+
+var (
+	agentVersionsLock   sync.Mutex
+	agentVersionsLabels = map[string][]prometheus.Labels{}
+)
+
+// SetAgentVersions replaces the agent versions for the nodes of the given OneAgent object. The versions are removed if
+// nodes is empty.
+func SetAgentVersions(ns, name string, nodes map[string]NodeVersion) {
+	agentVersionsLock.Lock()
+	defer agentVersionsLock.Unlock()
+
+	// The versions are labels, so the old series are removed to not keep reporting them.
+	key := ns + "/" + name
+	for _, labels := range agentVersionsLabels[key] {
+		AgentVersions.Delete(labels)
+	}
+	delete(agentVersionsLabels, key)
+
+	for node, v := range nodes {
+		labels := prometheus.Labels{
+			"namespace":       ns,
+			"name":            name,
+			"node":            node,
+			"desired_version": v.Desired,
+			"actual_version":  v.Actual,
+		}
+		AgentVersions.With(labels).Set(1)
+		agentVersionsLabels[key] = append(agentVersionsLabels[key], labels)
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveDynatraceRequest(t *testing.T) {
+	ObserveDynatraceRequest("/v1/tokens/lookup", 200, time.Second)
+	ObserveDynatraceRequest("/v1/tokens/lookup", 200, time.Second)
+	ObserveDynatraceRequest("/v1/tokens/lookup", 0, time.Second)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(DynatraceRequests.WithLabelValues("/v1/tokens/lookup", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(DynatraceRequests.WithLabelValues("/v1/tokens/lookup", "error")))
+}
+
+func TestSetAgentVersions(t *testing.T) {
+	SetAgentVersions("dynatrace", "oneagent", map[string]NodeVersion{
+		"node1": {Desired: "1.203.0", Actual: "1.202.0"},
+		"node2": {Desired: "1.203.0", Actual: "1.203.0"},
+	})
+	assert.Equal(t, 2, testutil.CollectAndCount(AgentVersions))
+
+	// Series for previous versions are replaced.
+	SetAgentVersions("dynatrace", "oneagent", map[string]NodeVersion{
+		"node1": {Desired: "1.203.0", Actual: "1.203.0"},
+	})
+	assert.Equal(t, 1, testutil.CollectAndCount(AgentVersions))
+	assert.Equal(t, 1.0, testutil.ToFloat64(AgentVersions.WithLabelValues("dynatrace", "oneagent", "node1", "1.203.0", "1.203.0")))
+
+	SetAgentVersions("dynatrace", "oneagent", nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(AgentVersions))
+}
@@ -115,6 +115,21 @@ func (cs *Certs) validateServerCerts(now time.Time) bool {
 	return false
 }
 
+// certExpiry returns the expiration time of the PEM encoded certificate, or false if it can't be parsed.
+func certExpiry(data []byte) (time.Time, bool) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return cert.NotAfter, true
+}
+
 func (cs *Certs) generateRootCerts(domain string, now time.Time) error {
 	var err error
 
@@ -10,14 +10,20 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/webhook"
 	"github.com/go-logr/logr"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -35,6 +41,17 @@ const (
 	certsDir    = "/mnt/webhook-certs"
 )
 
+// Reasons of the events recorded on the certificates secret and webhook configurations.
+const (
+	eventCertificatesCreated  = "CertificatesCreated"
+	eventCertificatesRenewed  = "CertificatesRenewed"
+	eventWebhookConfigCreated = "WebhookConfigurationCreated"
+	eventWebhookConfigUpdated = "WebhookConfigurationUpdated"
+)
+
+// convertedCRDs are the CRDs served on more than one version, which get converted by the webhook.
+var convertedCRDs = []string{"oneagents.dynatrace.com", "oneagentapms.dynatrace.com"}
+
 // AddToManager creates a new OneAgent Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func AddToManager(mgr manager.Manager, ns string) error {
@@ -44,6 +61,7 @@ func AddToManager(mgr manager.Manager, ns string) error {
 		scheme:    mgr.GetScheme(),
 		namespace: ns,
 		logger:    log.Log.WithName("webhook.controller"),
+		recorder:  mgr.GetEventRecorderFor("dynatrace-oneagent-webhook"),
 		certsDir:  certsDir,
 	})
 }
@@ -98,6 +116,7 @@ type ReconcileWebhook struct {
 	client    client.Client
 	scheme    *runtime.Scheme
 	logger    logr.Logger
+	recorder  record.EventRecorder
 	namespace string
 	certsDir  string
 	now       time.Time
@@ -124,6 +143,16 @@ func (r *ReconcileWebhook) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, fmt.Errorf("failed to reconcile webhook configuration: %w", err)
 	}
 
+	if err := r.reconcileValidatingWebhookConfig(ctx, r.logger, rootCerts); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to reconcile validating webhook configuration: %w", err)
+	}
+
+	for _, crd := range convertedCRDs {
+		if err := r.reconcileCRDConversion(ctx, r.logger, crd, rootCerts); err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to reconcile conversion for %s: %w", crd, err)
+		}
+	}
+
 	return reconcile.Result{}, nil
 }
 
@@ -154,10 +183,10 @@ func (r *ReconcileWebhook) reconcileService(ctx context.Context, log logr.Logger
 
 	var svc corev1.Service
 
-	err := r.client.Get(context.TODO(), client.ObjectKey{Name: webhookName, Namespace: r.namespace}, &svc)
+	err := r.client.Get(ctx, client.ObjectKey{Name: webhookName, Namespace: r.namespace}, &svc)
 	if k8serrors.IsNotFound(err) {
 		log.Info("Service doesn't exist, creating...")
-		if err = r.client.Create(ctx, &expected); err != nil {
+		if err = utils.Apply(ctx, r.client, &expected, utils.WebhookFieldManager, log); err != nil {
 			return err
 		}
 		return nil
@@ -190,20 +219,34 @@ func (r *ReconcileWebhook) reconcileCerts(ctx context.Context, log logr.Logger)
 		return nil, err
 	}
 
-	if newSecret {
-		log.Info("Creating certificates secret...")
-		err = r.client.Create(ctx, &corev1.Secret{
+	for name, key := range map[string]string{"root": "ca.crt", "server": "tls.crt"} {
+		if expiry, ok := certExpiry(cs.Data[key]); ok {
+			metrics.CertificateExpiry.WithLabelValues(name).Set(float64(expiry.Unix()))
+		}
+	}
+
+	expiry, _ := certExpiry(cs.Data["tls.crt"])
+
+	if newSecret || !reflect.DeepEqual(cs.Data, secret.Data) {
+		if newSecret {
+			log.Info("Creating certificates secret...")
+		} else {
+			log.Info("Updating certificates secret...")
+		}
+
+		secret = corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{Name: webhook.SecretCertsName, Namespace: r.namespace},
 			Data:       cs.Data,
-		})
-	} else if !reflect.DeepEqual(cs.Data, secret.Data) {
-		log.Info("Updating certificates secret...")
-		secret.Data = cs.Data
-		err = r.client.Update(ctx, &secret)
-	}
+		}
+		if err := utils.Apply(ctx, r.client, &secret, utils.WebhookFieldManager, log); err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, err
+		if newSecret {
+			r.recorder.Eventf(&secret, corev1.EventTypeNormal, eventCertificatesCreated, "Created certificates valid until %s", expiry.Format(time.RFC3339))
+		} else {
+			r.recorder.Eventf(&secret, corev1.EventTypeNormal, eventCertificatesRenewed, "Renewed certificates valid until %s", expiry.Format(time.RFC3339))
+		}
 	}
 
 	for _, key := range []string{"tls.crt", "tls.key"} {
@@ -269,13 +312,14 @@ func (r *ReconcileWebhook) reconcileWebhookConfig(ctx context.Context, log logr.
 	}
 
 	var cfg admissionregistrationv1.MutatingWebhookConfiguration
-	err := r.client.Get(context.TODO(), client.ObjectKey{Name: webhookName}, &cfg)
+	err := r.client.Get(ctx, client.ObjectKey{Name: webhookName}, &cfg)
 	if k8serrors.IsNotFound(err) {
 		log.Info("MutatingWebhookConfiguration doesn't exist, creating...")
 
-		if err = r.client.Create(ctx, webhookConfiguration); err != nil {
+		if err = utils.Apply(ctx, r.client, webhookConfiguration, utils.WebhookFieldManager, log); err != nil {
 			return err
 		}
+		r.recorder.Event(webhookConfiguration, corev1.EventTypeNormal, eventWebhookConfigCreated, "Created webhook configuration")
 		return nil
 	}
 
@@ -288,6 +332,134 @@ func (r *ReconcileWebhook) reconcileWebhookConfig(ctx context.Context, log logr.
 	}
 
 	log.Info("MutatingWebhookConfiguration is outdated, updating...")
-	cfg.Webhooks = webhookConfiguration.Webhooks
-	return r.client.Update(ctx, &cfg)
+	if err := utils.Apply(ctx, r.client, webhookConfiguration, utils.WebhookFieldManager, log); err != nil {
+		return err
+	}
+	r.recorder.Event(webhookConfiguration, corev1.EventTypeNormal, eventWebhookConfigUpdated, "Updated webhook configuration with the current certificates")
+	return nil
+}
+
+func (r *ReconcileWebhook) reconcileValidatingWebhookConfig(ctx context.Context, log logr.Logger, rootCerts []byte) error {
+	log.Info("Reconciling ValidatingWebhookConfiguration...")
+
+	scope := admissionregistrationv1.NamespacedScope
+	path := "/validate"
+	sideEffect := admissionregistrationv1.SideEffectClassNone
+
+	// The objects get validated on reconciliation too, so these can still be edited when the webhook is unavailable,
+	// e.g., to remove them after the Operator has been uninstalled.
+	failurePolicy := admissionregistrationv1.Ignore
+
+	webhookConfiguration := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: webhookName,
+			Labels: map[string]string{
+				"dynatrace.com/operator":                    "oneagent",
+				"internal.oneagent.dynatrace.com/component": "webhook",
+			},
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name:                    "validation.oneagent.dynatrace.com",
+			AdmissionReviewVersions: []string{"v1beta1"},
+			Rules: []admissionregistrationv1.RuleWithOperations{{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{"dynatrace.com"},
+					APIVersions: []string{"v1alpha1"},
+					Resources:   []string{"oneagents", "oneagentapms"},
+					Scope:       &scope,
+				},
+			}},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      webhookName,
+					Namespace: r.namespace,
+					Path:      &path,
+				},
+				CABundle: rootCerts,
+			},
+			FailurePolicy: &failurePolicy,
+			SideEffects:   &sideEffect,
+		}},
+	}
+
+	var cfg admissionregistrationv1.ValidatingWebhookConfiguration
+	err := r.client.Get(ctx, client.ObjectKey{Name: webhookName}, &cfg)
+	if k8serrors.IsNotFound(err) {
+		log.Info("ValidatingWebhookConfiguration doesn't exist, creating...")
+		if err = utils.Apply(ctx, r.client, webhookConfiguration, utils.WebhookFieldManager, log); err != nil {
+			return err
+		}
+		r.recorder.Event(webhookConfiguration, corev1.EventTypeNormal, eventWebhookConfigCreated, "Created webhook configuration")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Webhooks) == 1 && bytes.Equal(cfg.Webhooks[0].ClientConfig.CABundle, rootCerts) &&
+		reflect.DeepEqual(cfg.Webhooks[0].Rules, webhookConfiguration.Webhooks[0].Rules) {
+		return nil
+	}
+
+	log.Info("ValidatingWebhookConfiguration is outdated, updating...")
+	if err := utils.Apply(ctx, r.client, webhookConfiguration, utils.WebhookFieldManager, log); err != nil {
+		return err
+	}
+	r.recorder.Event(webhookConfiguration, corev1.EventTypeNormal, eventWebhookConfigUpdated, "Updated webhook configuration with the current certificates")
+	return nil
+}
+
+func (r *ReconcileWebhook) reconcileCRDConversion(ctx context.Context, log logr.Logger, name string, rootCerts []byte) error {
+	log.Info("Reconciling CustomResourceDefinition conversion...", "name", name)
+
+	path := "/convert"
+	expected := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Name:      webhookName,
+					Namespace: r.namespace,
+					Path:      &path,
+				},
+				CABundle: rootCerts,
+			},
+			ConversionReviewVersions: []string{"v1beta1"},
+		},
+	}
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	err := r.client.Get(ctx, client.ObjectKey{Name: name}, &crd)
+	if k8serrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// E.g., on OpenShift 3.11, where CRDs are only served on v1alpha1 and can't be converted.
+		log.Info("CustomResourceDefinition isn't available for conversion, skipping...", "name", name)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(crd.Spec.Conversion, expected) {
+		return nil
+	}
+
+	log.Info("CustomResourceDefinition conversion is outdated, updating...", "name", name)
+
+	// Only the conversion is applied, the rest of the CRD is owned by whoever installed it.
+	conversion, err := runtime.DefaultUnstructuredConverter.ToUnstructured(expected)
+	if err != nil {
+		return err
+	}
+
+	var cfg unstructured.Unstructured
+	cfg.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	cfg.SetName(name)
+	if err := unstructured.SetNestedMap(cfg.Object, conversion, "spec", "conversion"); err != nil {
+		return err
+	}
+
+	return utils.Apply(ctx, r.client, &cfg, utils.WebhookFieldManager, log)
 }
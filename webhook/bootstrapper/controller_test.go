@@ -7,18 +7,27 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+func init() {
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme.Scheme))
+}
+
 func TestReconcileWebhook(t *testing.T) {
 	logger := zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stdout))
 	ns := "dynatrace"
@@ -30,8 +39,19 @@ func TestReconcileWebhook(t *testing.T) {
 	now, err := time.Parse(time.RFC3339, "2018-01-10T00:00:00Z")
 	require.NoError(t, err)
 
-	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
-	r := ReconcileWebhook{client: c, logger: logger, namespace: ns, scheme: scheme.Scheme, certsDir: tmpDir}
+	// The OneAgentAPM CRD is missing, which is to be skipped.
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "oneagents.dynatrace.com"},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: "dynatrace.com",
+				Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "oneagents", Kind: "OneAgent"},
+				Scope: apiextensionsv1.NamespaceScoped,
+			},
+		},
+	).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := ReconcileWebhook{client: utils.FakeApplyClient{Client: c}, logger: logger, namespace: ns, scheme: scheme.Scheme, certsDir: tmpDir, recorder: recorder}
 
 	reconcileAndGetCreds := func(days time.Duration) map[string]string {
 		r.now = now.Add(days * 24 * time.Hour)
@@ -51,6 +71,20 @@ func TestReconcileWebhook(t *testing.T) {
 	getWebhookCA := func() string {
 		var webhookCfg admissionregistrationv1.MutatingWebhookConfiguration
 		require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: webhook.ServiceName}, &webhookCfg))
+
+		var validatingCfg admissionregistrationv1.ValidatingWebhookConfiguration
+		require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: webhook.ServiceName}, &validatingCfg))
+		assert.Equal(t, webhookCfg.Webhooks[0].ClientConfig.CABundle, validatingCfg.Webhooks[0].ClientConfig.CABundle)
+
+		var crd apiextensionsv1.CustomResourceDefinition
+		require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Name: "oneagents.dynatrace.com"}, &crd))
+		assert.Equal(t, "dynatrace.com", crd.Spec.Group)
+		assert.Equal(t, "OneAgent", crd.Spec.Names.Kind)
+		require.NotNil(t, crd.Spec.Conversion)
+		assert.Equal(t, apiextensionsv1.WebhookConverter, crd.Spec.Conversion.Strategy)
+		assert.Equal(t, "/convert", *crd.Spec.Conversion.Webhook.ClientConfig.Service.Path)
+		assert.Equal(t, webhookCfg.Webhooks[0].ClientConfig.CABundle, crd.Spec.Conversion.Webhook.ClientConfig.CABundle)
+
 		return string(webhookCfg.Webhooks[0].ClientConfig.CABundle)
 	}
 
@@ -66,12 +100,14 @@ func TestReconcileWebhook(t *testing.T) {
 	assert.NotEmpty(t, secret0["ca.crt"])
 	assert.NotEmpty(t, secret0["ca.key"])
 	assert.Equal(t, secret0["ca.crt"], getWebhookCA())
+	assert.Contains(t, drainEvents(recorder), "Normal CertificatesCreated Created certificates valid until 2018-01-17T00:00:00Z")
 
 	// Day 1: Certificates are valid, no changes.
 
 	secret1 := reconcileAndGetCreds(1)
 	assert.Equal(t, secret0, secret1)
 	assert.Equal(t, secret1["ca.crt"], getWebhookCA())
+	assert.Empty(t, drainEvents(recorder))
 
 	// Day 8: TLS certificates have expired and need to be renewed.
 
@@ -81,6 +117,7 @@ func TestReconcileWebhook(t *testing.T) {
 	assert.Equal(t, secret1["ca.crt"], secret8["ca.crt"])
 	assert.Equal(t, secret1["ca.key"], secret8["ca.key"])
 	assert.Equal(t, secret8["ca.crt"], getWebhookCA())
+	assert.Contains(t, drainEvents(recorder), "Normal CertificatesRenewed Renewed certificates valid until 2018-01-25T00:00:00Z")
 
 	// Day 9: TLS certificates were renewed recently, no changes.
 
@@ -103,3 +140,15 @@ func TestReconcileWebhook(t *testing.T) {
 	assert.Equal(t, secret400, secret401)
 	assert.Equal(t, secret401["ca.crt"], getWebhookCA())
 }
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
 	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/utils"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/metrics"
 	dtwebhook "github.com/Dynatrace/dynatrace-oneagent-operator/webhook"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -20,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 )
 
 var logger = log.Log.WithName("oneagent.webhook")
@@ -44,6 +46,11 @@ func AddToManager(mgr manager.Manager, ns string) error {
 		image:     pod.Spec.Containers[0].Image,
 	}})
 
+	mgr.GetWebhookServer().Register("/validate", &webhook.Admission{Handler: &crValidator{}})
+
+	// Converts the OneAgent and OneAgentAPM objects between API versions, through v1alpha1.
+	mgr.GetWebhookServer().Register("/convert", &conversion.Webhook{})
+
 	mgr.GetWebhookServer().Register("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -61,6 +68,20 @@ type podInjector struct {
 
 // podAnnotator adds an annotation to every incoming pods
 func (m *podInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	resp := m.handle(ctx, req)
+
+	outcome := "injected"
+	if !resp.Allowed {
+		outcome = "error"
+	} else if len(resp.Patches) == 0 {
+		outcome = "skipped"
+	}
+	metrics.WebhookInjections.WithLabelValues(req.Namespace, outcome).Inc()
+
+	return resp
+}
+
+func (m *podInjector) handle(ctx context.Context, req admission.Request) admission.Response {
 	pod := &corev1.Pod{}
 
 	err := m.decoder.Decode(req, pod)
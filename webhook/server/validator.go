@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/oneagent"
+	"github.com/Dynatrace/dynatrace-oneagent-operator/controllers/oneagentapm"
+	admissionv1 "k8s.io/api/admission/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// crValidator rejects OneAgent and OneAgentAPM objects with invalid settings, so that these are reported on apply
+// instead of on reconciliation. Settings which earlier versions of the Operator accepted are only rejected for new
+// objects, and reported as warnings otherwise.
+type crValidator struct {
+	decoder *admission.Decoder
+}
+
+// Handle validates the incoming OneAgent or OneAgentAPM object
+func (v *crValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var errs, newErrs field.ErrorList
+
+	switch req.Kind.Kind {
+	case "OneAgent":
+		var oa dynatracev1alpha1.OneAgent
+		if err := v.decoder.Decode(req, &oa); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = oneagent.ValidateOneAgent(&oa)
+		newErrs = oneagent.ValidateNewOneAgent(&oa)
+	case "OneAgentAPM":
+		var apm dynatracev1alpha1.OneAgentAPM
+		if err := v.decoder.Decode(req, &apm); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = oneagentapm.ValidateOneAgentAPM(&apm)
+		newErrs = oneagentapm.ValidateNewOneAgentAPM(&apm)
+	default:
+		return admission.Allowed("")
+	}
+
+	var warnings []string
+	if req.Operation == admissionv1.Create {
+		errs = append(errs, newErrs...)
+	} else {
+		for _, err := range newErrs {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	if len(errs) == 0 {
+		return admission.Allowed("").WithWarnings(warnings...)
+	}
+
+	logger.Info("rejecting invalid object", "kind", req.Kind.Kind, "name", req.Name, "namespace", req.Namespace)
+
+	// The status includes each of the issues along with their field, same as for validation on built-in types.
+	status := k8serrors.NewInvalid(schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind}, req.Name, errs).ErrStatus
+	return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{Allowed: false, Result: &status}}
+}
+
+// InjectDecoder injects the decoder
+func (v *crValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
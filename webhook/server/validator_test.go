@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	dynatracev1alpha1 "github.com/Dynatrace/dynatrace-oneagent-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateOneAgent(t *testing.T) {
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	require.NoError(t, err)
+
+	v := &crValidator{decoder: decoder}
+
+	validate := func(op admissionv1.Operation, oa *dynatracev1alpha1.OneAgent) admission.Response {
+		raw, err := json.Marshal(oa)
+		require.NoError(t, err)
+
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "dynatrace.com", Version: "v1alpha1", Kind: "OneAgent"},
+				Operation: op,
+				Name:      oa.Name,
+				Namespace: oa.Namespace,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+		resp := v.Handle(context.TODO(), req)
+		require.NoError(t, resp.Complete(req))
+		return resp
+	}
+
+	oa := &dynatracev1alpha1.OneAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Spec: dynatracev1alpha1.OneAgentSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api"},
+		},
+	}
+	assert.True(t, validate(admissionv1.Create, oa).Allowed)
+
+	// Settings accepted by earlier versions are only rejected for new objects.
+	oa.Spec.Proxy = &dynatracev1alpha1.OneAgentProxy{Value: "http://proxy:80", ValueFrom: "proxy"}
+
+	resp := validate(admissionv1.Update, oa)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, []string{"spec.proxy.valueFrom: Forbidden: can't be set together with value"}, resp.Warnings)
+
+	oa.Spec.AgentVersion = "latest"
+
+	resp = validate(admissionv1.Update, oa)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, []string{
+		"spec.proxy.valueFrom: Forbidden: can't be set together with value",
+		"spec.agentVersion: Invalid value: \"latest\": invalid version 'latest': expected at least major and minor components",
+	}, resp.Warnings)
+
+	resp = validate(admissionv1.Create, oa)
+	require.False(t, resp.Allowed)
+	assert.Equal(t, metav1.StatusReasonInvalid, resp.Result.Reason)
+	assert.Equal(t, "OneAgent.dynatrace.com \"oneagent\" is invalid: "+
+		"[spec.proxy.valueFrom: Forbidden: can't be set together with value, "+
+		"spec.agentVersion: Invalid value: \"latest\": invalid version 'latest': expected at least major and minor components]",
+		resp.Result.Message)
+
+	if assert.NotNil(t, resp.Result.Details) {
+		var fields []string
+		for _, cause := range resp.Result.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		assert.Equal(t, []string{"spec.proxy.valueFrom", "spec.agentVersion"}, fields)
+	}
+}
+
+func TestValidateOneAgentAPM(t *testing.T) {
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	require.NoError(t, err)
+
+	apm := &dynatracev1alpha1.OneAgentAPM{
+		ObjectMeta: metav1.ObjectMeta{Name: "oneagent", Namespace: "dynatrace"},
+		Spec: dynatracev1alpha1.OneAgentAPMSpec{
+			BaseOneAgentSpec: dynatracev1alpha1.BaseOneAgentSpec{APIURL: "https://ENVIRONMENTID.live.dynatrace.com/api"},
+			Flavor:           "alpine",
+		},
+	}
+	raw, err := json.Marshal(apm)
+	require.NoError(t, err)
+
+	req := admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind:   metav1.GroupVersionKind{Group: "dynatrace.com", Version: "v1alpha1", Kind: "OneAgentAPM"},
+			Name:   apm.Name,
+			Object: runtime.RawExtension{Raw: raw},
+		},
+	}
+	resp := (&crValidator{decoder: decoder}).Handle(context.TODO(), req)
+	require.NoError(t, resp.Complete(req))
+	require.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Message, `spec.flavor: Unsupported value: "alpine"`)
+}